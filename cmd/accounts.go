@@ -0,0 +1,249 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/spf13/cobra"
+	"github.com/taemon1337/ec-manager/pkg/ami"
+	"github.com/taemon1337/ec-manager/pkg/client"
+	"github.com/taemon1337/ec-manager/pkg/config"
+	"github.com/taemon1337/ec-manager/pkg/logger"
+	"github.com/taemon1337/ec-manager/pkg/types"
+)
+
+var (
+	// assumeRoles is the role chain assumed for the whole command, set with
+	// --assume-role or the context's assume-role
+	assumeRoles []string
+	externalID  string
+	mfaSerialID string
+	mfaCode     string
+
+	// accountNames selects the configured accounts a command runs in
+	accountNames []string
+	// accountTargets are the selected accounts with their clients
+	accountTargets []accountTarget
+)
+
+// runsInAccounts annotates the commands that run in every account selected
+// with --accounts, through forEachAccount or forEachRegion. Other commands
+// reject --accounts rather than silently running in the current account.
+const runsInAccounts = "ec-manager:accounts"
+
+// checkAccountsFlag rejects --accounts for commands that do not run in the
+// selected accounts
+func checkAccountsFlag(cmd *cobra.Command) error {
+	if len(accountNames) > 0 && cmd.Annotations[runsInAccounts] == "" {
+		return fmt.Errorf("%s does not support --accounts", cmd.CommandPath())
+	}
+	return nil
+}
+
+// accountTarget is an account and region a command runs in. The zero value
+// stands for the current credentials and region when no accounts or regions
+// are selected.
+type accountTarget struct {
+	config.Account
+	Region string
+	client *client.Client
+}
+
+// describe names the target in error messages
+func (t accountTarget) describe() string {
+	switch {
+	case t.ID != "" && t.Region != "":
+		return fmt.Sprintf("Account %s, region %s", t.Label(), t.Region)
+	case t.Region != "":
+		return "Region " + t.Region
+	default:
+		return "Account " + t.Label()
+	}
+}
+
+// roleChain returns the roles assumed for the whole command. MFA applies to
+// the first role, which is assumed with the user's own credentials, and the
+// external ID to the last one unless an account role follows.
+func roleChain(withAccount bool) []client.Role {
+	roles := make([]client.Role, len(assumeRoles))
+	for i, arn := range assumeRoles {
+		roles[i] = client.Role{ARN: arn}
+	}
+	if len(roles) > 0 {
+		if mfaSerialID != "" {
+			roles[0].MFASerial = mfaSerialID
+			roles[0].TokenCode = mfaTokenProvider()
+		}
+		if !withAccount {
+			roles[len(roles)-1].ExternalID = externalID
+		}
+	}
+	return roles
+}
+
+// mfaTokenProvider returns --mfa-token, or nil to prompt on the terminal
+func mfaTokenProvider() func() (string, error) {
+	if mfaCode == "" {
+		return nil
+	}
+	return func() (string, error) {
+		return mfaCode, nil
+	}
+}
+
+// selectAccountTargets creates a client for every account selected with
+// --accounts, assuming the account's role after the role chain, in every
+// region selected with --regions
+func selectAccountTargets(ctx context.Context) error {
+	accountTargets = nil
+	if len(accountNames) == 0 {
+		if len(selectedRegions) > 0 {
+			accountTargets = regionTargets(selectedRegions)
+		}
+		return nil
+	}
+
+	accounts, err := activeContext.SelectAccounts(accountNames)
+	if err != nil {
+		return err
+	}
+
+	for _, a := range accounts {
+		role := client.Role{ARN: a.RoleARN(), ExternalID: a.ExternalID}
+		if role.ExternalID == "" {
+			role.ExternalID = externalID
+		}
+		if len(selectedRegions) == 0 {
+			accountTargets = append(accountTargets, accountTarget{
+				Account: a,
+				client:  awsClient.ForAccount(a.Region, role),
+			})
+			continue
+		}
+		for _, r := range selectedRegions {
+			accountTargets = append(accountTargets, accountTarget{
+				Account: a,
+				Region:  r,
+				client:  awsClient.ForAccount(r, role),
+			})
+		}
+	}
+	return nil
+}
+
+// forEachAccount runs fn once in every account selected with --accounts,
+// with the account's clients in the context, or once with the current
+// clients when no accounts are selected. A failure in one account does not
+// stop the others; all failures are reported at the end.
+func forEachAccount(cmd *cobra.Command, fn func(ctx context.Context, account accountTarget) error) error {
+	ctx := cmd.Context()
+	if len(selectedRegions) > 0 {
+		return fmt.Errorf("%s does not support --regions or --all-regions", cmd.CommandPath())
+	}
+	if len(accountTargets) == 0 {
+		return fn(ctx, accountTarget{})
+	}
+
+	var failed int
+	for _, target := range accountTargets {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		logger.Debug("running in account", "account", target.ID, "name", target.Name)
+		if err := fn(targetContext(ctx, target), target); err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "%s: %v\n", target.describe(), err)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed in %d of %d accounts", failed, len(accountTargets))
+	}
+	return nil
+}
+
+// targetContext returns ctx with the target's clients
+func targetContext(ctx context.Context, target accountTarget) context.Context {
+	ctx = context.WithValue(ctx, types.EC2ClientKey, target.client.GetEC2Client())
+	if !target.client.IsMock() {
+		cfg := target.client.AWSConfig()
+		ctx = context.WithValue(ctx, types.STSClientKey, sts.NewFromConfig(cfg))
+		ctx = context.WithValue(ctx, types.IAMClientKey, iam.NewFromConfig(cfg))
+		ctx = context.WithValue(ctx, types.CloudWatchClientKey, cloudwatch.NewFromConfig(cfg))
+	}
+	if auditLog != nil {
+		ctx = context.WithValue(ctx, types.AuditLogKey, auditLog.For(target.ID, target.client.Region(), clientCaller(target.client)))
+	}
+	return ctx
+}
+
+// ec2ClientFor returns the EC2 client in ctx, falling back to the root client
+func ec2ClientFor(ctx context.Context) types.EC2Client {
+	if ec2Client, ok := ctx.Value(types.EC2ClientKey).(types.EC2Client); ok {
+		return ec2Client
+	}
+	return awsClient.GetEC2Client()
+}
+
+// amiServiceFor returns an AMI service for the EC2 client in ctx
+func amiServiceFor(ctx context.Context) *ami.Service {
+	return ami.NewService(ec2ClientFor(ctx), serviceOptions(ctx)...)
+}
+
+// printAccountHeader prints which account and region the following text
+// output is for
+func printAccountHeader(account accountTarget) {
+	switch {
+	case account.ID != "" && account.Region != "":
+		fmt.Printf("=== Account %s, region %s ===\n", account.Label(), account.Region)
+	case account.ID != "":
+		fmt.Printf("=== Account %s ===\n", account.Label())
+	case account.Region != "":
+		fmt.Printf("=== Region %s ===\n", account.Region)
+	}
+}
+
+// printAccount prints the account and region of a listed resource as its
+// fields
+func printAccount(account accountTarget) {
+	if account.ID != "" {
+		fmt.Printf("  Account: %s\n", account.Label())
+	}
+	if account.Region != "" {
+		fmt.Printf("  Region: %s\n", account.Region)
+	}
+}
+
+// withAccount adds the account and region to a JSON result, so results from
+// several accounts and regions can be merged into one list
+func withAccount(account accountTarget, v interface{}) (interface{}, error) {
+	if account.ID == "" && account.Region == "" {
+		return v, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode JSON output: %w", err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to encode JSON output: %w", err)
+	}
+
+	if account.ID != "" {
+		m["Account"] = account.ID
+		if account.Name != "" {
+			m["AccountName"] = account.Name
+		}
+	}
+	if account.Region != "" {
+		m["Region"] = account.Region
+	}
+	return m, nil
+}
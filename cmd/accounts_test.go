@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/taemon1337/ec-manager/pkg/client"
+	"github.com/taemon1337/ec-manager/pkg/config"
+	ectypes "github.com/taemon1337/ec-manager/pkg/types"
+)
+
+func TestForEachAccount(t *testing.T) {
+	base, err := client.NewClient(true, "", "us-east-1")
+	require.NoError(t, err)
+
+	cmd := &cobra.Command{}
+	cmd.SetContext(context.Background())
+
+	t.Run("without accounts", func(t *testing.T) {
+		calls := 0
+		err := forEachAccount(cmd, func(ctx context.Context, account accountTarget) error {
+			calls++
+			assert.Empty(t, account.ID)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("continues after a failing account", func(t *testing.T) {
+		accountTargets = []accountTarget{
+			{Account: config.Account{ID: "111111111111", Name: "dev"}, client: base.ForAccount("")},
+			{Account: config.Account{ID: "222222222222"}, client: base.ForAccount("")},
+			{Account: config.Account{ID: "333333333333"}, client: base.ForAccount("")},
+		}
+		defer func() { accountTargets = nil }()
+
+		var visited []string
+		err := forEachAccount(cmd, func(ctx context.Context, account accountTarget) error {
+			visited = append(visited, account.ID)
+			_, ok := ctx.Value(ectypes.EC2ClientKey).(ectypes.EC2Client)
+			assert.True(t, ok, "account EC2 client must be in the context")
+			if account.ID == "222222222222" {
+				return errors.New("access denied")
+			}
+			return nil
+		})
+		assert.EqualError(t, err, "failed in 1 of 3 accounts")
+		assert.Equal(t, []string{"111111111111", "222222222222", "333333333333"}, visited)
+	})
+}
+
+func TestCheckAccountsFlag(t *testing.T) {
+	accountNames = []string{"prod"}
+	t.Cleanup(func() { accountNames = nil })
+
+	assert.NoError(t, checkAccountsFlag(listInstancesCmd))
+	assert.NoError(t, checkAccountsFlag(NewMigrateCmd()))
+	assert.EqualError(t, checkAccountsFlag(DeleteCmd), "ec-manager delete does not support --accounts")
+
+	accountNames = nil
+	assert.NoError(t, checkAccountsFlag(DeleteCmd))
+}
+
+func TestWithAccount(t *testing.T) {
+	v := map[string]string{"InstanceId": "i-123"}
+
+	same, err := withAccount(accountTarget{}, v)
+	require.NoError(t, err)
+	assert.Equal(t, v, same)
+
+	tagged, err := withAccount(accountTarget{Account: config.Account{ID: "111111111111", Name: "dev"}}, v)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"InstanceId":  "i-123",
+		"Account":     "111111111111",
+		"AccountName": "dev",
+	}, tagged)
+}
@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+	"github.com/taemon1337/ec-manager/pkg/spec"
+)
+
+var (
+	applyFile string
+	applyYes  bool
+)
+
+// applyCmd represents the apply command
+var applyCmd = &cobra.Command{
+	Use:   "apply -f FILE",
+	Short: "Converge instances to a declarative spec",
+	Long: `Apply a YAML spec of desired instances. Each instance is matched to an
+existing one by its Name tag; missing instances are created, and the tags,
+security groups and type (of stopped instances) of existing ones are updated.
+Drift that cannot be fixed in place, such as a different AMI or subnet, is
+reported but left alone. The plan is shown and must be confirmed unless --yes
+is given, which is required with -f - as the spec is read from standard input.
+Settings left out fall back to the configuration context.
+
+  instances:
+    - name: web-1
+      ami:
+        os: RHEL9          # the AMI tagged ami-migrate=latest, or
+        version: "9.2"     # a Version tag; or id: ami-0123456789
+      type: t3.small
+      subnet: subnet-0123456789
+      key: deploy
+      security-groups: [sg-0123456789]
+      instance-profile: web
+      root-volume: {size: 50, type: gp3}
+      volumes:
+        - {size: 100, type: gp3, device: /dev/sdf}
+      tags:
+        Env: prod
+      backup: daily        # none, daily, weekly or monthly (ami-backup tag)
+      migrate: true        # opts in to migrate --enabled (ami-migrate tag)`,
+	Args:         cobra.NoArgs,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		out := cmd.OutOrStdout()
+
+		// The spec uses up standard input, leaving nothing to confirm with
+		if applyFile == "-" && !applyYes && !dryRun {
+			return fmt.Errorf("--yes is required when the spec is read from standard input")
+		}
+
+		file, err := spec.Load(applyFile, spec.Defaults{
+			Type:   activeContext.InstanceType,
+			Subnet: activeContext.Subnet,
+			Key:    activeContext.KeyName,
+			Tags:   activeContext.Tags,
+		})
+		if err != nil {
+			return err
+		}
+
+		amiService := amiServiceFor(ctx)
+
+		changes, err := spec.Diff(ctx, amiService, file)
+		if err != nil {
+			return err
+		}
+
+		pending := printApplyPlan(out, changes)
+		if pending == 0 {
+			return nil
+		}
+		if !applyYes && dryRunPlan == nil {
+			ok, err := newPrompter(cmd.InOrStdin(), out).confirm(fmt.Sprintf("Apply %d change(s)?", pending))
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("apply cancelled")
+			}
+		}
+
+		return spec.Apply(ctx, amiService, changes, func(c spec.Change, err error) {
+			if err != nil {
+				fmt.Fprintf(out, "Failed to %s %s: %v\n", c.Action, c.Name, err)
+				return
+			}
+			verb := "Created"
+			if c.Action == spec.ActionUpdate {
+				verb = "Updated"
+			}
+			fmt.Fprintf(out, "%s %s (%s)\n", verb, c.Name, c.InstanceID)
+		})
+	},
+}
+
+// printApplyPlan shows the changes and returns how many do something
+func printApplyPlan(w io.Writer, changes []spec.Change) int {
+	created, updated, unchanged := 0, 0, 0
+	for _, c := range changes {
+		switch c.Action {
+		case spec.ActionCreate:
+			created++
+			fmt.Fprintf(w, "+ create %s\n", c.Name)
+		case spec.ActionUpdate:
+			updated++
+			fmt.Fprintf(w, "~ update %s (%s)\n", c.Name, c.InstanceID)
+		default:
+			unchanged++
+			fmt.Fprintf(w, "= %s (%s) is up to date\n", c.Name, c.InstanceID)
+		}
+		for _, detail := range c.Details {
+			fmt.Fprintf(w, "    %s\n", detail)
+		}
+		for _, warning := range c.Warnings {
+			fmt.Fprintf(w, "  ! %s\n", warning)
+		}
+	}
+	fmt.Fprintf(w, "Plan: %d to create, %d to update, %d unchanged\n", created, updated, unchanged)
+	return created + updated
+}
+
+func init() {
+	rootCmd.AddCommand(applyCmd)
+	applyCmd.Flags().StringVarP(&applyFile, "file", "f", "", "Spec file of desired instances, or - for standard input")
+	applyCmd.Flags().BoolVarP(&applyYes, "yes", "y", false, "Apply without asking for confirmation")
+	if err := applyCmd.MarkFlagRequired("file"); err != nil {
+		panic(err)
+	}
+}
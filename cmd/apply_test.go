@@ -0,0 +1,16 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyStdinNeedsYes(t *testing.T) {
+	applyFile = "-"
+	t.Cleanup(func() { applyFile, applyYes, dryRun = "", false, false })
+
+	// Standard input holds the spec, so it cannot answer the confirmation
+	err := applyCmd.RunE(applyCmd, nil)
+	assert.EqualError(t, err, "--yes is required when the spec is read from standard input")
+}
@@ -0,0 +1,226 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/spf13/cobra"
+	"github.com/taemon1337/ec-manager/pkg/audit"
+	"github.com/taemon1337/ec-manager/pkg/client"
+	"github.com/taemon1337/ec-manager/pkg/config"
+	"github.com/taemon1337/ec-manager/pkg/logger"
+	"github.com/taemon1337/ec-manager/pkg/types"
+)
+
+var (
+	// auditConfig is the audit section of the configuration file
+	auditConfig config.Audit
+	// auditLog records the command's mutating calls, and is nil in dry
+	// runs and mock mode
+	auditLog *audit.Logger
+
+	auditFilter audit.Filter
+	auditSince  string
+	auditLimit  int
+)
+
+// auditCmd groups the audit log commands
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Inspect the audit log of changes made by ec-manager",
+	Long: `Every change ec-manager makes, such as launching, tagging, stopping or
+terminating instances, is appended to an audit log with the time, the caller's
+ARN, the command line, the resources and parameters, and the result.
+
+The log is ~/.local/state/ec-manager/audit.jsonl unless ECMAN_AUDIT_LOG or the
+audit section of the configuration file says otherwise:
+
+  audit:
+    file: /var/log/ec-manager/audit.jsonl
+    syslog: local                       # or udp://host:514, tcp://host:514
+    url: https://audit.example.com/ec2  # each record is POSTed as JSON`,
+	// Reading the audit log never talks to AWS, so skip creating a client
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		logger.Init(logger.LogLevel(logLevel))
+		file, err := loadConfigFile()
+		if err != nil {
+			return err
+		}
+		auditConfig = file.Audit
+		return nil
+	},
+}
+
+var auditShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show audit records",
+	Long: `Show the most recent audit records, oldest first, optionally filtered by
+action, resource, caller, time or result.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filter := auditFilter
+		if auditSince != "" {
+			since, err := parseSince(auditSince, time.Now())
+			if err != nil {
+				return err
+			}
+			filter.Since = since
+		}
+
+		path, err := auditLogPath()
+		if err != nil {
+			return err
+		}
+
+		var records []audit.Record
+		err = audit.Read(path, func(r audit.Record) error {
+			if filter.Match(r) {
+				records = append(records, r)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if auditLimit > 0 && len(records) > auditLimit {
+			records = records[len(records)-auditLimit:]
+		}
+
+		out := cmd.OutOrStdout()
+		if outputJSON() {
+			list := newJSONList(out)
+			for _, r := range records {
+				if err := list.Add(r); err != nil {
+					return err
+				}
+			}
+			return list.Close()
+		}
+
+		if len(records) == 0 {
+			fmt.Fprintln(out, "No audit records found")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TIME\tCALLER\tACCOUNT\tREGION\tACTION\tRESOURCES\tRESULT")
+		for _, r := range records {
+			result := r.Result
+			if r.Error != "" {
+				result = fmt.Sprintf("%s: %s", r.Result, r.Error)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Time.Local().Format(time.RFC3339), r.Caller, r.Account, r.Region,
+				r.Action, strings.Join(r.Resources, ","), result)
+		}
+		return w.Flush()
+	},
+}
+
+// auditLogPath returns the audit log file: ECMAN_AUDIT_LOG, the configured
+// file or the default location
+func auditLogPath() (string, error) {
+	if os.Getenv(audit.EnvLogPath) == "" && auditConfig.File != "" {
+		return auditConfig.File, nil
+	}
+	return audit.DefaultPath()
+}
+
+// newAuditLogger creates the logger for the command's mutating calls, with
+// the file sink and the configured syslog and HTTP sinks
+func newAuditLogger() (*audit.Logger, error) {
+	path, err := auditLogPath()
+	if err != nil {
+		return nil, err
+	}
+
+	sinks := []audit.Sink{audit.NewFileSink(path)}
+	if auditConfig.Syslog != "" {
+		sink, err := audit.NewSyslogSink(auditConfig.Syslog)
+		if err != nil {
+			return nil, fmt.Errorf("invalid audit configuration: %w", err)
+		}
+		sinks = append(sinks, sink)
+	}
+	if auditConfig.URL != "" {
+		sinks = append(sinks, audit.NewHTTPSink(auditConfig.URL))
+	}
+
+	log := audit.NewLogger(commandLine(os.Args), nil, sinks...)
+	return log.For("", awsClient.Region(), clientCaller(awsClient)), nil
+}
+
+// auditLogFor returns the audit logger of the account and region in ctx,
+// falling back to the root logger
+func auditLogFor(ctx context.Context) *audit.Logger {
+	if log, ok := ctx.Value(types.AuditLogKey).(*audit.Logger); ok {
+		return log
+	}
+	return auditLog
+}
+
+// clientCaller returns a resolver for the ARN of the identity c calls AWS
+// as
+func clientCaller(c *client.Client) func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) {
+		identity, err := sts.NewFromConfig(c.AWSConfig()).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+		if err != nil {
+			return "", fmt.Errorf("failed to get caller identity: %w", err)
+		}
+		return aws.ToString(identity.Arn), nil
+	}
+}
+
+// secretFlags are flags whose values never go into the audit log
+var secretFlags = []string{"--mfa-token"}
+
+// commandLine joins args for the audit log, hiding the values of secret
+// flags
+func commandLine(args []string) string {
+	redacted := make([]string, len(args))
+	copy(redacted, args)
+	for i := 0; i < len(redacted); i++ {
+		for _, flag := range secretFlags {
+			switch {
+			case redacted[i] == flag && i+1 < len(redacted):
+				i++
+				redacted[i] = "***"
+			case strings.HasPrefix(redacted[i], flag+"="):
+				redacted[i] = flag + "=***"
+			}
+		}
+	}
+	return strings.Join(redacted, " ")
+}
+
+// parseSince parses a duration before now, such as 24h, a date or an
+// RFC 3339 time
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since %q, expected a duration such as 24h, a date or an RFC 3339 time", s)
+}
+
+func init() {
+	rootCmd.AddCommand(auditCmd)
+	auditCmd.AddCommand(auditShowCmd)
+
+	auditShowCmd.Flags().StringVar(&auditFilter.Action, "action", "", "Only show this action, e.g. TerminateInstances")
+	auditShowCmd.Flags().StringVar(&auditFilter.Resource, "resource", "", "Only show actions on this resource ID")
+	auditShowCmd.Flags().StringVar(&auditFilter.Caller, "caller", "", "Only show actions by callers containing this text")
+	auditShowCmd.Flags().StringVar(&auditSince, "since", "", "Only show actions since a duration ago (e.g. 24h), a date or an RFC 3339 time")
+	auditShowCmd.Flags().BoolVar(&auditFilter.Failed, "failed", false, "Only show failed actions")
+	auditShowCmd.Flags().IntVar(&auditLimit, "limit", 50, "Show at most this many of the most recent records (0 shows all)")
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommandLine(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{args: []string{"ec-manager", "delete", "web-1", "--yes"}, want: "ec-manager delete web-1 --yes"},
+		{args: []string{"ec-manager", "--mfa-token", "123456", "stop", "web-1"}, want: "ec-manager --mfa-token *** stop web-1"},
+		{args: []string{"ec-manager", "--mfa-token=123456", "stop"}, want: "ec-manager --mfa-token=*** stop"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			assert.Equal(t, tt.want, commandLine(tt.args))
+		})
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	since, err := parseSince("24h", now)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(-24*time.Hour), since)
+
+	since, err = parseSince("2026-10-17T08:00:00Z", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 10, 17, 8, 0, 0, 0, time.UTC), since)
+
+	since, err = parseSince("2026-10-01", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 10, 1, 0, 0, 0, 0, time.Local), since)
+
+	_, err = parseSince("yesterday", now)
+	assert.Error(t, err)
+}
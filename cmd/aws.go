@@ -1,19 +1,369 @@
 package cmd
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"os"
+	"strings"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/spf13/cobra"
+	"github.com/taemon1337/ec-manager/pkg/client"
+	ecconfig "github.com/taemon1337/ec-manager/pkg/config"
+	"github.com/taemon1337/ec-manager/pkg/logger"
+	"github.com/taemon1337/ec-manager/pkg/types"
+	"golang.org/x/term"
 )
 
 // AwsCmd represents the aws command
-var AwsCmd = &cobra.Command{
-	Use:   "aws",
-	Short: "AWS configuration",
-	Long:  `Configure AWS credentials and settings`,
-	RunE: func(cmd *cobra.Command, args []string) error {
-		return fmt.Errorf("not implemented")
-	},
+var AwsCmd = NewAwsCmd()
+
+// NewAwsCmd creates the aws profile setup command
+func NewAwsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "aws [PROFILE]",
+		Short: "AWS configuration",
+		Long: `Configure AWS credentials and settings.
+
+Lists the profiles in the shared AWS config and credentials files, then walks
+through creating or editing one. A profile can use static access keys, IAM
+Identity Center (SSO), or assume a role from a source profile with optional
+MFA. The profile is validated with STS GetCallerIdentity before it is saved.`,
+		Args: cobra.MaximumNArgs(1),
+		// The wizard must work before any credentials exist, so it does not
+		// create the AWS client the other commands use
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			logger.Init(logger.LogLevel(logLevel))
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runProfileWizard(cmd, args)
+		},
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "profiles",
+		Short: "List AWS profiles",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			profiles, err := ecconfig.ListProfiles()
+			if err != nil {
+				return fmt.Errorf("failed to list profiles: %w", err)
+			}
+			printProfiles(cmd.OutOrStdout(), profiles)
+			return nil
+		},
+	})
+
+	return cmd
+}
+
+// runProfileWizard prompts for a profile, validates it and saves it
+func runProfileWizard(cmd *cobra.Command, args []string) error {
+	ctx := cmd.Context()
+	out := cmd.OutOrStdout()
+	prompt := newPrompter(cmd.InOrStdin(), out)
+
+	profiles, err := ecconfig.ListProfiles()
+	if err != nil {
+		return fmt.Errorf("failed to list profiles: %w", err)
+	}
+	printProfiles(out, profiles)
+
+	var name string
+	if len(args) > 0 {
+		name = args[0]
+	} else if name, err = prompt.ask("Profile to create or edit", "default"); err != nil {
+		return err
+	}
+
+	existing, found, err := ecconfig.LoadProfile(name)
+	if err != nil {
+		return fmt.Errorf("failed to load profile: %w", err)
+	}
+	if found {
+		fmt.Fprintf(out, "Editing %s profile %s\n", existing.Kind(), name)
+	} else {
+		fmt.Fprintf(out, "Creating profile %s\n", name)
+	}
+
+	p, err := promptProfile(prompt, existing)
+	if err != nil {
+		return err
+	}
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	identity, err := validateProfile(ctx, p, prompt)
+	if err != nil {
+		fmt.Fprintf(out, "Validation failed: %v\n", err)
+		if p.Kind() == ecconfig.ProfileSSO {
+			fmt.Fprintln(out, "SSO profiles need a signed-in session before they can be validated.")
+		}
+		save, err := prompt.confirm("Save the profile anyway?")
+		if err != nil {
+			return err
+		}
+		if !save {
+			return fmt.Errorf("profile %s was not saved", name)
+		}
+	} else {
+		fmt.Fprintf(out, "Validated profile %s as %s\n", name, aws.ToString(identity.Arn))
+	}
+
+	if err := ecconfig.SaveProfile(p); err != nil {
+		return fmt.Errorf("failed to save profile: %w", err)
+	}
+	fmt.Fprintf(out, "Saved profile %s\n", name)
+	return nil
+}
+
+// printProfiles lists profiles with the kind of credentials they use
+func printProfiles(w io.Writer, profiles []ecconfig.Profile) {
+	if len(profiles) == 0 {
+		fmt.Fprintln(w, "No AWS profiles found")
+		return
+	}
+
+	fmt.Fprintln(w, "AWS profiles:")
+	for _, p := range profiles {
+		region := p.Region
+		if region == "" {
+			region = "-"
+		}
+		fmt.Fprintf(w, "  %-20s %-12s %s\n", p.Name, p.Kind(), region)
+	}
+}
+
+// profileQuestion is one setting asked for by the wizard
+type profileQuestion struct {
+	label  string
+	def    string
+	field  *string
+	secret bool
+}
+
+// promptProfile asks for the settings of a profile, defaulting to the values
+// of existing
+func promptProfile(prompt *prompter, existing ecconfig.Profile) (ecconfig.Profile, error) {
+	p := ecconfig.Profile{Name: existing.Name}
+
+	kind, err := prompt.choose("Credential type", []string{
+		ecconfig.ProfileStatic,
+		ecconfig.ProfileSSO,
+		ecconfig.ProfileAssumeRole,
+	}, existing.Kind())
+	if err != nil {
+		return p, err
+	}
+
+	regionDefault := existing.Region
+	if regionDefault == "" {
+		regionDefault = region
+	}
+
+	questions := []profileQuestion{
+		{label: "Region", def: regionDefault, field: &p.Region},
+	}
+
+	switch kind {
+	case ecconfig.ProfileStatic:
+		questions = append(questions, []profileQuestion{
+			{label: "Access key ID", def: existing.AccessKeyID, field: &p.AccessKeyID},
+			{label: "Secret access key", def: existing.SecretAccessKey, field: &p.SecretAccessKey, secret: true},
+			{label: "Session token (optional)", def: existing.SessionToken, field: &p.SessionToken, secret: true},
+		}...)
+	case ecconfig.ProfileSSO:
+		ssoRegion := existing.SSORegion
+		if ssoRegion == "" {
+			ssoRegion = regionDefault
+		}
+		questions = append(questions, []profileQuestion{
+			{label: "SSO start URL", def: existing.SSOStartURL, field: &p.SSOStartURL},
+			{label: "SSO region", def: ssoRegion, field: &p.SSORegion},
+			{label: "Account ID", def: existing.SSOAccountID, field: &p.SSOAccountID},
+			{label: "Role name", def: existing.SSORoleName, field: &p.SSORoleName},
+		}...)
+	case ecconfig.ProfileAssumeRole:
+		source := existing.SourceProfile
+		if source == "" && existing.Name != "default" {
+			source = "default"
+		}
+		questions = append(questions, []profileQuestion{
+			{label: "Role ARN", def: existing.RoleARN, field: &p.RoleARN},
+			{label: "Source profile", def: source, field: &p.SourceProfile},
+			{label: "MFA device serial (optional)", def: existing.MFASerial, field: &p.MFASerial},
+		}...)
+	}
+
+	for _, q := range questions {
+		ask := prompt.ask
+		if q.secret {
+			ask = prompt.askSecret
+		}
+		if *q.field, err = ask(q.label, q.def); err != nil {
+			return p, err
+		}
+	}
+	return p, nil
+}
+
+// validateProfile calls STS GetCallerIdentity with the profile's credentials.
+// The profile is staged in a copy of the shared files so nothing is changed
+// until validation succeeds.
+func validateProfile(ctx context.Context, p ecconfig.Profile, prompt *prompter) (*sts.GetCallerIdentityOutput, error) {
+	stsClient, ok := ctx.Value(types.STSClientKey).(types.STSClient)
+	if !ok {
+		if mockMode {
+			return &sts.GetCallerIdentityOutput{Arn: aws.String("arn:aws:iam::123456789012:user/mock")}, nil
+		}
+
+		dir, err := os.MkdirTemp("", "ec-manager-profile-")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create staging directory: %w", err)
+		}
+		defer os.RemoveAll(dir)
+
+		configPath, credentialsPath, err := ecconfig.StageProfile(p, dir)
+		if err != nil {
+			return nil, err
+		}
+
+		retryer := client.NewRetryer(retryPolicy)
+		opts := []func(*config.LoadOptions) error{
+			config.WithSharedConfigFiles([]string{configPath}),
+			config.WithSharedCredentialsFiles([]string{credentialsPath}),
+			config.WithSharedConfigProfile(p.Name),
+			config.WithRetryer(func() aws.Retryer { return retryer }),
+			config.WithAssumeRoleCredentialOptions(func(o *stscreds.AssumeRoleOptions) {
+				o.TokenProvider = func() (string, error) {
+					return prompt.ask("MFA code for "+p.MFASerial, "")
+				}
+			}),
+		}
+		if p.Region == "" {
+			opts = append(opts, config.WithRegion(region))
+		}
+
+		cfg, err := config.LoadDefaultConfig(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load profile: %w", err)
+		}
+		stsClient = sts.NewFromConfig(cfg)
+	}
+
+	identity, err := stsClient.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+// prompter reads answers to interactive questions
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+	// readSecret reads a line without echoing it, when in is a terminal
+	readSecret func() ([]byte, error)
+}
+
+func newPrompter(in io.Reader, out io.Writer) *prompter {
+	p := &prompter{in: bufio.NewReader(in), out: out}
+	if f, ok := in.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		p.readSecret = func() ([]byte, error) { return term.ReadPassword(int(f.Fd())) }
+	}
+	return p
+}
+
+// ask prints label and returns the answer, or def when the answer is empty
+func (p *prompter) ask(label, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", label, def)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", label)
+	}
+	return p.read(def)
+}
+
+// askSecret is like ask but only shows the last characters of def, and does
+// not echo the answer when reading from a terminal
+func (p *prompter) askSecret(label, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", label, maskSecret(def))
+	} else {
+		fmt.Fprintf(p.out, "%s: ", label)
+	}
+	if p.readSecret == nil {
+		return p.read(def)
+	}
+
+	secret, err := p.readSecret()
+	// The user's newline was not echoed either
+	fmt.Fprintln(p.out)
+	if err != nil {
+		return "", fmt.Errorf("failed to read input: %w", err)
+	}
+	if answer := strings.TrimSpace(string(secret)); answer != "" {
+		return answer, nil
+	}
+	return def, nil
+}
+
+// choose asks for one of options
+func (p *prompter) choose(label string, options []string, def string) (string, error) {
+	for {
+		answer, err := p.ask(fmt.Sprintf("%s (%s)", label, strings.Join(options, ", ")), def)
+		if err != nil {
+			return "", err
+		}
+		for _, option := range options {
+			if answer == option {
+				return answer, nil
+			}
+		}
+		fmt.Fprintf(p.out, "Please enter one of: %s\n", strings.Join(options, ", "))
+	}
+}
+
+// confirm asks a yes/no question, defaulting to no
+func (p *prompter) confirm(label string) (bool, error) {
+	answer, err := p.ask(label+" [y/N]", "")
+	if err != nil {
+		return false, err
+	}
+	answer = strings.ToLower(answer)
+	return answer == "y" || answer == "yes", nil
+}
+
+func (p *prompter) read(def string) (string, error) {
+	line, err := p.in.ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		if errors.Is(err, io.EOF) {
+			return "", fmt.Errorf("input closed before all questions were answered")
+		}
+		return "", fmt.Errorf("failed to read input: %w", err)
+	}
+
+	answer := strings.TrimSpace(line)
+	if answer == "" {
+		return def, nil
+	}
+	return answer, nil
+}
+
+// maskSecret hides all but the last four characters of a secret
+func maskSecret(s string) string {
+	if len(s) <= 4 {
+		return strings.Repeat("*", len(s))
+	}
+	return strings.Repeat("*", 4) + s[len(s)-4:]
 }
 
 func init() {
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	ecconfig "github.com/taemon1337/ec-manager/pkg/config"
+	mockclient "github.com/taemon1337/ec-manager/pkg/mock"
+	ectypes "github.com/taemon1337/ec-manager/pkg/types"
+)
+
+func TestAwsCmd(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		input       string
+		stsErr      error
+		wantSaved   bool
+		errContains string
+	}{
+		{
+			name:      "create static profile",
+			args:      []string{"dev"},
+			input:     "static\nus-west-2\nAKIA1\nsecret\n\n",
+			wantSaved: true,
+		},
+		{
+			name:        "validation failure is not saved",
+			args:        []string{"dev"},
+			input:       "static\nus-west-2\nAKIA1\nsecret\n\nn\n",
+			stsErr:      errors.New("InvalidClientTokenId"),
+			errContains: "was not saved",
+		},
+		{
+			name:      "validation failure saved on request",
+			input:     "dev\nstatic\nus-west-2\nAKIA1\nsecret\n\ny\n",
+			stsErr:    errors.New("InvalidClientTokenId"),
+			wantSaved: true,
+		},
+		{
+			name:        "input closed",
+			args:        []string{"dev"},
+			input:       "static\n",
+			errContains: "input closed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+			t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+
+			mockSTSClient := mockclient.NewMockSTSClient(t)
+			if tt.stsErr != nil {
+				mockSTSClient.On("GetCallerIdentity", mock.Anything, mock.Anything, mock.Anything).Return(nil, tt.stsErr).Maybe()
+			} else {
+				mockSTSClient.On("GetCallerIdentity", mock.Anything, mock.Anything, mock.Anything).Return(&sts.GetCallerIdentityOutput{
+					Arn: aws.String("arn:aws:iam::123456789012:user/test-user"),
+				}, nil).Maybe()
+			}
+
+			cmd := NewAwsCmd()
+			cmd.SetContext(context.WithValue(context.Background(), ectypes.STSClientKey, mockSTSClient))
+			cmd.SetIn(strings.NewReader(tt.input))
+			cmd.SetOut(&bytes.Buffer{})
+			cmd.SetArgs(tt.args)
+
+			err := cmd.Execute()
+			if tt.errContains != "" {
+				assert.ErrorContains(t, err, tt.errContains)
+			} else {
+				require.NoError(t, err)
+			}
+
+			p, found, err := ecconfig.LoadProfile("dev")
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantSaved, found)
+			if tt.wantSaved {
+				assert.Equal(t, ecconfig.Profile{
+					Name:            "dev",
+					Region:          "us-west-2",
+					AccessKeyID:     "AKIA1",
+					SecretAccessKey: "secret",
+				}, p)
+			}
+		})
+	}
+}
+
+func TestAskSecretTerminal(t *testing.T) {
+	var out bytes.Buffer
+	prompt := newPrompter(strings.NewReader("echoed\n"), &out)
+	answers := []string{"typed-secret", ""}
+	prompt.readSecret = func() ([]byte, error) {
+		answer := answers[0]
+		answers = answers[1:]
+		return []byte(answer), nil
+	}
+
+	got, err := prompt.askSecret("AWS Secret Access Key", "old-secret-1234")
+	require.NoError(t, err)
+	assert.Equal(t, "typed-secret", got)
+	assert.Equal(t, "AWS Secret Access Key [****1234]: \n", out.String())
+
+	// An empty answer keeps the default, and nothing is read from the echoed input
+	got, err = prompt.askSecret("AWS Secret Access Key", "old-secret-1234")
+	require.NoError(t, err)
+	assert.Equal(t, "old-secret-1234", got)
+	line, err := prompt.read("")
+	require.NoError(t, err)
+	assert.Equal(t, "echoed", line)
+}
@@ -4,58 +4,57 @@ import (
 	"fmt"
 
 	"github.com/spf13/cobra"
-	"github.com/taemon1337/ec-manager/pkg/ami"
-	"github.com/taemon1337/ec-manager/pkg/types"
 )
 
 // backupCmd represents the backup command
 func NewBackupCmd() *cobra.Command {
 	var backupInstanceID string
+	var selection instanceSelection
 
 	cmd := &cobra.Command{
-		Use:   "backup",
-		Short: "Backup an EC2 instance",
-		Long:  `Create a backup AMI of an EC2 instance.`,
+		Use:   "backup [INSTANCE...]",
+		Short: "Backup EC2 instances",
+		Long: `Create a backup AMI of each EC2 instance selected by instance ID or Name tag,
+with --filter and --name.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			// Get EC2 client from context
-			ec2Client, ok := cmd.Context().Value(types.EC2ClientKey).(types.EC2Client)
-			if !ok {
-				return fmt.Errorf("failed to get EC2 client")
-			}
-
-			amiService := ami.NewService(ec2Client)
 			ctx := cmd.Context()
+			amiService := amiServiceFor(ctx)
 
-			// Get instance OS for tagging
-			os, err := amiService.GetInstanceOS(ctx, backupInstanceID)
+			ids, err := selectInstanceIDs(ctx, amiService, selection.selector(args, backupInstanceID))
 			if err != nil {
-				return fmt.Errorf("failed to get instance OS: %w", err)
+				return err
 			}
 
-			// Create backup AMI
-			amiID, err := amiService.BackupInstance(ctx, backupInstanceID)
-			if err != nil {
-				return fmt.Errorf("failed to create backup AMI: %w", err)
-			}
+			for _, id := range ids {
+				// Get instance OS for tagging
+				os, err := amiService.GetInstanceOS(ctx, id)
+				if err != nil {
+					return fmt.Errorf("failed to get instance OS: %w", err)
+				}
 
-			// Tag the AMI with OS and version info
-			err = amiService.UpdateAMITags(ctx, amiID, map[string]string{
-				"OS":         os,
-				"BackupType": "manual",
-			})
-			if err != nil {
-				return fmt.Errorf("failed to tag backup AMI: %w", err)
-			}
+				// Create backup AMI
+				amiID, err := amiService.BackupInstance(ctx, id)
+				if err != nil {
+					return fmt.Errorf("failed to create backup AMI: %w", err)
+				}
+
+				// Tag the AMI with OS and version info
+				err = amiService.UpdateAMITags(ctx, amiID, map[string]string{
+					"OS":         os,
+					"BackupType": "manual",
+				})
+				if err != nil {
+					return fmt.Errorf("failed to tag backup AMI: %w", err)
+				}
 
-			fmt.Printf("Successfully created backup AMI %s for instance %s\n", amiID, backupInstanceID)
+				fmt.Printf("Successfully created backup AMI %s for instance %s\n", amiID, id)
+			}
 			return nil
 		},
 	}
 
-	cmd.Flags().StringVarP(&backupInstanceID, "instance-id", "i", "", "Instance ID to backup")
-	if err := cmd.MarkFlagRequired("instance-id"); err != nil {
-		panic(err)
-	}
+	cmd.Flags().StringVarP(&backupInstanceID, "instance-id", "i", "", "Instance ID or Name tag to backup")
+	addSelectionFlags(cmd, &selection)
 
 	return cmd
 }
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+	"github.com/taemon1337/ec-manager/pkg/ami"
+)
+
+// fallbackFlags holds the capacity fallback flags shared by create and
+// migrate
+type fallbackFlags struct {
+	instanceTypes []string
+	subnetIDs     []string
+}
+
+// addFallbackFlags adds --fallback-type and --fallback-subnet to a command
+// that launches instances
+func addFallbackFlags(cmd *cobra.Command, f *fallbackFlags) {
+	cmd.Flags().StringSliceVar(&f.instanceTypes, "fallback-type", nil, "Instance types to try in order when there is no capacity, e.g. t3a.large,m5.large")
+	cmd.Flags().StringSliceVar(&f.subnetIDs, "fallback-subnet", nil, "Subnets, usually in other availability zones, to try in order when there is no capacity")
+}
+
+// printLaunchAttempts reports the attempts that found no capacity and where
+// the instance was launched in the end
+func printLaunchAttempts(w io.Writer, result *ami.LaunchResult) {
+	if len(result.Attempts) < 2 {
+		return
+	}
+	for _, attempt := range result.Attempts[:len(result.Attempts)-1] {
+		fmt.Fprintf(w, "No capacity for %s: %s\n", describeAttempt(attempt), attempt.Error)
+	}
+	fmt.Fprintf(w, "Launched %s after %d attempts\n", describeAttempt(result.Attempts[len(result.Attempts)-1]), len(result.Attempts))
+}
+
+// describeAttempt names the type, subnet and purchase option of an attempt
+func describeAttempt(attempt ami.LaunchAttempt) string {
+	instanceType := attempt.InstanceType
+	if instanceType == "" {
+		instanceType = "the template's type"
+	}
+	s := instanceType
+	if attempt.SubnetID != "" {
+		s += " in " + attempt.SubnetID
+	}
+	if attempt.Spot {
+		return s + " (Spot)"
+	}
+	return s + " (on-demand)"
+}
@@ -10,7 +10,10 @@ var checkCmd = &cobra.Command{
 	Long: `Check command provides various subcommands to verify and check the status
 of your AWS resources, including:
 - credentials: Verify AWS credentials and assume roles
-- migrate: Check if your instances need migration to newer AMIs`,
+- permissions: Verify the identity can perform the actions each command needs
+- migrate: Check if your instances need migration to newer AMIs
+- drift: Check instances for changes made outside ec-manager
+- rightsize: Recommend instance types from CPU and network utilization`,
 }
 
 func init() {
@@ -3,8 +3,6 @@ package cmd
 import (
 	"context"
 	"fmt"
-	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
@@ -14,79 +12,33 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/iam"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
 	"github.com/spf13/cobra"
+	"github.com/taemon1337/ec-manager/pkg/client"
+	ecconfig "github.com/taemon1337/ec-manager/pkg/config"
+	"github.com/taemon1337/ec-manager/pkg/session"
+	"github.com/taemon1337/ec-manager/pkg/trust"
 	"github.com/taemon1337/ec-manager/pkg/types"
-	"gopkg.in/ini.v1"
 )
 
-// loadConfig loads AWS configuration
+// loadConfig loads AWS configuration, reusing the root client's config so
+// STS and IAM calls share its retry policy
 func loadConfig(ctx context.Context) (aws.Config, error) {
-	return config.LoadDefaultConfig(ctx)
+	if awsClient != nil && !awsClient.IsMock() {
+		return awsClient.AWSConfig(), nil
+	}
+
+	retryer := client.NewRetryer(retryPolicy)
+	return config.LoadDefaultConfig(ctx, config.WithRetryer(func() aws.Retryer {
+		return retryer
+	}))
 }
 
 // saveCredentials saves AWS credentials to the credentials file
 func saveCredentials(profile, accessKey, secretKey, sessionToken string) error {
-	homeDir, err := os.UserHomeDir()
+	credentialsPath, err := ecconfig.SharedCredentialsPath()
 	if err != nil {
-		return fmt.Errorf("unable to get home directory: %w", err)
-	}
-
-	awsDir := filepath.Join(homeDir, ".aws")
-	credentialsPath := filepath.Join(awsDir, "credentials")
-
-	// Check if .aws directory exists
-	if mkdirErr := os.MkdirAll(awsDir, 0700); mkdirErr != nil {
-		return fmt.Errorf("failed to create .aws directory: %w", mkdirErr)
-	}
-
-	// Check if credentials file exists
-	if _, statErr := os.Stat(credentialsPath); statErr == nil {
-		iniFile, err := ini.Load(credentialsPath)
-		if err != nil {
-			return fmt.Errorf("failed to load credentials file: %w", err)
-		}
-
-		profileSection := profile
-		if profileSection == "" {
-			profileSection = "default"
-		}
-
-		section, err := iniFile.NewSection(profileSection)
-		if err != nil {
-			return fmt.Errorf("failed to create profile section: %w", err)
-		}
-
-		section.Key("aws_access_key_id").SetValue(accessKey)
-		section.Key("aws_secret_access_key").SetValue(secretKey)
-		section.Key("aws_session_token").SetValue(sessionToken)
-
-		if err := iniFile.SaveTo(credentialsPath); err != nil {
-			return fmt.Errorf("failed to save credentials file: %w", err)
-		}
-
-		return nil
-	} else {
-		iniFile := ini.Empty()
-
-		profileSection := profile
-		if profileSection == "" {
-			profileSection = "default"
-		}
-
-		section, err := iniFile.NewSection(profileSection)
-		if err != nil {
-			return fmt.Errorf("failed to create profile section: %w", err)
-		}
-
-		section.Key("aws_access_key_id").SetValue(accessKey)
-		section.Key("aws_secret_access_key").SetValue(secretKey)
-		section.Key("aws_session_token").SetValue(sessionToken)
-
-		if err := iniFile.SaveTo(credentialsPath); err != nil {
-			return fmt.Errorf("failed to save credentials file: %w", err)
-		}
-
-		return nil
+		return err
 	}
+	return ecconfig.SaveCredentials(profile, accessKey, secretKey, sessionToken, credentialsPath)
 }
 
 // isCredentialError checks if the error is related to missing or invalid credentials
@@ -121,30 +73,72 @@ func getCredentialHelp() string {
    aws_session_token = your_session_token (optional)`
 }
 
-// discoverRoleARN attempts to discover available roles for the user
-func discoverRoleARN(ctx context.Context, iamClient types.IAMClient) ([]string, error) {
-	var roles []string
+// discoveredRole is a role found by discoverRoles and whether the caller can
+// assume it
+type discoveredRole struct {
+	ARN string
+	trust.Result
+}
 
-	// List roles
-	output, err := iamClient.ListRoles(ctx, &iam.ListRolesInput{})
-	if err != nil {
-		return nil, fmt.Errorf("failed to list roles: %w", err)
-	}
+// discoverRoles lists every role in the account and evaluates its trust
+// policy against the caller
+func discoverRoles(ctx context.Context, iamClient types.IAMClient, caller trust.Caller) ([]discoveredRole, error) {
+	var roles []discoveredRole
 
-	for _, role := range output.Roles {
-		if role.AssumeRolePolicyDocument == nil {
-			continue
+	paginator := iam.NewListRolesPaginator(iamClient, &iam.ListRolesInput{})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list roles: %w", err)
 		}
 
-		// Check if the role can be assumed by the current user/role
-		if strings.Contains(*role.AssumeRolePolicyDocument, "sts:AssumeRole") {
-			roles = append(roles, *role.Arn)
+		for _, role := range page.Roles {
+			r := discoveredRole{ARN: aws.ToString(role.Arn)}
+			policy, err := trust.ParsePolicy(aws.ToString(role.AssumeRolePolicyDocument))
+			if err != nil {
+				r.Result = trust.Result{Decision: trust.Denied, Reasons: []string{err.Error()}}
+			} else {
+				r.Result = trust.Evaluate(policy, caller)
+			}
+			roles = append(roles, r)
 		}
 	}
 
 	return roles, nil
 }
 
+// printDiscoveredRoles prints the assumable roles first, then the others,
+// each with the reasons for its decision
+func printDiscoveredRoles(roles []discoveredRole) {
+	var assumable, other []discoveredRole
+	for _, r := range roles {
+		if r.Decision == trust.Denied {
+			other = append(other, r)
+		} else {
+			assumable = append(assumable, r)
+		}
+	}
+
+	printGroup := func(title string, roles []discoveredRole) {
+		if len(roles) == 0 {
+			return
+		}
+		fmt.Printf("\n%s:\n", title)
+		for _, r := range roles {
+			fmt.Printf("- %s [%s]\n", r.ARN, r.Decision)
+			for _, reason := range r.Reasons {
+				fmt.Printf("    %s\n", reason)
+			}
+		}
+	}
+
+	if len(assumable) == 0 {
+		fmt.Println("No assumable roles found")
+	}
+	printGroup("Available roles", assumable)
+	printGroup("Roles that cannot be assumed", other)
+}
+
 // ec2ClientWrapper wraps the EC2 client to implement the EC2Client interface
 type ec2ClientWrapper struct {
 	*ec2.Client
@@ -187,7 +181,8 @@ var (
 2. Assume a role (with optional MFA)
 3. Discover available roles that you can assume
 
-The credentials will be stored in ~/.aws/credentials under the specified profile.`,
+The credentials will be stored in ~/.aws/credentials under the --save-profile profile,
+or with --cache in ec-manager's session cache for use through credential-process.`,
 		SilenceUsage:  true,
 		SilenceErrors: true,
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -251,20 +246,17 @@ The credentials will be stored in ~/.aws/credentials under the specified profile
 
 			// If discover flag is set, try to find available roles
 			if discover {
-				roles, err := discoverRoleARN(ctx, iamClient)
+				caller := trust.Caller{
+					Account: aws.ToString(callerIdentity.Account),
+					ARN:     aws.ToString(callerIdentity.Arn),
+					UserID:  aws.ToString(callerIdentity.UserId),
+				}
+				roles, err := discoverRoles(ctx, iamClient, caller)
 				if err != nil {
 					return fmt.Errorf("failed to discover roles: %w", err)
 				}
 
-				if len(roles) == 0 {
-					fmt.Println("No assumable roles found")
-					return nil
-				}
-
-				fmt.Println("\nAvailable roles:")
-				for _, role := range roles {
-					fmt.Printf("- %s\n", role)
-				}
+				printDiscoveredRoles(roles)
 				return nil
 			}
 
@@ -275,9 +267,11 @@ The credentials will be stored in ~/.aws/credentials under the specified profile
 					RoleSessionName: aws.String("ec-manager-session"),
 				}
 
-				if mfaToken != "" {
-					input.SerialNumber = aws.String(mfaSerial)
-					input.TokenCode = aws.String(mfaToken)
+				// --mfa-serial and --mfa-token are the root flags, so the
+				// context's MFA device applies too
+				if mfaCode != "" {
+					input.SerialNumber = aws.String(mfaSerialID)
+					input.TokenCode = aws.String(mfaCode)
 				}
 
 				assumeRoleOutput, err := stsClient.AssumeRole(ctx, input)
@@ -285,8 +279,14 @@ The credentials will be stored in ~/.aws/credentials under the specified profile
 					return fmt.Errorf("failed to assume role: %w", err)
 				}
 
+				// Cache the session instead of writing secrets to the
+				// shared credentials file
+				if cacheSession {
+					return cacheAssumedRole(assumeRoleOutput)
+				}
+
 				// Save the temporary credentials
-				err = saveCredentials(profile,
+				err = saveCredentials(saveProfile,
 					*assumeRoleOutput.Credentials.AccessKeyId,
 					*assumeRoleOutput.Credentials.SecretAccessKey,
 					*assumeRoleOutput.Credentials.SessionToken)
@@ -295,20 +295,50 @@ The credentials will be stored in ~/.aws/credentials under the specified profile
 				}
 
 				fmt.Printf("Successfully assumed role %s\n", roleARN)
-				fmt.Printf("Temporary credentials saved to profile: %s\n", profile)
+				fmt.Printf("Temporary credentials saved to profile: %s\n", saveProfile)
 			}
 
 			return nil
 		},
 	}
 
-	roleARN   string
-	mfaSerial string
-	mfaToken  string
-	profile   string
-	discover  bool
+	roleARN      string
+	saveProfile  string
+	discover     bool
+	cacheSession bool
 )
 
+// cacheAssumedRole stores assumed-role credentials in the session cache and
+// shows how to use them through credential_process
+func cacheAssumedRole(out *sts.AssumeRoleOutput) error {
+	cache, err := session.NewDefaultCache()
+	if err != nil {
+		return err
+	}
+
+	s := &session.Session{
+		Name:          session.NameForRole(roleARN),
+		RoleARN:       roleARN,
+		SourceProfile: awsProfile,
+		MFASerial:     mfaSerialID,
+	}
+	s.SetCredentials(aws.Credentials{
+		AccessKeyID:     aws.ToString(out.Credentials.AccessKeyId),
+		SecretAccessKey: aws.ToString(out.Credentials.SecretAccessKey),
+		SessionToken:    aws.ToString(out.Credentials.SessionToken),
+		Expires:         aws.ToTime(out.Credentials.Expiration),
+	})
+	if err := cache.Save(s); err != nil {
+		return fmt.Errorf("failed to cache session: %w", err)
+	}
+
+	fmt.Printf("Successfully assumed role %s\n", roleARN)
+	fmt.Printf("Session %s cached until %s\n", s.Name, s.Expiration.Local().Format(time.RFC1123))
+	fmt.Println("\nTo use it from other AWS tools, add to ~/.aws/config:")
+	fmt.Printf("\n[profile %s]\ncredential_process = ec-manager credential-process --session %s\n", s.Name, s.Name)
+	return nil
+}
+
 // NewCheckCredentialsCmd creates a new check credentials command
 func NewCheckCredentialsCmd() *cobra.Command {
 	return checkCredentialsCmd
@@ -316,8 +346,7 @@ func NewCheckCredentialsCmd() *cobra.Command {
 
 func init() {
 	checkCredentialsCmd.Flags().StringVarP(&roleARN, "role", "r", "", "Role ARN to assume")
-	checkCredentialsCmd.Flags().StringVarP(&mfaSerial, "mfa-serial", "s", "", "MFA device serial number")
-	checkCredentialsCmd.Flags().StringVarP(&mfaToken, "mfa-token", "t", "", "MFA token code")
-	checkCredentialsCmd.Flags().StringVarP(&profile, "profile", "p", "default", "AWS profile to save credentials to")
+	checkCredentialsCmd.Flags().StringVarP(&saveProfile, "save-profile", "p", "default", "AWS profile to save credentials to")
 	checkCredentialsCmd.Flags().BoolVarP(&discover, "discover", "d", false, "Discover available roles")
+	checkCredentialsCmd.Flags().BoolVar(&cacheSession, "cache", false, "Cache the assumed-role session for credential-process instead of writing it to ~/.aws/credentials")
 }
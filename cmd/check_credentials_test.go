@@ -3,6 +3,7 @@ package cmd
 import (
 	"context"
 	"errors"
+	"net/url"
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -11,9 +12,11 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/iam"
 	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	mockclient "github.com/taemon1337/ec-manager/pkg/mock"
 	"github.com/taemon1337/ec-manager/pkg/testutil"
+	"github.com/taemon1337/ec-manager/pkg/trust"
 	ectypes "github.com/taemon1337/ec-manager/pkg/types"
 )
 
@@ -131,3 +134,55 @@ func TestCheckCredentialsCmd(t *testing.T) {
 
 	testutil.RunCommandTest(t, NewCheckCredentialsCmd, tests)
 }
+
+func TestDiscoverRoles(t *testing.T) {
+	trustAccount := url.QueryEscape(`{"Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::123456789012:root"},"Action":"sts:AssumeRole"}]}`)
+	trustService := url.QueryEscape(`{"Statement":[{"Effect":"Allow","Principal":{"Service":"ec2.amazonaws.com"},"Action":"sts:AssumeRole"}]}`)
+	trustMFA := url.QueryEscape(`{"Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::123456789012:user/test-user"},"Action":"sts:AssumeRole","Condition":{"Bool":{"aws:MultiFactorAuthPresent":"true"}}}]}`)
+
+	mockIAMClient := mockclient.NewMockIAMClient(t)
+	mockIAMClient.On("ListRoles", mock.Anything, mock.MatchedBy(func(input *iam.ListRolesInput) bool {
+		return input.Marker == nil
+	}), mock.Anything).Return(&iam.ListRolesOutput{
+		Roles: []iamtypes.Role{
+			{Arn: aws.String("arn:aws:iam::123456789012:role/admin"), AssumeRolePolicyDocument: aws.String(trustAccount)},
+			{Arn: aws.String("arn:aws:iam::123456789012:role/ec2"), AssumeRolePolicyDocument: aws.String(trustService)},
+		},
+		IsTruncated: true,
+		Marker:      aws.String("page-2"),
+	}, nil).Once()
+	mockIAMClient.On("ListRoles", mock.Anything, mock.MatchedBy(func(input *iam.ListRolesInput) bool {
+		return aws.ToString(input.Marker) == "page-2"
+	}), mock.Anything).Return(&iam.ListRolesOutput{
+		Roles: []iamtypes.Role{
+			{Arn: aws.String("arn:aws:iam::123456789012:role/secure"), AssumeRolePolicyDocument: aws.String(trustMFA)},
+		},
+	}, nil).Once()
+
+	caller := trust.Caller{
+		Account: "123456789012",
+		ARN:     "arn:aws:iam::123456789012:user/test-user",
+	}
+	roles, err := discoverRoles(context.Background(), mockIAMClient, caller)
+	assert.NoError(t, err)
+	if assert.Len(t, roles, 3) {
+		assert.Equal(t, trust.Allowed, roles[0].Decision)
+		assert.Equal(t, trust.Denied, roles[1].Decision)
+		assert.Equal(t, trust.RequiresMFA, roles[2].Decision)
+		assert.Equal(t, "arn:aws:iam::123456789012:role/secure", roles[2].ARN)
+	}
+
+	mockIAMClient.AssertExpectations(t)
+}
+
+func TestCheckCredentialsProfileFlags(t *testing.T) {
+	// --profile is the root flag selecting the profile to use, so it must not
+	// be shadowed by the profile credentials are saved to
+	assert.Nil(t, checkCredentialsCmd.Flags().Lookup("profile"))
+
+	saveFlag := checkCredentialsCmd.Flags().Lookup("save-profile")
+	if assert.NotNil(t, saveFlag) {
+		assert.Equal(t, "p", saveFlag.Shorthand)
+		assert.Equal(t, "default", saveFlag.DefValue)
+	}
+}
@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/spf13/cobra"
+	"github.com/taemon1337/ec-manager/pkg/ami"
+	"github.com/taemon1337/ec-manager/pkg/spec"
+)
+
+// Statuses of an instance in a drift report
+const (
+	driftInSync     = "in-sync"
+	driftDrifted    = "drifted"
+	driftMissing    = "missing"
+	driftUnrecorded = "unrecorded"
+)
+
+// instanceDrift is the drift check result for one instance
+type instanceDrift struct {
+	InstanceID string      `json:"instanceId,omitempty"`
+	Name       string      `json:"name,omitempty"`
+	Status     string      `json:"status"`
+	Drift      []ami.Drift `json:"drift,omitempty"`
+}
+
+// liveStateFilter selects the instances check drift looks at without a
+// selection
+const liveStateFilter = "state=pending,running,stopping,stopped"
+
+// NewCheckDriftCmd creates the check drift command
+func NewCheckDriftCmd() *cobra.Command {
+	var specFile string
+	var selection instanceSelection
+
+	cmd := &cobra.Command{
+		Use:   "drift [INSTANCE...]",
+		Short: "Check instances for changes made outside ec-manager",
+		Long: `Check whether instances still match their declared configuration, reporting
+each drifted attribute.
+
+With -f the instances of a spec file, as used by apply, are compared with it:
+their AMI, type, subnet, key, security groups and tags. Otherwise instances are
+compared with the configuration create, apply and migrate record in
+ec-manager:launch-* tags when they launch: their type, security groups and tags.
+Tags are compared by digest, so a changed tag is reported without naming it.
+Instances launched without a record, such as from a launch template or by
+other tools, are reported as unrecorded.
+
+Without instance arguments, --filter or --name every live instance is checked.
+The command exits with an error when any instance drifted or is missing, so it
+can gate CI jobs.`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+			amiService := amiServiceFor(ctx)
+
+			var report []instanceDrift
+			if specFile != "" {
+				sel := selection.selector(args, "")
+				if !sel.IsEmpty() {
+					return fmt.Errorf("instances cannot be selected with a spec file, which selects its own")
+				}
+				file, err := spec.Load(specFile, spec.Defaults{
+					Type:   activeContext.InstanceType,
+					Subnet: activeContext.Subnet,
+					Key:    activeContext.KeyName,
+					Tags:   activeContext.Tags,
+				})
+				if err != nil {
+					return err
+				}
+				changes, err := spec.Diff(ctx, amiService, file)
+				if err != nil {
+					return err
+				}
+				report = specDrift(changes)
+			} else {
+				sel := selection.selector(args, "")
+				if sel.IsEmpty() {
+					sel.Filters = []string{liveStateFilter}
+				}
+				instances, err := amiService.SelectInstances(ctx, sel)
+				if err != nil {
+					return fmt.Errorf("failed to select instances: %w", err)
+				}
+				report = launchDrift(instances)
+			}
+
+			out := cmd.OutOrStdout()
+			if outputJSON() {
+				data, err := json.MarshalIndent(report, "", "  ")
+				if err != nil {
+					return fmt.Errorf("failed to encode JSON output: %w", err)
+				}
+				fmt.Fprintln(out, string(data))
+			} else if err := printDriftReport(out, report); err != nil {
+				return err
+			}
+
+			failed := 0
+			for _, r := range report {
+				if r.Status == driftDrifted || r.Status == driftMissing {
+					failed++
+				}
+			}
+			if failed > 0 {
+				return fmt.Errorf("%d of %d instance(s) drifted or missing", failed, len(report))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&specFile, "file", "f", "", "Compare with this spec file instead of the launch records, or - for standard input")
+	addSelectionFlags(cmd, &selection)
+
+	return cmd
+}
+
+// specDrift reports the drift of the instances of a spec from their changes
+func specDrift(changes []spec.Change) []instanceDrift {
+	report := make([]instanceDrift, len(changes))
+	for i, c := range changes {
+		r := instanceDrift{InstanceID: c.InstanceID, Name: c.Name, Status: driftInSync, Drift: c.Drift}
+		switch {
+		case c.Action == spec.ActionCreate:
+			r.Status = driftMissing
+		case len(c.Drift) > 0:
+			r.Status = driftDrifted
+		}
+		report[i] = r
+	}
+	return report
+}
+
+// launchDrift reports the drift of instances from their launch records
+func launchDrift(instances []ec2types.Instance) []instanceDrift {
+	report := make([]instanceDrift, len(instances))
+	for i, instance := range instances {
+		r := instanceDrift{InstanceID: aws.ToString(instance.InstanceId), Status: driftInSync}
+		for _, tag := range instance.Tags {
+			if aws.ToString(tag.Key) == "Name" {
+				r.Name = aws.ToString(tag.Value)
+			}
+		}
+		switch {
+		case !ami.HasLaunchRecord(instance):
+			r.Status = driftUnrecorded
+		default:
+			r.Drift = ami.LaunchDrift(instance)
+			if len(r.Drift) > 0 {
+				r.Status = driftDrifted
+			}
+		}
+		report[i] = r
+	}
+	return report
+}
+
+// printDriftReport prints one row per drifted attribute, and one for each
+// instance that is missing or has no launch record
+func printDriftReport(w io.Writer, report []instanceDrift) error {
+	counts := map[string]int{}
+	for _, r := range report {
+		counts[r.Status]++
+	}
+	if counts[driftDrifted]+counts[driftMissing]+counts[driftUnrecorded] == 0 {
+		fmt.Fprintf(w, "No drift found in %d instance(s)\n", len(report))
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "INSTANCE\tNAME\tSTATUS\tATTRIBUTE\tEXPECTED\tACTUAL")
+	for _, r := range report {
+		id := r.InstanceID
+		if id == "" {
+			id = "-"
+		}
+		switch r.Status {
+		case driftMissing, driftUnrecorded:
+			fmt.Fprintf(tw, "%s\t%s\t%s\t-\t-\t-\n", id, r.Name, r.Status)
+		case driftDrifted:
+			for _, d := range r.Drift {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", id, r.Name, r.Status, d.Attribute, orNone(d.Expected), orNone(d.Actual))
+			}
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "%d drifted, %d missing, %d unrecorded, %d in sync\n",
+		counts[driftDrifted], counts[driftMissing], counts[driftUnrecorded], counts[driftInSync])
+	return nil
+}
+
+// orNone shows an empty value as (none)
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+	return s
+}
+
+func init() {
+	checkCmd.AddCommand(NewCheckDriftCmd())
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/taemon1337/ec-manager/pkg/ami"
+	"github.com/taemon1337/ec-manager/pkg/spec"
+)
+
+func TestSpecDrift(t *testing.T) {
+	changes := []spec.Change{
+		{Action: spec.ActionCreate, Name: "new"},
+		{Action: spec.ActionNone, Name: "same", InstanceID: "i-1"},
+		{Action: spec.ActionNone, Name: "moved", InstanceID: "i-2", Drift: []ami.Drift{{Attribute: "subnet", Expected: "subnet-1", Actual: "subnet-2"}}},
+	}
+
+	report := specDrift(changes)
+	require.Len(t, report, 3)
+	assert.Equal(t, driftMissing, report[0].Status)
+	assert.Equal(t, driftInSync, report[1].Status)
+	assert.Equal(t, driftDrifted, report[2].Status)
+
+	var out bytes.Buffer
+	require.NoError(t, printDriftReport(&out, report))
+	assert.Contains(t, out.String(), "-         new    missing")
+	assert.Contains(t, out.String(), "subnet     subnet-1  subnet-2")
+	assert.Contains(t, out.String(), "1 drifted, 1 missing, 0 unrecorded, 1 in sync")
+}
+
+func TestLaunchDriftReport(t *testing.T) {
+	instances := []ec2types.Instance{
+		{
+			InstanceId:   aws.String("i-1"),
+			InstanceType: "t3.large",
+			Tags: []ec2types.Tag{
+				{Key: aws.String("Name"), Value: aws.String("web-1")},
+				{Key: aws.String(ami.LaunchTypeTag), Value: aws.String("t3.micro")},
+			},
+		},
+		{InstanceId: aws.String("i-2"), InstanceType: "t3.micro"},
+	}
+
+	report := launchDrift(instances)
+	assert.Equal(t, []instanceDrift{
+		{InstanceID: "i-1", Name: "web-1", Status: driftDrifted, Drift: []ami.Drift{{Attribute: "type", Expected: "t3.micro", Actual: "t3.large"}}},
+		{InstanceID: "i-2", Status: driftUnrecorded},
+	}, report)
+
+	var out bytes.Buffer
+	require.NoError(t, printDriftReport(&out, []instanceDrift{{InstanceID: "i-3", Status: driftInSync}}))
+	assert.Equal(t, "No drift found in 1 instance(s)\n", out.String())
+}
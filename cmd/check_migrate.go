@@ -1,8 +1,11 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/spf13/cobra"
 	"github.com/taemon1337/ec-manager/pkg/ami"
 	"github.com/taemon1337/ec-manager/pkg/client"
@@ -12,74 +15,79 @@ import (
 // NewCheckMigrateCmd creates a new check migrate command
 func NewCheckMigrateCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "migrate",
-		Short: "Check instances that need migration",
-		Long:  "Check and list EC2 instances that need to be migrated",
+		Use:         "migrate",
+		Short:       "Check instances that need migration",
+		Long:        "Check and list EC2 instances that need to be migrated",
+		Annotations: map[string]string{runsInAccounts: "true", runsInRegions: "true"},
 		RunE: func(cmd *cobra.Command, args []string) error {
-			ctx := cmd.Context()
-			ec2Client, ok := ctx.Value(types.EC2ClientKey).(types.EC2Client)
-			if !ok {
-				if awsClient == nil {
-					var err error
-					awsClient, err = client.NewClient(false, "us-east-1", "default")
-					if err != nil {
-						return fmt.Errorf("failed to create AWS client: %w", err)
-					}
-				}
-				ec2Client = awsClient.GetEC2Client()
-			}
-			amiService := ami.NewService(ec2Client)
-
 			instanceID, _ := cmd.Flags().GetString("check-instance-id")
 			targetAMI, _ := cmd.Flags().GetString("check-target-ami")
 
-			if instanceID != "" {
-				instance, err := amiService.DescribeInstance(ctx, instanceID)
-				if err != nil {
-					return fmt.Errorf("failed to describe instance: %w", err)
-				}
-				if instance == nil {
-					return fmt.Errorf("instance not found: %s", instanceID)
+			if instanceID == "" {
+				fmt.Println("Instances that need migration:")
+			}
+
+			return forEachRegion(cmd, func(ctx context.Context, account accountTarget, emit func(v interface{}) error) error {
+				ec2Client, ok := ctx.Value(types.EC2ClientKey).(types.EC2Client)
+				if !ok {
+					if awsClient == nil {
+						var err error
+						awsClient, err = client.NewClient(false, "us-east-1", "default")
+						if err != nil {
+							return fmt.Errorf("failed to create AWS client: %w", err)
+						}
+					}
+					ec2Client = awsClient.GetEC2Client()
 				}
+				amiService := ami.NewService(ec2Client, serviceOptions(ctx)...)
 
-				if targetAMI != "" {
-					images, err := amiService.DescribeImages(ctx, []string{targetAMI})
+				if instanceID != "" {
+					instance, err := amiService.DescribeInstance(ctx, instanceID)
 					if err != nil {
-						return fmt.Errorf("failed to describe AMI: %w", err)
+						return fmt.Errorf("failed to describe instance: %w", err)
 					}
-					if len(images.Images) == 0 {
-						return fmt.Errorf("AMI not found: %s", targetAMI)
+					if instance == nil {
+						return fmt.Errorf("instance not found: %s", instanceID)
 					}
-				}
 
-				fmt.Printf("Instance ID: %s\n", *instance.InstanceId)
-				fmt.Printf("  State: %s\n", instance.State.Name)
-				fmt.Printf("  Instance Type: %s\n", instance.InstanceType)
-				fmt.Printf("  Launch Time: %s\n", instance.LaunchTime)
-				return nil
-			}
+					if targetAMI != "" {
+						images, err := amiService.DescribeImages(ctx, []string{targetAMI})
+						if err != nil {
+							return fmt.Errorf("failed to describe AMI: %w", err)
+						}
+						if len(images.Images) == 0 {
+							return fmt.Errorf("AMI not found: %s", targetAMI)
+						}
+					}
 
-			output, err := amiService.DescribeInstances(ctx)
-			if err != nil {
-				return fmt.Errorf("failed to list instances: %w", err)
-			}
+					return emit(*instance)
+				}
 
-			fmt.Println("Instances that need migration:")
-			for _, reservation := range output.Reservations {
-				for _, instance := range reservation.Instances {
+				err := amiService.EachInstance(ctx, &ec2.DescribeInstancesInput{}, func(instance ec2types.Instance) error {
 					for _, tag := range instance.Tags {
 						if *tag.Key == "ami-migrate" && *tag.Value == "enabled" {
-							fmt.Printf("Instance ID: %s\n", *instance.InstanceId)
-							fmt.Printf("  State: %s\n", instance.State.Name)
-							fmt.Printf("  Instance Type: %s\n", instance.InstanceType)
-							fmt.Printf("  Launch Time: %s\n", instance.LaunchTime)
-							fmt.Println()
+							return emit(instance)
 						}
 					}
+					return nil
+				})
+				if err != nil {
+					return fmt.Errorf("failed to list instances: %w", err)
 				}
-			}
 
-			return nil
+				return nil
+			}, func(account accountTarget, v interface{}) error {
+				instance := v.(ec2types.Instance)
+				fmt.Printf("Instance ID: %s\n", *instance.InstanceId)
+				printAccount(account)
+				fmt.Printf("  State: %s\n", instance.State.Name)
+				fmt.Printf("  Instance Type: %s\n", instance.InstanceType)
+				fmt.Printf("  Launch Time: %s\n", instance.LaunchTime)
+				if instanceID == "" {
+					fmt.Println()
+				}
+				return nil
+			})
 		},
 	}
 
@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/spf13/cobra"
+	"github.com/taemon1337/ec-manager/pkg/permissions"
+	"github.com/taemon1337/ec-manager/pkg/types"
+)
+
+// commandPermissions is the permission check result for one command
+type commandPermissions struct {
+	Account string               `json:"account,omitempty"`
+	Command string               `json:"command"`
+	Status  permissions.Status   `json:"status"`
+	Actions []permissions.Result `json:"actions"`
+}
+
+// NewCheckPermissionsCmd creates the check permissions command
+func NewCheckPermissionsCmd() *cobra.Command {
+	var noSimulate bool
+
+	cmd := &cobra.Command{
+		Use:   "permissions [command]",
+		Short: "Check the identity can perform the actions each command needs",
+		Long: `Check whether the current identity can perform every AWS action an ec-manager
+command needs, before running it for real. Without a command every command is
+checked, for example:
+
+  ec-manager check permissions
+  ec-manager check permissions migrate
+  ec-manager check permissions list instances
+
+EC2 actions are sent with DryRun set, and all actions are checked with the IAM
+policy simulator for the calling user or role, which needs
+iam:SimulatePrincipalPolicy (and iam:GetRole for assumed roles). An action
+fails when either check denies it. The command exits with an error when any
+action fails, so it can gate CI jobs.`,
+		Annotations:  map[string]string{runsInAccounts: "true"},
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			names := permissions.CommandNames()
+			if len(args) > 0 {
+				name := strings.Join(args, " ")
+				if _, ok := permissions.Commands[name]; !ok {
+					return fmt.Errorf("unknown command %q, expected one of: %s", name, strings.Join(names, ", "))
+				}
+				names = []string{name}
+			}
+
+			var report []commandPermissions
+			err := forEachAccount(cmd, func(ctx context.Context, account accountTarget) error {
+				results, identity, err := checkPermissions(ctx, names, noSimulate)
+				if err != nil {
+					return err
+				}
+
+				accountReport := permissionReport(account.ID, names, results)
+				report = append(report, accountReport...)
+				if !outputJSON() {
+					printAccountHeader(account)
+					printPermissionMatrix(cmd, identity, accountReport)
+				}
+
+				var failed []string
+				for _, c := range accountReport {
+					if c.Status == permissions.Fail {
+						failed = append(failed, c.Command)
+					}
+				}
+				if len(failed) > 0 {
+					return fmt.Errorf("missing permissions for: %s", strings.Join(failed, ", "))
+				}
+				return nil
+			})
+
+			if outputJSON() {
+				data, jsonErr := json.MarshalIndent(report, "", "  ")
+				if jsonErr != nil {
+					return fmt.Errorf("failed to encode JSON output: %w", jsonErr)
+				}
+				fmt.Fprintln(cmd.OutOrStdout(), string(data))
+			}
+			return err
+		},
+	}
+
+	cmd.Flags().BoolVar(&noSimulate, "no-simulate", false, "Only use EC2 DryRun checks, without IAM policy simulation")
+
+	return cmd
+}
+
+// checkPermissions checks every action the named commands need with the
+// clients in ctx, returning the results and the identity checked
+func checkPermissions(ctx context.Context, names []string, noSimulate bool) ([]permissions.Result, string, error) {
+	ec2Client := ec2ClientFor(ctx)
+	stsClient, stsOK := ctx.Value(types.STSClientKey).(types.STSClient)
+	iamClient, iamOK := ctx.Value(types.IAMClientKey).(types.IAMClient)
+	if !stsOK || !iamOK {
+		cfg, err := loadConfig(ctx)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to load AWS config: %w", err)
+		}
+		if !stsOK {
+			stsClient = sts.NewFromConfig(cfg)
+		}
+		if !iamOK {
+			iamClient = iam.NewFromConfig(cfg)
+		}
+	}
+
+	identity, err := stsClient.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get caller identity: %w", err)
+	}
+
+	// Check each action once, however many commands need it
+	var actions []string
+	seen := map[string]bool{}
+	for _, name := range names {
+		for _, action := range permissions.Commands[name] {
+			if !seen[action] {
+				seen[action] = true
+				actions = append(actions, action)
+			}
+		}
+	}
+
+	var simulator permissions.IAMAPI = iamClient
+	if noSimulate {
+		simulator = nil
+	}
+	checker := permissions.NewChecker(ec2Client, simulator, aws.ToString(identity.Arn))
+	results, err := checker.Check(ctx, actions)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to check permissions: %w", err)
+	}
+	return results, aws.ToString(identity.Arn), nil
+}
+
+// permissionReport groups action results by command. A command fails when
+// any of its actions fails, and is unknown when none fails but some could
+// not be checked.
+func permissionReport(account string, names []string, results []permissions.Result) []commandPermissions {
+	byAction := make(map[string]permissions.Result, len(results))
+	for _, r := range results {
+		byAction[r.Action] = r
+	}
+
+	report := make([]commandPermissions, len(names))
+	for i, name := range names {
+		report[i] = commandPermissions{Account: account, Command: name, Status: permissions.Pass}
+		for _, action := range permissions.Commands[name] {
+			r := byAction[action]
+			report[i].Actions = append(report[i].Actions, r)
+			if r.Status == permissions.Fail {
+				report[i].Status = permissions.Fail
+			} else if r.Status == permissions.Unknown && report[i].Status == permissions.Pass {
+				report[i].Status = permissions.Unknown
+			}
+		}
+	}
+	return report
+}
+
+// printPermissionMatrix prints one row per command and action, followed by
+// the details of every action that did not pass
+func printPermissionMatrix(cmd *cobra.Command, identity string, report []commandPermissions) {
+	out := cmd.OutOrStdout()
+	fmt.Fprintf(out, "Identity: %s\n\n", identity)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "COMMAND\tACTION\tDRY-RUN\tSIMULATION\tRESULT")
+	for _, c := range report {
+		for _, r := range c.Actions {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", c.Command, r.Action, r.DryRun, r.Simulation, r.Status)
+		}
+	}
+	w.Flush()
+
+	printed := map[string]bool{}
+	for _, c := range report {
+		for _, r := range c.Actions {
+			if r.Status == permissions.Pass || r.Detail == "" || printed[r.Action] {
+				continue
+			}
+			if len(printed) == 0 {
+				fmt.Fprintln(out, "\nDetails:")
+			}
+			printed[r.Action] = true
+			fmt.Fprintf(out, "  %s: %s\n", r.Action, r.Detail)
+		}
+	}
+
+	fmt.Fprintln(out)
+	for _, c := range report {
+		fmt.Fprintf(out, "%-20s %s\n", c.Command, strings.ToUpper(string(c.Status)))
+	}
+}
+
+func init() {
+	checkCmd.AddCommand(NewCheckPermissionsCmd())
+}
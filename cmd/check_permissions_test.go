@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	mockclient "github.com/taemon1337/ec-manager/pkg/mock"
+	ectypes "github.com/taemon1337/ec-manager/pkg/types"
+)
+
+func TestCheckPermissionsCmd(t *testing.T) {
+	tests := []struct {
+		name        string
+		args        []string
+		dryRunCode  string
+		decision    iamtypes.PolicyEvaluationDecisionType
+		wantErr     string
+		wantOutput  []string
+		noAWSCalled bool
+	}{
+		{
+			name:       "pass",
+			args:       []string{"list", "instances"},
+			dryRunCode: "DryRunOperation",
+			decision:   iamtypes.PolicyEvaluationDecisionTypeAllowed,
+			wantOutput: []string{"Identity: arn:aws:iam::123456789012:user/ci", "list instances  ec2:DescribeInstances  pass     pass        pass", "PASS"},
+		},
+		{
+			name:       "denied by dry run",
+			args:       []string{"list", "instances"},
+			dryRunCode: "UnauthorizedOperation",
+			decision:   iamtypes.PolicyEvaluationDecisionTypeAllowed,
+			wantErr:    "missing permissions for: list instances",
+			wantOutput: []string{"ec2:DescribeInstances: dry run: UnauthorizedOperation", "FAIL"},
+		},
+		{
+			name:        "unknown command",
+			args:        []string{"launch"},
+			wantErr:     `unknown command "launch"`,
+			noAWSCalled: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockEC2Client := mockclient.NewMockEC2Client(t)
+			mockSTSClient := mockclient.NewMockSTSClient(t)
+			mockIAMClient := mockclient.NewMockIAMClient(t)
+
+			if !tt.noAWSCalled {
+				mockSTSClient.On("GetCallerIdentity", mock.Anything, mock.Anything, mock.Anything).Return(&sts.GetCallerIdentityOutput{
+					Account: aws.String("123456789012"),
+					Arn:     aws.String("arn:aws:iam::123456789012:user/ci"),
+				}, nil)
+				mockEC2Client.On("DescribeInstances", mock.Anything, mock.Anything).
+					Return(nil, &smithy.GenericAPIError{Code: tt.dryRunCode})
+				mockIAMClient.On("SimulatePrincipalPolicy", mock.Anything, mock.Anything, mock.Anything).Return(&iam.SimulatePrincipalPolicyOutput{
+					EvaluationResults: []iamtypes.EvaluationResult{
+						{EvalActionName: aws.String("ec2:DescribeInstances"), EvalDecision: tt.decision},
+					},
+				}, nil)
+			}
+
+			ctx := context.WithValue(context.Background(), ectypes.EC2ClientKey, mockEC2Client)
+			ctx = context.WithValue(ctx, ectypes.STSClientKey, mockSTSClient)
+			ctx = context.WithValue(ctx, ectypes.IAMClientKey, mockIAMClient)
+
+			var out bytes.Buffer
+			cmd := NewCheckPermissionsCmd()
+			cmd.SetContext(ctx)
+			cmd.SetOut(&out)
+			cmd.SetErr(&out)
+			cmd.SetArgs(tt.args)
+
+			err := cmd.Execute()
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			for _, want := range tt.wantOutput {
+				assert.Contains(t, out.String(), want)
+			}
+
+			mockEC2Client.AssertExpectations(t)
+			mockSTSClient.AssertExpectations(t)
+			mockIAMClient.AssertExpectations(t)
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/taemon1337/ec-manager/pkg/ami"
+	"github.com/taemon1337/ec-manager/pkg/rightsize"
+	"github.com/taemon1337/ec-manager/pkg/types"
+)
+
+// runningStateFilter selects the instances check rightsize looks at without
+// a selection, as only running instances report utilization
+const runningStateFilter = "state=running"
+
+// NewCheckRightsizeCmd creates the check rightsize command
+func NewCheckRightsizeCmd() *cobra.Command {
+	var selection instanceSelection
+	var days int
+	var opts rightsize.Options
+	var migrate, yes bool
+
+	cmd := &cobra.Command{
+		Use:   "rightsize [INSTANCE...]",
+		Short: "Recommend instance types from CPU and network utilization",
+		Long: `Recommend smaller or newer-generation instance types from the CloudWatch CPU
+and network utilization of instances over the last --days days.
+
+A recommended type keeps the instance's architecture and family features, such
+as local storage, has enough vCPUs to run the peak CPU load at --target-cpu
+percent, enough bandwidth for the peak network load, and at least half the
+memory of the current type, as CloudWatch does not report memory use.
+
+With --migrate each recommended instance is migrated to its recommended type on
+its current AMI, after confirmation unless --yes is given. Without instance
+arguments, --filter or --name every running instance is checked.`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if days <= 0 {
+				return fmt.Errorf("invalid --days %d, expected a positive number of days", days)
+			}
+			if err := opts.Validate(); err != nil {
+				return err
+			}
+
+			ctx := cmd.Context()
+			amiService := amiServiceFor(ctx)
+			sel := selection.selector(args, "")
+			if sel.IsEmpty() {
+				sel.Filters = []string{runningStateFilter}
+			}
+			instances, err := amiService.SelectInstances(ctx, sel)
+			if err != nil {
+				return fmt.Errorf("failed to select instances: %w", err)
+			}
+
+			recommender := rightsize.NewRecommender(amiService, metricsSourceFor(ctx), opts)
+			end := time.Now()
+			start := end.AddDate(0, 0, -days)
+
+			report := make([]rightsize.Recommendation, 0, len(instances))
+			for _, instance := range instances {
+				rec, err := recommender.Recommend(ctx, instance, start, end)
+				if err != nil {
+					return err
+				}
+				report = append(report, rec)
+			}
+
+			out := cmd.OutOrStdout()
+			if outputJSON() {
+				data, err := json.MarshalIndent(report, "", "  ")
+				if err != nil {
+					return fmt.Errorf("failed to encode JSON output: %w", err)
+				}
+				fmt.Fprintln(out, string(data))
+			} else if err := printRightsizeReport(out, report, migrate); err != nil {
+				return err
+			}
+
+			if migrate {
+				return migrateRecommended(ctx, cmd, amiService, report, yes)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().IntVar(&days, "days", 14, "Number of days of utilization to look at")
+	cmd.Flags().Float64Var(&opts.TargetCPU, "target-cpu", rightsize.DefaultTargetCPU, "Peak CPU utilization percentage recommended types should run at")
+	cmd.Flags().BoolVar(&migrate, "migrate", false, "Migrate instances to their recommended types")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Migrate without asking for confirmation")
+	addSelectionFlags(cmd, &selection)
+
+	return cmd
+}
+
+// metricsSourceFor returns the utilization metrics source for ctx: the
+// CloudWatch client in ctx, or the root client's, which is a mock in mock
+// mode
+func metricsSourceFor(ctx context.Context) rightsize.MetricsSource {
+	if cw, ok := ctx.Value(types.CloudWatchClientKey).(types.CloudWatchClient); ok {
+		return rightsize.NewCloudWatchSource(cw)
+	}
+	return rightsize.NewCloudWatchSource(awsClient.GetCloudWatchClient())
+}
+
+// printRightsizeReport prints one row per instance, followed by the migrate
+// commands that apply the recommendations unless they are about to be run
+func printRightsizeReport(w io.Writer, report []rightsize.Recommendation, migrating bool) error {
+	if len(report) == 0 {
+		fmt.Fprintln(w, "No instances match the selection")
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "INSTANCE\tNAME\tTYPE\tCPU AVG\tCPU MAX\tNETWORK PEAK\tRECOMMENDED\tREASON")
+	var recommended []rightsize.Recommendation
+	for _, r := range report {
+		cpuAvg, cpuMax, network := "-", "-", "-"
+		if r.Utilization.HasData() {
+			cpuAvg = fmt.Sprintf("%.1f%%", r.Utilization.CPUAverage)
+			cpuMax = fmt.Sprintf("%.1f%%", r.Utilization.CPUMax)
+			network = formatBandwidth(r.Utilization.NetworkPeakBytes)
+		}
+		target := r.RecommendedType
+		if target == "" {
+			target = "(keep)"
+		} else {
+			recommended = append(recommended, r)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.InstanceID, r.Name, r.CurrentType, cpuAvg, cpuMax, network, target, r.Reason)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "%d of %d instance(s) can change type\n", len(recommended), len(report))
+	if len(recommended) > 0 && !migrating {
+		fmt.Fprintln(w, "\nTo migrate them:")
+		for _, r := range recommended {
+			fmt.Fprintf(w, "  ec-manager migrate %s --new-ami %s --type %s\n", r.InstanceID, r.ImageID, r.RecommendedType)
+		}
+	}
+	return nil
+}
+
+// formatBandwidth formats bytes per second as bits per second
+func formatBandwidth(bytesPerSec float64) string {
+	bits := bytesPerSec * 8
+	switch {
+	case bits >= 1e9:
+		return fmt.Sprintf("%.1f Gbps", bits/1e9)
+	case bits >= 1e6:
+		return fmt.Sprintf("%.1f Mbps", bits/1e6)
+	default:
+		return fmt.Sprintf("%.1f Kbps", bits/1e3)
+	}
+}
+
+// migrateRecommended migrates every instance with a recommendation to its
+// recommended type on its current AMI
+func migrateRecommended(ctx context.Context, cmd *cobra.Command, amiService *ami.Service, report []rightsize.Recommendation, yes bool) error {
+	prompt := newPrompter(cmd.InOrStdin(), cmd.OutOrStdout())
+	for _, r := range report {
+		if r.RecommendedType == "" {
+			continue
+		}
+		if !yes {
+			ok, err := prompt.confirm(fmt.Sprintf("Migrate %s from %s to %s?", r.InstanceID, r.CurrentType, r.RecommendedType))
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+		}
+		if err := migrateInstance(ctx, ec2ClientFor(ctx), amiService, r.InstanceID, r.ImageID, "", ami.WithInstanceType(r.RecommendedType)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func init() {
+	checkCmd.AddCommand(NewCheckRightsizeCmd())
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/taemon1337/ec-manager/pkg/rightsize"
+)
+
+func TestPrintRightsizeReport(t *testing.T) {
+	report := []rightsize.Recommendation{
+		{
+			InstanceID:      "i-1",
+			Name:            "web-1",
+			ImageID:         "ami-1",
+			CurrentType:     "m5.xlarge",
+			RecommendedType: "m6i.large",
+			Reason:          "newer generation",
+			Utilization:     rightsize.Utilization{CPUAverage: 4.25, CPUMax: 12, NetworkPeakBytes: 2.5e6, Datapoints: 24},
+		},
+		{InstanceID: "i-2", CurrentType: "t3.micro", Reason: "no utilization data"},
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, printRightsizeReport(&out, report, false))
+	assert.Contains(t, out.String(), "i-1       web-1  m5.xlarge  4.2%     12.0%    20.0 Mbps     m6i.large")
+	assert.Contains(t, out.String(), "i-2              t3.micro   -        -        -             (keep)")
+	assert.Contains(t, out.String(), "1 of 2 instance(s) can change type")
+	assert.Contains(t, out.String(), "ec-manager migrate i-1 --new-ami ami-1 --type m6i.large")
+
+	out.Reset()
+	require.NoError(t, printRightsizeReport(&out, report, true))
+	assert.NotContains(t, out.String(), "ec-manager migrate")
+
+	out.Reset()
+	require.NoError(t, printRightsizeReport(&out, nil, false))
+	assert.Equal(t, "No instances match the selection\n", out.String())
+}
@@ -0,0 +1,289 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/taemon1337/ec-manager/pkg/config"
+	"github.com/taemon1337/ec-manager/pkg/logger"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	viewResolved bool
+	newContext   config.Context
+	newAccount   config.Account
+)
+
+// configCmd manages the ec-manager configuration file
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage ec-manager configuration contexts",
+	Long: `Manage the ec-manager configuration file (~/.config/ec-manager/config.yaml).
+
+A context bundles the AWS profile, region, default subnet, key pair, instance
+type, tags applied to created instances, output format, the roles assumed for
+every command and the accounts commands can run in. Flags always win
+over the context, and ECMAN_PROFILE, ECMAN_REGION, ECMAN_SUBNET, ECMAN_KEY,
+ECMAN_INSTANCE_TYPE and ECMAN_OUTPUT override the context's values.`,
+	// Configuration commands never talk to AWS, so skip creating a client
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		logger.Init(logger.LogLevel(logLevel))
+		return nil
+	},
+}
+
+var configViewCmd = &cobra.Command{
+	Use:   "view",
+	Short: "Display the configuration file",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file, err := loadConfigFile()
+		if err != nil {
+			return err
+		}
+
+		var v interface{} = file
+		if viewResolved {
+			resolved, err := file.Resolve(contextName)
+			if err != nil {
+				return err
+			}
+			v = resolved
+		}
+
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("failed to encode config: %w", err)
+		}
+		fmt.Print(string(data))
+		return nil
+	},
+}
+
+var configUseContextCmd = &cobra.Command{
+	Use:   "use-context NAME",
+	Short: "Set the current context",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfigFile(func(file *config.File) error {
+			if err := file.UseContext(args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("Switched to context %q\n", args[0])
+			return nil
+		})
+	},
+}
+
+var configCurrentContextCmd = &cobra.Command{
+	Use:   "current-context",
+	Short: "Display the current context",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file, err := loadConfigFile()
+		if err != nil {
+			return err
+		}
+		if file.CurrentContext == "" {
+			return fmt.Errorf("current context is not set")
+		}
+		fmt.Println(file.CurrentContext)
+		return nil
+	},
+}
+
+var configGetContextsCmd = &cobra.Command{
+	Use:   "get-contexts",
+	Short: "List the configured contexts",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		file, err := loadConfigFile()
+		if err != nil {
+			return err
+		}
+
+		names := file.ContextNames()
+		if len(names) == 0 {
+			fmt.Println("No contexts configured")
+			return nil
+		}
+
+		for _, name := range names {
+			marker := " "
+			if name == file.CurrentContext {
+				marker = "*"
+			}
+			c := file.Contexts[name]
+			fmt.Printf("%s %s\n", marker, name)
+			fmt.Printf("    Profile: %s\n", c.Profile)
+			fmt.Printf("    Region: %s\n", c.Region)
+		}
+		return nil
+	},
+}
+
+var configSetContextCmd = &cobra.Command{
+	Use:   "set-context NAME",
+	Short: "Create or update a context",
+	Long: `Create or update a context. Only the flags given are changed, so an existing
+context can be updated one field at a time.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := config.ValidateOutput(newContext.Output); err != nil {
+			return err
+		}
+
+		return updateConfigFile(func(file *config.File) error {
+			c := &config.Context{}
+			if existing, ok := file.Contexts[args[0]]; ok {
+				c = existing
+			}
+
+			flags := cmd.Flags()
+			fields := map[string]*string{
+				"profile":       &c.Profile,
+				"region":        &c.Region,
+				"subnet":        &c.Subnet,
+				"key":           &c.KeyName,
+				"instance-type": &c.InstanceType,
+				"output":        &c.Output,
+				"external-id":   &c.ExternalID,
+				"mfa-serial":    &c.MFASerial,
+			}
+			values := map[string]string{
+				"profile":       newContext.Profile,
+				"region":        newContext.Region,
+				"subnet":        newContext.Subnet,
+				"key":           newContext.KeyName,
+				"instance-type": newContext.InstanceType,
+				"output":        newContext.Output,
+				"external-id":   newContext.ExternalID,
+				"mfa-serial":    newContext.MFASerial,
+			}
+			for name, field := range fields {
+				if flags.Changed(name) {
+					*field = values[name]
+				}
+			}
+			if flags.Changed("assume-role") {
+				c.AssumeRole = newContext.AssumeRole
+			}
+			if flags.Changed("tag") {
+				if c.Tags == nil {
+					c.Tags = map[string]string{}
+				}
+				for k, v := range newContext.Tags {
+					if v == "" {
+						delete(c.Tags, k)
+						continue
+					}
+					c.Tags[k] = v
+				}
+			}
+
+			file.SetContext(args[0], c)
+			if file.CurrentContext == "" {
+				file.CurrentContext = args[0]
+			}
+			fmt.Printf("Context %q saved\n", args[0])
+			return nil
+		})
+	},
+}
+
+var configSetAccountCmd = &cobra.Command{
+	Use:   "set-account CONTEXT ACCOUNT_ID",
+	Short: "Add or update an account commands can run in with --accounts",
+	Long: `Add or update an account of a context. Commands run in the account with
+--accounts NAME (or --accounts all) assume its role after the context's
+assume-role chain, e.g.:
+
+  ec-manager config set-context hub --profile main --assume-role arn:aws:iam::111111111111:role/hub
+  ec-manager config set-account hub 222222222222 --name prod --role ec-manager`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if newAccount.Role == "" {
+			return fmt.Errorf("--role is required")
+		}
+
+		return updateConfigFile(func(file *config.File) error {
+			c, ok := file.Contexts[args[0]]
+			if !ok {
+				return fmt.Errorf("context %q not found", args[0])
+			}
+
+			a := newAccount
+			a.ID = args[1]
+			c.SetAccount(a)
+			fmt.Printf("Account %s saved in context %q\n", a.Label(), args[0])
+			return nil
+		})
+	},
+}
+
+var configDeleteAccountCmd = &cobra.Command{
+	Use:   "delete-account CONTEXT ACCOUNT",
+	Short: "Remove an account, by ID or name, from a context",
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateConfigFile(func(file *config.File) error {
+			c, ok := file.Contexts[args[0]]
+			if !ok {
+				return fmt.Errorf("context %q not found", args[0])
+			}
+			if err := c.RemoveAccount(args[1]); err != nil {
+				return err
+			}
+			fmt.Printf("Account %s removed from context %q\n", args[1], args[0])
+			return nil
+		})
+	},
+}
+
+// updateConfigFile loads the configuration file, applies fn and saves it
+func updateConfigFile(fn func(*config.File) error) error {
+	path, err := configFilePath()
+	if err != nil {
+		return err
+	}
+
+	file, err := config.LoadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(file); err != nil {
+		return err
+	}
+
+	if err := file.Save(path); err != nil {
+		return err
+	}
+	logger.Debug("saved configuration", "path", path)
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configViewCmd, configUseContextCmd, configCurrentContextCmd,
+		configGetContextsCmd, configSetContextCmd, configSetAccountCmd, configDeleteAccountCmd)
+
+	configViewCmd.Flags().BoolVar(&viewResolved, "resolved", false, "Show the effective context after environment overrides")
+
+	configSetContextCmd.Flags().StringVar(&newContext.Profile, "profile", "", "AWS profile")
+	configSetContextCmd.Flags().StringVar(&newContext.Region, "region", "", "AWS region")
+	configSetContextCmd.Flags().StringVar(&newContext.Subnet, "subnet", "", "Default subnet ID for new instances")
+	configSetContextCmd.Flags().StringVar(&newContext.KeyName, "key", "", "Default SSH key name for new instances")
+	configSetContextCmd.Flags().StringVar(&newContext.InstanceType, "instance-type", "", "Default instance type for new instances")
+	configSetContextCmd.Flags().StringVar(&newContext.Output, "output", "", "Output format (text, json)")
+	configSetContextCmd.Flags().StringToStringVar(&newContext.Tags, "tag", nil, "Tags applied to created instances, e.g. Team=infra (an empty value removes a tag)")
+	configSetContextCmd.Flags().StringSliceVar(&newContext.AssumeRole, "assume-role", nil, "Role ARNs assumed in order for every command (empty to clear)")
+	configSetContextCmd.Flags().StringVar(&newContext.ExternalID, "external-id", "", "External ID passed when assuming the last role")
+	configSetContextCmd.Flags().StringVar(&newContext.MFASerial, "mfa-serial", "", "MFA device used when assuming the first role")
+
+	configSetAccountCmd.Flags().StringVar(&newAccount.Name, "name", "", "Short name used with --accounts")
+	configSetAccountCmd.Flags().StringVar(&newAccount.Role, "role", "", "Role name or ARN assumed in the account")
+	configSetAccountCmd.Flags().StringVar(&newAccount.ExternalID, "external-id", "", "External ID required by the account role")
+	configSetAccountCmd.Flags().StringVar(&newAccount.Region, "region", "", "Region used in the account (defaults to the command's region)")
+}
@@ -0,0 +1,410 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	awspricing "github.com/aws/aws-sdk-go-v2/service/pricing"
+	"github.com/spf13/cobra"
+	"github.com/taemon1337/ec-manager/pkg/ami"
+	"github.com/taemon1337/ec-manager/pkg/pricing"
+)
+
+// costPlan is a planned change whose cost is estimated: a new type, as with
+// resize or migrate --type, and a new purchase option, as with migrate
+// --spot or --on-demand
+type costPlan struct {
+	instanceType   string
+	purchaseOption string
+}
+
+// isEmpty reports whether the plan changes nothing
+func (p costPlan) isEmpty() bool {
+	return p.instanceType == "" && p.purchaseOption == ""
+}
+
+// instanceCost is the estimated monthly cost of one instance
+type instanceCost struct {
+	InstanceID     string  `json:"instanceId"`
+	Name           string  `json:"name,omitempty"`
+	State          string  `json:"state"`
+	InstanceType   string  `json:"instanceType"`
+	PurchaseOption string  `json:"purchaseOption"`
+	Monthly        float64 `json:"monthly"`
+	// The planned fields are set when a change is planned
+	PlannedType           string   `json:"plannedType,omitempty"`
+	PlannedPurchaseOption string   `json:"plannedPurchaseOption,omitempty"`
+	PlannedMonthly        *float64 `json:"plannedMonthly,omitempty"`
+	// Error and PlannedError explain a missing current or planned price
+	Error        string `json:"error,omitempty"`
+	PlannedError string `json:"plannedError,omitempty"`
+}
+
+// backupCost is the estimated monthly cost of snapshot storage
+type backupCost struct {
+	Snapshots int     `json:"snapshots"`
+	SizeGiB   int64   `json:"sizeGiB"`
+	Monthly   float64 `json:"monthly"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// costReport is the output of the cost command
+type costReport struct {
+	Region         string         `json:"region"`
+	Currency       string         `json:"currency"`
+	PricesUpdated  string         `json:"pricesUpdated"`
+	Instances      []instanceCost `json:"instances"`
+	Backups        *backupCost    `json:"backups,omitempty"`
+	Monthly        float64        `json:"monthly"`
+	PlannedMonthly *float64       `json:"plannedMonthly,omitempty"`
+}
+
+// NewCostCmd creates the cost command
+func NewCostCmd() *cobra.Command {
+	var selection instanceSelection
+	var plan costPlan
+	var noBackups bool
+
+	cmd := &cobra.Command{
+		Use:   "cost [INSTANCE...]",
+		Short: "Estimate the monthly cost of instances and backups",
+		Long: `Estimate the monthly cost of EC2 instances, by type, region and purchase
+option, and of the EBS snapshots that hold backups.
+
+Prices come from a table of Linux on-demand prices shipped with ec-manager,
+updated with 'cost refresh' from the AWS Pricing API. Spot capacity is estimated
+at a fixed fraction of the on-demand price, capped by the instance's Spot
+maximum price. Only pending and running instances are charged for compute.
+Snapshot storage is estimated from the sizes of the snapshotted volumes, an
+upper bound as snapshots only store changed blocks.
+
+--type and --purchase-option estimate a planned resize or migrate, showing
+each instance's cost before and after the change. Without instance arguments,
+--filter or --name every live instance is estimated.`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			switch plan.purchaseOption {
+			case "", ami.PurchaseOnDemand, ami.PurchaseSpot:
+			default:
+				return fmt.Errorf("invalid --purchase-option %q, expected %s or %s", plan.purchaseOption, ami.PurchaseOnDemand, ami.PurchaseSpot)
+			}
+
+			ctx := cmd.Context()
+			table, err := loadPrices()
+			if err != nil {
+				return err
+			}
+
+			amiService := amiServiceFor(ctx)
+			sel := selection.selector(args, "")
+			if sel.IsEmpty() {
+				sel.Filters = []string{liveStateFilter}
+			}
+			instances, err := amiService.SelectInstances(ctx, sel)
+			if err != nil {
+				return fmt.Errorf("failed to select instances: %w", err)
+			}
+
+			report := estimateCosts(table, costRegion(), instances, plan)
+			if !noBackups {
+				report.Backups = estimateBackups(ctx, amiService, table, report.Region)
+				report.Monthly += report.Backups.Monthly
+				if report.PlannedMonthly != nil {
+					*report.PlannedMonthly += report.Backups.Monthly
+				}
+			}
+
+			out := cmd.OutOrStdout()
+			if outputJSON() {
+				data, err := json.MarshalIndent(report, "", "  ")
+				if err != nil {
+					return fmt.Errorf("failed to encode JSON output: %w", err)
+				}
+				fmt.Fprintln(out, string(data))
+				return nil
+			}
+			return printCostReport(out, report)
+		},
+	}
+
+	cmd.Flags().StringVar(&plan.instanceType, "type", "", "Estimate changing the instances to this type")
+	cmd.Flags().StringVar(&plan.purchaseOption, "purchase-option", "", "Estimate changing the instances to this purchase option: on-demand or spot")
+	cmd.Flags().BoolVar(&noBackups, "no-backups", false, "Leave out snapshot storage")
+	addSelectionFlags(cmd, &selection)
+
+	cmd.AddCommand(newCostRefreshCmd())
+	return cmd
+}
+
+// newCostRefreshCmd creates the cost refresh command
+func newCostRefreshCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "refresh",
+		Short: "Update the price table from the AWS Pricing API",
+		Long: `Read the current Linux on-demand instance and snapshot storage prices of the
+region, or of the regions selected with --regions, from the AWS Pricing API.
+They are saved to ~/.cache/ec-manager/pricing.json, or ECMAN_PRICING, and used
+by cost instead of the shipped prices for those regions.`,
+		Annotations:  map[string]string{runsInRegions: "true"},
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if mockMode {
+				return fmt.Errorf("cost refresh needs the AWS Pricing API and is not available in mock mode")
+			}
+
+			ctx := cmd.Context()
+			regions := selectedRegions
+			if len(regions) == 0 {
+				regions = []string{costRegion()}
+			}
+
+			path, err := pricing.DefaultPath()
+			if err != nil {
+				return err
+			}
+			saved, err := pricing.LoadFile(path)
+			if err != nil {
+				return err
+			}
+			shipped, err := pricing.Default()
+			if err != nil {
+				return err
+			}
+			cfg, err := loadConfig(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to load AWS config: %w", err)
+			}
+			client := awspricing.NewFromConfig(cfg, func(o *awspricing.Options) {
+				o.Region = pricing.APIRegion
+			})
+			refreshed, err := pricing.Refresh(ctx, client, regions, shipped.SpotFactor)
+			if err != nil {
+				return err
+			}
+			saved.Merge(refreshed)
+			if err := saved.Save(path); err != nil {
+				return err
+			}
+			for _, region := range regions {
+				fmt.Fprintf(cmd.OutOrStdout(), "Updated %d instance prices for %s\n", len(refreshed.Regions[region].Instances), region)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Saved prices to %s\n", path)
+			return nil
+		},
+	}
+}
+
+// loadPrices returns the shipped price table with the refreshed prices
+func loadPrices() (*pricing.Table, error) {
+	path, err := pricing.DefaultPath()
+	if err != nil {
+		return nil, err
+	}
+	return pricing.Load(path)
+}
+
+// costRegion returns the region instances are priced in
+func costRegion() string {
+	if awsClient != nil && awsClient.Region() != "" {
+		return awsClient.Region()
+	}
+	return region
+}
+
+// estimateCosts estimates the monthly cost of instances in region, before
+// and after plan when it changes anything
+func estimateCosts(table *pricing.Table, region string, instances []ec2types.Instance, plan costPlan) costReport {
+	report := costReport{
+		Region:        region,
+		Currency:      table.Currency,
+		PricesUpdated: table.UpdatedFor(region),
+		Instances:     make([]instanceCost, 0, len(instances)),
+	}
+	var planned float64
+
+	for _, instance := range instances {
+		c := instanceCost{
+			InstanceID:     aws.ToString(instance.InstanceId),
+			InstanceType:   string(instance.InstanceType),
+			PurchaseOption: ami.PurchaseOnDemand,
+		}
+		for _, tag := range instance.Tags {
+			if aws.ToString(tag.Key) == "Name" {
+				c.Name = aws.ToString(tag.Value)
+			}
+		}
+		if instance.State != nil {
+			c.State = string(instance.State.Name)
+		}
+		spot := instance.InstanceLifecycle == ec2types.InstanceLifecycleTypeSpot
+		if spot {
+			c.PurchaseOption = ami.PurchaseSpot
+		}
+		maxPrice := spotMaxPrice(instance)
+		charged := c.State == string(ec2types.InstanceStateNamePending) || c.State == string(ec2types.InstanceStateNameRunning)
+
+		if charged {
+			var err error
+			if c.Monthly, err = table.InstanceMonthly(region, c.InstanceType, spot, maxPrice); err != nil {
+				c.Error = err.Error()
+			}
+		}
+
+		if !plan.isEmpty() {
+			c.PlannedType, c.PlannedPurchaseOption = c.InstanceType, c.PurchaseOption
+			if plan.instanceType != "" {
+				c.PlannedType = plan.instanceType
+			}
+			if plan.purchaseOption != "" {
+				c.PlannedPurchaseOption = plan.purchaseOption
+			}
+			var monthly float64
+			if charged {
+				var err error
+				if monthly, err = table.InstanceMonthly(region, c.PlannedType, c.PlannedPurchaseOption == ami.PurchaseSpot, maxPrice); err != nil {
+					c.PlannedError = err.Error()
+				}
+			}
+			c.PlannedMonthly = &monthly
+		}
+
+		// Instances without a price are left out of that total only
+		if c.Error == "" {
+			report.Monthly += c.Monthly
+		}
+		if c.PlannedMonthly != nil && c.PlannedError == "" {
+			planned += *c.PlannedMonthly
+		}
+		report.Instances = append(report.Instances, c)
+	}
+
+	if !plan.isEmpty() {
+		report.PlannedMonthly = &planned
+	}
+	return report
+}
+
+// spotMaxPrice returns the Spot maximum price recorded on the instance, or
+// zero when there is none
+func spotMaxPrice(instance ec2types.Instance) float64 {
+	for _, tag := range instance.Tags {
+		if aws.ToString(tag.Key) != ami.PurchaseOptionTag {
+			continue
+		}
+		spot, err := ami.ParsePurchaseOption(aws.ToString(tag.Value))
+		if err != nil || spot == nil {
+			return 0
+		}
+		price, _ := strconv.ParseFloat(spot.MaxPrice, 64)
+		return price
+	}
+	return 0
+}
+
+// estimateBackups estimates the monthly cost of the account's snapshots
+func estimateBackups(ctx context.Context, amiService *ami.Service, table *pricing.Table, region string) *backupCost {
+	b := &backupCost{}
+	err := amiService.EachSnapshot(ctx, &ec2.DescribeSnapshotsInput{OwnerIds: []string{"self"}}, func(s ec2types.Snapshot) error {
+		b.Snapshots++
+		b.SizeGiB += int64(aws.ToInt32(s.VolumeSize))
+		return nil
+	})
+	if err != nil {
+		b.Error = err.Error()
+		return b
+	}
+	if b.SizeGiB > 0 {
+		b.Monthly, err = table.SnapshotMonthly(region, b.SizeGiB)
+		if err != nil {
+			b.Error = err.Error()
+		}
+	}
+	return b
+}
+
+// printCostReport prints one row per instance, the snapshot storage and the
+// totals, with the planned costs and their difference when a change is
+// planned
+func printCostReport(w io.Writer, report costReport) error {
+	planned := report.PlannedMonthly != nil
+	fmt.Fprintf(w, "Estimated monthly cost in %s (%s, prices from %s)\n\n", report.Region, report.Currency, report.PricesUpdated)
+
+	var unpriced, plannedUnpriced int
+	if len(report.Instances) > 0 {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		header := "INSTANCE\tNAME\tSTATE\tTYPE\tPURCHASE\tMONTHLY"
+		if planned {
+			header += "\tPLANNED TYPE\tPLANNED PURCHASE\tPLANNED MONTHLY\tDELTA"
+		}
+		fmt.Fprintln(tw, header)
+		for _, c := range report.Instances {
+			monthly := formatCost(c.Monthly)
+			if c.Error != "" {
+				monthly = "?"
+				unpriced++
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s", c.InstanceID, c.Name, c.State, c.InstanceType, c.PurchaseOption, monthly)
+			if planned {
+				after, delta := "?", "?"
+				if c.PlannedError != "" {
+					plannedUnpriced++
+				} else {
+					after = formatCost(*c.PlannedMonthly)
+					if c.Error == "" {
+						delta = formatDelta(*c.PlannedMonthly - c.Monthly)
+					}
+				}
+				fmt.Fprintf(tw, "\t%s\t%s\t%s\t%s", c.PlannedType, c.PlannedPurchaseOption, after, delta)
+			}
+			fmt.Fprintln(tw)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		fmt.Fprintln(w)
+	}
+
+	if b := report.Backups; b != nil {
+		if b.Error != "" {
+			fmt.Fprintf(w, "Backup storage: %d snapshot(s), %d GiB, cost unknown: %s\n", b.Snapshots, b.SizeGiB, b.Error)
+		} else {
+			fmt.Fprintf(w, "Backup storage: %d snapshot(s), %d GiB, %s\n", b.Snapshots, b.SizeGiB, formatCost(b.Monthly))
+		}
+	}
+	fmt.Fprintf(w, "Total: %s/month", formatCost(report.Monthly))
+	if planned {
+		fmt.Fprintf(w, ", %s/month after the change (%s)", formatCost(*report.PlannedMonthly), formatDelta(*report.PlannedMonthly-report.Monthly))
+	}
+	fmt.Fprintln(w)
+	if unpriced > 0 {
+		fmt.Fprintf(w, "%d instance(s) have no price and are left out; run 'ec-manager cost refresh' to update the prices\n", unpriced)
+	}
+	if plannedUnpriced > 0 {
+		fmt.Fprintf(w, "%d instance(s) have no price after the change and are left out of the planned total\n", plannedUnpriced)
+	}
+	return nil
+}
+
+// formatCost formats a monthly cost in dollars
+func formatCost(cost float64) string {
+	return fmt.Sprintf("$%.2f", cost)
+}
+
+// formatDelta formats a change in cost with its sign
+func formatDelta(delta float64) string {
+	if delta < 0 {
+		return fmt.Sprintf("-$%.2f", -delta)
+	}
+	return fmt.Sprintf("+$%.2f", delta)
+}
+
+func init() {
+	rootCmd.AddCommand(NewCostCmd())
+}
@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/taemon1337/ec-manager/pkg/ami"
+	"github.com/taemon1337/ec-manager/pkg/pricing"
+)
+
+func costTable() *pricing.Table {
+	return &pricing.Table{
+		Updated:    "2024-03-01",
+		Currency:   "USD",
+		SpotFactor: 0.5,
+		Regions: map[string]pricing.RegionPrices{
+			"us-east-1": {
+				Instances:       map[string]float64{"t3.micro": 0.01, "m5.large": 0.1},
+				SnapshotGBMonth: 0.05,
+			},
+		},
+	}
+}
+
+func costInstance(id, instanceType string, state ec2types.InstanceStateName, tags ...ec2types.Tag) ec2types.Instance {
+	return ec2types.Instance{
+		InstanceId:   aws.String(id),
+		InstanceType: ec2types.InstanceType(instanceType),
+		State:        &ec2types.InstanceState{Name: state},
+		Tags:         tags,
+	}
+}
+
+func TestEstimateCosts(t *testing.T) {
+	spot := costInstance("i-spot", "m5.large", ec2types.InstanceStateNameRunning,
+		ec2types.Tag{Key: aws.String(ami.PurchaseOptionTag), Value: aws.String("spot,type=one-time,interruption=terminate,max-price=0.02")})
+	spot.InstanceLifecycle = ec2types.InstanceLifecycleTypeSpot
+
+	instances := []ec2types.Instance{
+		costInstance("i-web", "t3.micro", ec2types.InstanceStateNameRunning, ec2types.Tag{Key: aws.String("Name"), Value: aws.String("web")}),
+		costInstance("i-idle", "m5.large", ec2types.InstanceStateNameStopped),
+		spot,
+		costInstance("i-new", "x9.huge", ec2types.InstanceStateNameRunning),
+	}
+
+	tests := []struct {
+		name     string
+		plan     costPlan
+		monthly  []float64
+		planned  []float64
+		total    float64
+		totalNew *float64
+		// plannedError is expected for the first instance
+		plannedError string
+	}{
+		{
+			name:    "current",
+			monthly: []float64{7.3, 0, 14.6, 0},
+			total:   21.9,
+		},
+		{
+			name:     "resize",
+			plan:     costPlan{instanceType: "m5.large"},
+			monthly:  []float64{7.3, 0, 14.6, 0},
+			planned:  []float64{73, 0, 14.6, 73},
+			total:    21.9,
+			totalNew: aws.Float64(160.6),
+		},
+		{
+			name:         "unpriced planned type",
+			plan:         costPlan{instanceType: "x9.huge"},
+			monthly:      []float64{7.3, 0, 14.6, 0},
+			planned:      []float64{0, 0, 0, 0},
+			total:        21.9,
+			totalNew:     aws.Float64(0),
+			plannedError: "no price for x9.huge in us-east-1",
+		},
+		{
+			name:     "on-demand",
+			plan:     costPlan{purchaseOption: ami.PurchaseOnDemand},
+			monthly:  []float64{7.3, 0, 14.6, 0},
+			planned:  []float64{7.3, 0, 73, 0},
+			total:    21.9,
+			totalNew: aws.Float64(80.3),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := estimateCosts(costTable(), "us-east-1", instances, tt.plan)
+			require.Len(t, report.Instances, len(instances))
+
+			assert.Equal(t, "web", report.Instances[0].Name)
+			assert.Equal(t, ami.PurchaseSpot, report.Instances[2].PurchaseOption)
+			assert.Equal(t, "no price for x9.huge in us-east-1", report.Instances[3].Error)
+			// A missing planned price leaves the current cost alone
+			assert.Equal(t, tt.plannedError, report.Instances[0].PlannedError)
+			for i, c := range report.Instances {
+				assert.InDelta(t, tt.monthly[i], c.Monthly, 1e-9, c.InstanceID)
+				if tt.planned == nil {
+					assert.Nil(t, c.PlannedMonthly)
+				} else {
+					require.NotNil(t, c.PlannedMonthly)
+					assert.InDelta(t, tt.planned[i], *c.PlannedMonthly, 1e-9, c.InstanceID)
+				}
+			}
+
+			assert.InDelta(t, tt.total, report.Monthly, 1e-9)
+			if tt.totalNew == nil {
+				assert.Nil(t, report.PlannedMonthly)
+			} else {
+				require.NotNil(t, report.PlannedMonthly)
+				assert.InDelta(t, *tt.totalNew, *report.PlannedMonthly, 1e-9)
+			}
+		})
+	}
+}
+
+func TestPrintCostReport(t *testing.T) {
+	planned := 73.0
+	report := costReport{
+		Region:        "us-east-1",
+		Currency:      "USD",
+		PricesUpdated: "2024-03-01",
+		Instances: []instanceCost{
+			{InstanceID: "i-web", Name: "web", State: "running", InstanceType: "t3.micro", PurchaseOption: "on-demand", Monthly: 7.3,
+				PlannedType: "m5.large", PlannedPurchaseOption: "on-demand", PlannedMonthly: &planned},
+			{InstanceID: "i-new", State: "running", InstanceType: "x9.huge", PurchaseOption: "on-demand",
+				PlannedType: "m5.large", PlannedPurchaseOption: "on-demand", PlannedMonthly: &planned, Error: "no price for x9.huge in us-east-1"},
+			{InstanceID: "i-db", State: "running", InstanceType: "t3.micro", PurchaseOption: "on-demand", Monthly: 7.3,
+				PlannedType: "x9.huge", PlannedPurchaseOption: "on-demand", PlannedMonthly: new(float64), PlannedError: "no price for x9.huge in us-east-1"},
+		},
+		Backups:        &backupCost{Snapshots: 2, SizeGiB: 16, Monthly: 0.8},
+		Monthly:        15.4,
+		PlannedMonthly: aws.Float64(146.8),
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, printCostReport(&out, report))
+	assert.Contains(t, out.String(), "Estimated monthly cost in us-east-1 (USD, prices from 2024-03-01)")
+	assert.Contains(t, out.String(), "i-web     web   running  t3.micro  on-demand  $7.30    m5.large      on-demand         $73.00           +$65.70")
+	assert.Contains(t, out.String(), "i-new           running  x9.huge   on-demand  ?        m5.large      on-demand         $73.00           ?")
+	assert.Contains(t, out.String(), "i-db            running  t3.micro  on-demand  $7.30    x9.huge       on-demand         ?                ?")
+	assert.Contains(t, out.String(), "Backup storage: 2 snapshot(s), 16 GiB, $0.80")
+	assert.Contains(t, out.String(), "Total: $15.40/month, $146.80/month after the change (+$131.40)")
+	assert.Contains(t, out.String(), "1 instance(s) have no price and are left out")
+	assert.Contains(t, out.String(), "1 instance(s) have no price after the change and are left out of the planned total")
+
+	out.Reset()
+	report.Instances, report.PlannedMonthly = report.Instances[:1], nil
+	report.Backups = &backupCost{Error: "access denied"}
+	require.NoError(t, printCostReport(&out, report))
+	assert.NotContains(t, out.String(), "PLANNED")
+	assert.Contains(t, out.String(), "Backup storage: 0 snapshot(s), 0 GiB, cost unknown: access denied")
+	assert.Contains(t, out.String(), "Total: $15.40/month\n")
+}
+
+func TestFormatDelta(t *testing.T) {
+	assert.Equal(t, "+$1.50", formatDelta(1.5))
+	assert.Equal(t, "-$0.25", formatDelta(-0.25))
+	assert.Equal(t, "+$0.00", formatDelta(0))
+}
@@ -1,8 +1,9 @@
 package cmd
 
 import (
-	"context"
 	"fmt"
+	"os"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
@@ -12,28 +13,85 @@ import (
 )
 
 var (
-	imageID      string
-	instanceType string
-	keyName      string
-	subnetID     string
-	userData     string
-	useLatestAmi bool
+	imageID         string
+	instanceType    string
+	keyName         string
+	subnetID        string
+	instanceName    string
+	userDataFile    string
+	useLatestAmi    bool
+	securityGroups  []string
+	instanceProfile string
+	rootSize        int32
+	rootType        string
+	volumeSpecs     []string
+	instanceTags    map[string]string
+
+	launchTemplate        string
+	launchTemplateVersion string
+	createSpot            spotFlags
+	createFallbacks       fallbackFlags
 )
 
 // CreateCmd represents the create command
 var CreateCmd = &cobra.Command{
-	Use:   "create",
-	Short: "Create a new EC2 instance",
-	Long:  "Create a new EC2 instance with specified configuration",
+	Use:          "create",
+	Short:        "Create a new EC2 instance",
+	SilenceUsage: true,
+	Long: `Create a new EC2 instance with specified configuration.
+
+With --launch-template the instance is launched from an EC2 launch template,
+and only the flags that are given override it; the context's defaults are not
+applied. --user-data-file is base64-encoded before it is sent.
+
+With --spot the instance is requested on Spot capacity, and launched on-demand
+instead when there is none. The purchase option is recorded in the
+ec-manager:purchase-option tag, so migrate requests the same.
+
+When there is no capacity for the instance type in the subnet, the
+--fallback-type types and --fallback-subnet subnets are tried in order: the
+type in each subnet, then each fallback type in each subnet. The type and
+subnet chosen are recorded in the ec-manager:capacity-choice tag.`,
 	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if rootSize < 0 {
+			return fmt.Errorf("--root-size must be a positive number of GiB")
+		}
+		if launchTemplate != "" {
+			if !cmd.Flags().Changed("type") {
+				instanceType = ""
+			}
+			return nil
+		}
+		if launchTemplateVersion != "" {
+			return fmt.Errorf("--launch-template-version needs --launch-template")
+		}
+
 		if !useLatestAmi && imageID == "" {
 			return fmt.Errorf("either --ami or --latest flag must be specified")
 		}
+
+		// Fill in anything not given on the command line from the context
+		if keyName == "" {
+			keyName = activeContext.KeyName
+		}
+		if subnetID == "" {
+			subnetID = activeContext.Subnet
+		}
+		if !cmd.Flags().Changed("type") && activeContext.InstanceType != "" {
+			instanceType = activeContext.InstanceType
+		}
+
+		if keyName == "" {
+			return fmt.Errorf("--key must be specified or set in the configuration context")
+		}
+		if subnetID == "" {
+			return fmt.Errorf("--subnet must be specified or set in the configuration context")
+		}
 		return nil
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		ctx := context.Background()
-		amiService := ami.NewService(awsClient.GetEC2Client())
+		ctx := cmd.Context()
+		amiService := ami.NewService(awsClient.GetEC2Client(), serviceOptions(ctx)...)
 
 		// If --latest flag is set, find the latest AMI
 		if useLatestAmi {
@@ -67,45 +125,130 @@ var CreateCmd = &cobra.Command{
 		}
 
 		cfg := ami.InstanceConfig{
-			ImageID:      imageID,
-			InstanceType: instanceType,
-			KeyName:      keyName,
-			SubnetID:     subnetID,
-			UserData:     userData,
+			ImageID:               imageID,
+			InstanceType:          instanceType,
+			KeyName:               keyName,
+			SubnetID:              subnetID,
+			Name:                  instanceName,
+			SecurityGroupIDs:      securityGroups,
+			InstanceProfile:       instanceProfile,
+			RootVolume:            ami.VolumeConfig{SizeGiB: rootSize, Type: rootType},
+			LaunchTemplate:        launchTemplate,
+			LaunchTemplateVersion: launchTemplateVersion,
+			Tags:                  createTags(),
 		}
 
-		instanceID, err := amiService.CreateInstance(ctx, cfg)
+		spot, err := createSpot.config()
 		if err != nil {
 			return err
 		}
+		cfg.Spot = spot
+		cfg.FallbackTypes = createFallbacks.instanceTypes
+		cfg.FallbackSubnets = createFallbacks.subnetIDs
+
+		if userDataFile != "" {
+			data, err := os.ReadFile(userDataFile)
+			if err != nil {
+				return fmt.Errorf("failed to read user data: %w", err)
+			}
+			cfg.UserData = string(data)
+		}
+
+		for _, spec := range volumeSpecs {
+			volume, err := ami.ParseVolume(spec)
+			if err != nil {
+				return err
+			}
+			cfg.Volumes = append(cfg.Volumes, volume)
+		}
 
-		fmt.Printf("Created instance %s with:\n", instanceID)
-		fmt.Printf("  Image ID: %s\n", imageID)
-		fmt.Printf("  Instance Type: %s\n", instanceType)
-		fmt.Printf("  Key Name: %s\n", keyName)
-		fmt.Printf("  Subnet ID: %s\n", subnetID)
-		if userData != "" {
+		result, err := amiService.RunInstance(ctx, cfg)
+		if err != nil {
+			return err
+		}
+		printLaunchAttempts(os.Stdout, result)
+
+		fmt.Printf("Created instance %s with:\n", result.InstanceID)
+		printSetting("Launch Template", launchTemplate)
+		printSetting("Name", instanceName)
+		printSetting("Image ID", imageID)
+		printSetting("Instance Type", result.InstanceType)
+		printSetting("Key Name", keyName)
+		printSetting("Subnet ID", result.SubnetID)
+		printSetting("Security Groups", strings.Join(securityGroups, ", "))
+		printSetting("Instance Profile", instanceProfile)
+		if !cfg.RootVolume.IsEmpty() {
+			printSetting("Root Volume", describeVolume(cfg.RootVolume))
+		}
+		for _, volume := range cfg.Volumes {
+			printSetting("Volume", describeVolume(volume))
+		}
+		if cfg.UserData != "" {
 			fmt.Println("  User Data: [provided]")
 		}
+		if result.Spot {
+			printSetting("Purchase Option", cfg.Spot.String())
+		}
 
 		return nil
 	},
 }
 
+// createTags returns the context's tags overridden by --tag. The context's
+// tags are not applied to launches from a template.
+func createTags() map[string]string {
+	tags := map[string]string{}
+	if launchTemplate == "" {
+		for key, value := range activeContext.Tags {
+			tags[key] = value
+		}
+	}
+	for key, value := range instanceTags {
+		tags[key] = value
+	}
+	return tags
+}
+
+// printSetting prints one setting of the created instance, when it is set
+func printSetting(label, value string) {
+	if value != "" {
+		fmt.Printf("  %s: %s\n", label, value)
+	}
+}
+
+// describeVolume describes a volume as its device, size and type
+func describeVolume(v ami.VolumeConfig) string {
+	var parts []string
+	if v.Device != "" {
+		parts = append(parts, v.Device)
+	}
+	if v.SizeGiB > 0 {
+		parts = append(parts, fmt.Sprintf("%d GiB", v.SizeGiB))
+	}
+	if v.Type != "" {
+		parts = append(parts, v.Type)
+	}
+	return strings.Join(parts, " ")
+}
+
 func init() {
 	rootCmd.AddCommand(CreateCmd)
 
-	CreateCmd.Flags().StringVar(&keyName, "key", "", "SSH key name")
-	CreateCmd.Flags().StringVar(&subnetID, "subnet", "", "Subnet ID")
+	CreateCmd.Flags().StringVar(&keyName, "key", "", "SSH key name (defaults to the context's key)")
+	CreateCmd.Flags().StringVar(&subnetID, "subnet", "", "Subnet ID (defaults to the context's subnet)")
 	CreateCmd.Flags().StringVar(&imageID, "ami", "", "AMI ID")
 	CreateCmd.Flags().StringVar(&instanceType, "type", "t2.micro", "Instance type")
-	CreateCmd.Flags().StringVar(&userData, "name", "", "Instance name")
+	CreateCmd.Flags().StringVar(&instanceName, "name", "", "Instance name, set as its Name tag")
 	CreateCmd.Flags().BoolVar(&useLatestAmi, "latest", false, "Use latest AMI with tag ami-migrate=latest")
-
-	if err := CreateCmd.MarkFlagRequired("key"); err != nil {
-		panic(err)
-	}
-	if err := CreateCmd.MarkFlagRequired("subnet"); err != nil {
-		panic(err)
-	}
+	CreateCmd.Flags().StringSliceVar(&securityGroups, "security-group", nil, "Security group IDs (repeatable or comma-separated)")
+	CreateCmd.Flags().StringVar(&instanceProfile, "instance-profile", "", "IAM instance profile name or ARN")
+	CreateCmd.Flags().Int32Var(&rootSize, "root-size", 0, "Root volume size in GiB (default: the AMI's)")
+	CreateCmd.Flags().StringVar(&rootType, "root-type", "", "Root volume type, e.g. gp3 (default: the AMI's)")
+	CreateCmd.Flags().StringArrayVar(&volumeSpecs, "volume", nil, "Additional EBS volume, e.g. size=100,type=gp3,device=/dev/sdf (repeatable)")
+	CreateCmd.Flags().StringToStringVar(&instanceTags, "tag", nil, "Tag for the instance and its volumes, e.g. Env=prod (repeatable)")
+	CreateCmd.Flags().StringVar(&userDataFile, "user-data-file", "", "File with user data for the instance")
+	CreateCmd.Flags().StringVar(&launchTemplate, "launch-template", "", "Launch template ID or name to launch from")
+	CreateCmd.Flags().StringVar(&launchTemplateVersion, "launch-template-version", "", "Launch template version (default: the template's default version)")
+	addSpotFlags(CreateCmd, &createSpot)
+	addFallbackFlags(CreateCmd, &createFallbacks)
 }
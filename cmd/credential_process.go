@@ -0,0 +1,197 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/spf13/cobra"
+	"github.com/taemon1337/ec-manager/pkg/client"
+	"github.com/taemon1337/ec-manager/pkg/logger"
+	"github.com/taemon1337/ec-manager/pkg/session"
+	"github.com/taemon1337/ec-manager/pkg/types"
+)
+
+// NewCredentialProcessCmd creates the credential-process command
+func NewCredentialProcessCmd() *cobra.Command {
+	var (
+		spec     session.Session
+		duration time.Duration
+		cacheDir string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "credential-process",
+		Short: "Print cached role credentials for the AWS credential_process setting",
+		Long: `Print assumed-role credentials in the format expected by the credential_process
+setting of the shared AWS config file, so other AWS tools can use sessions
+cached by ec-manager without secrets in ~/.aws/credentials:
+
+  [profile admin]
+  credential_process = ec-manager credential-process --session admin
+
+Sessions are cached in ~/.cache/ec-manager/sessions and assumed again
+automatically shortly before they expire. Sessions that need MFA prompt for a
+code when run from a terminal; otherwise refresh them with
+'ec-manager check credentials --role ARN --mfa-serial SERIAL --mfa-token CODE --cache'.`,
+		Args: cobra.NoArgs,
+		// stdout carries only the credentials, and no AWS client is needed
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			logger.InitWriter(logger.LogLevel(logLevel), os.Stderr)
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx := cmd.Context()
+
+			cache := session.NewCache(cacheDir)
+			if cacheDir == "" {
+				var err error
+				if cache, err = session.NewDefaultCache(); err != nil {
+					return err
+				}
+			}
+
+			// --mfa-serial and --mfa-token are the root flags, which fall
+			// back to the context's MFA device
+			want := spec
+			want.MFASerial = mfaSerialID
+			want.DurationSeconds = int32(duration.Seconds())
+			if want.Name == "" {
+				if want.RoleARN == "" {
+					return fmt.Errorf("either --session or --role must be specified")
+				}
+				want.Name = session.NameForRole(want.RoleARN)
+			}
+
+			// A session name alone refreshes with the settings it was cached with
+			if want.RoleARN == "" {
+				cached, err := cache.Load(want.Name)
+				if errors.Is(err, session.ErrNotFound) {
+					return fmt.Errorf("no cached session %s, pass --role to create it", want.Name)
+				}
+				if err != nil {
+					return err
+				}
+				want = *cached
+			}
+
+			s, err := cache.Get(ctx, &want, func(ctx context.Context, s *session.Session) (aws.Credentials, error) {
+				logger.Debug("assuming role for session", "session", s.Name, "role", s.RoleARN)
+				stsClient, err := sourceSTSClient(ctx, s.SourceProfile)
+				if err != nil {
+					return aws.Credentials{}, err
+				}
+				return assumeRoleCredentials(ctx, stsClient, s, func() (string, error) {
+					return mfaTokenCode(cmd, s, mfaCode)
+				})
+			})
+			if err != nil {
+				return err
+			}
+
+			out, err := s.ProcessOutput()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), string(out))
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(&spec.Name, "session", "", "Name of the cached session (defaults to the role name)")
+	cmd.Flags().StringVar(&spec.RoleARN, "role", "", "Role ARN to assume when the session is missing or expiring")
+	cmd.Flags().StringVar(&spec.SourceProfile, "source-profile", "", "Profile whose credentials assume the role (defaults to the default credential chain)")
+	cmd.Flags().DurationVar(&duration, "duration", 0, "Session duration (defaults to the role's setting)")
+	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "Session cache directory")
+	if err := cmd.Flags().MarkHidden("cache-dir"); err != nil {
+		panic(err)
+	}
+
+	return cmd
+}
+
+// sourceSTSClient returns an STS client using the credentials of profile
+func sourceSTSClient(ctx context.Context, profile string) (types.STSClient, error) {
+	if stsClient, ok := ctx.Value(types.STSClientKey).(types.STSClient); ok {
+		return stsClient, nil
+	}
+
+	retryer := client.NewRetryer(retryPolicy)
+	opts := []func(*config.LoadOptions) error{
+		config.WithRetryer(func() aws.Retryer { return retryer }),
+	}
+	if profile != "" {
+		opts = append(opts, config.WithSharedConfigProfile(profile))
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load source credentials: %w", err)
+	}
+	if cfg.Region == "" {
+		cfg.Region = region
+	}
+	return sts.NewFromConfig(cfg), nil
+}
+
+// assumeRoleCredentials assumes the session's role, asking tokenCode for an
+// MFA code when the session needs one
+func assumeRoleCredentials(ctx context.Context, stsClient types.STSClient, s *session.Session, tokenCode func() (string, error)) (aws.Credentials, error) {
+	input := &sts.AssumeRoleInput{
+		RoleArn:         aws.String(s.RoleARN),
+		RoleSessionName: aws.String("ec-manager-session"),
+	}
+	if s.DurationSeconds > 0 {
+		input.DurationSeconds = aws.Int32(s.DurationSeconds)
+	}
+	if s.MFASerial != "" {
+		code, err := tokenCode()
+		if err != nil {
+			return aws.Credentials{}, err
+		}
+		input.SerialNumber = aws.String(s.MFASerial)
+		input.TokenCode = aws.String(code)
+	}
+
+	out, err := stsClient.AssumeRole(ctx, input)
+	if err != nil {
+		return aws.Credentials{}, fmt.Errorf("failed to assume role: %w", err)
+	}
+	if out.Credentials == nil {
+		return aws.Credentials{}, fmt.Errorf("no credentials returned for role %s", s.RoleARN)
+	}
+
+	return aws.Credentials{
+		AccessKeyID:     aws.ToString(out.Credentials.AccessKeyId),
+		SecretAccessKey: aws.ToString(out.Credentials.SecretAccessKey),
+		SessionToken:    aws.ToString(out.Credentials.SessionToken),
+		CanExpire:       true,
+		Expires:         aws.ToTime(out.Credentials.Expiration),
+	}, nil
+}
+
+// mfaTokenCode returns code when given, otherwise prompts on the terminal.
+// credential_process may run without one, in which case the session has to
+// be refreshed by hand.
+func mfaTokenCode(cmd *cobra.Command, s *session.Session, code string) (string, error) {
+	if code != "" {
+		return code, nil
+	}
+
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return "", fmt.Errorf("session %s needs an MFA code: refresh it with 'ec-manager check credentials --role %s --mfa-serial %s --mfa-token CODE --cache'",
+			s.Name, s.RoleARN, s.MFASerial)
+	}
+
+	prompt := newPrompter(cmd.InOrStdin(), cmd.ErrOrStderr())
+	return prompt.ask("MFA code for "+s.MFASerial, "")
+}
+
+func init() {
+	rootCmd.AddCommand(NewCredentialProcessCmd())
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	ststypes "github.com/aws/aws-sdk-go-v2/service/sts/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	mockclient "github.com/taemon1337/ec-manager/pkg/mock"
+	ectypes "github.com/taemon1337/ec-manager/pkg/types"
+)
+
+func TestCredentialProcessCmd(t *testing.T) {
+	cacheDir := t.TempDir()
+	roleARN := "arn:aws:iam::123456789012:role/admin"
+
+	mockSTSClient := mockclient.NewMockSTSClient(t)
+	mockSTSClient.On("AssumeRole", mock.Anything, mock.MatchedBy(func(input *sts.AssumeRoleInput) bool {
+		return aws.ToString(input.RoleArn) == roleARN && aws.ToInt32(input.DurationSeconds) == 3600
+	}), mock.Anything).Return(&sts.AssumeRoleOutput{
+		Credentials: &ststypes.Credentials{
+			AccessKeyId:     aws.String("ASIA1"),
+			SecretAccessKey: aws.String("secret"),
+			SessionToken:    aws.String("token"),
+			Expiration:      aws.Time(time.Now().Add(time.Hour)),
+		},
+	}, nil).Once()
+
+	run := func(args ...string) (map[string]interface{}, error) {
+		cmd := NewCredentialProcessCmd()
+		cmd.SetContext(context.WithValue(context.Background(), ectypes.STSClientKey, mockSTSClient))
+		var out bytes.Buffer
+		cmd.SetOut(&out)
+		cmd.SetArgs(append(args, "--cache-dir", cacheDir))
+		if err := cmd.Execute(); err != nil {
+			return nil, err
+		}
+
+		var creds map[string]interface{}
+		err := json.Unmarshal(out.Bytes(), &creds)
+		return creds, err
+	}
+
+	_, err := run("--session", "admin")
+	assert.ErrorContains(t, err, "no cached session admin")
+
+	creds, err := run("--role", roleARN, "--duration", "1h")
+	require.NoError(t, err)
+	assert.Equal(t, float64(1), creds["Version"])
+	assert.Equal(t, "ASIA1", creds["AccessKeyId"])
+	assert.NotEmpty(t, creds["Expiration"])
+
+	// The cached session is served by name without assuming the role again
+	creds, err = run("--session", "admin")
+	require.NoError(t, err)
+	assert.Equal(t, "ASIA1", creds["AccessKeyId"])
+
+	mockSTSClient.AssertExpectations(t)
+}
+
+func TestCredentialProcessRootMFAFlags(t *testing.T) {
+	roleARN := "arn:aws:iam::123456789012:role/mfa"
+	mfaSerialID, mfaCode = "arn:aws:iam::123456789012:mfa/alice", "123456"
+	t.Cleanup(func() { mfaSerialID, mfaCode = "", "" })
+
+	mockSTSClient := mockclient.NewMockSTSClient(t)
+	mockSTSClient.On("AssumeRole", mock.Anything, mock.MatchedBy(func(input *sts.AssumeRoleInput) bool {
+		return aws.ToString(input.SerialNumber) == mfaSerialID && aws.ToString(input.TokenCode) == "123456"
+	}), mock.Anything).Return(&sts.AssumeRoleOutput{
+		Credentials: &ststypes.Credentials{
+			AccessKeyId:     aws.String("ASIA2"),
+			SecretAccessKey: aws.String("secret"),
+			SessionToken:    aws.String("token"),
+			Expiration:      aws.Time(time.Now().Add(time.Hour)),
+		},
+	}, nil).Once()
+
+	cmd := NewCredentialProcessCmd()
+	// The root flags are not shadowed by local ones
+	assert.Nil(t, cmd.Flags().Lookup("mfa-serial"))
+	assert.Nil(t, cmd.Flags().Lookup("mfa-token"))
+	assert.Nil(t, checkCredentialsCmd.Flags().Lookup("mfa-serial"))
+	assert.Nil(t, checkCredentialsCmd.Flags().Lookup("mfa-token"))
+
+	cmd.SetContext(context.WithValue(context.Background(), ectypes.STSClientKey, mockSTSClient))
+	cmd.SetOut(&bytes.Buffer{})
+	cmd.SetArgs([]string{"--role", roleARN, "--cache-dir", t.TempDir()})
+	require.NoError(t, cmd.Execute())
+	mockSTSClient.AssertExpectations(t)
+}
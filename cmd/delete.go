@@ -1,39 +1,151 @@
 package cmd
 
 import (
-	"context"
+	"errors"
 	"fmt"
+	"io"
+	"sort"
+	"strings"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/spf13/cobra"
 	"github.com/taemon1337/ec-manager/pkg/ami"
 )
 
 // DeleteCmd represents the delete command
 var DeleteCmd = &cobra.Command{
-	Use:   "delete",
-	Short: "Delete an EC2 instance",
-	Long:  "Delete an EC2 instance by its ID",
+	Use:   "delete [INSTANCE...]",
+	Short: "Delete EC2 instances",
+	Long: `Delete EC2 instances selected by instance ID or Name tag, with --filter and
+--name. The instances, their tags and volumes are shown and must be confirmed
+unless --yes is given. Instances tagged Protected=true or with termination
+protection enabled are refused; use 'ec-manager protect --off' to lift
+termination protection. With --backup a final backup AMI of each instance is
+created first. The Spot requests of Spot instances are cancelled, so persistent
+requests do not relaunch them. The command waits until every instance is
+terminated.`,
+	SilenceUsage: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		ctx := context.Background()
-		amiService := ami.NewService(awsClient.GetEC2Client())
+		ctx := cmd.Context()
+		out := cmd.OutOrStdout()
+		amiService := ami.NewService(awsClient.GetEC2Client(), serviceOptions(ctx)...)
 
-		state, err := amiService.DeleteInstance(ctx, deleteInstanceID)
+		instances, err := selectInstances(ctx, amiService, deleteSelection.selector(args, deleteInstanceID))
 		if err != nil {
 			return err
 		}
 
-		fmt.Printf("Instance %s is being terminated (current state: %s)\n", deleteInstanceID, state)
-		return nil
+		// Refuse protected instances before anything is changed
+		var refused []string
+		for _, instance := range instances {
+			if err := amiService.CheckDeletable(ctx, instance); err != nil {
+				if !errors.Is(err, ami.ErrProtected) {
+					return err
+				}
+				refused = append(refused, fmt.Sprintf("%s: %v", instanceLabel(instance), err))
+			}
+		}
+		if len(refused) > 0 {
+			return fmt.Errorf("refusing to delete protected instances:\n  %s", strings.Join(refused, "\n  "))
+		}
+
+		printDeletionPlan(out, instances, deleteBackup)
+		if !deleteYes && dryRunPlan == nil {
+			ok, err := newPrompter(cmd.InOrStdin(), out).confirm(fmt.Sprintf("Delete %d instance(s)?", len(instances)))
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return fmt.Errorf("deletion cancelled")
+			}
+		}
+
+		ids := make([]string, len(instances))
+		for i, instance := range instances {
+			ids[i] = aws.ToString(instance.InstanceId)
+		}
+
+		if deleteBackup {
+			for _, id := range ids {
+				amiID, err := amiService.FinalBackup(ctx, id)
+				if err != nil {
+					return fmt.Errorf("failed to back up instance %s, no instances were deleted: %w", id, err)
+				}
+				fmt.Fprintf(out, "Created final backup AMI %s of instance %s\n", amiID, id)
+			}
+		}
+
+		// A persistent Spot request would relaunch its terminated instance
+		if err := amiService.CancelSpotRequests(ctx, instances); err != nil {
+			return fmt.Errorf("%w, no instances were deleted", err)
+		}
+
+		err = amiService.TerminateInstances(ctx, ids, progressPrinter(out))
+		return bulkSummary(out, "Deleted", ids, err)
 	},
 }
 
-var deleteInstanceID string
+// instanceLabel names an instance by its ID and Name tag
+func instanceLabel(instance ec2types.Instance) string {
+	id := aws.ToString(instance.InstanceId)
+	for _, tag := range instance.Tags {
+		if aws.ToString(tag.Key) == "Name" && aws.ToString(tag.Value) != "" {
+			return fmt.Sprintf("%s (%s)", id, aws.ToString(tag.Value))
+		}
+	}
+	return id
+}
+
+// printDeletionPlan shows what deleting the instances will remove
+func printDeletionPlan(w io.Writer, instances []ec2types.Instance, backup bool) {
+	fmt.Fprintln(w, "The following instances will be terminated:")
+	for _, instance := range instances {
+		fmt.Fprintf(w, "  %s\n", instanceLabel(instance))
+		if instance.State != nil {
+			fmt.Fprintf(w, "    State: %s\n", instance.State.Name)
+		}
+		if instance.InstanceType != "" {
+			fmt.Fprintf(w, "    Type: %s\n", instance.InstanceType)
+		}
+
+		tags := make([]string, 0, len(instance.Tags))
+		for _, tag := range instance.Tags {
+			tags = append(tags, aws.ToString(tag.Key)+"="+aws.ToString(tag.Value))
+		}
+		sort.Strings(tags)
+		if len(tags) > 0 {
+			fmt.Fprintf(w, "    Tags: %s\n", strings.Join(tags, ", "))
+		}
+
+		for _, mapping := range instance.BlockDeviceMappings {
+			if mapping.Ebs == nil {
+				continue
+			}
+			fate := "kept"
+			if aws.ToBool(mapping.Ebs.DeleteOnTermination) {
+				fate = "deleted"
+			}
+			fmt.Fprintf(w, "    Volume: %s %s (%s)\n", aws.ToString(mapping.DeviceName), aws.ToString(mapping.Ebs.VolumeId), fate)
+		}
+	}
+	if backup {
+		fmt.Fprintln(w, "A final backup AMI of each instance is created first.")
+	}
+}
+
+var (
+	deleteInstanceID string
+	deleteSelection  instanceSelection
+	deleteYes        bool
+	deleteBackup     bool
+)
 
 func init() {
 	rootCmd.AddCommand(DeleteCmd)
 
-	DeleteCmd.Flags().StringVarP(&deleteInstanceID, "instance", "i", "", "Instance ID to delete")
-	if err := DeleteCmd.MarkFlagRequired("instance"); err != nil {
-		panic(err)
-	}
+	DeleteCmd.Flags().StringVarP(&deleteInstanceID, "instance", "i", "", "Instance ID or Name tag to delete")
+	DeleteCmd.Flags().BoolVarP(&deleteYes, "yes", "y", false, "Delete without asking for confirmation")
+	DeleteCmd.Flags().BoolVar(&deleteBackup, "backup", false, "Create a final backup AMI of each instance before deleting it")
+	addSelectionFlags(DeleteCmd, &deleteSelection)
 }
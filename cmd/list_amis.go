@@ -1,37 +1,49 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"os"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/spf13/cobra"
 )
 
 // listAmisCmd represents the list AMIs command
 var listAmisCmd = &cobra.Command{
-	Use:   "amis",
-	Short: "List AMIs",
-	Long:  `List all AMIs created by this project.`,
+	Use:         "amis",
+	Short:       "List AMIs",
+	Long:        `List all AMIs created by this project.`,
+	Annotations: map[string]string{runsInAccounts: "true", runsInRegions: "true"},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// Get AMIs with project tags
-		images, err := awsClient.ListImages([]types.Filter{
-			{
-				Name:   aws.String("tag:Project"),
-				Values: []string{"ec-manager"},
-			},
-		})
-		if err != nil {
-			return fmt.Errorf("failed to list AMIs: %w", err)
-		}
-
-		if len(images) == 0 {
-			fmt.Println("No AMIs found")
-			return nil
-		}
-
-		for _, image := range images {
+		// Stream AMIs with project tags one page at a time
+		out := newJSONList(os.Stdout)
+		found := 0
+		err := forEachRegion(cmd, func(ctx context.Context, account accountTarget, emit func(v interface{}) error) error {
+			return amiServiceFor(ctx).EachImage(ctx, &ec2.DescribeImagesInput{
+				Filters: []types.Filter{
+					{
+						Name:   aws.String("tag:Project"),
+						Values: []string{"ec-manager"},
+					},
+				},
+			}, func(image types.Image) error {
+				return emit(image)
+			})
+		}, func(account accountTarget, v interface{}) error {
+			image := v.(types.Image)
+			found++
+			if outputJSON() {
+				v, err := withAccount(account, image)
+				if err != nil {
+					return err
+				}
+				return out.Add(v)
+			}
 			fmt.Printf("AMI ID: %s\n", *image.ImageId)
+			printAccount(account)
 			if image.Name != nil {
 				fmt.Printf("  Name: %s\n", *image.Name)
 			}
@@ -52,6 +64,18 @@ var listAmisCmd = &cobra.Command{
 				}
 			}
 			fmt.Println()
+			return nil
+		})
+		err = closeJSONList(out, err)
+		if err != nil {
+			return fmt.Errorf("failed to list AMIs: %w", err)
+		}
+
+		if outputJSON() {
+			return nil
+		}
+		if found == 0 {
+			fmt.Println("No AMIs found")
 		}
 
 		return nil
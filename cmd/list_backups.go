@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/spf13/cobra"
+)
+
+var listBackupsInstanceID string
+
+// listBackupsCmd represents the list backups command
+var listBackupsCmd = &cobra.Command{
+	Use:         "backups",
+	Short:       "List backup AMIs",
+	Long:        `List the backup AMIs created by the backup command, optionally only those of one instance.`,
+	Annotations: map[string]string{runsInAccounts: "true", runsInRegions: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filters := []types.Filter{
+			{
+				Name:   aws.String("tag-key"),
+				Values: []string{"SourceInstanceId"},
+			},
+		}
+		if listBackupsInstanceID != "" {
+			filters = append(filters, types.Filter{
+				Name:   aws.String("tag:SourceInstanceId"),
+				Values: []string{listBackupsInstanceID},
+			})
+		}
+
+		out := newJSONList(os.Stdout)
+		found := 0
+		err := forEachRegion(cmd, func(ctx context.Context, account accountTarget, emit func(v interface{}) error) error {
+			return amiServiceFor(ctx).EachImage(ctx, &ec2.DescribeImagesInput{
+				Owners:  []string{"self"},
+				Filters: filters,
+			}, func(image types.Image) error {
+				return emit(image)
+			})
+		}, func(account accountTarget, v interface{}) error {
+			image := v.(types.Image)
+			found++
+			if outputJSON() {
+				v, err := withAccount(account, image)
+				if err != nil {
+					return err
+				}
+				return out.Add(v)
+			}
+
+			tags := make(map[string]string, len(image.Tags))
+			for _, tag := range image.Tags {
+				tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+			}
+
+			fmt.Printf("AMI ID: %s\n", aws.ToString(image.ImageId))
+			printAccount(account)
+			if id := tags["SourceInstanceId"]; id != "" {
+				fmt.Printf("  Instance: %s\n", id)
+			}
+			if image.Name != nil {
+				fmt.Printf("  Name: %s\n", *image.Name)
+			}
+			if image.CreationDate != nil {
+				fmt.Printf("  Created: %s\n", *image.CreationDate)
+			}
+			if image.State != "" {
+				fmt.Printf("  State: %s\n", image.State)
+			}
+			if backupType := tags["BackupType"]; backupType != "" {
+				fmt.Printf("  Type: %s\n", backupType)
+			}
+			fmt.Println()
+			return nil
+		})
+		err = closeJSONList(out, err)
+		if err != nil {
+			return fmt.Errorf("failed to list backups: %w", err)
+		}
+
+		if outputJSON() {
+			return nil
+		}
+		if found == 0 {
+			fmt.Println("No backups found")
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	listBackupsCmd.Flags().StringVarP(&listBackupsInstanceID, "instance-id", "i", "", "Only list backups of this instance")
+	listCmd.AddCommand(listBackupsCmd)
+}
@@ -3,53 +3,76 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"os"
 
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/spf13/cobra"
-	"github.com/taemon1337/ec-manager/pkg/ami"
 )
 
 // listInstancesCmd represents the list instances command
 var listInstancesCmd = &cobra.Command{
-	Use:   "instances",
+	Use:   "instances [INSTANCE...]",
 	Short: "List EC2 instances",
-	Long:  `List all EC2 instances in your AWS account.`,
-	RunE: func(cmd *cobra.Command, args []string) error {
-		ctx := context.Background()
-		amiService := ami.NewService(awsClient.GetEC2Client())
+	Long: `List the EC2 instances in your AWS account, or only those selected by
+instance ID or Name tag, with --filter and --name, for example:
 
-		output, err := amiService.DescribeInstances(ctx)
+  ec-manager list instances --filter state=running --filter tag:Env=prod
+  ec-manager list instances --name 'web-*'`,
+	Annotations: map[string]string{runsInAccounts: "true", runsInRegions: "true"},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sel := listInstancesSelection.selector(args, "")
+		out := newJSONList(os.Stdout)
+		found := 0
+		err := forEachRegion(cmd, func(ctx context.Context, account accountTarget, emit func(v interface{}) error) error {
+			return amiServiceFor(ctx).EachSelected(ctx, sel, func(instance types.Instance) error {
+				return emit(instance)
+			})
+		}, func(account accountTarget, v interface{}) error {
+			instance := v.(types.Instance)
+			found++
+			if outputJSON() {
+				v, err := withAccount(account, instance)
+				if err != nil {
+					return err
+				}
+				return out.Add(v)
+			}
+			fmt.Printf("Instance ID: %s\n", *instance.InstanceId)
+			printAccount(account)
+			if instance.State != nil {
+				fmt.Printf("  State: %s\n", instance.State.Name)
+			}
+			if instance.InstanceType != "" {
+				fmt.Printf("  Type: %s\n", instance.InstanceType)
+			}
+			if instance.PublicIpAddress != nil {
+				fmt.Printf("  Public IP: %s\n", *instance.PublicIpAddress)
+			}
+			if instance.PrivateIpAddress != nil {
+				fmt.Printf("  Private IP: %s\n", *instance.PrivateIpAddress)
+			}
+			fmt.Println()
+			return nil
+		})
+		err = closeJSONList(out, err)
 		if err != nil {
 			return fmt.Errorf("failed to list instances: %w", err)
 		}
 
-		if len(output.Reservations) == 0 {
-			fmt.Println("No instances found")
+		if outputJSON() {
 			return nil
 		}
-
-		for _, reservation := range output.Reservations {
-			for _, instance := range reservation.Instances {
-				fmt.Printf("Instance ID: %s\n", *instance.InstanceId)
-				if instance.State != nil {
-					fmt.Printf("  State: %s\n", instance.State.Name)
-				}
-				if instance.InstanceType != "" {
-					fmt.Printf("  Type: %s\n", instance.InstanceType)
-				}
-				if instance.PublicIpAddress != nil {
-					fmt.Printf("  Public IP: %s\n", *instance.PublicIpAddress)
-				}
-				if instance.PrivateIpAddress != nil {
-					fmt.Printf("  Private IP: %s\n", *instance.PrivateIpAddress)
-				}
-				fmt.Println()
-			}
+		if found == 0 {
+			fmt.Println("No instances found")
 		}
 
 		return nil
 	},
 }
 
+var listInstancesSelection instanceSelection
+
 func init() {
+	addSelectionFlags(listInstancesCmd, &listInstancesSelection)
 	listCmd.AddCommand(listInstancesCmd)
 }
@@ -3,44 +3,66 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"os"
 
 	"github.com/spf13/cobra"
-	"github.com/taemon1337/ec-manager/pkg/ami"
 )
 
 // listKeysCmd represents the list keys command
 var listKeysCmd = &cobra.Command{
-	Use:   "keys",
-	Short: "List SSH key pairs",
-	Long:  `List all SSH key pairs in your AWS account.`,
+	Use:         "keys",
+	Short:       "List SSH key pairs",
+	Long:        `List all SSH key pairs in your AWS account.`,
+	Annotations: map[string]string{runsInAccounts: "true"},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		ctx := context.Background()
-		amiService := ami.NewService(awsClient.GetEC2Client())
+		out := newJSONList(os.Stdout)
+		found := 0
+		err := forEachAccount(cmd, func(ctx context.Context, account accountTarget) error {
+			keys, err := amiServiceFor(ctx).ListKeyPairs(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to list key pairs: %w", err)
+			}
+
+			for _, key := range keys {
+				found++
+				if outputJSON() {
+					v, err := withAccount(account, key)
+					if err != nil {
+						return err
+					}
+					if err := out.Add(v); err != nil {
+						return err
+					}
+					continue
+				}
 
-		keys, err := amiService.ListKeyPairs(ctx)
+				fmt.Printf("Key Name: %s\n", *key.KeyName)
+				printAccount(account)
+				if key.KeyFingerprint != nil {
+					fmt.Printf("  Fingerprint: %s\n", *key.KeyFingerprint)
+				}
+				if len(key.Tags) > 0 {
+					fmt.Println("  Tags:")
+					for _, tag := range key.Tags {
+						if tag.Key != nil && tag.Value != nil {
+							fmt.Printf("    %s: %s\n", *tag.Key, *tag.Value)
+						}
+					}
+				}
+				fmt.Println()
+			}
+			return nil
+		})
+		err = closeJSONList(out, err)
 		if err != nil {
-			return fmt.Errorf("failed to list key pairs: %w", err)
+			return err
 		}
 
-		if len(keys) == 0 {
-			fmt.Println("No key pairs found")
+		if outputJSON() {
 			return nil
 		}
-
-		for _, key := range keys {
-			fmt.Printf("Key Name: %s\n", *key.KeyName)
-			if key.KeyFingerprint != nil {
-				fmt.Printf("  Fingerprint: %s\n", *key.KeyFingerprint)
-			}
-			if len(key.Tags) > 0 {
-				fmt.Println("  Tags:")
-				for _, tag := range key.Tags {
-					if tag.Key != nil && tag.Value != nil {
-						fmt.Printf("    %s: %s\n", *tag.Key, *tag.Value)
-					}
-				}
-			}
-			fmt.Println()
+		if found == 0 {
+			fmt.Println("No key pairs found")
 		}
 
 		return nil
@@ -3,47 +3,62 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"os"
 
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/spf13/cobra"
-	"github.com/taemon1337/ec-manager/pkg/ami"
 )
 
 // listSubnetsCmd represents the list subnets command
 var listSubnetsCmd = &cobra.Command{
-	Use:   "subnets",
-	Short: "List available VPC subnets",
-	Long:  `List all available VPC subnets in your AWS account.`,
+	Use:         "subnets",
+	Short:       "List available VPC subnets",
+	Long:        `List all available VPC subnets in your AWS account.`,
+	Annotations: map[string]string{runsInAccounts: "true"},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		ctx := context.Background()
-		amiService := ami.NewService(awsClient.GetEC2Client())
-
-		subnets, err := amiService.ListSubnets(ctx)
+		out := newJSONList(os.Stdout)
+		found := 0
+		err := forEachAccount(cmd, func(ctx context.Context, account accountTarget) error {
+			return amiServiceFor(ctx).EachSubnet(ctx, &ec2.DescribeSubnetsInput{}, func(subnet types.Subnet) error {
+				found++
+				if outputJSON() {
+					v, err := withAccount(account, subnet)
+					if err != nil {
+						return err
+					}
+					return out.Add(v)
+				}
+				fmt.Printf("Subnet ID: %s\n", *subnet.SubnetId)
+				printAccount(account)
+				fmt.Printf("  VPC ID: %s\n", *subnet.VpcId)
+				fmt.Printf("  CIDR Block: %s\n", *subnet.CidrBlock)
+				fmt.Printf("  Availability Zone: %s\n", *subnet.AvailabilityZone)
+				if subnet.AvailableIpAddressCount != nil {
+					fmt.Printf("  Available IPs: %d\n", *subnet.AvailableIpAddressCount)
+				}
+				if len(subnet.Tags) > 0 {
+					fmt.Println("  Tags:")
+					for _, tag := range subnet.Tags {
+						if tag.Key != nil && tag.Value != nil {
+							fmt.Printf("    %s: %s\n", *tag.Key, *tag.Value)
+						}
+					}
+				}
+				fmt.Println()
+				return nil
+			})
+		})
+		err = closeJSONList(out, err)
 		if err != nil {
 			return fmt.Errorf("failed to list subnets: %w", err)
 		}
 
-		if len(subnets) == 0 {
-			fmt.Println("No subnets found")
+		if outputJSON() {
 			return nil
 		}
-
-		for _, subnet := range subnets {
-			fmt.Printf("Subnet ID: %s\n", *subnet.SubnetId)
-			fmt.Printf("  VPC ID: %s\n", *subnet.VpcId)
-			fmt.Printf("  CIDR Block: %s\n", *subnet.CidrBlock)
-			fmt.Printf("  Availability Zone: %s\n", *subnet.AvailabilityZone)
-			if subnet.AvailableIpAddressCount != nil {
-				fmt.Printf("  Available IPs: %d\n", *subnet.AvailableIpAddressCount)
-			}
-			if len(subnet.Tags) > 0 {
-				fmt.Println("  Tags:")
-				for _, tag := range subnet.Tags {
-					if tag.Key != nil && tag.Value != nil {
-						fmt.Printf("    %s: %s\n", *tag.Key, *tag.Value)
-					}
-				}
-			}
-			fmt.Println()
+		if found == 0 {
+			fmt.Println("No subnets found")
 		}
 
 		return nil
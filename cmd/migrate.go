@@ -1,9 +1,13 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
+	"os"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/spf13/cobra"
 	"github.com/taemon1337/ec-manager/pkg/ami"
 	"github.com/taemon1337/ec-manager/pkg/client"
@@ -12,10 +16,27 @@ import (
 
 // NewMigrateCmd creates a new migrate command
 func NewMigrateCmd() *cobra.Command {
+	var selection instanceSelection
+	var spot spotFlags
+	var onDemand bool
+	var fallbacks fallbackFlags
+	var instanceType string
+
 	cmd := &cobra.Command{
-		Use:   "migrate",
-		Short: "Migrate an instance to a new AMI",
-		Long:  `Migrate an instance by creating a new instance with the specified AMI and copying over the volumes.`,
+		Use:   "migrate [INSTANCE...]",
+		Short: "Migrate instances to a new AMI",
+		Long: `Migrate instances by creating a new instance with the specified AMI and copying
+over the volumes. Instances are selected by instance ID or Name tag, with
+--filter and --name, or with --enabled for every instance tagged
+ami-migrate=enabled.
+
+New instances are requested as Spot or on-demand capacity like the instances
+they replace, unless --spot or --on-demand says otherwise. Spot requests fall
+back to on-demand when there is no Spot capacity. When there is no capacity for
+an instance's type in its subnet, the --fallback-type types and
+--fallback-subnet subnets are tried in order. --type changes the type of the
+new instances, e.g. to one recommended by check rightsize.`,
+		Annotations: map[string]string{runsInAccounts: "true"},
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// Get flag values
 			instanceID, _ := cmd.Flags().GetString("instance-id")
@@ -23,62 +44,74 @@ func NewMigrateCmd() *cobra.Command {
 			enabled, _ := cmd.Flags().GetBool("enabled")
 			targetVersion, _ := cmd.Flags().GetString("version")
 
+			sel := selection.selector(args, instanceID)
+			if enabled {
+				sel.Filters = append(sel.Filters, "tag:ami-migrate=enabled")
+			}
+
 			// Validate flags
-			if instanceID == "" && !enabled {
-				return fmt.Errorf("either --instance-id or --enabled flag must be set")
+			if sel.IsEmpty() {
+				return fmt.Errorf("select instances to migrate with instance IDs or Name tags, --filter, --name or --enabled")
 			}
 
 			if targetAMI == "" && targetVersion == "" {
 				return fmt.Errorf("either --new-ami or --version flag must be specified")
 			}
 
-			// Get EC2 client from context
-			ctx := cmd.Context()
-			ec2Client, ok := ctx.Value(types.EC2ClientKey).(types.EC2Client)
-			if !ok {
-				if awsClient == nil {
-					var err error
-					awsClient, err = client.NewClient(false, "us-east-1", "default")
-					if err != nil {
-						return fmt.Errorf("failed to create AWS client: %w", err)
+			spotConfig, err := spot.config()
+			if err != nil {
+				return err
+			}
+			var opts []ami.MigrateOption
+			switch {
+			case spotConfig != nil && onDemand:
+				return fmt.Errorf("--spot and --on-demand cannot be used together")
+			case spotConfig != nil, onDemand:
+				opts = append(opts, ami.WithPurchaseOption(spotConfig))
+			}
+			if instanceType != "" {
+				opts = append(opts, ami.WithInstanceType(instanceType))
+			}
+			if len(fallbacks.instanceTypes) > 0 || len(fallbacks.subnetIDs) > 0 {
+				opts = append(opts, ami.WithFallbacks(fallbacks.instanceTypes, fallbacks.subnetIDs))
+			}
+
+			return forEachAccount(cmd, func(ctx context.Context, account accountTarget) error {
+				// Get EC2 client from context
+				ec2Client, ok := ctx.Value(types.EC2ClientKey).(types.EC2Client)
+				if !ok {
+					if awsClient == nil {
+						var err error
+						awsClient, err = client.NewClient(false, "us-east-1", "default")
+						if err != nil {
+							return fmt.Errorf("failed to create AWS client: %w", err)
+						}
 					}
+					ec2Client = awsClient.GetEC2Client()
 				}
-				ec2Client = awsClient.GetEC2Client()
-			}
+				amiService := ami.NewService(ec2Client, serviceOptions(ctx)...)
+				printAccountHeader(account)
 
-			if instanceID != "" {
-				_, err := ec2Client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
-					InstanceIds: []string{instanceID},
+				var instanceIDs []string
+				err := amiService.EachSelected(ctx, sel, func(instance ec2types.Instance) error {
+					instanceIDs = append(instanceIDs, aws.ToString(instance.InstanceId))
+					return nil
 				})
 				if err != nil {
-					return fmt.Errorf("failed to describe instance: %v", err)
+					return fmt.Errorf("failed to select instances: %w", err)
 				}
-			}
-
-			amiService := ami.NewService(ec2Client)
-
-			if targetVersion != "" {
-				// Get instance OS
-				os, err := amiService.GetInstanceOS(ctx, instanceID)
-				if err != nil {
-					return err
+				if len(instanceIDs) == 0 {
+					fmt.Println("No instances match the selection")
+					return nil
 				}
 
-				// Get AMI by version
-				ami, err := amiService.GetAMIByVersion(ctx, os, targetVersion)
-				if err != nil {
-					return err
+				for _, id := range instanceIDs {
+					if err := migrateInstance(ctx, ec2Client, amiService, id, targetAMI, targetVersion, opts...); err != nil {
+						return err
+					}
 				}
-				targetAMI = *ami.ImageId
-			}
-
-			newInstanceID, err := amiService.MigrateInstance(ctx, instanceID, targetAMI)
-			if err != nil {
-				return err
-			}
-
-			fmt.Printf("Successfully migrated instance %s to %s (new instance ID: %s)\n", instanceID, targetAMI, newInstanceID)
-			return nil
+				return nil
+			})
 		},
 	}
 
@@ -86,10 +119,50 @@ func NewMigrateCmd() *cobra.Command {
 	cmd.Flags().StringP("new-ami", "a", "", "New AMI ID to migrate to")
 	cmd.Flags().BoolP("enabled", "e", false, "Migrate all enabled instances")
 	cmd.Flags().StringP("version", "v", "", "Version to migrate to")
+	cmd.Flags().StringVar(&instanceType, "type", "", "Instance type of the new instances, instead of the type of the instances they replace")
+	cmd.Flags().BoolVar(&onDemand, "on-demand", false, "Request on-demand capacity for the new instances, even for Spot instances")
+	addSpotFlags(cmd, &spot)
+	addFallbackFlags(cmd, &fallbacks)
+	addSelectionFlags(cmd, &selection)
 
 	return cmd
 }
 
+// migrateInstance migrates one instance to targetAMI, or to the AMI of
+// targetVersion for the instance's OS
+func migrateInstance(ctx context.Context, ec2Client types.EC2Client, amiService *ami.Service, instanceID, targetAMI, targetVersion string, opts ...ami.MigrateOption) error {
+	_, err := ec2Client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
+		InstanceIds: []string{instanceID},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to describe instance: %v", err)
+	}
+
+	if targetVersion != "" {
+		// Get instance OS
+		os, err := amiService.GetInstanceOS(ctx, instanceID)
+		if err != nil {
+			return err
+		}
+
+		// Get AMI by version
+		ami, err := amiService.GetAMIByVersion(ctx, os, targetVersion)
+		if err != nil {
+			return err
+		}
+		targetAMI = *ami.ImageId
+	}
+
+	result, err := amiService.MigrateInstance(ctx, instanceID, targetAMI, opts...)
+	if err != nil {
+		return err
+	}
+
+	printLaunchAttempts(os.Stdout, result)
+	fmt.Printf("Successfully migrated instance %s to %s (new instance ID: %s)\n", instanceID, targetAMI, result.InstanceID)
+	return nil
+}
+
 func init() {
 	rootCmd.AddCommand(NewMigrateCmd())
 }
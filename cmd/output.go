@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/taemon1337/ec-manager/pkg/config"
+)
+
+// outputJSON reports whether results should be printed as JSON
+func outputJSON() bool {
+	return outputFormat == config.OutputJSON
+}
+
+// jsonList streams values as the elements of a single JSON array, so list
+// commands can keep printing one page at a time in JSON mode
+type jsonList struct {
+	w     io.Writer
+	count int
+}
+
+func newJSONList(w io.Writer) *jsonList {
+	return &jsonList{w: w}
+}
+
+// Add writes one element of the array
+func (l *jsonList) Add(v interface{}) error {
+	data, err := json.MarshalIndent(v, "  ", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode JSON output: %w", err)
+	}
+
+	sep := ",\n  "
+	if l.count == 0 {
+		sep = "[\n  "
+	}
+	l.count++
+
+	_, err = fmt.Fprintf(l.w, "%s%s", sep, data)
+	return err
+}
+
+// Close terminates the array, printing an empty one when nothing was added
+func (l *jsonList) Close() error {
+	if l.count == 0 {
+		_, err := fmt.Fprintln(l.w, "[]")
+		return err
+	}
+	_, err := fmt.Fprintln(l.w, "\n]")
+	return err
+}
+
+// closeJSONList closes l when JSON output is selected, also after err so
+// the elements already written still form a valid array, and returns err or
+// the error closing l
+func closeJSONList(l *jsonList, err error) error {
+	if !outputJSON() {
+		return err
+	}
+	if closeErr := l.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
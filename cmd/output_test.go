@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/taemon1337/ec-manager/pkg/config"
+)
+
+func TestCloseJSONListAfterError(t *testing.T) {
+	outputFormat = config.OutputJSON
+	t.Cleanup(func() { outputFormat = "" })
+
+	var buf bytes.Buffer
+	list := newJSONList(&buf)
+	require.NoError(t, list.Add(map[string]string{"region": "us-east-1"}))
+
+	failed := errors.New("failed in 1 of 2 regions")
+	assert.Equal(t, failed, closeJSONList(list, failed))
+
+	var got []map[string]string
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	assert.Equal(t, []map[string]string{{"region": "us-east-1"}}, got)
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/taemon1337/ec-manager/pkg/ami"
+)
+
+var (
+	// dryRun plans the command's changes instead of making them
+	dryRun bool
+	// dryRunPlan collects the planned calls of every AMI service the
+	// command creates, and is nil unless --dry-run is set
+	dryRunPlan *ami.Plan
+)
+
+// serviceOptions returns the options every AMI service of the command is
+// created with, auditing calls as made in the account and region of ctx
+func serviceOptions(ctx context.Context) []ami.ServiceOption {
+	opts := []ami.ServiceOption{ami.WithPageSize(pageSize)}
+	switch {
+	case dryRunPlan != nil:
+		opts = append(opts, ami.WithDryRun(dryRunPlan))
+	case auditLog != nil:
+		opts = append(opts, ami.WithAudit(auditLogFor(ctx)))
+	}
+	return opts
+}
+
+// printPlan prints the calls a dry run planned, as text or as JSON
+func printPlan(w io.Writer, plan *ami.Plan) error {
+	calls := plan.Calls()
+	if outputJSON() {
+		data, err := json.MarshalIndent(struct {
+			DryRun bool              `json:"dryRun"`
+			Calls  []ami.PlannedCall `json:"calls"`
+		}{DryRun: true, Calls: calls}, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode JSON output: %w", err)
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return err
+	}
+
+	if len(calls) == 0 {
+		fmt.Fprintln(w, "Dry run: no changes planned")
+		return nil
+	}
+
+	fmt.Fprintf(w, "Dry run: %d API calls planned, nothing was changed\n", len(calls))
+	for i, call := range calls {
+		fmt.Fprintf(w, "%3d. %s", i+1, call.Action)
+		if call.Validation != "" {
+			fmt.Fprintf(w, " (%s", call.Validation)
+			if call.Detail != "" {
+				fmt.Fprintf(w, ": %s", call.Detail)
+			}
+			fmt.Fprint(w, ")")
+		}
+		fmt.Fprintln(w)
+
+		keys := make([]string, 0, len(call.Params))
+		for key := range call.Params {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(w, "       %s: %s\n", key, formatParam(call.Params[key]))
+		}
+	}
+	return nil
+}
+
+// formatParam prints strings as they are and anything else as JSON
+func formatParam(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
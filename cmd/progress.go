@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/taemon1337/ec-manager/pkg/ami"
+)
+
+// progressPrinter returns a callback printing each instance's state changes
+// during a bulk operation as they happen, with the time since it started
+func progressPrinter(w io.Writer) func(ami.Progress) {
+	start := time.Now()
+	return func(p ami.Progress) {
+		elapsed := time.Since(start).Round(time.Second)
+		if p.Err != nil {
+			fmt.Fprintf(w, "%-20s %-9s %5s  %v\n", p.InstanceID, p.State, elapsed, p.Err)
+			return
+		}
+		fmt.Fprintf(w, "%-20s %-9s %5s\n", p.InstanceID, p.State, elapsed)
+	}
+}
+
+// bulkSummary prints how many instances a bulk operation succeeded for, and
+// returns its error listing the ones that failed
+func bulkSummary(w io.Writer, done string, ids []string, err error) error {
+	failed := 0
+	var bulkErr *ami.BulkError
+	if errors.As(err, &bulkErr) {
+		failed = len(bulkErr.Failed)
+	} else if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "%s %d of %d instances\n", done, len(ids)-failed, len(ids))
+	return err
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/taemon1337/ec-manager/pkg/ami"
+)
+
+var (
+	protectOff       bool
+	protectSelection instanceSelection
+)
+
+// protectCmd represents the protect command
+var protectCmd = &cobra.Command{
+	Use:   "protect [INSTANCE...]",
+	Short: "Enable or disable termination protection",
+	Long: `Enable termination protection on EC2 instances selected by instance ID or
+Name tag, with --filter and --name, or disable it with --off. Protected
+instances are refused by delete.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		amiService := ami.NewService(awsClient.GetEC2Client(), serviceOptions(ctx)...)
+
+		ids, err := selectInstanceIDs(ctx, amiService, protectSelection.selector(args, ""))
+		if err != nil {
+			return err
+		}
+
+		state := "Enabled"
+		if protectOff {
+			state = "Disabled"
+		}
+		for _, id := range ids {
+			if err := amiService.SetTerminationProtection(ctx, id, !protectOff); err != nil {
+				return fmt.Errorf("instance %s: %w", id, err)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "%s termination protection for instance %s\n", state, id)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(protectCmd)
+	protectCmd.Flags().BoolVar(&protectOff, "off", false, "Disable termination protection instead of enabling it")
+	addSelectionFlags(protectCmd, &protectSelection)
+}
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+	"github.com/taemon1337/ec-manager/pkg/logger"
+)
+
+// maxConcurrentTargets bounds how many accounts and regions are queried at
+// once by forEachRegion
+const maxConcurrentTargets = 8
+
+var (
+	// regionNames and allRegions select the regions a command runs in
+	regionNames []string
+	allRegions  bool
+	// selectedRegions are the regions resolved from --regions or --all-regions
+	selectedRegions []string
+)
+
+// runsInRegions annotates the commands that run in every region selected
+// with --regions or --all-regions. Other commands reject those flags rather
+// than silently running in --region.
+const runsInRegions = "ec-manager:regions"
+
+// checkRegionsFlags rejects --regions and --all-regions for commands that do
+// not run in the selected regions
+func checkRegionsFlags(cmd *cobra.Command) error {
+	if (len(regionNames) > 0 || allRegions) && cmd.Annotations[runsInRegions] == "" {
+		return fmt.Errorf("%s does not support --regions or --all-regions", cmd.CommandPath())
+	}
+	return nil
+}
+
+// selectRegions resolves --regions, or every region enabled for the account
+// with --all-regions
+func selectRegions(ctx context.Context) error {
+	selectedRegions = nil
+	if allRegions && len(regionNames) > 0 {
+		return fmt.Errorf("--regions and --all-regions cannot be used together")
+	}
+
+	if allRegions {
+		regions, err := awsClient.Regions(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list regions: %w", err)
+		}
+		selectedRegions = regions
+		return nil
+	}
+
+	seen := map[string]bool{}
+	for _, r := range regionNames {
+		r = strings.TrimSpace(r)
+		if r == "" || seen[r] {
+			continue
+		}
+		seen[r] = true
+		selectedRegions = append(selectedRegions, r)
+	}
+	return nil
+}
+
+// regionTargets derives a client in every region from the root client, so
+// the role chain is assumed once and every region shares its credentials,
+// retryer and rate limit
+func regionTargets(regions []string) []accountTarget {
+	targets := make([]accountTarget, len(regions))
+	for i, r := range regions {
+		targets[i] = accountTarget{Region: r, client: awsClient.ForRegion(r)}
+	}
+	return targets
+}
+
+// forEachRegion runs fn in every selected account and region concurrently,
+// or once with the current clients when none are selected. fn passes each
+// result to emit, and handle prints it: immediately with a single target, or
+// in account and region order once every target has finished, so output is
+// never interleaved. A failure in one target does not stop the others; all
+// failures are reported at the end.
+func forEachRegion(cmd *cobra.Command, fn func(ctx context.Context, target accountTarget, emit func(v interface{}) error) error, handle func(target accountTarget, v interface{}) error) error {
+	ctx := cmd.Context()
+	if len(accountTargets) == 0 {
+		target := accountTarget{}
+		return fn(ctx, target, func(v interface{}) error {
+			return handle(target, v)
+		})
+	}
+
+	results := make([][]interface{}, len(accountTargets))
+	errs := make([]error, len(accountTargets))
+	sem := make(chan struct{}, maxConcurrentTargets)
+	var wg sync.WaitGroup
+	for i, target := range accountTargets {
+		wg.Add(1)
+		go func(i int, target accountTarget) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			if err := ctx.Err(); err != nil {
+				errs[i] = err
+				return
+			}
+			logger.Debug("running in target", "account", target.ID, "region", target.Region)
+			errs[i] = fn(targetContext(ctx, target), target, func(v interface{}) error {
+				results[i] = append(results[i], v)
+				return nil
+			})
+		}(i, target)
+	}
+	wg.Wait()
+
+	var failed int
+	for i, target := range accountTargets {
+		for _, v := range results[i] {
+			if err := handle(target, v); err != nil {
+				return err
+			}
+		}
+		if errs[i] != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "%s: %v\n", target.describe(), errs[i])
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("failed in %d of %d %s", failed, len(accountTargets), targetNoun())
+	}
+	return ctx.Err()
+}
+
+// targetNoun names what the selected targets are in failure summaries
+func targetNoun() string {
+	switch {
+	case len(accountNames) > 0 && len(selectedRegions) > 0:
+		return "account regions"
+	case len(selectedRegions) > 0:
+		return "regions"
+	default:
+		return "accounts"
+	}
+}
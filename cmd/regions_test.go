@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/taemon1337/ec-manager/pkg/client"
+	"github.com/taemon1337/ec-manager/pkg/config"
+)
+
+func TestSelectRegions(t *testing.T) {
+	base, err := client.NewClient(true, "", "us-east-1")
+	require.NoError(t, err)
+	awsClient = base
+	defer func() {
+		awsClient, regionNames, allRegions, selectedRegions = nil, nil, false, nil
+	}()
+
+	tests := []struct {
+		name    string
+		regions []string
+		all     bool
+		want    []string
+		wantErr string
+	}{
+		{name: "none"},
+		{name: "listed", regions: []string{"us-west-2", " eu-west-1", "us-west-2"}, want: []string{"us-west-2", "eu-west-1"}},
+		{name: "all", all: true, want: []string{"us-east-1", "us-west-2"}},
+		{name: "both", regions: []string{"us-west-2"}, all: true, wantErr: "--regions and --all-regions cannot be used together"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			regionNames, allRegions = tt.regions, tt.all
+			err := selectRegions(context.Background())
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, selectedRegions)
+		})
+	}
+}
+
+func TestCheckRegionsFlags(t *testing.T) {
+	regionNames = []string{"us-west-2"}
+	t.Cleanup(func() { regionNames, allRegions = nil, false })
+
+	assert.NoError(t, checkRegionsFlags(listInstancesCmd))
+	assert.NoError(t, checkRegionsFlags(newCostRefreshCmd()))
+	assert.EqualError(t, checkRegionsFlags(DeleteCmd), "ec-manager delete does not support --regions or --all-regions")
+	assert.EqualError(t, checkRegionsFlags(listKeysCmd), "ec-manager list keys does not support --regions or --all-regions")
+
+	regionNames, allRegions = nil, true
+	assert.Error(t, checkRegionsFlags(stopCmd))
+
+	allRegions = false
+	assert.NoError(t, checkRegionsFlags(stopCmd))
+}
+
+func TestRegionTargets(t *testing.T) {
+	base, err := client.NewClient(true, "", "us-east-1")
+	require.NoError(t, err)
+	awsClient = base
+	t.Cleanup(func() { awsClient = nil })
+
+	targets := regionTargets([]string{"us-west-2", "eu-west-1"})
+	require.Len(t, targets, 2)
+	for i, r := range []string{"us-west-2", "eu-west-1"} {
+		assert.Equal(t, r, targets[i].Region)
+		assert.Equal(t, r, targets[i].client.Region())
+		// Derived from the root client rather than created and assumed again
+		assert.Same(t, base.GetEC2Client(), targets[i].client.GetEC2Client())
+	}
+}
+
+func TestForEachRegion(t *testing.T) {
+	base, err := client.NewClient(true, "", "us-east-1")
+	require.NoError(t, err)
+
+	cmd := &cobra.Command{}
+	cmd.SetContext(context.Background())
+
+	t.Run("streams without regions", func(t *testing.T) {
+		var handled []interface{}
+		err := forEachRegion(cmd, func(ctx context.Context, target accountTarget, emit func(v interface{}) error) error {
+			assert.Empty(t, target.Region)
+			return emit("i-1")
+		}, func(target accountTarget, v interface{}) error {
+			handled = append(handled, v)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, []interface{}{"i-1"}, handled)
+	})
+
+	t.Run("aggregates in region order and tolerates failures", func(t *testing.T) {
+		selectedRegions = []string{"us-east-1", "ap-south-1", "us-west-2"}
+		accountTargets = []accountTarget{
+			{Region: "us-east-1", client: base.ForAccount("us-east-1")},
+			{Region: "ap-south-1", client: base.ForAccount("ap-south-1")},
+			{Region: "us-west-2", client: base.ForAccount("us-west-2")},
+		}
+		defer func() { selectedRegions, accountTargets = nil, nil }()
+
+		var handled []string
+		err := forEachRegion(cmd, func(ctx context.Context, target accountTarget, emit func(v interface{}) error) error {
+			if target.Region == "ap-south-1" {
+				return errors.New("access denied")
+			}
+			if err := emit(target.Region + "/a"); err != nil {
+				return err
+			}
+			return emit(target.Region + "/b")
+		}, func(target accountTarget, v interface{}) error {
+			handled = append(handled, v.(string))
+			return nil
+		})
+		assert.EqualError(t, err, "failed in 1 of 3 regions")
+		assert.Equal(t, []string{"us-east-1/a", "us-east-1/b", "us-west-2/a", "us-west-2/b"}, handled)
+	})
+
+	t.Run("account-only commands reject regions", func(t *testing.T) {
+		selectedRegions = []string{"us-west-2"}
+		defer func() { selectedRegions = nil }()
+
+		err := forEachAccount(cmd, func(ctx context.Context, account accountTarget) error {
+			return nil
+		})
+		assert.ErrorContains(t, err, "does not support --regions")
+	})
+}
+
+func TestWithAccountRegion(t *testing.T) {
+	v := map[string]string{"InstanceId": "i-123"}
+
+	tagged, err := withAccount(accountTarget{
+		Account: config.Account{ID: "111111111111"},
+		Region:  "us-west-2",
+	}, v)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"InstanceId": "i-123",
+		"Account":    "111111111111",
+		"Region":     "us-west-2",
+	}, tagged)
+}
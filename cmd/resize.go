@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/taemon1337/ec-manager/pkg/ami"
+)
+
+// NewResizeCmd creates the resize command
+func NewResizeCmd() *cobra.Command {
+	var instanceID, instanceType string
+	var selection instanceSelection
+
+	cmd := &cobra.Command{
+		Use:   "resize [INSTANCE...] --type TYPE",
+		Short: "Change the type of EC2 instances in place",
+		Long: `Change the instance type of EC2 instances without replacing them. Instances
+are selected by instance ID or Name tag, with --filter and --name.
+
+The new type must support the architecture and virtualization type of each
+instance's AMI, and ENA must be enabled on the instance when the type
+requires it. Running instances are
+stopped, changed and started again; an instance that does not start with the
+new type is changed back to its original type and started. Stopped instances
+are only changed. Instances are resized one at a time, printing each one's
+progress; the command fails listing the instances that could not be resized.`,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if instanceType == "" {
+				return fmt.Errorf("--type is required")
+			}
+
+			ctx := cmd.Context()
+			amiService := amiServiceFor(ctx)
+			ids, err := selectInstanceIDs(ctx, amiService, selection.selector(args, instanceID))
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			progress := progressPrinter(out)
+			failed := map[string]error{}
+			for _, id := range ids {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				if err := amiService.ResizeInstance(ctx, id, instanceType, progress); err != nil {
+					fmt.Fprintf(out, "%-20s %v\n", id, err)
+					failed[id] = err
+				}
+			}
+
+			if len(failed) > 0 {
+				err = &ami.BulkError{Op: "resize", Total: len(ids), Failed: failed}
+			}
+			return bulkSummary(out, "Resized", ids, err)
+		},
+	}
+
+	cmd.Flags().StringVarP(&instanceID, "instance", "i", "", "Instance ID or Name tag to resize")
+	cmd.Flags().StringVarP(&instanceType, "type", "t", "", "New instance type")
+	addSelectionFlags(cmd, &selection)
+
+	return cmd
+}
+
+func init() {
+	rootCmd.AddCommand(NewResizeCmd())
+}
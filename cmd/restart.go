@@ -1,41 +1,39 @@
 package cmd
 
 import (
-	"fmt"
-
 	"github.com/spf13/cobra"
 )
 
-var restartInstanceID string
+var (
+	restartInstanceID string
+	restartSelection  instanceSelection
+)
 
 var restartCmd = &cobra.Command{
-	Use:   "restart",
-	Short: "Restart an EC2 instance",
-	Long:  `Restart an EC2 instance by stopping and starting it.`,
+	Use:   "restart [INSTANCE...]",
+	Short: "Restart EC2 instances",
+	Long: `Restart EC2 instances by stopping and starting them. Instances are selected
+by instance ID or Name tag, with --filter and --name. All instances are
+stopped together, then the ones that stopped are started together, printing
+each one's progress; the command fails listing the instances that could not
+be restarted.`,
+	SilenceUsage: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if restartInstanceID == "" {
-			return fmt.Errorf("instance ID must be set")
-		}
-
 		ctx := cmd.Context()
-		amiService := awsClient.GetAMIService()
+		amiService := amiServiceFor(ctx)
 
-		fmt.Printf("Restarting instance %s...\n", restartInstanceID)
-		err := amiService.RestartInstance(ctx, restartInstanceID)
+		ids, err := selectInstanceIDs(ctx, amiService, restartSelection.selector(args, restartInstanceID))
 		if err != nil {
-			return fmt.Errorf("failed to restart instance: %v", err)
+			return err
 		}
 
-		fmt.Printf("Successfully restarted instance %s\n", restartInstanceID)
-		return nil
+		err = amiService.RestartInstances(ctx, ids, progressPrinter(cmd.OutOrStdout()))
+		return bulkSummary(cmd.OutOrStdout(), "Restarted", ids, err)
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(restartCmd)
-	restartCmd.Flags().StringVarP(&restartInstanceID, "instance", "i", "", "Instance ID to restart")
-	if err := restartCmd.MarkFlagRequired("instance"); err != nil {
-		// This should only happen during development if we make a mistake with flag names
-		panic(fmt.Sprintf("failed to mark flag as required: %v", err))
-	}
+	restartCmd.Flags().StringVarP(&restartInstanceID, "instance", "i", "", "Instance ID or Name tag to restart")
+	addSelectionFlags(restartCmd, &restartSelection)
 }
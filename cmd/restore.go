@@ -30,7 +30,12 @@ var restoreCmd = &cobra.Command{
 			ec2Client = awsClient.GetEC2Client()
 		}
 
-		amiService := ami.NewService(ec2Client)
+		amiService := ami.NewService(ec2Client, serviceOptions(ctx)...)
+
+		restoreInstanceID, err := amiService.ResolveInstanceID(ctx, restoreInstance)
+		if err != nil {
+			return fmt.Errorf("failed to find instance: %w", err)
+		}
 
 		if restoreVersion != "" {
 			// Get instance OS
@@ -46,13 +51,13 @@ var restoreCmd = &cobra.Command{
 			}
 
 			// Migrate to this version
-			newInstanceID, err := amiService.MigrateInstance(ctx, restoreInstanceID, *ami.ImageId)
+			result, err := amiService.MigrateInstance(ctx, restoreInstanceID, *ami.ImageId)
 			if err != nil {
 				return err
 			}
 
 			fmt.Printf("Successfully restored instance %s to version %s (new instance: %s)\n",
-				restoreInstanceID, restoreVersion, newInstanceID)
+				restoreInstanceID, restoreVersion, result.InstanceID)
 			return nil
 		}
 
@@ -61,8 +66,7 @@ var restoreCmd = &cobra.Command{
 		}
 
 		// Restore from snapshot
-		err := amiService.RestoreInstance(ctx, restoreInstanceID, snapshotID)
-		if err != nil {
+		if err := amiService.RestoreInstance(ctx, restoreInstanceID, snapshotID); err != nil {
 			return err
 		}
 
@@ -72,15 +76,15 @@ var restoreCmd = &cobra.Command{
 }
 
 var (
-	restoreInstanceID string
-	snapshotID        string
-	restoreVersion    string
+	restoreInstance string
+	snapshotID      string
+	restoreVersion  string
 )
 
 func init() {
 	rootCmd.AddCommand(restoreCmd)
 
-	restoreCmd.Flags().StringVarP(&restoreInstanceID, "instance-id", "i", "", "Instance ID to restore")
+	restoreCmd.Flags().StringVarP(&restoreInstance, "instance-id", "i", "", "Instance ID, Name tag, private IP or private DNS name to restore")
 	restoreCmd.Flags().StringVarP(&snapshotID, "snapshot", "s", "", "Snapshot ID to restore from (optional if using --version)")
 	restoreCmd.Flags().StringVarP(&restoreVersion, "version", "v", "", "Version to restore to (optional if using --snapshot)")
 
@@ -1,17 +1,44 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/taemon1337/ec-manager/pkg/ami"
 	"github.com/taemon1337/ec-manager/pkg/client"
+	"github.com/taemon1337/ec-manager/pkg/config"
+	"github.com/taemon1337/ec-manager/pkg/logger"
 )
 
 var (
 	awsClient *client.Client
 	mockMode  bool
 	region    string
+	pageSize  int32
+	logLevel  string
+
+	// awsProfile, region and outputFormat fall back to the active context
+	// from the configuration file when their flags are not set
+	awsProfile    string
+	outputFormat  string
+	configPath    string
+	contextName   string
+	activeContext config.Context
+
+	// retryPolicy is applied to every AWS API call made by the command
+	retryPolicy = client.DefaultRetryPolicy()
+
+	// timeout bounds the whole command, waitTimeout bounds each waiter
+	timeout           time.Duration
+	waitTimeout       time.Duration
+	operationTimeouts map[string]string
+	cancelTimeout     context.CancelFunc
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -23,11 +50,64 @@ var rootCmd = &cobra.Command{
 - Migrating instances to new AMIs
 - Restoring instances from backups`,
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		logger.Init(logger.LogLevel(logLevel))
+
+		if err := applyTimeouts(cmd); err != nil {
+			return err
+		}
+
+		if err := loadContext(cmd); err != nil {
+			return err
+		}
+		if err := checkAccountsFlag(cmd); err != nil {
+			return err
+		}
+		if err := checkRegionsFlags(cmd); err != nil {
+			return err
+		}
+
+		if !mockMode {
+			refreshSSOToken(cmd)
+		}
+
 		var err error
-		awsClient, err = client.NewClient(mockMode, "", region)
+		awsClient, err = client.NewClient(mockMode, awsProfile, region, clientOptions(cmd.Context())...)
 		if err != nil {
 			return fmt.Errorf("failed to create AWS client: %w", err)
 		}
+		if err := selectRegions(cmd.Context()); err != nil {
+			return err
+		}
+
+		// Calls are only validated with DryRun against real AWS
+		dryRunPlan = nil
+		if dryRun {
+			dryRunPlan = ami.NewPlan(!mockMode)
+		}
+
+		// Dry runs and mock mode change nothing, so there is nothing to audit
+		auditLog = nil
+		if !dryRun && !mockMode {
+			if auditLog, err = newAuditLogger(); err != nil {
+				return err
+			}
+		}
+		return selectAccountTargets(cmd.Context())
+	},
+	PersistentPostRunE: func(cmd *cobra.Command, args []string) error {
+		if cancelTimeout != nil {
+			cancelTimeout()
+		}
+		if awsClient != nil {
+			if stats := awsClient.RetryStats(); stats.Retries > 0 {
+				logger.Info("AWS API calls were retried",
+					"retries", stats.Retries,
+					"throttled", stats.Throttles)
+			}
+		}
+		if dryRunPlan != nil {
+			return printPlan(cmd.OutOrStdout(), dryRunPlan)
+		}
 		return nil
 	},
 }
@@ -37,10 +117,120 @@ func NewRootCmd() *cobra.Command {
 	return rootCmd
 }
 
+// clientOptions returns the options every AWS client of the command is
+// created with
+func clientOptions(ctx context.Context) []client.Option {
+	opts := []client.Option{
+		client.WithContext(ctx),
+		client.WithPageSize(pageSize),
+		client.WithRetryPolicy(retryPolicy),
+		client.WithRoleChain(roleChain(len(accountNames) > 0)...),
+	}
+	// Without a chain every account role is assumed with the user's own
+	// credentials, and an MFA code cannot be used for more than one of them
+	if len(accountNames) > 0 && len(assumeRoles) == 0 && mfaSerialID != "" {
+		opts = append(opts, client.WithMFASession(mfaSerialID, mfaTokenProvider()))
+	}
+	return opts
+}
+
+// loadContext resolves the active configuration context and applies its
+// defaults to the global flags that were not set on the command line
+func loadContext(cmd *cobra.Command) error {
+	file, err := loadConfigFile()
+	if err != nil {
+		return err
+	}
+
+	activeContext, err = file.Resolve(contextName)
+	if err != nil {
+		return fmt.Errorf("failed to load context: %w", err)
+	}
+	auditConfig = file.Audit
+
+	flags := cmd.Flags()
+	if !flags.Changed("profile") && activeContext.Profile != "" {
+		awsProfile = activeContext.Profile
+	}
+	if !flags.Changed("region") && activeContext.Region != "" {
+		region = activeContext.Region
+	}
+	if !flags.Changed("output") && activeContext.Output != "" {
+		outputFormat = activeContext.Output
+	}
+	if !flags.Changed("assume-role") && len(activeContext.AssumeRole) > 0 {
+		assumeRoles = activeContext.AssumeRole
+	}
+	if !flags.Changed("external-id") && activeContext.ExternalID != "" {
+		externalID = activeContext.ExternalID
+	}
+	if !flags.Changed("mfa-serial") && activeContext.MFASerial != "" {
+		mfaSerialID = activeContext.MFASerial
+	}
+
+	if err := config.ValidateOutput(outputFormat); err != nil {
+		return fmt.Errorf("invalid --output: %w", err)
+	}
+	return nil
+}
+
+// configFilePath returns the --config path or the default location
+func configFilePath() (string, error) {
+	if configPath != "" {
+		return configPath, nil
+	}
+	return config.DefaultConfigPath()
+}
+
+// loadConfigFile reads the configuration file, which may not exist yet
+func loadConfigFile() (*config.File, error) {
+	path, err := configFilePath()
+	if err != nil {
+		return nil, err
+	}
+	return config.LoadFile(path)
+}
+
+// applyTimeouts configures waiter timeouts and bounds the command's context
+// by the global --timeout
+func applyTimeouts(cmd *cobra.Command) error {
+	if waitTimeout <= 0 {
+		return fmt.Errorf("--wait-timeout must be positive")
+	}
+	config.SetTimeout(waitTimeout)
+
+	if err := config.SetOperationTimeouts(operationTimeouts); err != nil {
+		return fmt.Errorf("invalid --operation-timeout: %w", err)
+	}
+
+	if timeout > 0 {
+		ctx, cancel := context.WithTimeout(cmd.Context(), timeout)
+		cancelTimeout = cancel
+		cmd.SetContext(ctx)
+	}
+	return nil
+}
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() error {
-	if err := rootCmd.Execute(); err != nil {
+	// The first Ctrl-C cancels the root context so in-flight AWS calls and
+	// waiters return promptly; a second one terminates immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
+		switch {
+		case ctx.Err() != nil:
+			fmt.Fprintln(os.Stderr, "Interrupted: in-flight operations were cancelled")
+			os.Exit(130)
+		case errors.Is(err, context.DeadlineExceeded):
+			fmt.Fprintf(os.Stderr, "Timed out: command did not finish within --timeout %s\n", timeout)
+		}
 		os.Exit(1)
 		return err
 	}
@@ -49,5 +239,25 @@ func Execute() error {
 
 func init() {
 	rootCmd.PersistentFlags().BoolVar(&mockMode, "mock", false, "Use mock mode for testing")
+	rootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "Print the changes the command would make, validated with EC2 DryRun, without making them")
 	rootCmd.PersistentFlags().StringVar(&region, "region", "us-east-1", "AWS region to use")
+	rootCmd.PersistentFlags().StringVar(&awsProfile, "profile", "", "AWS shared config profile to use")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", config.OutputText, "Output format (text, json)")
+	rootCmd.PersistentFlags().StringVar(&configPath, "config", "", "Path to the configuration file (default ~/.config/ec-manager/config.yaml)")
+	rootCmd.PersistentFlags().StringVar(&contextName, "context", "", "Configuration context to use instead of the current context")
+	rootCmd.PersistentFlags().StringSliceVar(&assumeRoles, "assume-role", nil, "Role ARN to assume for the command; repeat to chain roles, e.g. through a hub account")
+	rootCmd.PersistentFlags().StringVar(&externalID, "external-id", "", "External ID passed when assuming the last role")
+	rootCmd.PersistentFlags().StringVar(&mfaSerialID, "mfa-serial", "", "MFA device serial number used when assuming the first role")
+	rootCmd.PersistentFlags().StringVar(&mfaCode, "mfa-token", "", "MFA token code (prompted for when needed and not given)")
+	rootCmd.PersistentFlags().StringSliceVar(&accountNames, "accounts", nil, "Run in these accounts from the context, by name or ID, or 'all'")
+	rootCmd.PersistentFlags().StringSliceVar(&regionNames, "regions", nil, "Run in these regions concurrently, e.g. us-east-1,us-west-2 (list instances, amis and backups, check migrate and cost refresh)")
+	rootCmd.PersistentFlags().BoolVar(&allRegions, "all-regions", false, "Run in every region enabled for the account (list instances, amis and backups, check migrate and cost refresh)")
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", string(logger.InfoLevel), "Log level (debug, info, warn, error)")
+	rootCmd.PersistentFlags().StringVar(&retryPolicy.Mode, "retry-mode", retryPolicy.Mode, "Retry mode for AWS API calls (standard, adaptive)")
+	rootCmd.PersistentFlags().IntVar(&retryPolicy.MaxAttempts, "max-attempts", retryPolicy.MaxAttempts, "Maximum attempts per AWS API call, including the first")
+	rootCmd.PersistentFlags().DurationVar(&retryPolicy.MaxBackoff, "max-backoff", retryPolicy.MaxBackoff, "Maximum delay between retries of an AWS API call")
+	rootCmd.PersistentFlags().DurationVar(&timeout, "timeout", 0, "Maximum time the whole command may run (0 means no limit)")
+	rootCmd.PersistentFlags().DurationVar(&waitTimeout, "wait-timeout", config.GetTimeout(), "Maximum time to wait for a resource to change state")
+	rootCmd.PersistentFlags().StringToStringVar(&operationTimeouts, "operation-timeout", nil, "Per-operation wait timeouts, e.g. instance-stopped=10m (operations: instance-running, instance-stopped, instance-terminated, volume-available, image-available)")
+	rootCmd.PersistentFlags().Int32Var(&pageSize, "page-size", 0, "Number of results to request per page from list APIs (0 uses the service default)")
 }
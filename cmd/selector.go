@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/spf13/cobra"
+	"github.com/taemon1337/ec-manager/pkg/ami"
+)
+
+// instanceSelection holds the selector flags shared by instance commands
+type instanceSelection struct {
+	filters []string
+	names   []string
+}
+
+// addSelectionFlags adds --filter and --name to an instance command
+func addSelectionFlags(cmd *cobra.Command, sel *instanceSelection) {
+	cmd.Flags().StringArrayVar(&sel.filters, "filter", nil, "Select instances matching key=value, e.g. state=running or tag:Env=prod (repeatable)")
+	cmd.Flags().StringArrayVar(&sel.names, "name", nil, "Select instances whose Name tag matches a pattern, e.g. web-* (repeatable)")
+}
+
+// selector combines the flags with the instance IDs or Name tags given as
+// arguments and with the command's instance flag
+func (s *instanceSelection) selector(args []string, instance string) ami.Selector {
+	sel := ami.Selector{Filters: s.filters, Names: s.names}
+	sel.Refs = append(sel.Refs, args...)
+	if instance != "" {
+		sel.Refs = append(sel.Refs, instance)
+	}
+	return sel
+}
+
+// selectInstances resolves a selection to instances. An empty selection is
+// an error, so a command never acts on every instance by accident.
+func selectInstances(ctx context.Context, amiService *ami.Service, sel ami.Selector) ([]ec2types.Instance, error) {
+	if sel.IsEmpty() {
+		return nil, fmt.Errorf("no instances selected: pass instance IDs or Name tags, --filter or --name")
+	}
+
+	instances, err := amiService.SelectInstances(ctx, sel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select instances: %w", err)
+	}
+	if len(instances) == 0 {
+		return nil, fmt.Errorf("no instances match the selection")
+	}
+	return instances, nil
+}
+
+// selectInstanceIDs resolves a selection to instance IDs, like
+// selectInstances
+func selectInstanceIDs(ctx context.Context, amiService *ami.Service, sel ami.Selector) ([]string, error) {
+	instances, err := selectInstances(ctx, amiService, sel)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, len(instances))
+	for i, instance := range instances {
+		ids[i] = aws.ToString(instance.InstanceId)
+	}
+	return ids, nil
+}
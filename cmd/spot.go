@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/taemon1337/ec-manager/pkg/ami"
+)
+
+// spotFlags holds the Spot request flags shared by create and migrate
+type spotFlags struct {
+	spot         bool
+	requestType  string
+	maxPrice     string
+	interruption string
+}
+
+// addSpotFlags adds --spot and its options to a command that launches
+// instances
+func addSpotFlags(cmd *cobra.Command, f *spotFlags) {
+	cmd.Flags().BoolVar(&f.spot, "spot", false, "Request Spot capacity, falling back to on-demand when there is none")
+	cmd.Flags().StringVar(&f.requestType, "spot-type", "", "Spot request type: one-time (default) or persistent")
+	cmd.Flags().StringVar(&f.maxPrice, "spot-max-price", "", "Highest hourly Spot price in USD (default: the on-demand price)")
+	cmd.Flags().StringVar(&f.interruption, "spot-interruption", "", "What an interrupted Spot instance does: terminate, stop or hibernate (default: terminate for one-time, stop for persistent requests)")
+}
+
+// config returns the Spot request the flags describe, or nil without --spot
+func (f *spotFlags) config() (*ami.SpotConfig, error) {
+	if !f.spot {
+		if f.requestType != "" || f.maxPrice != "" || f.interruption != "" {
+			return nil, fmt.Errorf("--spot-type, --spot-max-price and --spot-interruption need --spot")
+		}
+		return nil, nil
+	}
+
+	spot := &ami.SpotConfig{Type: f.requestType, MaxPrice: f.maxPrice, InterruptionBehavior: f.interruption}
+	if err := spot.Validate(); err != nil {
+		return nil, err
+	}
+	return spot, nil
+}
@@ -1,11 +1,11 @@
 package cmd
 
 import (
-	"context"
 	"fmt"
 	"os"
 	"os/exec"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/spf13/cobra"
 	"github.com/taemon1337/ec-manager/pkg/ami"
 )
@@ -18,21 +18,31 @@ var (
 
 // sshCmd represents the ssh command
 var sshCmd = &cobra.Command{
-	Use:   "ssh",
+	Use:   "ssh [INSTANCE]",
 	Short: "SSH into an EC2 instance",
-	Long:  `SSH into an EC2 instance using its instance ID and the specified key pair.`,
+	Long: `SSH into an EC2 instance using the specified key pair. The instance is given
+by instance ID, Name tag, private IP address or private DNS name.`,
+	Args: cobra.MaximumNArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		ctx := context.Background()
-		amiService := ami.NewService(awsClient.GetEC2Client())
+		ctx := cmd.Context()
+		amiService := ami.NewService(awsClient.GetEC2Client(), serviceOptions(ctx)...)
+
+		ref := sshInstanceID
+		if len(args) > 0 {
+			ref = args[0]
+		}
+		if ref == "" {
+			return fmt.Errorf("an instance must be given as an argument or with --instance")
+		}
 
 		// Get instance details
-		instance, err := amiService.GetInstance(ctx, sshInstanceID)
+		instance, err := amiService.ResolveInstance(ctx, ref)
 		if err != nil {
 			return fmt.Errorf("failed to get instance details: %w", err)
 		}
 
 		if instance.PublicIpAddress == nil {
-			return fmt.Errorf("instance %s does not have a public IP address", sshInstanceID)
+			return fmt.Errorf("instance %s does not have a public IP address", aws.ToString(instance.InstanceId))
 		}
 
 		// Prepare SSH command
@@ -56,13 +66,10 @@ var sshCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(sshCmd)
 
-	sshCmd.Flags().StringVarP(&sshInstanceID, "instance", "i", "", "Instance ID to SSH into")
+	sshCmd.Flags().StringVarP(&sshInstanceID, "instance", "i", "", "Instance ID, Name tag, private IP or private DNS name to SSH into")
 	sshCmd.Flags().StringVarP(&sshKeyPath, "key", "k", "", "Path to SSH private key file")
 	sshCmd.Flags().StringVarP(&sshUser, "user", "u", "ec2-user", "SSH user (default: ec2-user)")
 
-	if err := sshCmd.MarkFlagRequired("instance"); err != nil {
-		panic(err)
-	}
 	if err := sshCmd.MarkFlagRequired("key"); err != nil {
 		panic(err)
 	}
@@ -0,0 +1,279 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	ecconfig "github.com/taemon1337/ec-manager/pkg/config"
+	"github.com/taemon1337/ec-manager/pkg/logger"
+	"github.com/taemon1337/ec-manager/pkg/sso"
+)
+
+var (
+	ssoStartURL string
+	ssoRegion   string
+	ssoEndpoint string
+	ssoAccount  string
+	ssoRole     string
+	ssoForce    bool
+)
+
+// ssoCmd groups the IAM Identity Center commands
+var ssoCmd = &cobra.Command{
+	Use:   "sso",
+	Short: "Sign in with AWS IAM Identity Center (SSO)",
+	Long: `Sign in with AWS IAM Identity Center (SSO) and choose the account and role
+used by a profile.
+
+The start URL and SSO region are read from the profile selected with --profile
+or the configuration context, and can be overridden with --start-url and
+--sso-region. Tokens are cached in ~/.aws/sso/cache like the AWS CLI does and
+are refreshed automatically before they expire.`,
+	// Signing in must work before any credentials exist
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		logger.Init(logger.LogLevel(logLevel))
+		if err := applyTimeouts(cmd); err != nil {
+			return err
+		}
+		return loadContext(cmd)
+	},
+}
+
+var ssoLoginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Sign in and select the account and role for the profile",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		p, c, err := newSSOClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		token, err := c.Login(ctx, ssoForce)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Signed in to %s (session expires %s)\n", p.SSOStartURL, token.ExpiresAt.Local().Format(time.RFC1123))
+
+		prompt := newPrompter(cmd.InOrStdin(), os.Stdout)
+		if err := selectSSORole(cmd, c, prompt, &p); err != nil {
+			return err
+		}
+
+		if p.Region == "" {
+			p.Region = region
+		}
+		if err := ecconfig.SaveProfile(p); err != nil {
+			return fmt.Errorf("failed to save profile: %w", err)
+		}
+		fmt.Printf("Profile %s uses role %s in account %s\n", p.Name, p.SSORoleName, p.SSOAccountID)
+		return nil
+	},
+}
+
+var ssoAccountsCmd = &cobra.Command{
+	Use:   "accounts",
+	Short: "List the accounts and roles available to the signed-in user",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		_, c, err := newSSOClient(cmd)
+		if err != nil {
+			return err
+		}
+
+		accounts, err := c.Accounts(ctx)
+		if err != nil {
+			return err
+		}
+		if len(accounts) == 0 {
+			fmt.Println("No accounts found")
+			return nil
+		}
+
+		for _, account := range accounts {
+			roles, err := c.AccountRoles(ctx, account.ID)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Account: %s (%s)\n", account.ID, account.Name)
+			for _, role := range roles {
+				fmt.Printf("  Role: %s\n", role)
+			}
+		}
+		return nil
+	},
+}
+
+var ssoLogoutCmd = &cobra.Command{
+	Use:   "logout",
+	Short: "Sign out and remove the cached SSO token",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		p, c, err := newSSOClient(cmd)
+		if err != nil {
+			return err
+		}
+		if err := c.Logout(cmd.Context()); err != nil {
+			return err
+		}
+		fmt.Printf("Signed out of %s\n", p.SSOStartURL)
+		return nil
+	},
+}
+
+// ssoProfileName returns the profile the sso commands read and update
+func ssoProfileName() string {
+	if awsProfile != "" {
+		return awsProfile
+	}
+	if env := os.Getenv("AWS_PROFILE"); env != "" {
+		return env
+	}
+	return "default"
+}
+
+// newSSOClient resolves the SSO settings of the selected profile, applying
+// flag overrides, and creates a client for them
+func newSSOClient(cmd *cobra.Command) (ecconfig.Profile, *sso.Client, error) {
+	p, _, err := ecconfig.LoadProfile(ssoProfileName())
+	if err != nil {
+		return p, nil, fmt.Errorf("failed to load profile: %w", err)
+	}
+
+	if ssoStartURL != "" {
+		p.SSOStartURL = ssoStartURL
+	}
+	if ssoRegion != "" {
+		p.SSORegion = ssoRegion
+	}
+	if p.SSORegion == "" {
+		p.SSORegion = region
+	}
+	if p.SSOStartURL == "" {
+		return p, nil, fmt.Errorf("profile %s has no SSO start URL, pass --start-url or configure it with 'ec-manager aws %s'", p.Name, p.Name)
+	}
+
+	opts := []sso.Option{sso.WithOutput(cmd.ErrOrStderr())}
+	if ssoEndpoint != "" {
+		opts = append(opts, sso.WithEndpoint(ssoEndpoint))
+	}
+
+	c, err := sso.NewClient(p.SSOStartURL, p.SSORegion, opts...)
+	if err != nil {
+		return p, nil, err
+	}
+	return p, c, nil
+}
+
+// selectSSORole sets the profile's account and role from the flags, or asks
+// for them when they are not given and there is more than one choice
+func selectSSORole(cmd *cobra.Command, c *sso.Client, prompt *prompter, p *ecconfig.Profile) error {
+	ctx := cmd.Context()
+
+	if ssoAccount != "" {
+		p.SSOAccountID = ssoAccount
+	} else {
+		accounts, err := c.Accounts(ctx)
+		if err != nil {
+			return err
+		}
+		if len(accounts) == 0 {
+			return fmt.Errorf("no accounts are assigned to this SSO user")
+		}
+
+		ids := make([]string, len(accounts))
+		labels := make([]string, len(accounts))
+		for i, a := range accounts {
+			ids[i] = a.ID
+			labels[i] = fmt.Sprintf("%s (%s)", a.ID, a.Name)
+		}
+		if p.SSOAccountID, err = pickOne(prompt, "Account", ids, labels, p.SSOAccountID); err != nil {
+			return err
+		}
+	}
+
+	if ssoRole != "" {
+		p.SSORoleName = ssoRole
+		return nil
+	}
+
+	roles, err := c.AccountRoles(ctx, p.SSOAccountID)
+	if err != nil {
+		return err
+	}
+	if len(roles) == 0 {
+		return fmt.Errorf("no roles are available in account %s", p.SSOAccountID)
+	}
+	p.SSORoleName, err = pickOne(prompt, "Role", roles, roles, p.SSORoleName)
+	return err
+}
+
+// pickOne asks for one of values, accepted either as the value itself or its
+// number in the printed list. A single value is chosen without asking.
+func pickOne(prompt *prompter, label string, values, labels []string, current string) (string, error) {
+	if len(values) == 1 {
+		return values[0], nil
+	}
+
+	def := values[0]
+	for i, v := range values {
+		if v == current {
+			def = v
+		}
+		fmt.Fprintf(prompt.out, "  %d) %s\n", i+1, labels[i])
+	}
+
+	for {
+		answer, err := prompt.ask(label, def)
+		if err != nil {
+			return "", err
+		}
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(values) {
+			return values[n-1], nil
+		}
+		for _, v := range values {
+			if v == answer {
+				return v, nil
+			}
+		}
+		fmt.Fprintf(prompt.out, "Please enter a number between 1 and %d\n", len(values))
+	}
+}
+
+// refreshSSOToken refreshes the cached token of an SSO profile before the SDK
+// reads it, since the SDK only refreshes tokens of sso-session profiles
+func refreshSSOToken(cmd *cobra.Command) {
+	p, found, err := ecconfig.LoadProfile(ssoProfileName())
+	if err != nil || !found || p.Kind() != ecconfig.ProfileSSO {
+		return
+	}
+
+	c, err := sso.NewClient(p.SSOStartURL, p.SSORegion, sso.WithOutput(cmd.ErrOrStderr()))
+	if err != nil {
+		return
+	}
+	if _, err := c.Token(cmd.Context()); err != nil {
+		logger.Debug("SSO token not refreshed", "profile", p.Name, "error", err)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(ssoCmd)
+	ssoCmd.AddCommand(ssoLoginCmd, ssoAccountsCmd, ssoLogoutCmd)
+
+	ssoCmd.PersistentFlags().StringVar(&ssoStartURL, "start-url", "", "SSO start URL (defaults to the profile's sso_start_url)")
+	ssoCmd.PersistentFlags().StringVar(&ssoRegion, "sso-region", "", "Region of the SSO instance (defaults to the profile's sso_region)")
+	ssoCmd.PersistentFlags().StringVar(&ssoEndpoint, "sso-endpoint", "", "Override the SSO OIDC and portal endpoint, e.g. a local stand-in for testing")
+	if err := ssoCmd.PersistentFlags().MarkHidden("sso-endpoint"); err != nil {
+		panic(err)
+	}
+
+	ssoLoginCmd.Flags().StringVar(&ssoAccount, "account", "", "Account ID to use (prompted for when there are several)")
+	ssoLoginCmd.Flags().StringVar(&ssoRole, "role", "", "Role name to use (prompted for when there are several)")
+	ssoLoginCmd.Flags().BoolVar(&ssoForce, "force", false, "Sign in again even if the cached token is still valid")
+}
@@ -1,42 +1,44 @@
 package cmd
 
 import (
-	"fmt"
-
 	"github.com/spf13/cobra"
 )
 
 var startCmd = &cobra.Command{
-	Use:   "start",
-	Short: "Start an EC2 instance",
-	Long:  `Start a stopped EC2 instance by its instance ID.`,
+	Use:   "start [INSTANCE...]",
+	Short: "Start EC2 instances",
+	Long: `Start stopped EC2 instances, selected by instance ID or Name tag, with
+--filter and --name. Instances are started together and each one's progress
+is printed as it changes state; the command fails listing the instances that
+could not be started. For example:
+
+  ec-manager start web-1 web-2
+  ec-manager start --filter tag:Env=dev --filter state=stopped`,
+	SilenceUsage: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		amiService := awsClient.GetAMIService()
+		ctx := cmd.Context()
+		amiService := amiServiceFor(ctx)
 
-		err := amiService.StartInstance(cmd.Context(), startInstanceID)
+		ids, err := selectInstanceIDs(ctx, amiService, startSelection.selector(args, startInstanceID))
 		if err != nil {
-			return fmt.Errorf("failed to start instance: %w", err)
+			return err
 		}
 
-		fmt.Printf("Successfully started instance %s\n", startInstanceID)
-		return nil
+		err = amiService.StartInstances(ctx, ids, progressPrinter(cmd.OutOrStdout()))
+		return bulkSummary(cmd.OutOrStdout(), "Started", ids, err)
 	},
 }
 
 var (
 	// Instance ID to start
 	startInstanceID string
+	startSelection  instanceSelection
 )
 
 func init() {
 	rootCmd.AddCommand(startCmd)
 
 	// Add flags
-	startCmd.Flags().StringVarP(&startInstanceID, "instance", "i", "", "Instance ID to start")
-
-	// Mark required flags
-	if err := startCmd.MarkFlagRequired("instance"); err != nil {
-		// This should only happen during development if we make a mistake with flag names
-		panic(fmt.Sprintf("failed to mark flag as required: %v", err))
-	}
+	startCmd.Flags().StringVarP(&startInstanceID, "instance", "i", "", "Instance ID or Name tag to start")
+	addSelectionFlags(startCmd, &startSelection)
 }
@@ -1,41 +1,41 @@
 package cmd
 
 import (
-	"fmt"
-
 	"github.com/spf13/cobra"
 )
 
-var stopInstanceID string
+var (
+	stopInstanceID string
+	stopSelection  instanceSelection
+)
 
 var stopCmd = &cobra.Command{
-	Use:   "stop",
-	Short: "Stop an EC2 instance",
-	Long:  `Stop a running EC2 instance by its instance ID.`,
+	Use:   "stop [INSTANCE...]",
+	Short: "Stop EC2 instances",
+	Long: `Stop running EC2 instances, selected by instance ID or Name tag, with
+--filter and --name. Instances are stopped together and each one's progress
+is printed as it changes state; the command fails listing the instances that
+could not be stopped. For example:
+
+  ec-manager stop web-1
+  ec-manager stop --name 'web-*' --filter state=running`,
+	SilenceUsage: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		if stopInstanceID == "" {
-			return fmt.Errorf("instance ID must be set")
-		}
-
 		ctx := cmd.Context()
-		amiService := awsClient.GetAMIService()
+		amiService := amiServiceFor(ctx)
 
-		fmt.Printf("Stopping instance %s...\n", stopInstanceID)
-		err := amiService.StopInstance(ctx, stopInstanceID)
+		ids, err := selectInstanceIDs(ctx, amiService, stopSelection.selector(args, stopInstanceID))
 		if err != nil {
-			return fmt.Errorf("failed to stop instance: %v", err)
+			return err
 		}
 
-		fmt.Printf("Successfully stopped instance %s\n", stopInstanceID)
-		return nil
+		err = amiService.StopInstances(ctx, ids, progressPrinter(cmd.OutOrStdout()))
+		return bulkSummary(cmd.OutOrStdout(), "Stopped", ids, err)
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(stopCmd)
-	stopCmd.Flags().StringVarP(&stopInstanceID, "instance", "i", "", "Instance ID to stop")
-	if err := stopCmd.MarkFlagRequired("instance"); err != nil {
-		// This should only happen during development if we make a mistake with flag names
-		panic(fmt.Sprintf("failed to mark flag as required: %v", err))
-	}
+	stopCmd.Flags().StringVarP(&stopInstanceID, "instance", "i", "", "Instance ID or Name tag to stop")
+	addSelectionFlags(stopCmd, &stopSelection)
 }
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/taemon1337/ec-manager/pkg/ami"
+	"github.com/taemon1337/ec-manager/pkg/audit"
+	mockclient "github.com/taemon1337/ec-manager/pkg/mock"
+	"github.com/taemon1337/ec-manager/pkg/mock/waiters"
+	ectypes "github.com/taemon1337/ec-manager/pkg/types"
+)
+
+// recordSink keeps the audit records written to it
+type recordSink struct {
+	records []audit.Record
+}
+
+func (s *recordSink) Write(r audit.Record) error {
+	s.records = append(s.records, r)
+	return nil
+}
+
+func stopMockClient(t *testing.T) *mockclient.MockEC2Client {
+	mockEC2Client := mockclient.NewMockEC2Client(t)
+	mockEC2Client.On("DescribeInstances", mock.Anything, mock.Anything, mock.Anything).Return(&ec2.DescribeInstancesOutput{
+		Reservations: []types.Reservation{{Instances: []types.Instance{{
+			InstanceId: aws.String("i-0123456789abcdef0"),
+			State:      &types.InstanceState{Name: types.InstanceStateNameRunning},
+		}}}},
+	}, nil)
+	return mockEC2Client
+}
+
+func TestStopDryRun(t *testing.T) {
+	mockEC2Client := stopMockClient(t)
+
+	plan := ami.NewPlan(false)
+	dryRunPlan = plan
+	t.Cleanup(func() { dryRunPlan = nil })
+
+	var out bytes.Buffer
+	stopCmd.SetOut(&out)
+	t.Cleanup(func() { stopCmd.SetOut(nil) })
+	stopCmd.SetContext(context.WithValue(context.Background(), ectypes.EC2ClientKey, mockEC2Client))
+
+	require.NoError(t, stopCmd.RunE(stopCmd, []string{"i-0123456789abcdef0"}))
+	mockEC2Client.AssertNotCalled(t, "StopInstances", mock.Anything, mock.Anything, mock.Anything)
+	require.Len(t, plan.Calls(), 1)
+	assert.Equal(t, "ec2:StopInstances", plan.Calls()[0].Action)
+}
+
+func TestStopAudit(t *testing.T) {
+	mockEC2Client := stopMockClient(t)
+	mockEC2Client.On("StopInstances", mock.Anything, mock.Anything, mock.Anything).Return(&ec2.StopInstancesOutput{}, nil)
+	mockEC2Client.InstanceStoppedWaiter = &waiters.MockInstanceStoppedWaiter{}
+	mockEC2Client.InstanceStoppedWaiter.On("Wait", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	sink := &recordSink{}
+	auditLog = audit.NewLogger("ec-manager stop i-0123456789abcdef0", nil, sink)
+	t.Cleanup(func() { auditLog = nil })
+
+	var out bytes.Buffer
+	stopCmd.SetOut(&out)
+	t.Cleanup(func() { stopCmd.SetOut(nil) })
+	stopCmd.SetContext(context.WithValue(context.Background(), ectypes.EC2ClientKey, mockEC2Client))
+
+	require.NoError(t, stopCmd.RunE(stopCmd, []string{"i-0123456789abcdef0"}))
+	require.Len(t, sink.records, 1)
+	assert.Equal(t, "ec2:StopInstances", sink.records[0].Action)
+	assert.Equal(t, []string{"i-0123456789abcdef0"}, sink.records[0].Resources)
+	assert.Equal(t, audit.ResultSuccess, sink.records[0].Result)
+}
+
+func TestStartRestartUseContextClient(t *testing.T) {
+	for _, cmd := range []*cobra.Command{startCmd, restartCmd} {
+		t.Run(cmd.Name(), func(t *testing.T) {
+			mockEC2Client := stopMockClient(t)
+
+			dryRunPlan = ami.NewPlan(false)
+			t.Cleanup(func() { dryRunPlan = nil })
+
+			var out bytes.Buffer
+			cmd.SetOut(&out)
+			t.Cleanup(func() { cmd.SetOut(nil) })
+			cmd.SetContext(context.WithValue(context.Background(), ectypes.EC2ClientKey, mockEC2Client))
+
+			require.NoError(t, cmd.RunE(cmd, []string{"i-0123456789abcdef0"}))
+			mockEC2Client.AssertCalled(t, "DescribeInstances", mock.Anything, mock.Anything, mock.Anything)
+		})
+	}
+}
@@ -5,11 +5,13 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"sort"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/taemon1337/ec-manager/pkg/config"
 )
 
 // Error constants
@@ -45,12 +47,16 @@ type EC2Client interface {
 	AttachVolume(ctx context.Context, params *ec2.AttachVolumeInput, optFns ...func(*ec2.Options)) (*ec2.AttachVolumeOutput, error)
 	CreateSnapshot(ctx context.Context, params *ec2.CreateSnapshotInput, optFns ...func(*ec2.Options)) (*ec2.CreateSnapshotOutput, error)
 	TerminateInstances(ctx context.Context, params *ec2.TerminateInstancesInput, optFns ...func(*ec2.Options)) (*ec2.TerminateInstancesOutput, error)
+	CancelSpotInstanceRequests(ctx context.Context, params *ec2.CancelSpotInstanceRequestsInput, optFns ...func(*ec2.Options)) (*ec2.CancelSpotInstanceRequestsOutput, error)
 	DescribeSnapshots(ctx context.Context, params *ec2.DescribeSnapshotsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSnapshotsOutput, error)
 	DescribeVolumes(ctx context.Context, params *ec2.DescribeVolumesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeVolumesOutput, error)
 	DescribeSubnets(ctx context.Context, params *ec2.DescribeSubnetsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeSubnetsOutput, error)
 	DescribeKeyPairs(ctx context.Context, params *ec2.DescribeKeyPairsInput, optFns ...func(*ec2.Options)) (*ec2.DescribeKeyPairsOutput, error)
 	CreateImage(ctx context.Context, params *ec2.CreateImageInput, optFns ...func(*ec2.Options)) (*ec2.CreateImageOutput, error)
 	CreateVolume(ctx context.Context, params *ec2.CreateVolumeInput, optFns ...func(*ec2.Options)) (*ec2.CreateVolumeOutput, error)
+	DescribeInstanceAttribute(ctx context.Context, params *ec2.DescribeInstanceAttributeInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceAttributeOutput, error)
+	ModifyInstanceAttribute(ctx context.Context, params *ec2.ModifyInstanceAttributeInput, optFns ...func(*ec2.Options)) (*ec2.ModifyInstanceAttributeOutput, error)
+	DescribeInstanceTypes(ctx context.Context, params *ec2.DescribeInstanceTypesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceTypesOutput, error)
 	NewInstanceRunningWaiter() interface {
 		Wait(ctx context.Context, params *ec2.DescribeInstancesInput, maxWaitDur time.Duration, optFns ...func(*ec2.InstanceRunningWaiterOptions)) error
 	}
@@ -67,14 +73,19 @@ type EC2Client interface {
 
 // Service provides methods for managing EC2 instances
 type Service struct {
-	client EC2Client
+	client   EC2Client
+	pageSize int32
 }
 
 // NewService creates a new Service instance
-func NewService(client EC2Client) *Service {
-	return &Service{
+func NewService(client EC2Client, opts ...ServiceOption) *Service {
+	s := &Service{
 		client: client,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // BackupInstance creates a backup AMI of the given instance
@@ -121,85 +132,90 @@ func (s *Service) BackupInstance(ctx context.Context, instanceID string) (string
 	return *createImageOutput.ImageId, nil
 }
 
-// CreateInstance creates a new EC2 instance with the given configuration
+// CreateInstance creates a new EC2 instance with the given configuration.
+// With a launch template, only the fields that are set override the
+// template.
 func (s *Service) CreateInstance(ctx context.Context, cfg InstanceConfig) (string, error) {
-	input := &ec2.RunInstancesInput{
-		ImageId:      aws.String(cfg.ImageID),
-		InstanceType: types.InstanceType(cfg.InstanceType),
-		KeyName:      aws.String(cfg.KeyName),
-		SubnetId:     aws.String(cfg.SubnetID),
-		MinCount:     aws.Int32(1),
-		MaxCount:     aws.Int32(1),
+	result, err := s.RunInstance(ctx, cfg)
+	if err != nil {
+		return "", err
 	}
+	return result.InstanceID, nil
+}
 
-	if cfg.UserData != "" {
-		input.UserData = aws.String(cfg.UserData)
-	}
+// MigrateOption changes the configuration of the instance a migration
+// launches
+type MigrateOption func(*InstanceConfig)
 
-	output, err := s.client.RunInstances(ctx, input)
-	if err != nil {
-		return "", fmt.Errorf("failed to create instance: %w", err)
+// WithPurchaseOption launches the new instance on Spot capacity, or
+// on-demand when spot is nil, instead of as the old instance was requested
+func WithPurchaseOption(spot *SpotConfig) MigrateOption {
+	return func(cfg *InstanceConfig) {
+		cfg.Spot = spot
 	}
+}
 
-	if len(output.Instances) == 0 {
-		return "", fmt.Errorf("no instance was created")
+// WithFallbacks tries the instance types and subnets in order when there is
+// no capacity for the new instance's type in its subnet
+func WithFallbacks(instanceTypes, subnetIDs []string) MigrateOption {
+	return func(cfg *InstanceConfig) {
+		cfg.FallbackTypes = instanceTypes
+		cfg.FallbackSubnets = subnetIDs
 	}
+}
 
-	return *output.Instances[0].InstanceId, nil
+// WithInstanceType launches the new instance as instanceType instead of the
+// old instance's type
+func WithInstanceType(instanceType string) MigrateOption {
+	return func(cfg *InstanceConfig) {
+		cfg.InstanceType = instanceType
+	}
 }
 
-// MigrateInstance migrates an EC2 instance to a new AMI
-func (s *Service) MigrateInstance(ctx context.Context, instanceID string, newAMI string) (string, error) {
+// MigrateInstance migrates an EC2 instance to a new AMI, returning how the
+// new instance was launched. The new instance is requested as Spot or
+// on-demand capacity like the old one, as recorded in its PurchaseOptionTag
+// or its lifecycle.
+func (s *Service) MigrateInstance(ctx context.Context, instanceID string, newAMI string, opts ...MigrateOption) (*LaunchResult, error) {
 	// First, describe the instance to make sure it exists
 	describeOutput, err := s.client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
 		InstanceIds: []string{instanceID},
 	})
 	if err != nil {
-		return "", fmt.Errorf("failed to describe instance: %w", err)
+		return nil, fmt.Errorf("failed to describe instance: %w", err)
 	}
 
 	if len(describeOutput.Reservations) == 0 || len(describeOutput.Reservations[0].Instances) == 0 {
-		return "", fmt.Errorf("instance not found: %s", instanceID)
+		return nil, fmt.Errorf("instance not found: %s", instanceID)
 	}
 
 	instance := describeOutput.Reservations[0].Instances[0]
 
-	// Create a new instance from the AMI with the same configuration
+	// Create a new instance from the AMI with the same configuration, tagged
+	// at launch so its launch record includes the tags
 	cfg := InstanceConfig{
 		ImageID:      newAMI,
 		InstanceType: string(instance.InstanceType),
 		KeyName:      *instance.KeyName,
 		SubnetID:     *instance.SubnetId,
+		Name:         fmt.Sprintf("Migrated from %s", instanceID),
+		Tags:         map[string]string{"SourceInstanceId": instanceID},
 	}
-
-	newInstanceID, err := s.CreateInstance(ctx, cfg)
+	spot, err := purchaseOption(instance)
 	if err != nil {
-		return "", fmt.Errorf("failed to create new instance: %w", err)
+		return nil, err
+	}
+	cfg.Spot = spot
+	for _, opt := range opts {
+		opt(&cfg)
 	}
 
-	// Tag the new instance
-	var tags []types.Tag
-	tags = append(tags, types.Tag{
-		Key:   aws.String("Name"),
-		Value: aws.String(fmt.Sprintf("Migrated from %s", instanceID)),
-	})
-	tags = append(tags, types.Tag{
-		Key:   aws.String("SourceInstanceId"),
-		Value: aws.String(instanceID),
-	})
-
-	if len(tags) > 0 {
-		tagInput := &ec2.CreateTagsInput{
-			Resources: []string{newInstanceID},
-			Tags:      tags,
-		}
-		_, err = s.client.CreateTags(ctx, tagInput)
-		if err != nil {
-			return "", fmt.Errorf("failed to create tags: %w", err)
-		}
+	result, err := s.RunInstance(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create new instance: %w", err)
 	}
 
-	return newInstanceID, nil
+	return result, nil
 }
 
 // DeleteInstance terminates an EC2 instance
@@ -216,6 +232,10 @@ func (s *Service) DeleteInstance(ctx context.Context, instanceID string) (string
 		return "", fmt.Errorf("instance not found: %s", instanceID)
 	}
 
+	if err := s.CancelSpotRequests(ctx, describeOutput.Reservations[0].Instances[:1]); err != nil {
+		return "", err
+	}
+
 	// Terminate the instance
 	terminateOutput, err := s.client.TerminateInstances(ctx, &ec2.TerminateInstancesInput{
 		InstanceIds: []string{instanceID},
@@ -231,18 +251,38 @@ func (s *Service) DeleteInstance(ctx context.Context, instanceID string) (string
 	return string(terminateOutput.TerminatingInstances[0].CurrentState.Name), nil
 }
 
-// DescribeInstances returns a list of all EC2 instances
+// DescribeInstances returns a list of all EC2 instances, merging the
+// reservations from every page into a single output
 func (s *Service) DescribeInstances(ctx context.Context) (*ec2.DescribeInstancesOutput, error) {
-	return s.client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{})
+	paginator := ec2.NewDescribeInstancesPaginator(s.client, &ec2.DescribeInstancesInput{},
+		func(o *ec2.DescribeInstancesPaginatorOptions) {
+			o.Limit = s.pageLimit()
+			o.StopOnDuplicateToken = true
+		})
+
+	output := &ec2.DescribeInstancesOutput{}
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe instances: %w", err)
+		}
+		output.Reservations = append(output.Reservations, page.Reservations...)
+	}
+
+	return output, nil
 }
 
 // ListSubnets returns a list of all VPC subnets
 func (s *Service) ListSubnets(ctx context.Context) ([]types.Subnet, error) {
-	output, err := s.client.DescribeSubnets(ctx, &ec2.DescribeSubnetsInput{})
+	var subnets []types.Subnet
+	err := s.EachSubnet(ctx, &ec2.DescribeSubnetsInput{}, func(subnet types.Subnet) error {
+		subnets = append(subnets, subnet)
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to describe subnets: %w", err)
+		return nil, err
 	}
-	return output.Subnets, nil
+	return subnets, nil
 }
 
 // ListKeyPairs returns a list of all SSH key pairs
@@ -336,13 +376,13 @@ func (s *Service) UpdateLatestAMITag(ctx context.Context, namePrefix, newLatestA
 		},
 	}
 
-	output, err := s.client.DescribeImages(ctx, input)
+	images, err := s.ListImages(ctx, input)
 	if err != nil {
-		return fmt.Errorf("failed to describe images: %w", err)
+		return err
 	}
 
 	// Remove 'latest' tag from all existing AMIs
-	for _, img := range output.Images {
+	for _, img := range images {
 		if *img.ImageId == newLatestAMI {
 			continue // Skip the new AMI
 		}
@@ -392,16 +432,20 @@ func (s *Service) GetLatestAMI(ctx context.Context, os string) (*types.Image, er
 		},
 	}
 
-	output, err := s.client.DescribeImages(ctx, input)
+	var image *types.Image
+	err := s.EachImage(ctx, input, func(img types.Image) error {
+		image = &img
+		return ErrStopIteration
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to describe images: %w", err)
+		return nil, err
 	}
 
-	if len(output.Images) == 0 {
+	if image == nil {
 		return nil, fmt.Errorf("no AMI found for OS %s", os)
 	}
 
-	return &output.Images[0], nil
+	return image, nil
 }
 
 // GetAMIByVersion returns a specific version of an AMI for the given OS
@@ -419,16 +463,20 @@ func (s *Service) GetAMIByVersion(ctx context.Context, os string, version string
 		},
 	}
 
-	output, err := s.client.DescribeImages(ctx, input)
+	var image *types.Image
+	err := s.EachImage(ctx, input, func(img types.Image) error {
+		image = &img
+		return ErrStopIteration
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to describe images: %w", err)
+		return nil, err
 	}
 
-	if len(output.Images) == 0 {
+	if image == nil {
 		return nil, fmt.Errorf("no AMI found for OS %s version %s", os, version)
 	}
 
-	return &output.Images[0], nil
+	return image, nil
 }
 
 // GetInstanceOS returns the OS of an instance based on its AMI
@@ -649,27 +697,14 @@ func (s *Service) StopInstance(ctx context.Context, instanceID string) error {
 		return fmt.Errorf("failed to stop instance: %w", err)
 	}
 
-	// Poll for instance state
-	for {
-		describeInput := &ec2.DescribeInstancesInput{
-			InstanceIds: []string{instanceID},
-		}
-
-		output, err := s.client.DescribeInstances(ctx, describeInput)
-		if err != nil {
-			return fmt.Errorf("failed to describe instance: %w", err)
-		}
-
-		if len(output.Reservations) == 0 || len(output.Reservations[0].Instances) == 0 {
-			return fmt.Errorf("instance not found")
-		}
-
-		state := output.Reservations[0].Instances[0].State.Name
-		if state == types.InstanceStateNameStopped {
-			break
-		}
-
-		time.Sleep(5 * time.Second)
+	// Wait for the instance to stop. The waiter backs off between polls
+	// instead of hammering DescribeInstances at a fixed interval.
+	waiter := s.client.NewInstanceStoppedWaiter()
+	err = waiter.Wait(ctx, &ec2.DescribeInstancesInput{
+		InstanceIds: []string{instanceID},
+	}, config.GetOperationTimeout(config.OpInstanceStopped))
+	if err != nil {
+		return fmt.Errorf("error waiting for instance to stop: %w", err)
 	}
 
 	return nil
@@ -689,7 +724,7 @@ func (s *Service) StartInstance(ctx context.Context, instanceID string) error {
 	waiter := s.client.NewInstanceRunningWaiter()
 	err = waiter.Wait(ctx, &ec2.DescribeInstancesInput{
 		InstanceIds: []string{instanceID},
-	}, 5*time.Minute)
+	}, config.GetOperationTimeout(config.OpInstanceRunning))
 	if err != nil {
 		return fmt.Errorf("error waiting for instance to start: %w", err)
 	}
@@ -728,5 +763,39 @@ type InstanceConfig struct {
 	InstanceType string
 	KeyName      string
 	SubnetID     string
-	UserData     string
+	// UserData is the raw user data script; it is base64-encoded at launch
+	UserData string
+	// Name is the instance's Name tag
+	Name             string
+	SecurityGroupIDs []string
+	// InstanceProfile is the name or ARN of the IAM instance profile
+	InstanceProfile string
+	// RootVolume resizes or retypes the root volume; zero fields keep the
+	// AMI's settings
+	RootVolume VolumeConfig
+	// Volumes are additional EBS volumes, deleted with the instance
+	Volumes []VolumeConfig
+	// LaunchTemplate is the ID or name of a launch template to launch from,
+	// at LaunchTemplateVersion or the template's default version
+	LaunchTemplate        string
+	LaunchTemplateVersion string
+	// Tags are applied to the instance and its volumes at launch
+	Tags map[string]string
+	// Spot requests Spot capacity, falling back to on-demand when there is
+	// none; nil requests on-demand capacity
+	Spot *SpotConfig
+	// FallbackTypes and FallbackSubnets are tried in order, after
+	// InstanceType and SubnetID, when there is no capacity for them
+	FallbackTypes   []string
+	FallbackSubnets []string
+}
+
+// sortedKeys returns the keys of m in sorted order so tag lists are stable
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
@@ -0,0 +1,123 @@
+package ami
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/taemon1337/ec-manager/pkg/audit"
+)
+
+// WithAudit records every mutating call the service makes in log, with the
+// resources it acted on and its result
+func WithAudit(log *audit.Logger) ServiceOption {
+	return func(s *Service) {
+		s.client = &auditingClient{EC2Client: s.client, log: log}
+	}
+}
+
+// auditingClient records mutating calls after making them, passing
+// read-only calls through
+type auditingClient struct {
+	EC2Client
+	log *audit.Logger
+}
+
+// record logs a call on resources. Empty resource IDs, such as those of a
+// resource a failed call did not create, are left out.
+func (c *auditingClient) record(ctx context.Context, action string, input interface{}, err error, resources ...string) {
+	r := audit.Record{Action: action, Params: compactParams(input)}
+	for _, id := range resources {
+		if id != "" {
+			r.Resources = append(r.Resources, id)
+		}
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	c.log.Log(ctx, r)
+}
+
+func (c *auditingClient) RunInstances(ctx context.Context, params *ec2.RunInstancesInput, optFns ...func(*ec2.Options)) (*ec2.RunInstancesOutput, error) {
+	out, err := c.EC2Client.RunInstances(ctx, params, optFns...)
+	resources := []string{aws.ToString(params.ImageId)}
+	if out != nil {
+		for _, instance := range out.Instances {
+			resources = append(resources, aws.ToString(instance.InstanceId))
+		}
+	}
+	c.record(ctx, "ec2:RunInstances", params, err, resources...)
+	return out, err
+}
+
+func (c *auditingClient) CreateTags(ctx context.Context, params *ec2.CreateTagsInput, optFns ...func(*ec2.Options)) (*ec2.CreateTagsOutput, error) {
+	out, err := c.EC2Client.CreateTags(ctx, params, optFns...)
+	c.record(ctx, "ec2:CreateTags", params, err, params.Resources...)
+	return out, err
+}
+
+func (c *auditingClient) CreateImage(ctx context.Context, params *ec2.CreateImageInput, optFns ...func(*ec2.Options)) (*ec2.CreateImageOutput, error) {
+	out, err := c.EC2Client.CreateImage(ctx, params, optFns...)
+	var imageID string
+	if out != nil {
+		imageID = aws.ToString(out.ImageId)
+	}
+	c.record(ctx, "ec2:CreateImage", params, err, aws.ToString(params.InstanceId), imageID)
+	return out, err
+}
+
+func (c *auditingClient) CreateSnapshot(ctx context.Context, params *ec2.CreateSnapshotInput, optFns ...func(*ec2.Options)) (*ec2.CreateSnapshotOutput, error) {
+	out, err := c.EC2Client.CreateSnapshot(ctx, params, optFns...)
+	var snapshotID string
+	if out != nil {
+		snapshotID = aws.ToString(out.SnapshotId)
+	}
+	c.record(ctx, "ec2:CreateSnapshot", params, err, aws.ToString(params.VolumeId), snapshotID)
+	return out, err
+}
+
+func (c *auditingClient) CreateVolume(ctx context.Context, params *ec2.CreateVolumeInput, optFns ...func(*ec2.Options)) (*ec2.CreateVolumeOutput, error) {
+	out, err := c.EC2Client.CreateVolume(ctx, params, optFns...)
+	var volumeID string
+	if out != nil {
+		volumeID = aws.ToString(out.VolumeId)
+	}
+	c.record(ctx, "ec2:CreateVolume", params, err, aws.ToString(params.SnapshotId), volumeID)
+	return out, err
+}
+
+func (c *auditingClient) AttachVolume(ctx context.Context, params *ec2.AttachVolumeInput, optFns ...func(*ec2.Options)) (*ec2.AttachVolumeOutput, error) {
+	out, err := c.EC2Client.AttachVolume(ctx, params, optFns...)
+	c.record(ctx, "ec2:AttachVolume", params, err, aws.ToString(params.InstanceId), aws.ToString(params.VolumeId))
+	return out, err
+}
+
+func (c *auditingClient) StartInstances(ctx context.Context, params *ec2.StartInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StartInstancesOutput, error) {
+	out, err := c.EC2Client.StartInstances(ctx, params, optFns...)
+	c.record(ctx, "ec2:StartInstances", params, err, params.InstanceIds...)
+	return out, err
+}
+
+func (c *auditingClient) StopInstances(ctx context.Context, params *ec2.StopInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StopInstancesOutput, error) {
+	out, err := c.EC2Client.StopInstances(ctx, params, optFns...)
+	c.record(ctx, "ec2:StopInstances", params, err, params.InstanceIds...)
+	return out, err
+}
+
+func (c *auditingClient) TerminateInstances(ctx context.Context, params *ec2.TerminateInstancesInput, optFns ...func(*ec2.Options)) (*ec2.TerminateInstancesOutput, error) {
+	out, err := c.EC2Client.TerminateInstances(ctx, params, optFns...)
+	c.record(ctx, "ec2:TerminateInstances", params, err, params.InstanceIds...)
+	return out, err
+}
+
+func (c *auditingClient) CancelSpotInstanceRequests(ctx context.Context, params *ec2.CancelSpotInstanceRequestsInput, optFns ...func(*ec2.Options)) (*ec2.CancelSpotInstanceRequestsOutput, error) {
+	out, err := c.EC2Client.CancelSpotInstanceRequests(ctx, params, optFns...)
+	c.record(ctx, "ec2:CancelSpotInstanceRequests", params, err, params.SpotInstanceRequestIds...)
+	return out, err
+}
+
+func (c *auditingClient) ModifyInstanceAttribute(ctx context.Context, params *ec2.ModifyInstanceAttributeInput, optFns ...func(*ec2.Options)) (*ec2.ModifyInstanceAttributeOutput, error) {
+	out, err := c.EC2Client.ModifyInstanceAttribute(ctx, params, optFns...)
+	c.record(ctx, "ec2:ModifyInstanceAttribute", params, err, aws.ToString(params.InstanceId))
+	return out, err
+}
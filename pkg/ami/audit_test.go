@@ -0,0 +1,41 @@
+package ami
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/taemon1337/ec-manager/pkg/audit"
+)
+
+func TestAuditRecordsCalls(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	log := audit.NewLogger("ec-manager delete i-1 i-2", nil, audit.NewFileSink(path))
+
+	client := &protectEC2Client{bulkEC2Client: bulkEC2Client{refused: map[string]bool{"i-2": true}}}
+	service := NewService(client, WithAudit(log))
+
+	err := service.TerminateInstances(context.Background(), []string{"i-1", "i-2"}, nil)
+	assert.EqualError(t, err, "failed to delete 1 of 2 instances: i-2")
+
+	var records []audit.Record
+	require.NoError(t, audit.Read(path, func(r audit.Record) error {
+		records = append(records, r)
+		return nil
+	}))
+
+	// The failed batch is retried one instance at a time
+	require.Len(t, records, 3)
+	assert.Equal(t, []string{"i-1", "i-2"}, records[0].Resources)
+	assert.Equal(t, audit.ResultFailed, records[0].Result)
+	assert.Equal(t, []string{"i-1"}, records[1].Resources)
+	assert.Equal(t, audit.ResultSuccess, records[1].Result)
+	assert.Equal(t, []string{"i-2"}, records[2].Resources)
+	assert.Equal(t, "IncorrectInstanceState", records[2].Error)
+	for _, r := range records {
+		assert.Equal(t, "ec2:TerminateInstances", r.Action)
+		assert.Equal(t, "ec-manager delete i-1 i-2", r.Command)
+	}
+}
@@ -0,0 +1,206 @@
+package ami
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/taemon1337/ec-manager/pkg/config"
+)
+
+const (
+	// batchSize is the most instances sent in one StartInstances or
+	// StopInstances call
+	batchSize = 50
+	// maxConcurrentWaits bounds how many instances are waited on at once
+	maxConcurrentWaits = 10
+)
+
+// Progress is one state change of an instance during a bulk operation
+type Progress struct {
+	InstanceID string
+	// State is the instance's new state, such as stopping or stopped, or
+	// failed when Err is set
+	State string
+	Err   error
+}
+
+// BulkError lists the instances a bulk operation failed for
+type BulkError struct {
+	Op     string
+	Total  int
+	Failed map[string]error
+}
+
+func (e *BulkError) Error() string {
+	ids := make([]string, 0, len(e.Failed))
+	for id := range e.Failed {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return fmt.Sprintf("failed to %s %d of %d instances: %s", e.Op, len(e.Failed), e.Total, strings.Join(ids, ", "))
+}
+
+// bulkOp is a state change applied to many instances at once
+type bulkOp struct {
+	name    string
+	pending string
+	done    string
+	call    func(ctx context.Context, ids []string) error
+	wait    func(ctx context.Context, id string) error
+}
+
+// StartInstances starts instances with batched StartInstances calls and
+// waits for them to be running concurrently. progress, which may be nil, is
+// called as each instance changes state. The error is a *BulkError listing
+// the instances that failed; the others are still started.
+func (s *Service) StartInstances(ctx context.Context, ids []string, progress func(Progress)) error {
+	return s.bulk(ctx, ids, s.startOp(), progress)
+}
+
+// StopInstances stops instances with batched StopInstances calls and waits
+// for them to be stopped concurrently, like StartInstances
+func (s *Service) StopInstances(ctx context.Context, ids []string, progress func(Progress)) error {
+	return s.bulk(ctx, ids, s.stopOp(), progress)
+}
+
+// RestartInstances stops every instance, then starts the ones that stopped
+func (s *Service) RestartInstances(ctx context.Context, ids []string, progress func(Progress)) error {
+	failed := map[string]error{}
+	collect := func(err error) error {
+		var bulkErr *BulkError
+		if !errors.As(err, &bulkErr) {
+			return err
+		}
+		for id, err := range bulkErr.Failed {
+			failed[id] = err
+		}
+		return nil
+	}
+
+	if err := collect(s.bulk(ctx, ids, s.stopOp(), progress)); err != nil {
+		return err
+	}
+
+	var stopped []string
+	for _, id := range ids {
+		if _, ok := failed[id]; !ok {
+			stopped = append(stopped, id)
+		}
+	}
+	if err := collect(s.bulk(ctx, stopped, s.startOp(), progress)); err != nil {
+		return err
+	}
+
+	if len(failed) > 0 {
+		return &BulkError{Op: "restart", Total: len(ids), Failed: failed}
+	}
+	return nil
+}
+
+func (s *Service) startOp() bulkOp {
+	return bulkOp{
+		name:    "start",
+		pending: "starting",
+		done:    "running",
+		call: func(ctx context.Context, ids []string) error {
+			_, err := s.client.StartInstances(ctx, &ec2.StartInstancesInput{InstanceIds: ids})
+			return err
+		},
+		wait: func(ctx context.Context, id string) error {
+			return s.client.NewInstanceRunningWaiter().Wait(ctx, &ec2.DescribeInstancesInput{
+				InstanceIds: []string{id},
+			}, config.GetOperationTimeout(config.OpInstanceRunning))
+		},
+	}
+}
+
+func (s *Service) stopOp() bulkOp {
+	return bulkOp{
+		name:    "stop",
+		pending: "stopping",
+		done:    "stopped",
+		call: func(ctx context.Context, ids []string) error {
+			_, err := s.client.StopInstances(ctx, &ec2.StopInstancesInput{InstanceIds: ids})
+			return err
+		},
+		wait: func(ctx context.Context, id string) error {
+			return s.client.NewInstanceStoppedWaiter().Wait(ctx, &ec2.DescribeInstancesInput{
+				InstanceIds: []string{id},
+			}, config.GetOperationTimeout(config.OpInstanceStopped))
+		},
+	}
+}
+
+// bulk applies op to ids in batches. When a batch call fails, for example
+// because one instance is in the wrong state, its instances are retried one
+// at a time so only the offending ones fail.
+func (s *Service) bulk(ctx context.Context, ids []string, op bulkOp, progress func(Progress)) error {
+	var mu sync.Mutex
+	failed := map[string]error{}
+	report := func(p Progress) {
+		mu.Lock()
+		defer mu.Unlock()
+		if p.Err != nil {
+			failed[p.InstanceID] = p.Err
+		}
+		if progress != nil {
+			progress(p)
+		}
+	}
+	fail := func(id string, err error) {
+		report(Progress{InstanceID: id, State: "failed", Err: err})
+	}
+
+	var accepted []string
+	for start := 0; start < len(ids); start += batchSize {
+		batch := ids[start:min(start+batchSize, len(ids))]
+		err := op.call(ctx, batch)
+		if err == nil {
+			accepted = append(accepted, batch...)
+			continue
+		}
+		if len(batch) == 1 || ctx.Err() != nil {
+			for _, id := range batch {
+				fail(id, fmt.Errorf("failed to %s instance: %w", op.name, err))
+			}
+			continue
+		}
+		for _, id := range batch {
+			if err := op.call(ctx, []string{id}); err != nil {
+				fail(id, fmt.Errorf("failed to %s instance: %w", op.name, err))
+				continue
+			}
+			accepted = append(accepted, id)
+		}
+	}
+
+	sem := make(chan struct{}, maxConcurrentWaits)
+	var wg sync.WaitGroup
+	for _, id := range accepted {
+		report(Progress{InstanceID: id, State: op.pending})
+
+		wg.Add(1)
+		go func(id string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			if err := op.wait(ctx, id); err != nil {
+				fail(id, fmt.Errorf("error waiting for instance to %s: %w", op.name, err))
+				return
+			}
+			report(Progress{InstanceID: id, State: op.done})
+		}(id)
+	}
+	wg.Wait()
+
+	if len(failed) > 0 {
+		return &BulkError{Op: op.name, Total: len(ids), Failed: failed}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package ami
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// bulkEC2Client rejects any StartInstances or StopInstances call that
+// includes a refused instance, and fails waits for stuck instances
+type bulkEC2Client struct {
+	EC2Client
+	refused map[string]bool
+	stuck   map[string]bool
+
+	mu    sync.Mutex
+	calls [][]string
+}
+
+func (c *bulkEC2Client) call(ids []string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = append(c.calls, ids)
+	for _, id := range ids {
+		if c.refused[id] {
+			return errors.New("IncorrectInstanceState")
+		}
+	}
+	return nil
+}
+
+func (c *bulkEC2Client) StartInstances(ctx context.Context, params *ec2.StartInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StartInstancesOutput, error) {
+	return &ec2.StartInstancesOutput{}, c.call(params.InstanceIds)
+}
+
+func (c *bulkEC2Client) StopInstances(ctx context.Context, params *ec2.StopInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StopInstancesOutput, error) {
+	return &ec2.StopInstancesOutput{}, c.call(params.InstanceIds)
+}
+
+type runningWaiter struct{ stuck map[string]bool }
+
+func (w runningWaiter) Wait(ctx context.Context, params *ec2.DescribeInstancesInput, maxWaitDur time.Duration, optFns ...func(*ec2.InstanceRunningWaiterOptions)) error {
+	if w.stuck[params.InstanceIds[0]] {
+		return errors.New("exceeded max wait time")
+	}
+	return nil
+}
+
+type stoppedWaiter struct{ stuck map[string]bool }
+
+func (w stoppedWaiter) Wait(ctx context.Context, params *ec2.DescribeInstancesInput, maxWaitDur time.Duration, optFns ...func(*ec2.InstanceStoppedWaiterOptions)) error {
+	if w.stuck[params.InstanceIds[0]] {
+		return errors.New("exceeded max wait time")
+	}
+	return nil
+}
+
+func (c *bulkEC2Client) NewInstanceRunningWaiter() interface {
+	Wait(ctx context.Context, params *ec2.DescribeInstancesInput, maxWaitDur time.Duration, optFns ...func(*ec2.InstanceRunningWaiterOptions)) error
+} {
+	return runningWaiter{stuck: c.stuck}
+}
+
+func (c *bulkEC2Client) NewInstanceStoppedWaiter() interface {
+	Wait(ctx context.Context, params *ec2.DescribeInstancesInput, maxWaitDur time.Duration, optFns ...func(*ec2.InstanceStoppedWaiterOptions)) error
+} {
+	return stoppedWaiter{stuck: c.stuck}
+}
+
+func TestStopInstancesBatches(t *testing.T) {
+	client := &bulkEC2Client{}
+	service := NewService(client)
+
+	var states []string
+	err := service.StopInstances(context.Background(), []string{"i-1", "i-2", "i-3"}, func(p Progress) {
+		states = append(states, p.InstanceID+" "+p.State)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"i-1", "i-2", "i-3"}}, client.calls)
+	assert.Len(t, states, 6)
+	assert.Subset(t, states, []string{"i-1 stopping", "i-2 stopping", "i-3 stopping", "i-1 stopped", "i-2 stopped", "i-3 stopped"})
+}
+
+func TestStartInstancesReportsFailures(t *testing.T) {
+	client := &bulkEC2Client{
+		refused: map[string]bool{"i-2": true},
+		stuck:   map[string]bool{"i-3": true},
+	}
+	service := NewService(client)
+
+	failed := map[string]string{}
+	err := service.StartInstances(context.Background(), []string{"i-1", "i-2", "i-3"}, func(p Progress) {
+		if p.Err != nil {
+			failed[p.InstanceID] = p.State
+		}
+	})
+
+	var bulkErr *BulkError
+	require.True(t, errors.As(err, &bulkErr))
+	assert.EqualError(t, err, "failed to start 2 of 3 instances: i-2, i-3")
+	assert.Equal(t, map[string]string{"i-2": "failed", "i-3": "failed"}, failed)
+	assert.ErrorContains(t, bulkErr.Failed["i-2"], "failed to start instance")
+	assert.ErrorContains(t, bulkErr.Failed["i-3"], "error waiting for instance to start")
+
+	// The rejected batch is retried one instance at a time
+	assert.Equal(t, [][]string{{"i-1", "i-2", "i-3"}, {"i-1"}, {"i-2"}, {"i-3"}}, client.calls)
+}
+
+func TestRestartInstancesSkipsStartWhenStopFails(t *testing.T) {
+	client := &bulkEC2Client{refused: map[string]bool{"i-2": true}}
+	service := NewService(client)
+
+	err := service.RestartInstances(context.Background(), []string{"i-1", "i-2"}, nil)
+	assert.EqualError(t, err, "failed to restart 1 of 2 instances: i-2")
+	assert.Equal(t, [][]string{{"i-1", "i-2"}, {"i-1"}, {"i-2"}, {"i-1"}}, client.calls)
+}
@@ -0,0 +1,146 @@
+package ami
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// CapacityChoiceTag records the instance type and subnet a launch with
+// fallbacks settled on, e.g. type=t3.large,subnet=subnet-2,attempt=3
+const CapacityChoiceTag = "ec-manager:capacity-choice"
+
+// LaunchAttempt is one RunInstances call of a launch
+type LaunchAttempt struct {
+	InstanceType string
+	SubnetID     string
+	Spot         bool
+	// Error is the capacity error the attempt failed with, and is empty
+	// for the attempt that launched the instance
+	Error string
+}
+
+// LaunchResult describes an instance RunInstance launched
+type LaunchResult struct {
+	InstanceID string
+	// InstanceType and SubnetID are those the instance was launched with,
+	// which differ from the requested ones after a fallback
+	InstanceType string
+	SubnetID     string
+	// Spot reports whether the instance runs on Spot capacity; it is false
+	// when a Spot request fell back to on-demand
+	Spot bool
+	// Attempts are the RunInstances calls made, the last one launching the
+	// instance
+	Attempts []LaunchAttempt
+}
+
+// placement is an instance type and subnet to launch in
+type placement struct {
+	instanceType string
+	subnetID     string
+}
+
+// placements returns where to try launching cfg, in order: the requested
+// type in each subnet, then each fallback type in each subnet
+func placements(cfg InstanceConfig) []placement {
+	instanceTypes := append([]string{cfg.InstanceType}, cfg.FallbackTypes...)
+	subnetIDs := append([]string{cfg.SubnetID}, cfg.FallbackSubnets...)
+
+	var result []placement
+	for _, instanceType := range instanceTypes {
+		for _, subnetID := range subnetIDs {
+			result = append(result, placement{instanceType: instanceType, subnetID: subnetID})
+		}
+	}
+	return result
+}
+
+// RunInstance creates a new EC2 instance like CreateInstance, reporting how
+// it was launched. When there is no capacity, the fallback types and
+// subnets are tried in order; a Spot request tries every placement on Spot
+// capacity before trying them on-demand. Errors other than a lack of
+// capacity fail the launch straight away.
+func (s *Service) RunInstance(ctx context.Context, cfg InstanceConfig) (*LaunchResult, error) {
+	for _, instanceType := range cfg.FallbackTypes {
+		if instanceType == "" {
+			return nil, fmt.Errorf("fallback instance types cannot be empty")
+		}
+	}
+	for _, subnetID := range cfg.FallbackSubnets {
+		if subnetID == "" {
+			return nil, fmt.Errorf("fallback subnets cannot be empty")
+		}
+	}
+
+	markets := []bool{cfg.Spot != nil}
+	if cfg.Spot != nil {
+		markets = append(markets, false)
+	}
+	fallbacks := len(cfg.FallbackTypes) > 0 || len(cfg.FallbackSubnets) > 0
+
+	result := &LaunchResult{}
+	var lastErr error
+	for _, spot := range markets {
+		for _, p := range placements(cfg) {
+			attempt := cfg
+			attempt.InstanceType, attempt.SubnetID = p.instanceType, p.subnetID
+			input, err := s.runInstancesInput(ctx, attempt)
+			if err != nil {
+				return nil, err
+			}
+			if !spot {
+				// The purchase option tag still records the Spot request,
+				// so a migration asks for Spot capacity again
+				input.InstanceMarketOptions = nil
+			}
+			if fallbacks {
+				addInstanceTag(input, CapacityChoiceTag, fmt.Sprintf("type=%s,subnet=%s,attempt=%d",
+					p.instanceType, p.subnetID, len(result.Attempts)+1))
+			}
+
+			output, err := s.client.RunInstances(ctx, input)
+			record := LaunchAttempt{InstanceType: p.instanceType, SubnetID: p.subnetID, Spot: spot}
+			if err != nil {
+				if !isCapacityError(err) {
+					return nil, fmt.Errorf("failed to create instance: %w", err)
+				}
+				record.Error = err.Error()
+				result.Attempts = append(result.Attempts, record)
+				lastErr = err
+				continue
+			}
+			result.Attempts = append(result.Attempts, record)
+
+			if len(output.Instances) == 0 {
+				return nil, fmt.Errorf("no instance was created")
+			}
+			result.InstanceID = aws.ToString(output.Instances[0].InstanceId)
+			result.InstanceType, result.SubnetID, result.Spot = p.instanceType, p.subnetID, spot
+			return result, nil
+		}
+	}
+
+	if len(result.Attempts) == 1 {
+		return nil, fmt.Errorf("failed to create instance: %w", lastErr)
+	}
+	return nil, fmt.Errorf("failed to create instance: no capacity in %d attempts: %w", len(result.Attempts), lastErr)
+}
+
+// addInstanceTag adds a tag to the instance's tag specification
+func addInstanceTag(input *ec2.RunInstancesInput, key, value string) {
+	tag := types.Tag{Key: aws.String(key), Value: aws.String(value)}
+	for i, spec := range input.TagSpecifications {
+		if spec.ResourceType == types.ResourceTypeInstance {
+			input.TagSpecifications[i].Tags = append(spec.Tags, tag)
+			return
+		}
+	}
+	input.TagSpecifications = append(input.TagSpecifications, types.TagSpecification{
+		ResourceType: types.ResourceTypeInstance,
+		Tags:         []types.Tag{tag},
+	})
+}
@@ -0,0 +1,142 @@
+package ami
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// capacityEC2Client has capacity only for the type and subnet pairs in
+// available, fails with err when it is set, and records each launch
+type capacityEC2Client struct {
+	EC2Client
+	available map[string]bool
+	err       error
+	launched  []*ec2.RunInstancesInput
+}
+
+func (c *capacityEC2Client) RunInstances(ctx context.Context, params *ec2.RunInstancesInput, optFns ...func(*ec2.Options)) (*ec2.RunInstancesOutput, error) {
+	c.launched = append(c.launched, params)
+	if c.err != nil {
+		return nil, c.err
+	}
+	if !c.available[string(params.InstanceType)+"/"+aws.ToString(params.SubnetId)] {
+		return nil, &smithy.GenericAPIError{Code: "InsufficientInstanceCapacity", Message: "no capacity"}
+	}
+	return &ec2.RunInstancesOutput{Instances: []types.Instance{{InstanceId: aws.String("i-new")}}}, nil
+}
+
+func TestRunInstanceFallbacks(t *testing.T) {
+	cfg := InstanceConfig{
+		ImageID:         "ami-1",
+		InstanceType:    "t3.large",
+		SubnetID:        "subnet-a",
+		FallbackTypes:   []string{"t3a.large"},
+		FallbackSubnets: []string{"subnet-b"},
+	}
+
+	tests := []struct {
+		name      string
+		available []string
+		spot      bool
+		want      []LaunchAttempt
+		wantErr   string
+	}{
+		{
+			name:      "first choice",
+			available: []string{"t3.large/subnet-a"},
+			want:      []LaunchAttempt{{InstanceType: "t3.large", SubnetID: "subnet-a"}},
+		},
+		{
+			name:      "other subnet before other type",
+			available: []string{"t3.large/subnet-b", "t3a.large/subnet-a"},
+			want: []LaunchAttempt{
+				{InstanceType: "t3.large", SubnetID: "subnet-a", Error: "api error InsufficientInstanceCapacity: no capacity"},
+				{InstanceType: "t3.large", SubnetID: "subnet-b"},
+			},
+		},
+		{
+			name:      "fallback type",
+			available: []string{"t3a.large/subnet-b"},
+			want: []LaunchAttempt{
+				{InstanceType: "t3.large", SubnetID: "subnet-a", Error: "api error InsufficientInstanceCapacity: no capacity"},
+				{InstanceType: "t3.large", SubnetID: "subnet-b", Error: "api error InsufficientInstanceCapacity: no capacity"},
+				{InstanceType: "t3a.large", SubnetID: "subnet-a", Error: "api error InsufficientInstanceCapacity: no capacity"},
+				{InstanceType: "t3a.large", SubnetID: "subnet-b"},
+			},
+		},
+		{
+			name:    "no capacity anywhere",
+			wantErr: "no capacity in 4 attempts",
+		},
+		{
+			name:    "spot everywhere before on-demand",
+			spot:    true,
+			wantErr: "no capacity in 8 attempts",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &capacityEC2Client{available: map[string]bool{}}
+			for _, p := range tt.available {
+				client.available[p] = true
+			}
+			cfg := cfg
+			if tt.spot {
+				cfg.Spot = &SpotConfig{}
+			}
+
+			result, err := NewService(client).RunInstance(context.Background(), cfg)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				if tt.spot {
+					require.Len(t, client.launched, 8)
+					assert.NotNil(t, client.launched[3].InstanceMarketOptions)
+					assert.Nil(t, client.launched[4].InstanceMarketOptions)
+				}
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, result.Attempts)
+
+			last := tt.want[len(tt.want)-1]
+			assert.Equal(t, last.InstanceType, result.InstanceType)
+			assert.Equal(t, last.SubnetID, result.SubnetID)
+
+			var choice, launchType string
+			for _, tag := range client.launched[len(client.launched)-1].TagSpecifications[0].Tags {
+				switch aws.ToString(tag.Key) {
+				case CapacityChoiceTag:
+					choice = aws.ToString(tag.Value)
+				case LaunchTypeTag:
+					launchType = aws.ToString(tag.Value)
+				}
+			}
+			assert.Contains(t, choice, "type="+last.InstanceType+",subnet="+last.SubnetID)
+			assert.Equal(t, last.InstanceType, launchType)
+		})
+	}
+}
+
+func TestRunInstanceStopsOnOtherErrors(t *testing.T) {
+	client := &capacityEC2Client{err: errors.New("InvalidSubnetID.NotFound")}
+
+	_, err := NewService(client).RunInstance(context.Background(), InstanceConfig{
+		ImageID:       "ami-1",
+		InstanceType:  "t3.large",
+		FallbackTypes: []string{"t3a.large"},
+	})
+	assert.ErrorContains(t, err, "InvalidSubnetID.NotFound")
+	assert.Len(t, client.launched, 1)
+
+	_, err = NewService(client).RunInstance(context.Background(), InstanceConfig{FallbackTypes: []string{""}})
+	assert.EqualError(t, err, "fallback instance types cannot be empty")
+}
@@ -0,0 +1,131 @@
+package ami
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// Tags recording the configuration an instance was launched with, so later
+// changes to it can be detected
+const (
+	LaunchTypeTag           = "ec-manager:launch-type"
+	LaunchSecurityGroupsTag = "ec-manager:launch-security-groups"
+	// LaunchTagsTag holds a digest of the instance's other tags, as tag
+	// values are too short to hold the tags themselves
+	LaunchTagsTag = "ec-manager:launch-tags"
+)
+
+// Drift is an attribute of an instance that differs from what was expected
+type Drift struct {
+	Attribute string `json:"attribute"`
+	Expected  string `json:"expected"`
+	Actual    string `json:"actual"`
+}
+
+// launchRecord returns the tags recording cfg for an instance launched with
+// tags. Instances launched from a template are not recorded, as the
+// template decides most of their configuration and its tags.
+func launchRecord(cfg InstanceConfig, tags map[string]string) map[string]string {
+	if cfg.LaunchTemplate != "" {
+		return nil
+	}
+	record := map[string]string{LaunchTagsTag: tagsDigest(tags)}
+	if cfg.InstanceType != "" {
+		record[LaunchTypeTag] = cfg.InstanceType
+	}
+	if len(cfg.SecurityGroupIDs) > 0 {
+		record[LaunchSecurityGroupsTag] = joinSorted(cfg.SecurityGroupIDs)
+	}
+	return record
+}
+
+// HasLaunchRecord reports whether the instance was launched by ec-manager
+// with its configuration recorded
+func HasLaunchRecord(instance types.Instance) bool {
+	for _, tag := range instance.Tags {
+		switch aws.ToString(tag.Key) {
+		case LaunchTypeTag, LaunchSecurityGroupsTag, LaunchTagsTag:
+			return true
+		}
+	}
+	return false
+}
+
+// LaunchRecordUpdate returns the launch record tags of instance that change
+// once it has tags, groups and instanceType, so that ec-manager's own
+// changes are not reported as drift. Attributes that were not recorded are
+// left out.
+func LaunchRecordUpdate(instance types.Instance, tags map[string]string, groups []string, instanceType string) map[string]string {
+	update := map[string]string{}
+	for _, tag := range instance.Tags {
+		key, value := aws.ToString(tag.Key), aws.ToString(tag.Value)
+		var want string
+		switch key {
+		case LaunchTypeTag:
+			want = instanceType
+		case LaunchSecurityGroupsTag:
+			want = joinSorted(groups)
+		case LaunchTagsTag:
+			want = tagsDigest(tags)
+		default:
+			continue
+		}
+		if want != value {
+			update[key] = want
+		}
+	}
+	return update
+}
+
+// LaunchDrift compares an instance with the configuration recorded when it
+// was launched. Attributes that were not recorded are not compared.
+func LaunchDrift(instance types.Instance) []Drift {
+	tags := map[string]string{}
+	for _, tag := range instance.Tags {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+
+	var drift []Drift
+	if expected, ok := tags[LaunchTypeTag]; ok && expected != string(instance.InstanceType) {
+		drift = append(drift, Drift{Attribute: "type", Expected: expected, Actual: string(instance.InstanceType)})
+	}
+	if expected, ok := tags[LaunchSecurityGroupsTag]; ok {
+		groups := make([]string, len(instance.SecurityGroups))
+		for i, group := range instance.SecurityGroups {
+			groups[i] = aws.ToString(group.GroupId)
+		}
+		if actual := joinSorted(groups); actual != expected {
+			drift = append(drift, Drift{Attribute: "security-groups", Expected: expected, Actual: actual})
+		}
+	}
+	if expected, ok := tags[LaunchTagsTag]; ok {
+		if actual := tagsDigest(tags); actual != expected {
+			drift = append(drift, Drift{Attribute: "tags", Expected: expected, Actual: actual})
+		}
+	}
+	return drift
+}
+
+// tagsDigest hashes tags other than the launch record and AWS's own tags
+func tagsDigest(tags map[string]string) string {
+	h := sha256.New()
+	for _, key := range sortedKeys(tags) {
+		if strings.HasPrefix(key, "ec-manager:") || strings.HasPrefix(key, "aws:") {
+			continue
+		}
+		fmt.Fprintf(h, "%s=%s\n", key, tags[key])
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+func joinSorted(values []string) string {
+	sorted := append([]string(nil), values...)
+	sort.Strings(sorted)
+	return strings.Join(sorted, ",")
+}
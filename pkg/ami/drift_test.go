@@ -0,0 +1,73 @@
+package ami
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLaunchDrift(t *testing.T) {
+	record := launchRecord(InstanceConfig{InstanceType: "t3.micro", SecurityGroupIDs: []string{"sg-2", "sg-1"}},
+		map[string]string{"Name": "web-1", "Env": "prod"})
+
+	launched := func(instanceType string, groups []string, tags map[string]string) types.Instance {
+		instance := types.Instance{InstanceType: types.InstanceType(instanceType)}
+		for _, group := range groups {
+			instance.SecurityGroups = append(instance.SecurityGroups, types.GroupIdentifier{GroupId: aws.String(group)})
+		}
+		all := map[string]string{"aws:cloudformation:stack-name": "web"}
+		for key, value := range record {
+			all[key] = value
+		}
+		for key, value := range tags {
+			all[key] = value
+		}
+		instance.Tags = ec2Tags(all)
+		return instance
+	}
+
+	tests := []struct {
+		name     string
+		instance types.Instance
+		want     []string
+	}{
+		{
+			name:     "unchanged",
+			instance: launched("t3.micro", []string{"sg-1", "sg-2"}, map[string]string{"Name": "web-1", "Env": "prod"}),
+		},
+		{
+			name:     "type",
+			instance: launched("t3.large", []string{"sg-1", "sg-2"}, map[string]string{"Name": "web-1", "Env": "prod"}),
+			want:     []string{"type"},
+		},
+		{
+			name:     "security groups and tags",
+			instance: launched("t3.micro", []string{"sg-1"}, map[string]string{"Name": "web-1", "Env": "dev"}),
+			want:     []string{"security-groups", "tags"},
+		},
+		{
+			name:     "added tag",
+			instance: launched("t3.micro", []string{"sg-1", "sg-2"}, map[string]string{"Name": "web-1", "Env": "prod", "Owner": "me"}),
+			want:     []string{"tags"},
+		},
+		{
+			name:     "not recorded",
+			instance: types.Instance{InstanceType: "t3.large", Tags: ec2Tags(map[string]string{"Name": "web-1"})},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, d := range LaunchDrift(tt.instance) {
+				got = append(got, d.Attribute)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	assert.True(t, HasLaunchRecord(tests[0].instance))
+	assert.False(t, HasLaunchRecord(tests[4].instance))
+}
@@ -0,0 +1,226 @@
+package ami
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// VolumeConfig is an EBS volume of a new instance
+type VolumeConfig struct {
+	// Device is the device name, e.g. /dev/sdf. Additional volumes without
+	// one get the next free name from /dev/sdf.
+	Device  string
+	SizeGiB int32
+	// Type is the EBS volume type, e.g. gp3
+	Type string
+}
+
+// IsEmpty reports whether the volume changes nothing
+func (v VolumeConfig) IsEmpty() bool {
+	return v.SizeGiB == 0 && v.Type == ""
+}
+
+// ParseVolume parses a volume spec of comma-separated key=value pairs:
+// size in GiB, and optionally type and device, e.g. size=100,type=gp3
+func ParseVolume(spec string) (VolumeConfig, error) {
+	var v VolumeConfig
+	for _, field := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(field, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || value == "" {
+			return VolumeConfig{}, fmt.Errorf("invalid volume %q, expected size=GiB[,type=TYPE][,device=DEVICE]", spec)
+		}
+		switch key {
+		case "size":
+			size, err := strconv.ParseInt(value, 10, 32)
+			if err != nil || size <= 0 {
+				return VolumeConfig{}, fmt.Errorf("invalid volume size %q, expected a positive number of GiB", value)
+			}
+			v.SizeGiB = int32(size)
+		case "type":
+			v.Type = value
+		case "device":
+			v.Device = value
+		default:
+			return VolumeConfig{}, fmt.Errorf("invalid volume %q: unknown key %q", spec, key)
+		}
+	}
+	if v.SizeGiB == 0 {
+		return VolumeConfig{}, fmt.Errorf("invalid volume %q: size is required", spec)
+	}
+	return v, nil
+}
+
+// runInstancesInput builds the RunInstances call for cfg
+func (s *Service) runInstancesInput(ctx context.Context, cfg InstanceConfig) (*ec2.RunInstancesInput, error) {
+	input := &ec2.RunInstancesInput{
+		MinCount: aws.Int32(1),
+		MaxCount: aws.Int32(1),
+	}
+
+	if cfg.LaunchTemplate != "" {
+		spec := &types.LaunchTemplateSpecification{}
+		if strings.HasPrefix(cfg.LaunchTemplate, "lt-") {
+			spec.LaunchTemplateId = aws.String(cfg.LaunchTemplate)
+		} else {
+			spec.LaunchTemplateName = aws.String(cfg.LaunchTemplate)
+		}
+		if cfg.LaunchTemplateVersion != "" {
+			spec.Version = aws.String(cfg.LaunchTemplateVersion)
+		}
+		input.LaunchTemplate = spec
+	}
+
+	if cfg.ImageID != "" {
+		input.ImageId = aws.String(cfg.ImageID)
+	}
+	if cfg.InstanceType != "" {
+		input.InstanceType = types.InstanceType(cfg.InstanceType)
+	}
+	if cfg.KeyName != "" {
+		input.KeyName = aws.String(cfg.KeyName)
+	}
+	if cfg.SubnetID != "" {
+		input.SubnetId = aws.String(cfg.SubnetID)
+	}
+	if len(cfg.SecurityGroupIDs) > 0 {
+		input.SecurityGroupIds = cfg.SecurityGroupIDs
+	}
+	if cfg.InstanceProfile != "" {
+		if strings.HasPrefix(cfg.InstanceProfile, "arn:") {
+			input.IamInstanceProfile = &types.IamInstanceProfileSpecification{Arn: aws.String(cfg.InstanceProfile)}
+		} else {
+			input.IamInstanceProfile = &types.IamInstanceProfileSpecification{Name: aws.String(cfg.InstanceProfile)}
+		}
+	}
+	if cfg.Spot != nil {
+		if err := cfg.Spot.Validate(); err != nil {
+			return nil, err
+		}
+		input.InstanceMarketOptions = cfg.Spot.marketOptions()
+	}
+	if cfg.UserData != "" {
+		input.UserData = aws.String(base64.StdEncoding.EncodeToString([]byte(cfg.UserData)))
+	}
+
+	mappings, err := s.blockDeviceMappings(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	input.BlockDeviceMappings = mappings
+
+	tags := make(map[string]string, len(cfg.Tags)+1)
+	for key, value := range cfg.Tags {
+		tags[key] = value
+	}
+	if cfg.Name != "" {
+		tags["Name"] = cfg.Name
+	}
+	// The instance also records its launch configuration for check drift
+	instanceTags := make(map[string]string, len(tags)+4)
+	for key, value := range tags {
+		instanceTags[key] = value
+	}
+	for key, value := range launchRecord(cfg, tags) {
+		instanceTags[key] = value
+	}
+	switch {
+	case cfg.Spot != nil:
+		instanceTags[PurchaseOptionTag] = cfg.Spot.String()
+	case cfg.LaunchTemplate == "":
+		instanceTags[PurchaseOptionTag] = PurchaseOnDemand
+	}
+	if len(instanceTags) > 0 {
+		input.TagSpecifications = []types.TagSpecification{
+			{ResourceType: types.ResourceTypeInstance, Tags: ec2Tags(instanceTags)},
+		}
+	}
+	if len(tags) > 0 {
+		input.TagSpecifications = append(input.TagSpecifications,
+			types.TagSpecification{ResourceType: types.ResourceTypeVolume, Tags: ec2Tags(tags)})
+	}
+
+	return input, nil
+}
+
+// ec2Tags converts tags to EC2 tags sorted by key
+func ec2Tags(tags map[string]string) []types.Tag {
+	converted := make([]types.Tag, 0, len(tags))
+	for _, key := range sortedKeys(tags) {
+		converted = append(converted, types.Tag{
+			Key:   aws.String(key),
+			Value: aws.String(tags[key]),
+		})
+	}
+	return converted
+}
+
+// blockDeviceMappings returns the mappings for the root volume changes and
+// additional volumes of cfg. Changing the root volume needs the AMI's root
+// device name.
+func (s *Service) blockDeviceMappings(ctx context.Context, cfg InstanceConfig) ([]types.BlockDeviceMapping, error) {
+	var mappings []types.BlockDeviceMapping
+	used := map[string]bool{}
+
+	if !cfg.RootVolume.IsEmpty() {
+		if cfg.ImageID == "" {
+			return nil, fmt.Errorf("changing the root volume needs the AMI to find its root device")
+		}
+		image, err := s.GetImage(ctx, cfg.ImageID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find root device of AMI %s: %w", cfg.ImageID, err)
+		}
+		device := aws.ToString(image.RootDeviceName)
+		if device == "" {
+			return nil, fmt.Errorf("AMI %s has no root device", cfg.ImageID)
+		}
+		mappings = append(mappings, ebsMapping(device, cfg.RootVolume))
+		used[device] = true
+	}
+
+	for _, volume := range cfg.Volumes {
+		if volume.Device == "" {
+			continue
+		}
+		if used[volume.Device] {
+			return nil, fmt.Errorf("device %s is used by more than one volume", volume.Device)
+		}
+		used[volume.Device] = true
+	}
+
+	next := 'f'
+	for _, volume := range cfg.Volumes {
+		device := volume.Device
+		for device == "" {
+			if next > 'p' {
+				return nil, fmt.Errorf("too many volumes, give devices explicitly")
+			}
+			if candidate := fmt.Sprintf("/dev/sd%c", next); !used[candidate] {
+				device = candidate
+				used[device] = true
+			}
+			next++
+		}
+		mappings = append(mappings, ebsMapping(device, volume))
+	}
+	return mappings, nil
+}
+
+// ebsMapping maps device to an EBS volume deleted with the instance
+func ebsMapping(device string, volume VolumeConfig) types.BlockDeviceMapping {
+	ebs := &types.EbsBlockDevice{DeleteOnTermination: aws.Bool(true)}
+	if volume.SizeGiB > 0 {
+		ebs.VolumeSize = aws.Int32(volume.SizeGiB)
+	}
+	if volume.Type != "" {
+		ebs.VolumeType = types.VolumeType(volume.Type)
+	}
+	return types.BlockDeviceMapping{DeviceName: aws.String(device), Ebs: ebs}
+}
@@ -0,0 +1,136 @@
+package ami
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rootDeviceEC2Client describes every AMI with a /dev/xvda root device
+type rootDeviceEC2Client struct {
+	EC2Client
+}
+
+func (c *rootDeviceEC2Client) DescribeImages(ctx context.Context, params *ec2.DescribeImagesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeImagesOutput, error) {
+	return &ec2.DescribeImagesOutput{Images: []types.Image{{
+		ImageId:        aws.String(params.ImageIds[0]),
+		RootDeviceName: aws.String("/dev/xvda"),
+	}}}, nil
+}
+
+func TestParseVolume(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    VolumeConfig
+		wantErr bool
+	}{
+		{spec: "size=100", want: VolumeConfig{SizeGiB: 100}},
+		{spec: "size=50,type=gp3,device=/dev/sdg", want: VolumeConfig{SizeGiB: 50, Type: "gp3", Device: "/dev/sdg"}},
+		{spec: "type=gp3", wantErr: true},
+		{spec: "size=0", wantErr: true},
+		{spec: "size=big", wantErr: true},
+		{spec: "size=10,iops=3000", wantErr: true},
+		{spec: "100", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseVolume(tt.spec)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRunInstancesInput(t *testing.T) {
+	service := NewService(&rootDeviceEC2Client{})
+
+	input, err := service.runInstancesInput(context.Background(), InstanceConfig{
+		ImageID:          "ami-1",
+		InstanceType:     "t3.micro",
+		KeyName:          "ops",
+		SubnetID:         "subnet-1",
+		Name:             "web-1",
+		SecurityGroupIDs: []string{"sg-1"},
+		InstanceProfile:  "arn:aws:iam::123456789012:instance-profile/web",
+		UserData:         "#!/bin/sh\n",
+		RootVolume:       VolumeConfig{SizeGiB: 20, Type: "gp3"},
+		Volumes:          []VolumeConfig{{SizeGiB: 100}, {SizeGiB: 10, Device: "/dev/sdf"}},
+		Tags:             map[string]string{"Env": "prod", "Name": "ignored"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "ami-1", aws.ToString(input.ImageId))
+	assert.Equal(t, types.InstanceType("t3.micro"), input.InstanceType)
+	assert.Equal(t, []string{"sg-1"}, input.SecurityGroupIds)
+	assert.Equal(t, "arn:aws:iam::123456789012:instance-profile/web", aws.ToString(input.IamInstanceProfile.Arn))
+	assert.Equal(t, "IyEvYmluL3NoCg==", aws.ToString(input.UserData))
+	assert.Nil(t, input.LaunchTemplate)
+
+	var devices []string
+	for _, mapping := range input.BlockDeviceMappings {
+		devices = append(devices, aws.ToString(mapping.DeviceName))
+	}
+	assert.Equal(t, []string{"/dev/xvda", "/dev/sdg", "/dev/sdf"}, devices)
+	assert.Equal(t, int32(20), aws.ToInt32(input.BlockDeviceMappings[0].Ebs.VolumeSize))
+	assert.Equal(t, types.VolumeTypeGp3, input.BlockDeviceMappings[0].Ebs.VolumeType)
+
+	require.Len(t, input.TagSpecifications, 2)
+	launchTags := map[string]string{"Env": "prod", "Name": "web-1"}
+	assert.Equal(t, []types.Tag{
+		{Key: aws.String("Env"), Value: aws.String("prod")},
+		{Key: aws.String("Name"), Value: aws.String("web-1")},
+		{Key: aws.String(LaunchSecurityGroupsTag), Value: aws.String("sg-1")},
+		{Key: aws.String(LaunchTagsTag), Value: aws.String(tagsDigest(launchTags))},
+		{Key: aws.String(LaunchTypeTag), Value: aws.String("t3.micro")},
+		{Key: aws.String(PurchaseOptionTag), Value: aws.String(PurchaseOnDemand)},
+	}, input.TagSpecifications[0].Tags)
+	assert.Nil(t, input.InstanceMarketOptions)
+	assert.Equal(t, []types.Tag{
+		{Key: aws.String("Env"), Value: aws.String("prod")},
+		{Key: aws.String("Name"), Value: aws.String("web-1")},
+	}, input.TagSpecifications[1].Tags)
+}
+
+func TestRunInstancesInputLaunchTemplate(t *testing.T) {
+	service := NewService(&rootDeviceEC2Client{})
+	ctx := context.Background()
+
+	input, err := service.runInstancesInput(ctx, InstanceConfig{
+		LaunchTemplate:        "lt-0123456789abcdef0",
+		LaunchTemplateVersion: "3",
+		InstanceType:          "t3.large",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, &types.LaunchTemplateSpecification{
+		LaunchTemplateId: aws.String("lt-0123456789abcdef0"),
+		Version:          aws.String("3"),
+	}, input.LaunchTemplate)
+	assert.Nil(t, input.ImageId)
+	assert.Nil(t, input.KeyName)
+	assert.Equal(t, types.InstanceType("t3.large"), input.InstanceType)
+	assert.Empty(t, input.TagSpecifications, "template launches are not recorded")
+
+	input, err = service.runInstancesInput(ctx, InstanceConfig{LaunchTemplate: "web", InstanceProfile: "web"})
+	require.NoError(t, err)
+	assert.Equal(t, "web", aws.ToString(input.LaunchTemplate.LaunchTemplateName))
+	assert.Equal(t, "web", aws.ToString(input.IamInstanceProfile.Name))
+
+	_, err = service.runInstancesInput(ctx, InstanceConfig{LaunchTemplate: "web", RootVolume: VolumeConfig{SizeGiB: 20}})
+	assert.EqualError(t, err, "changing the root volume needs the AMI to find its root device")
+
+	_, err = service.runInstancesInput(ctx, InstanceConfig{
+		LaunchTemplate: "web",
+		Volumes:        []VolumeConfig{{SizeGiB: 1, Device: "/dev/sdh"}, {SizeGiB: 2, Device: "/dev/sdh"}},
+	})
+	assert.EqualError(t, err, "device /dev/sdh is used by more than one volume")
+}
@@ -0,0 +1,47 @@
+package ami
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// TagInstance adds tags to an instance, replacing the values of tags it
+// already has
+func (s *Service) TagInstance(ctx context.Context, instanceID string, tags map[string]string) error {
+	_, err := s.client.CreateTags(ctx, &ec2.CreateTagsInput{
+		Resources: []string{instanceID},
+		Tags:      ec2Tags(tags),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to tag instance: %w", err)
+	}
+	return nil
+}
+
+// SetSecurityGroups replaces the security groups of an instance
+func (s *Service) SetSecurityGroups(ctx context.Context, instanceID string, groupIDs []string) error {
+	_, err := s.client.ModifyInstanceAttribute(ctx, &ec2.ModifyInstanceAttributeInput{
+		InstanceId: aws.String(instanceID),
+		Groups:     groupIDs,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set security groups: %w", err)
+	}
+	return nil
+}
+
+// SetInstanceType changes the type of a stopped instance
+func (s *Service) SetInstanceType(ctx context.Context, instanceID, instanceType string) error {
+	_, err := s.client.ModifyInstanceAttribute(ctx, &ec2.ModifyInstanceAttributeInput{
+		InstanceId:   aws.String(instanceID),
+		InstanceType: &types.AttributeValue{Value: aws.String(instanceType)},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set instance type: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package ami
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// ErrStopIteration can be returned from an iteration callback to stop
+// paging early. The Each* methods treat it as a normal end of iteration.
+var ErrStopIteration = errors.New("stop iteration")
+
+// Page size bounds accepted by the EC2 Describe* APIs
+const (
+	minPageSize int32 = 5
+	maxPageSize int32 = 1000
+)
+
+// ServiceOption configures optional Service behaviour
+type ServiceOption func(*Service)
+
+// WithPageSize sets the number of results requested per page from the
+// paginated EC2 APIs. Zero leaves the page size up to the service.
+func WithPageSize(size int32) ServiceOption {
+	return func(s *Service) {
+		s.pageSize = size
+	}
+}
+
+// pageLimit returns the page size to request, clamped to the API bounds
+func (s *Service) pageLimit() int32 {
+	switch {
+	case s.pageSize <= 0:
+		return 0
+	case s.pageSize < minPageSize:
+		return minPageSize
+	case s.pageSize > maxPageSize:
+		return maxPageSize
+	}
+	return s.pageSize
+}
+
+// stopped reports whether err ends an iteration, and the error to return
+func stopped(err error) (bool, error) {
+	if err == nil {
+		return false, nil
+	}
+	if errors.Is(err, ErrStopIteration) {
+		return true, nil
+	}
+	return true, err
+}
+
+// EachInstance calls fn for every instance matching input, following
+// NextToken until all pages have been read or fn stops the iteration
+func (s *Service) EachInstance(ctx context.Context, input *ec2.DescribeInstancesInput, fn func(types.Instance) error) error {
+	if input == nil {
+		input = &ec2.DescribeInstancesInput{}
+	}
+
+	// MaxResults cannot be combined with explicit instance IDs
+	opts := func(o *ec2.DescribeInstancesPaginatorOptions) {
+		if len(input.InstanceIds) == 0 {
+			o.Limit = s.pageLimit()
+		}
+		o.StopOnDuplicateToken = true
+	}
+
+	paginator := ec2.NewDescribeInstancesPaginator(s.client, input, opts)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to describe instances: %w", err)
+		}
+		for _, reservation := range page.Reservations {
+			for _, instance := range reservation.Instances {
+				if done, err := stopped(fn(instance)); done {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// ListInstances returns every instance matching input across all pages
+func (s *Service) ListInstances(ctx context.Context, input *ec2.DescribeInstancesInput) ([]types.Instance, error) {
+	var instances []types.Instance
+	err := s.EachInstance(ctx, input, func(instance types.Instance) error {
+		instances = append(instances, instance)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return instances, nil
+}
+
+// EachImage calls fn for every AMI matching input across all pages
+func (s *Service) EachImage(ctx context.Context, input *ec2.DescribeImagesInput, fn func(types.Image) error) error {
+	if input == nil {
+		input = &ec2.DescribeImagesInput{}
+	}
+
+	opts := func(o *ec2.DescribeImagesPaginatorOptions) {
+		if len(input.ImageIds) == 0 {
+			o.Limit = s.pageLimit()
+		}
+		o.StopOnDuplicateToken = true
+	}
+
+	paginator := ec2.NewDescribeImagesPaginator(s.client, input, opts)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to describe images: %w", err)
+		}
+		for _, image := range page.Images {
+			if done, err := stopped(fn(image)); done {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ListImages returns every AMI matching input across all pages
+func (s *Service) ListImages(ctx context.Context, input *ec2.DescribeImagesInput) ([]types.Image, error) {
+	var images []types.Image
+	err := s.EachImage(ctx, input, func(image types.Image) error {
+		images = append(images, image)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return images, nil
+}
+
+// EachSubnet calls fn for every subnet matching input across all pages
+func (s *Service) EachSubnet(ctx context.Context, input *ec2.DescribeSubnetsInput, fn func(types.Subnet) error) error {
+	if input == nil {
+		input = &ec2.DescribeSubnetsInput{}
+	}
+
+	opts := func(o *ec2.DescribeSubnetsPaginatorOptions) {
+		if len(input.SubnetIds) == 0 {
+			o.Limit = s.pageLimit()
+		}
+		o.StopOnDuplicateToken = true
+	}
+
+	paginator := ec2.NewDescribeSubnetsPaginator(s.client, input, opts)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to describe subnets: %w", err)
+		}
+		for _, subnet := range page.Subnets {
+			if done, err := stopped(fn(subnet)); done {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// EachSnapshot calls fn for every snapshot matching input across all pages
+func (s *Service) EachSnapshot(ctx context.Context, input *ec2.DescribeSnapshotsInput, fn func(types.Snapshot) error) error {
+	if input == nil {
+		input = &ec2.DescribeSnapshotsInput{}
+	}
+
+	opts := func(o *ec2.DescribeSnapshotsPaginatorOptions) {
+		if len(input.SnapshotIds) == 0 {
+			o.Limit = s.pageLimit()
+		}
+		o.StopOnDuplicateToken = true
+	}
+
+	paginator := ec2.NewDescribeSnapshotsPaginator(s.client, input, opts)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to describe snapshots: %w", err)
+		}
+		for _, snapshot := range page.Snapshots {
+			if done, err := stopped(fn(snapshot)); done {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ListSnapshots returns every snapshot matching input across all pages
+func (s *Service) ListSnapshots(ctx context.Context, input *ec2.DescribeSnapshotsInput) ([]types.Snapshot, error) {
+	var snapshots []types.Snapshot
+	err := s.EachSnapshot(ctx, input, func(snapshot types.Snapshot) error {
+		snapshots = append(snapshots, snapshot)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
+
+// maxInstanceTypesPageSize is the largest page DescribeInstanceTypes accepts
+const maxInstanceTypesPageSize int32 = 100
+
+// ListInstanceTypes returns every instance type matching input across all
+// pages
+func (s *Service) ListInstanceTypes(ctx context.Context, input *ec2.DescribeInstanceTypesInput) ([]types.InstanceTypeInfo, error) {
+	if input == nil {
+		input = &ec2.DescribeInstanceTypesInput{}
+	}
+
+	opts := func(o *ec2.DescribeInstanceTypesPaginatorOptions) {
+		if len(input.InstanceTypes) == 0 {
+			o.Limit = min(s.pageLimit(), maxInstanceTypesPageSize)
+		}
+		o.StopOnDuplicateToken = true
+	}
+
+	var infos []types.InstanceTypeInfo
+	paginator := ec2.NewDescribeInstanceTypesPaginator(s.client, input, opts)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to describe instance types: %w", err)
+		}
+		infos = append(infos, page.InstanceTypes...)
+	}
+	return infos, nil
+}
@@ -0,0 +1,145 @@
+package ami
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pagingEC2Client serves DescribeInstances and DescribeImages in fixed pages
+type pagingEC2Client struct {
+	EC2Client
+	instancePages [][]types.Instance
+	imagePages    [][]types.Image
+	maxResults    []*int32
+}
+
+func pageToken(i, total int) *string {
+	if i+1 >= total {
+		return nil
+	}
+	return aws.String(string(rune('a' + i + 1)))
+}
+
+func pageIndex(token *string) int {
+	if token == nil {
+		return 0
+	}
+	return int(rune((*token)[0]) - 'a')
+}
+
+func (c *pagingEC2Client) DescribeInstances(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	c.maxResults = append(c.maxResults, params.MaxResults)
+	i := pageIndex(params.NextToken)
+	return &ec2.DescribeInstancesOutput{
+		Reservations: []types.Reservation{{Instances: c.instancePages[i]}},
+		NextToken:    pageToken(i, len(c.instancePages)),
+	}, nil
+}
+
+func (c *pagingEC2Client) DescribeImages(ctx context.Context, params *ec2.DescribeImagesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeImagesOutput, error) {
+	i := pageIndex(params.NextToken)
+	return &ec2.DescribeImagesOutput{
+		Images:    c.imagePages[i],
+		NextToken: pageToken(i, len(c.imagePages)),
+	}, nil
+}
+
+func instancePage(ids ...string) []types.Instance {
+	var instances []types.Instance
+	for _, id := range ids {
+		instances = append(instances, types.Instance{InstanceId: aws.String(id)})
+	}
+	return instances
+}
+
+func TestEachInstanceFollowsNextToken(t *testing.T) {
+	client := &pagingEC2Client{
+		instancePages: [][]types.Instance{
+			instancePage("i-1", "i-2"),
+			instancePage("i-3"),
+			instancePage("i-4", "i-5"),
+		},
+	}
+	svc := NewService(client, WithPageSize(2))
+
+	instances, err := svc.ListInstances(context.Background(), nil)
+	require.NoError(t, err)
+	require.Len(t, instances, 5)
+	require.Equal(t, "i-5", aws.ToString(instances[4].InstanceId))
+
+	// page size is clamped to the API minimum
+	require.Len(t, client.maxResults, 3)
+	require.Equal(t, minPageSize, aws.ToInt32(client.maxResults[0]))
+}
+
+func TestEachInstanceStopIteration(t *testing.T) {
+	client := &pagingEC2Client{
+		instancePages: [][]types.Instance{
+			instancePage("i-1", "i-2"),
+			instancePage("i-3"),
+		},
+	}
+	svc := NewService(client)
+
+	var seen []string
+	err := svc.EachInstance(context.Background(), nil, func(instance types.Instance) error {
+		seen = append(seen, aws.ToString(instance.InstanceId))
+		return ErrStopIteration
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"i-1"}, seen)
+	require.Len(t, client.maxResults, 1)
+	require.Nil(t, client.maxResults[0])
+}
+
+func TestDescribeInstancesMergesPages(t *testing.T) {
+	client := &pagingEC2Client{
+		instancePages: [][]types.Instance{
+			instancePage("i-1"),
+			instancePage("i-2"),
+		},
+	}
+	svc := NewService(client)
+
+	output, err := svc.DescribeInstances(context.Background())
+	require.NoError(t, err)
+	require.Len(t, output.Reservations, 2)
+}
+
+// failingEC2Client fails DescribeInstances with err
+type failingEC2Client struct {
+	EC2Client
+	err error
+}
+
+func (c *failingEC2Client) DescribeInstances(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	return nil, c.err
+}
+
+func TestDescribeInstancesWrapsErrors(t *testing.T) {
+	client := &failingEC2Client{err: errors.New("throttled")}
+
+	_, err := NewService(client).DescribeInstances(context.Background())
+	assert.EqualError(t, err, "failed to describe instances: throttled")
+}
+
+func TestGetLatestAMIReadsPastEmptyPages(t *testing.T) {
+	client := &pagingEC2Client{
+		imagePages: [][]types.Image{
+			{},
+			{{ImageId: aws.String("ami-2")}},
+		},
+	}
+	svc := NewService(client)
+
+	image, err := svc.GetLatestAMI(context.Background(), "RHEL9")
+	require.NoError(t, err)
+	require.Equal(t, "ami-2", aws.ToString(image.ImageId))
+}
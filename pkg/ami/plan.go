@@ -0,0 +1,405 @@
+package ami
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+)
+
+// Validation outcomes of a planned call sent with EC2's DryRun flag
+const (
+	ValidationAllowed = "allowed"
+	ValidationDenied  = "denied"
+	ValidationSkipped = "skipped"
+	ValidationUnknown = "unknown"
+)
+
+// PlannedCall is a mutating EC2 API call a dry run recorded instead of making
+type PlannedCall struct {
+	Action string `json:"action"`
+	// Params are the call's resolved input, without empty fields
+	Params map[string]interface{} `json:"params"`
+	// Validation is the outcome of sending the call with DryRun set, or
+	// empty when calls are not validated
+	Validation string `json:"validation,omitempty"`
+	Detail     string `json:"detail,omitempty"`
+}
+
+// Plan records the mutating calls of every Service created WithDryRun
+type Plan struct {
+	validate bool
+
+	mu      sync.Mutex
+	calls   []PlannedCall
+	planned map[string]bool
+	nextID  int
+}
+
+// NewPlan creates an empty plan. With validate set, each recorded call is
+// also sent with EC2's DryRun flag to check it would be permitted.
+func NewPlan(validate bool) *Plan {
+	return &Plan{validate: validate, planned: map[string]bool{}}
+}
+
+// Calls returns the recorded calls in the order they were made
+func (p *Plan) Calls() []PlannedCall {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]PlannedCall(nil), p.calls...)
+}
+
+// WithDryRun makes the service record its mutating calls in plan instead
+// of making them. Planned calls return placeholder resource IDs, and waits
+// for planned changes return immediately.
+func WithDryRun(plan *Plan) ServiceOption {
+	return func(s *Service) {
+		s.client = &planningClient{EC2Client: s.client, plan: plan}
+	}
+}
+
+// placeholder returns a new ID for a resource a planned call would create
+func (p *Plan) placeholder(prefix string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.nextID++
+	id := fmt.Sprintf("%s-planned%d", prefix, p.nextID)
+	p.planned[id] = true
+	return id
+}
+
+// isPlanned reports whether id was returned by placeholder
+func (p *Plan) isPlanned(id string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.planned[id]
+}
+
+// record adds a call to the plan. probe sends the call with DryRun set; it
+// is skipped for calls on resources that only exist in the plan, which EC2
+// would reject as not found.
+func (p *Plan) record(action string, input interface{}, probe func() error) {
+	params := compactParams(input)
+	call := PlannedCall{Action: action, Params: params}
+
+	if p.validate {
+		encoded, _ := json.Marshal(params)
+		if p.referencesPlanned(string(encoded)) {
+			call.Validation = ValidationSkipped
+			call.Detail = "depends on a planned resource"
+		} else {
+			call.Validation, call.Detail = validation(probe())
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.calls = append(p.calls, call)
+}
+
+func (p *Plan) referencesPlanned(encoded string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for id := range p.planned {
+		if strings.Contains(encoded, `"`+id+`"`) {
+			return true
+		}
+	}
+	return false
+}
+
+// validation maps the error of a DryRun call to its outcome
+func validation(err error) (string, string) {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		if err == nil {
+			return ValidationUnknown, "dry run returned no error"
+		}
+		return ValidationUnknown, err.Error()
+	}
+
+	switch apiErr.ErrorCode() {
+	case "DryRunOperation":
+		return ValidationAllowed, ""
+	case "UnauthorizedOperation", "AccessDenied", "AuthFailure":
+		return ValidationDenied, apiErr.ErrorCode()
+	default:
+		return ValidationUnknown, apiErr.ErrorCode()
+	}
+}
+
+// secretParams are input fields that may hold secrets, such as user data
+// scripts with credentials, and are never recorded in plans or audit logs
+var secretParams = map[string]bool{"UserData": true}
+
+// redacted replaces the value of a secret field that was set
+const redacted = "[redacted]"
+
+// compactParams converts an API input to a map without the nil, empty and
+// DryRun fields the SDK structs are full of, with secret fields redacted
+func compactParams(input interface{}) map[string]interface{} {
+	data, err := json.Marshal(input)
+	if err != nil {
+		return map[string]interface{}{"error": err.Error()}
+	}
+	var params map[string]interface{}
+	if err := json.Unmarshal(data, &params); err != nil {
+		return map[string]interface{}{"error": err.Error()}
+	}
+	delete(params, "DryRun")
+	compact(params)
+	redact(params)
+	return params
+}
+
+// redact replaces the values of secret fields in v, recursively
+func redact(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if secretParams[key] {
+				v[key] = redacted
+				continue
+			}
+			redact(value)
+		}
+	case []interface{}:
+		for _, value := range v {
+			redact(value)
+		}
+	}
+}
+
+// compact removes empty values from v, recursively, and reports whether
+// anything is left
+func compact(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case string:
+		return v != ""
+	case map[string]interface{}:
+		for key, value := range v {
+			if !compact(value) {
+				delete(v, key)
+			}
+		}
+		return len(v) > 0
+	case []interface{}:
+		for _, value := range v {
+			compact(value)
+		}
+		return len(v) > 0
+	default:
+		return true
+	}
+}
+
+// planningClient records mutating calls in a plan and answers them with
+// placeholder results, passing read-only calls through
+type planningClient struct {
+	EC2Client
+	plan *Plan
+}
+
+func (c *planningClient) RunInstances(ctx context.Context, params *ec2.RunInstancesInput, optFns ...func(*ec2.Options)) (*ec2.RunInstancesOutput, error) {
+	c.plan.record("ec2:RunInstances", params, func() error {
+		in := *params
+		in.DryRun = aws.Bool(true)
+		_, err := c.EC2Client.RunInstances(ctx, &in, optFns...)
+		return err
+	})
+
+	count := int(aws.ToInt32(params.MinCount))
+	if count < 1 {
+		count = 1
+	}
+	out := &ec2.RunInstancesOutput{}
+	for i := 0; i < count; i++ {
+		out.Instances = append(out.Instances, types.Instance{
+			InstanceId:   aws.String(c.plan.placeholder("i")),
+			ImageId:      params.ImageId,
+			InstanceType: params.InstanceType,
+			State:        &types.InstanceState{Name: types.InstanceStateNamePending},
+		})
+	}
+	return out, nil
+}
+
+func (c *planningClient) CreateTags(ctx context.Context, params *ec2.CreateTagsInput, optFns ...func(*ec2.Options)) (*ec2.CreateTagsOutput, error) {
+	c.plan.record("ec2:CreateTags", params, func() error {
+		in := *params
+		in.DryRun = aws.Bool(true)
+		_, err := c.EC2Client.CreateTags(ctx, &in, optFns...)
+		return err
+	})
+	return &ec2.CreateTagsOutput{}, nil
+}
+
+func (c *planningClient) CreateImage(ctx context.Context, params *ec2.CreateImageInput, optFns ...func(*ec2.Options)) (*ec2.CreateImageOutput, error) {
+	c.plan.record("ec2:CreateImage", params, func() error {
+		in := *params
+		in.DryRun = aws.Bool(true)
+		_, err := c.EC2Client.CreateImage(ctx, &in, optFns...)
+		return err
+	})
+	return &ec2.CreateImageOutput{ImageId: aws.String(c.plan.placeholder("ami"))}, nil
+}
+
+func (c *planningClient) CreateSnapshot(ctx context.Context, params *ec2.CreateSnapshotInput, optFns ...func(*ec2.Options)) (*ec2.CreateSnapshotOutput, error) {
+	c.plan.record("ec2:CreateSnapshot", params, func() error {
+		in := *params
+		in.DryRun = aws.Bool(true)
+		_, err := c.EC2Client.CreateSnapshot(ctx, &in, optFns...)
+		return err
+	})
+	return &ec2.CreateSnapshotOutput{SnapshotId: aws.String(c.plan.placeholder("snap")), VolumeId: params.VolumeId}, nil
+}
+
+func (c *planningClient) CreateVolume(ctx context.Context, params *ec2.CreateVolumeInput, optFns ...func(*ec2.Options)) (*ec2.CreateVolumeOutput, error) {
+	c.plan.record("ec2:CreateVolume", params, func() error {
+		in := *params
+		in.DryRun = aws.Bool(true)
+		_, err := c.EC2Client.CreateVolume(ctx, &in, optFns...)
+		return err
+	})
+	return &ec2.CreateVolumeOutput{
+		VolumeId:         aws.String(c.plan.placeholder("vol")),
+		AvailabilityZone: params.AvailabilityZone,
+		SnapshotId:       params.SnapshotId,
+	}, nil
+}
+
+func (c *planningClient) AttachVolume(ctx context.Context, params *ec2.AttachVolumeInput, optFns ...func(*ec2.Options)) (*ec2.AttachVolumeOutput, error) {
+	c.plan.record("ec2:AttachVolume", params, func() error {
+		in := *params
+		in.DryRun = aws.Bool(true)
+		_, err := c.EC2Client.AttachVolume(ctx, &in, optFns...)
+		return err
+	})
+	return &ec2.AttachVolumeOutput{InstanceId: params.InstanceId, VolumeId: params.VolumeId, Device: params.Device}, nil
+}
+
+func (c *planningClient) StartInstances(ctx context.Context, params *ec2.StartInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StartInstancesOutput, error) {
+	c.plan.record("ec2:StartInstances", params, func() error {
+		in := *params
+		in.DryRun = aws.Bool(true)
+		_, err := c.EC2Client.StartInstances(ctx, &in, optFns...)
+		return err
+	})
+	return &ec2.StartInstancesOutput{StartingInstances: stateChanges(params.InstanceIds, types.InstanceStateNamePending)}, nil
+}
+
+func (c *planningClient) StopInstances(ctx context.Context, params *ec2.StopInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StopInstancesOutput, error) {
+	c.plan.record("ec2:StopInstances", params, func() error {
+		in := *params
+		in.DryRun = aws.Bool(true)
+		_, err := c.EC2Client.StopInstances(ctx, &in, optFns...)
+		return err
+	})
+	return &ec2.StopInstancesOutput{StoppingInstances: stateChanges(params.InstanceIds, types.InstanceStateNameStopping)}, nil
+}
+
+func (c *planningClient) TerminateInstances(ctx context.Context, params *ec2.TerminateInstancesInput, optFns ...func(*ec2.Options)) (*ec2.TerminateInstancesOutput, error) {
+	c.plan.record("ec2:TerminateInstances", params, func() error {
+		in := *params
+		in.DryRun = aws.Bool(true)
+		_, err := c.EC2Client.TerminateInstances(ctx, &in, optFns...)
+		return err
+	})
+	return &ec2.TerminateInstancesOutput{TerminatingInstances: stateChanges(params.InstanceIds, types.InstanceStateNameShuttingDown)}, nil
+}
+
+func (c *planningClient) CancelSpotInstanceRequests(ctx context.Context, params *ec2.CancelSpotInstanceRequestsInput, optFns ...func(*ec2.Options)) (*ec2.CancelSpotInstanceRequestsOutput, error) {
+	c.plan.record("ec2:CancelSpotInstanceRequests", params, func() error {
+		in := *params
+		in.DryRun = aws.Bool(true)
+		_, err := c.EC2Client.CancelSpotInstanceRequests(ctx, &in, optFns...)
+		return err
+	})
+	out := &ec2.CancelSpotInstanceRequestsOutput{}
+	for _, id := range params.SpotInstanceRequestIds {
+		out.CancelledSpotInstanceRequests = append(out.CancelledSpotInstanceRequests, types.CancelledSpotInstanceRequest{
+			SpotInstanceRequestId: aws.String(id),
+			State:                 types.CancelSpotInstanceRequestStateCancelled,
+		})
+	}
+	return out, nil
+}
+
+func (c *planningClient) ModifyInstanceAttribute(ctx context.Context, params *ec2.ModifyInstanceAttributeInput, optFns ...func(*ec2.Options)) (*ec2.ModifyInstanceAttributeOutput, error) {
+	c.plan.record("ec2:ModifyInstanceAttribute", params, func() error {
+		in := *params
+		in.DryRun = aws.Bool(true)
+		_, err := c.EC2Client.ModifyInstanceAttribute(ctx, &in, optFns...)
+		return err
+	})
+	return &ec2.ModifyInstanceAttributeOutput{}, nil
+}
+
+// DescribeImages answers for planned AMIs as if they were available, so
+// waiting for a planned backup returns at once
+func (c *planningClient) DescribeImages(ctx context.Context, params *ec2.DescribeImagesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeImagesOutput, error) {
+	if len(params.ImageIds) == 0 {
+		return c.EC2Client.DescribeImages(ctx, params, optFns...)
+	}
+	out := &ec2.DescribeImagesOutput{}
+	for _, id := range params.ImageIds {
+		if !c.plan.isPlanned(id) {
+			return c.EC2Client.DescribeImages(ctx, params, optFns...)
+		}
+		out.Images = append(out.Images, types.Image{ImageId: aws.String(id), State: types.ImageStateAvailable})
+	}
+	return out, nil
+}
+
+func (c *planningClient) NewInstanceRunningWaiter() interface {
+	Wait(ctx context.Context, params *ec2.DescribeInstancesInput, maxWaitDur time.Duration, optFns ...func(*ec2.InstanceRunningWaiterOptions)) error
+} {
+	return noWait[*ec2.DescribeInstancesInput, *ec2.InstanceRunningWaiterOptions]{}
+}
+
+func (c *planningClient) NewInstanceStoppedWaiter() interface {
+	Wait(ctx context.Context, params *ec2.DescribeInstancesInput, maxWaitDur time.Duration, optFns ...func(*ec2.InstanceStoppedWaiterOptions)) error
+} {
+	return noWait[*ec2.DescribeInstancesInput, *ec2.InstanceStoppedWaiterOptions]{}
+}
+
+func (c *planningClient) NewInstanceTerminatedWaiter() interface {
+	Wait(ctx context.Context, params *ec2.DescribeInstancesInput, maxWaitDur time.Duration, optFns ...func(*ec2.InstanceTerminatedWaiterOptions)) error
+} {
+	return noWait[*ec2.DescribeInstancesInput, *ec2.InstanceTerminatedWaiterOptions]{}
+}
+
+func (c *planningClient) NewVolumeAvailableWaiter() interface {
+	Wait(ctx context.Context, params *ec2.DescribeVolumesInput, maxWaitDur time.Duration, optFns ...func(*ec2.VolumeAvailableWaiterOptions)) error
+} {
+	return noWait[*ec2.DescribeVolumesInput, *ec2.VolumeAvailableWaiterOptions]{}
+}
+
+// noWait is a waiter for a planned change, which never has to be waited on
+type noWait[In, Opts any] struct{}
+
+func (noWait[In, Opts]) Wait(ctx context.Context, params In, maxWaitDur time.Duration, optFns ...func(Opts)) error {
+	return nil
+}
+
+// stateChanges reports ids as moved to state
+func stateChanges(ids []string, state types.InstanceStateName) []types.InstanceStateChange {
+	changes := make([]types.InstanceStateChange, len(ids))
+	for i, id := range ids {
+		changes[i] = types.InstanceStateChange{
+			InstanceId:   aws.String(id),
+			CurrentState: &types.InstanceState{Name: state},
+		}
+	}
+	return changes
+}
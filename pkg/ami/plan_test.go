@@ -0,0 +1,98 @@
+package ami
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dryRunEC2Client only accepts mutating calls with DryRun set, allowing
+// CreateImage and denying TerminateInstances
+type dryRunEC2Client struct {
+	filteringEC2Client
+}
+
+var errNotDryRun = errors.New("mutating call made without DryRun")
+
+func (c *dryRunEC2Client) CreateImage(ctx context.Context, params *ec2.CreateImageInput, optFns ...func(*ec2.Options)) (*ec2.CreateImageOutput, error) {
+	if !aws.ToBool(params.DryRun) {
+		return nil, errNotDryRun
+	}
+	return nil, &smithy.GenericAPIError{Code: "DryRunOperation"}
+}
+
+func (c *dryRunEC2Client) TerminateInstances(ctx context.Context, params *ec2.TerminateInstancesInput, optFns ...func(*ec2.Options)) (*ec2.TerminateInstancesOutput, error) {
+	if !aws.ToBool(params.DryRun) {
+		return nil, errNotDryRun
+	}
+	return nil, &smithy.GenericAPIError{Code: "UnauthorizedOperation"}
+}
+
+func TestDryRunRecordsCalls(t *testing.T) {
+	client := &dryRunEC2Client{filteringEC2Client{instances: []types.Instance{
+		namedInstance("i-1", "web-1", types.InstanceStateNameRunning),
+	}}}
+	plan := NewPlan(true)
+	service := NewService(client, WithDryRun(plan))
+	ctx := context.Background()
+
+	amiID, err := service.BackupInstance(ctx, "i-1")
+	require.NoError(t, err)
+	assert.Equal(t, "ami-planned1", amiID)
+
+	var states []string
+	err = service.TerminateInstances(ctx, []string{"i-1"}, func(p Progress) {
+		states = append(states, p.State)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"shutting-down", "terminated"}, states)
+
+	calls := plan.Calls()
+	require.Len(t, calls, 3)
+
+	assert.Equal(t, "ec2:CreateImage", calls[0].Action)
+	assert.Equal(t, "i-1", calls[0].Params["InstanceId"])
+	assert.Equal(t, ValidationAllowed, calls[0].Validation)
+
+	assert.Equal(t, "ec2:CreateTags", calls[1].Action)
+	assert.Equal(t, []interface{}{"ami-planned1"}, calls[1].Params["Resources"])
+	assert.Equal(t, ValidationSkipped, calls[1].Validation)
+
+	assert.Equal(t, "ec2:TerminateInstances", calls[2].Action)
+	assert.Equal(t, ValidationDenied, calls[2].Validation)
+	assert.Equal(t, "UnauthorizedOperation", calls[2].Detail)
+}
+
+func TestCompactParams(t *testing.T) {
+	params := compactParams(&ec2.ModifyInstanceAttributeInput{
+		DryRun:                aws.Bool(true),
+		InstanceId:            aws.String("i-1"),
+		DisableApiTermination: &types.AttributeBooleanValue{Value: aws.Bool(false)},
+		Groups:                []string{},
+	})
+	assert.Equal(t, map[string]interface{}{
+		"InstanceId":            "i-1",
+		"DisableApiTermination": map[string]interface{}{"Value": false},
+	}, params)
+}
+
+func TestCompactParamsRedactsSecrets(t *testing.T) {
+	params := compactParams(&ec2.RunInstancesInput{
+		ImageId:  aws.String("ami-1"),
+		UserData: aws.String("ZXhwb3J0IFRPS0VOPXNlY3JldA=="),
+	})
+	assert.Equal(t, map[string]interface{}{"ImageId": "ami-1", "UserData": redacted}, params)
+
+	params = compactParams(&ec2.ModifyInstanceAttributeInput{
+		InstanceId: aws.String("i-1"),
+		UserData:   &types.BlobAttributeValue{Value: []byte("export TOKEN=secret")},
+	})
+	assert.Equal(t, map[string]interface{}{"InstanceId": "i-1", "UserData": redacted}, params)
+}
@@ -0,0 +1,115 @@
+package ami
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/taemon1337/ec-manager/pkg/config"
+)
+
+// ProtectedTag marks instances that must never be deleted: an instance
+// tagged Protected=true is refused by CheckDeletable
+const ProtectedTag = "Protected"
+
+// ErrProtected is returned for instances that must not be deleted
+var ErrProtected = errors.New("instance is protected")
+
+// IsProtected reports whether the instance is tagged as protected
+func IsProtected(instance types.Instance) bool {
+	for _, tag := range instance.Tags {
+		if aws.ToString(tag.Key) == ProtectedTag && strings.EqualFold(aws.ToString(tag.Value), "true") {
+			return true
+		}
+	}
+	return false
+}
+
+// TerminationProtection reports whether the instance has termination
+// protection (the disableApiTermination attribute) enabled
+func (s *Service) TerminationProtection(ctx context.Context, instanceID string) (bool, error) {
+	out, err := s.client.DescribeInstanceAttribute(ctx, &ec2.DescribeInstanceAttributeInput{
+		InstanceId: aws.String(instanceID),
+		Attribute:  types.InstanceAttributeNameDisableApiTermination,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to describe termination protection: %w", err)
+	}
+	return out.DisableApiTermination != nil && aws.ToBool(out.DisableApiTermination.Value), nil
+}
+
+// SetTerminationProtection enables or disables termination protection
+func (s *Service) SetTerminationProtection(ctx context.Context, instanceID string, enabled bool) error {
+	_, err := s.client.ModifyInstanceAttribute(ctx, &ec2.ModifyInstanceAttributeInput{
+		InstanceId:            aws.String(instanceID),
+		DisableApiTermination: &types.AttributeBooleanValue{Value: aws.Bool(enabled)},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set termination protection: %w", err)
+	}
+	return nil
+}
+
+// CheckDeletable returns an ErrProtected error when the instance is tagged
+// as protected or has termination protection enabled
+func (s *Service) CheckDeletable(ctx context.Context, instance types.Instance) error {
+	if IsProtected(instance) {
+		return fmt.Errorf("%w: tagged %s=true", ErrProtected, ProtectedTag)
+	}
+
+	protected, err := s.TerminationProtection(ctx, aws.ToString(instance.InstanceId))
+	if err != nil {
+		return err
+	}
+	if protected {
+		return fmt.Errorf("%w: termination protection is enabled", ErrProtected)
+	}
+	return nil
+}
+
+// FinalBackup creates a backup AMI of an instance about to be deleted and
+// waits for it to become available, so the instance can be terminated
+// without losing the image
+func (s *Service) FinalBackup(ctx context.Context, instanceID string) (string, error) {
+	amiID, err := s.BackupInstance(ctx, instanceID)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.UpdateAMITags(ctx, amiID, map[string]string{"BackupType": "final"}); err != nil {
+		return "", fmt.Errorf("failed to tag backup AMI: %w", err)
+	}
+
+	waiter := ec2.NewImageAvailableWaiter(s.client)
+	err = waiter.Wait(ctx, &ec2.DescribeImagesInput{
+		ImageIds: []string{amiID},
+	}, config.GetOperationTimeout(config.OpImageAvailable))
+	if err != nil {
+		return "", fmt.Errorf("error waiting for backup AMI %s: %w", amiID, err)
+	}
+	return amiID, nil
+}
+
+// TerminateInstances terminates instances with batched TerminateInstances
+// calls and waits for them to be terminated concurrently, like
+// StartInstances. Cancel their Spot requests with CancelSpotRequests first.
+func (s *Service) TerminateInstances(ctx context.Context, ids []string, progress func(Progress)) error {
+	return s.bulk(ctx, ids, bulkOp{
+		name:    "delete",
+		pending: "shutting-down",
+		done:    "terminated",
+		call: func(ctx context.Context, ids []string) error {
+			_, err := s.client.TerminateInstances(ctx, &ec2.TerminateInstancesInput{InstanceIds: ids})
+			return err
+		},
+		wait: func(ctx context.Context, id string) error {
+			return s.client.NewInstanceTerminatedWaiter().Wait(ctx, &ec2.DescribeInstancesInput{
+				InstanceIds: []string{id},
+			}, config.GetOperationTimeout(config.OpInstanceTerminated))
+		},
+	}, progress)
+}
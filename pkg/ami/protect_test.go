@@ -0,0 +1,95 @@
+package ami
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// protectEC2Client reports termination protection for the protected
+// instances and terminates all others
+type protectEC2Client struct {
+	bulkEC2Client
+	protected map[string]bool
+}
+
+func (c *protectEC2Client) DescribeInstanceAttribute(ctx context.Context, params *ec2.DescribeInstanceAttributeInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceAttributeOutput, error) {
+	return &ec2.DescribeInstanceAttributeOutput{
+		InstanceId:            params.InstanceId,
+		DisableApiTermination: &types.AttributeBooleanValue{Value: aws.Bool(c.protected[aws.ToString(params.InstanceId)])},
+	}, nil
+}
+
+func (c *protectEC2Client) TerminateInstances(ctx context.Context, params *ec2.TerminateInstancesInput, optFns ...func(*ec2.Options)) (*ec2.TerminateInstancesOutput, error) {
+	return &ec2.TerminateInstancesOutput{}, c.call(params.InstanceIds)
+}
+
+type terminatedWaiter struct{ stuck map[string]bool }
+
+func (w terminatedWaiter) Wait(ctx context.Context, params *ec2.DescribeInstancesInput, maxWaitDur time.Duration, optFns ...func(*ec2.InstanceTerminatedWaiterOptions)) error {
+	if w.stuck[params.InstanceIds[0]] {
+		return errors.New("exceeded max wait time")
+	}
+	return nil
+}
+
+func (c *protectEC2Client) NewInstanceTerminatedWaiter() interface {
+	Wait(ctx context.Context, params *ec2.DescribeInstancesInput, maxWaitDur time.Duration, optFns ...func(*ec2.InstanceTerminatedWaiterOptions)) error
+} {
+	return terminatedWaiter{stuck: c.stuck}
+}
+
+func TestCheckDeletable(t *testing.T) {
+	tagged := namedInstance("i-2", "db-1", types.InstanceStateNameRunning)
+	tagged.Tags = append(tagged.Tags, types.Tag{Key: aws.String(ProtectedTag), Value: aws.String("True")})
+
+	tests := []struct {
+		name     string
+		instance types.Instance
+		wantErr  string
+	}{
+		{name: "deletable", instance: namedInstance("i-1", "web-1", types.InstanceStateNameRunning)},
+		{name: "protected tag", instance: tagged, wantErr: "instance is protected: tagged Protected=true"},
+		{name: "termination protection", instance: namedInstance("i-3", "web-3", types.InstanceStateNameStopped), wantErr: "instance is protected: termination protection is enabled"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewService(&protectEC2Client{protected: map[string]bool{"i-3": true}})
+			err := service.CheckDeletable(context.Background(), tt.instance)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				assert.True(t, errors.Is(err, ErrProtected))
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestTerminateInstances(t *testing.T) {
+	client := &protectEC2Client{bulkEC2Client: bulkEC2Client{
+		refused: map[string]bool{"i-2": true},
+		stuck:   map[string]bool{"i-3": true},
+	}}
+	service := NewService(client)
+
+	done := map[string]bool{}
+	err := service.TerminateInstances(context.Background(), []string{"i-1", "i-2", "i-3"}, func(p Progress) {
+		if p.State == "terminated" {
+			done[p.InstanceID] = true
+		}
+	})
+
+	var bulkErr *BulkError
+	require.ErrorAs(t, err, &bulkErr)
+	assert.EqualError(t, err, "failed to delete 2 of 3 instances: i-2, i-3")
+	assert.Equal(t, map[string]bool{"i-1": true}, done)
+}
@@ -0,0 +1,214 @@
+package ami
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// CheckResize checks that instance can run as instanceType: the type must
+// support the architecture and virtualization type of the instance's AMI,
+// and ENA must be enabled on the instance when the type requires it. An AMI
+// that supports ENA is not enough, as the instance attribute decides. The
+// instance's own attributes are used when its AMI no longer exists.
+func (s *Service) CheckResize(ctx context.Context, instance types.Instance, instanceType string) error {
+	if string(instance.InstanceType) == instanceType {
+		return fmt.Errorf("instance %s is already %s", aws.ToString(instance.InstanceId), instanceType)
+	}
+
+	infos, err := s.ListInstanceTypes(ctx, &ec2.DescribeInstanceTypesInput{
+		InstanceTypes: []types.InstanceType{types.InstanceType(instanceType)},
+	})
+	if err != nil {
+		return err
+	}
+	var info *types.InstanceTypeInfo
+	for i := range infos {
+		if string(infos[i].InstanceType) == instanceType {
+			info = &infos[i]
+		}
+	}
+	if info == nil {
+		return fmt.Errorf("unknown instance type %s", instanceType)
+	}
+
+	arch := string(instance.Architecture)
+	virtualization := instance.VirtualizationType
+	source := "instance " + aws.ToString(instance.InstanceId)
+	if image, err := s.GetImage(ctx, aws.ToString(instance.ImageId)); err == nil {
+		arch = string(image.Architecture)
+		virtualization = image.VirtualizationType
+		source = "AMI " + aws.ToString(image.ImageId)
+	}
+
+	if arch != "" && !supportsArchitecture(*info, arch) {
+		return fmt.Errorf("instance type %s does not support the %s architecture of %s", instanceType, arch, source)
+	}
+	if virtualization != "" && !supportsVirtualization(*info, virtualization) {
+		return fmt.Errorf("instance type %s does not support the %s virtualization of %s", instanceType, virtualization, source)
+	}
+	if info.NetworkInfo != nil && info.NetworkInfo.EnaSupport == types.EnaSupportRequired && !aws.ToBool(instance.EnaSupport) {
+		return fmt.Errorf("instance type %s requires ENA, which is not enabled on instance %s", instanceType, aws.ToString(instance.InstanceId))
+	}
+	return nil
+}
+
+// supportsArchitecture reports whether info runs arch
+func supportsArchitecture(info types.InstanceTypeInfo, arch string) bool {
+	if info.ProcessorInfo == nil {
+		return false
+	}
+	for _, a := range info.ProcessorInfo.SupportedArchitectures {
+		if string(a) == arch {
+			return true
+		}
+	}
+	return false
+}
+
+// supportsVirtualization reports whether info runs virtualization
+func supportsVirtualization(info types.InstanceTypeInfo, virtualization types.VirtualizationType) bool {
+	for _, v := range info.SupportedVirtualizationTypes {
+		if v == virtualization {
+			return true
+		}
+	}
+	return false
+}
+
+// ResizeInstance changes the type of an instance after CheckResize. A
+// running instance is stopped, changed and started again; when it does not
+// start with the new type it is changed back and started with its original
+// type. A stopped instance is only changed. progress, which may be nil, is
+// called as the instance changes state.
+func (s *Service) ResizeInstance(ctx context.Context, instanceID, instanceType string, progress func(Progress)) error {
+	if progress == nil {
+		progress = func(Progress) {}
+	}
+	report := func(state string, err error) {
+		progress(Progress{InstanceID: instanceID, State: state, Err: err})
+	}
+
+	instance, err := s.GetInstance(ctx, instanceID)
+	if err != nil {
+		return err
+	}
+	if err := s.CheckResize(ctx, *instance, instanceType); err != nil {
+		return err
+	}
+	original := string(instance.InstanceType)
+	recorded := hasTag(*instance, LaunchTypeTag)
+
+	var state types.InstanceStateName
+	if instance.State != nil {
+		state = instance.State.Name
+	}
+	var restart bool
+	switch state {
+	case types.InstanceStateNameStopped:
+	case types.InstanceStateNamePending, types.InstanceStateNameRunning, types.InstanceStateNameStopping:
+		restart = true
+		report("stopping", nil)
+		if err := s.StopInstance(ctx, instanceID); err != nil {
+			report("failed", err)
+			return err
+		}
+		report("stopped", nil)
+	default:
+		return fmt.Errorf("cannot resize instance %s in state %s", instanceID, state)
+	}
+
+	if err := s.SetInstanceType(ctx, instanceID, instanceType); err != nil {
+		report("failed", err)
+		return s.abortResize(ctx, instanceID, "", restart, report, err)
+	}
+	if recorded {
+		if err := s.TagInstance(ctx, instanceID, map[string]string{LaunchTypeTag: instanceType}); err != nil {
+			report("failed", err)
+			return s.abortResize(ctx, instanceID, original, restart, report, err)
+		}
+	}
+	report("resized", nil)
+	if !restart {
+		return nil
+	}
+
+	report("starting", nil)
+	startErr := s.StartInstance(ctx, instanceID)
+	if startErr == nil {
+		report("running", nil)
+		return nil
+	}
+	report("failed", startErr)
+
+	// Roll back so the instance runs again as it did before
+	if err := s.rollbackResize(ctx, instanceID, original, recorded); err != nil {
+		report("failed", err)
+		return fmt.Errorf("failed to start instance %s as %s: %v; rollback to %s failed: %w", instanceID, instanceType, startErr, original, err)
+	}
+	report("rolled-back", nil)
+	return fmt.Errorf("failed to start instance %s as %s, rolled back to %s: %w", instanceID, instanceType, original, startErr)
+}
+
+// abortResize recovers from a failure to change the type of the stopped
+// instance: the type is changed back to original, when given because the
+// change was made, and an instance that was running is started again. The
+// launch record still holds the original type, so it is left alone.
+func (s *Service) abortResize(ctx context.Context, instanceID, original string, restart bool, report func(string, error), cause error) error {
+	if original != "" {
+		if err := s.SetInstanceType(ctx, instanceID, original); err != nil {
+			report("failed", err)
+			return fmt.Errorf("failed to resize instance %s: %v; restoring %s failed: %w", instanceID, cause, original, err)
+		}
+	}
+	if !restart {
+		return cause
+	}
+
+	report("starting", nil)
+	if err := s.StartInstance(ctx, instanceID); err != nil {
+		report("failed", err)
+		return fmt.Errorf("failed to resize instance %s: %v; restarting it failed: %w", instanceID, cause, err)
+	}
+	report("running", nil)
+	return cause
+}
+
+// rollbackResize changes a stopped instance back to its original type and
+// starts it
+func (s *Service) rollbackResize(ctx context.Context, instanceID, original string, recorded bool) error {
+	// A failed start can leave the instance stopping
+	if err := s.StopInstance(ctx, instanceID); err != nil {
+		return err
+	}
+	if err := s.setInstanceType(ctx, instanceID, original, recorded); err != nil {
+		return err
+	}
+	return s.StartInstance(ctx, instanceID)
+}
+
+// setInstanceType changes the type of a stopped instance. When the type is
+// recorded in the launch record the record is updated too, so the change is
+// not reported as drift.
+func (s *Service) setInstanceType(ctx context.Context, instanceID, instanceType string, recorded bool) error {
+	if err := s.SetInstanceType(ctx, instanceID, instanceType); err != nil {
+		return err
+	}
+	if !recorded {
+		return nil
+	}
+	return s.TagInstance(ctx, instanceID, map[string]string{LaunchTypeTag: instanceType})
+}
+
+// hasTag reports whether instance has a tag with key
+func hasTag(instance types.Instance, key string) bool {
+	for _, tag := range instance.Tags {
+		if aws.ToString(tag.Key) == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,306 @@
+package ami
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// resizeEC2Client serves one instance, its AMI and instance types, and
+// records the type changes and state changes made to the instance
+type resizeEC2Client struct {
+	EC2Client
+	instance types.Instance
+	image    *types.Image
+	types    []types.InstanceTypeInfo
+	// startErrs are returned by successive StartInstances calls, and
+	// modifyErrs by successive ModifyInstanceAttribute calls
+	startErrs  []error
+	modifyErrs []error
+	tagErr     error
+	calls      []string
+}
+
+func (c *resizeEC2Client) DescribeInstances(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	return &ec2.DescribeInstancesOutput{Reservations: []types.Reservation{{Instances: []types.Instance{c.instance}}}}, nil
+}
+
+func (c *resizeEC2Client) DescribeImages(ctx context.Context, params *ec2.DescribeImagesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeImagesOutput, error) {
+	if c.image == nil {
+		return &ec2.DescribeImagesOutput{}, nil
+	}
+	return &ec2.DescribeImagesOutput{Images: []types.Image{*c.image}}, nil
+}
+
+func (c *resizeEC2Client) DescribeInstanceTypes(ctx context.Context, params *ec2.DescribeInstanceTypesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceTypesOutput, error) {
+	var found []types.InstanceTypeInfo
+	for _, info := range c.types {
+		for _, name := range params.InstanceTypes {
+			if info.InstanceType == name {
+				found = append(found, info)
+			}
+		}
+	}
+	return &ec2.DescribeInstanceTypesOutput{InstanceTypes: found}, nil
+}
+
+func (c *resizeEC2Client) StopInstances(ctx context.Context, params *ec2.StopInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StopInstancesOutput, error) {
+	c.calls = append(c.calls, "stop")
+	return &ec2.StopInstancesOutput{}, nil
+}
+
+func (c *resizeEC2Client) StartInstances(ctx context.Context, params *ec2.StartInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StartInstancesOutput, error) {
+	c.calls = append(c.calls, "start")
+	if len(c.startErrs) > 0 {
+		err := c.startErrs[0]
+		c.startErrs = c.startErrs[1:]
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &ec2.StartInstancesOutput{}, nil
+}
+
+func (c *resizeEC2Client) ModifyInstanceAttribute(ctx context.Context, params *ec2.ModifyInstanceAttributeInput, optFns ...func(*ec2.Options)) (*ec2.ModifyInstanceAttributeOutput, error) {
+	c.calls = append(c.calls, "type="+aws.ToString(params.InstanceType.Value))
+	if len(c.modifyErrs) > 0 {
+		err := c.modifyErrs[0]
+		c.modifyErrs = c.modifyErrs[1:]
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &ec2.ModifyInstanceAttributeOutput{}, nil
+}
+
+func (c *resizeEC2Client) CreateTags(ctx context.Context, params *ec2.CreateTagsInput, optFns ...func(*ec2.Options)) (*ec2.CreateTagsOutput, error) {
+	for _, tag := range params.Tags {
+		c.calls = append(c.calls, "tag "+aws.ToString(tag.Key)+"="+aws.ToString(tag.Value))
+	}
+	if c.tagErr != nil {
+		return nil, c.tagErr
+	}
+	return &ec2.CreateTagsOutput{}, nil
+}
+
+func (c *resizeEC2Client) NewInstanceStoppedWaiter() interface {
+	Wait(ctx context.Context, params *ec2.DescribeInstancesInput, maxWaitDur time.Duration, optFns ...func(*ec2.InstanceStoppedWaiterOptions)) error
+} {
+	return noWait[*ec2.DescribeInstancesInput, *ec2.InstanceStoppedWaiterOptions]{}
+}
+
+func (c *resizeEC2Client) NewInstanceRunningWaiter() interface {
+	Wait(ctx context.Context, params *ec2.DescribeInstancesInput, maxWaitDur time.Duration, optFns ...func(*ec2.InstanceRunningWaiterOptions)) error
+} {
+	return noWait[*ec2.DescribeInstancesInput, *ec2.InstanceRunningWaiterOptions]{}
+}
+
+// resizeTypes are x86_64 HVM types; only m5.large requires ENA
+func resizeTypes() []types.InstanceTypeInfo {
+	info := func(name types.InstanceType, ena types.EnaSupport, archs ...types.ArchitectureType) types.InstanceTypeInfo {
+		return types.InstanceTypeInfo{
+			InstanceType:                 name,
+			ProcessorInfo:                &types.ProcessorInfo{SupportedArchitectures: archs},
+			SupportedVirtualizationTypes: []types.VirtualizationType{types.VirtualizationTypeHvm},
+			NetworkInfo:                  &types.NetworkInfo{EnaSupport: ena},
+		}
+	}
+	return []types.InstanceTypeInfo{
+		info(types.InstanceTypeT2Small, types.EnaSupportUnsupported, types.ArchitectureTypeI386, types.ArchitectureTypeX8664),
+		info(types.InstanceTypeM5Large, types.EnaSupportRequired, types.ArchitectureTypeX8664),
+		info(types.InstanceTypeM6gLarge, types.EnaSupportRequired, types.ArchitectureTypeArm64),
+	}
+}
+
+func resizeInstance(state types.InstanceStateName) types.Instance {
+	return types.Instance{
+		InstanceId:   aws.String("i-1"),
+		ImageId:      aws.String("ami-1"),
+		InstanceType: types.InstanceTypeT2Micro,
+		State:        &types.InstanceState{Name: state},
+		EnaSupport:   aws.Bool(true),
+	}
+}
+
+func TestCheckResize(t *testing.T) {
+	hvm := &types.Image{
+		ImageId:            aws.String("ami-1"),
+		Architecture:       types.ArchitectureValuesX8664,
+		VirtualizationType: types.VirtualizationTypeHvm,
+		EnaSupport:         aws.Bool(true),
+	}
+	noENA := *hvm
+	noENA.EnaSupport = aws.Bool(false)
+	paravirtual := *hvm
+	paravirtual.VirtualizationType = types.VirtualizationTypeParavirtual
+
+	deregistered := resizeInstance(types.InstanceStateNameRunning)
+	deregistered.Architecture = types.ArchitectureValuesArm64
+	instanceNoENA := resizeInstance(types.InstanceStateNameRunning)
+	instanceNoENA.EnaSupport = aws.Bool(false)
+
+	tests := []struct {
+		name     string
+		instance types.Instance
+		image    *types.Image
+		newType  string
+		wantErr  string
+	}{
+		{name: "compatible", image: hvm, newType: "m5.large"},
+		{name: "same type", image: hvm, newType: "t2.micro", wantErr: "instance i-1 is already t2.micro"},
+		{name: "unknown type", image: hvm, newType: "x9.huge", wantErr: "unknown instance type x9.huge"},
+		{name: "architecture", image: hvm, newType: "m6g.large", wantErr: "instance type m6g.large does not support the x86_64 architecture of AMI ami-1"},
+		{name: "virtualization", image: &paravirtual, newType: "m5.large", wantErr: "instance type m5.large does not support the paravirtual virtualization of AMI ami-1"},
+		{name: "ENA required", instance: instanceNoENA, image: hvm, newType: "m5.large", wantErr: "instance type m5.large requires ENA, which is not enabled on instance i-1"},
+		{name: "ENA enabled on the instance", image: &noENA, newType: "m5.large"},
+		{name: "ENA not required", instance: instanceNoENA, image: hvm, newType: "t2.small"},
+		{name: "AMI gone uses the instance", instance: deregistered, newType: "m5.large", wantErr: "instance type m5.large does not support the arm64 architecture of instance i-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := tt.instance
+			if instance.InstanceId == nil {
+				instance = resizeInstance(types.InstanceStateNameRunning)
+			}
+			service := NewService(&resizeEC2Client{image: tt.image, types: resizeTypes()})
+			err := service.CheckResize(context.Background(), instance, tt.newType)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestResizeInstance(t *testing.T) {
+	image := &types.Image{ImageId: aws.String("ami-1"), Architecture: types.ArchitectureValuesX8664, VirtualizationType: types.VirtualizationTypeHvm}
+	startErr := errors.New("InsufficientInstanceCapacity")
+
+	tests := []struct {
+		name       string
+		state      types.InstanceStateName
+		recorded   bool
+		startErrs  []error
+		modifyErrs []error
+		tagErr     error
+		calls      []string
+		states     []string
+		wantErr    string
+	}{
+		{
+			name:   "running",
+			state:  types.InstanceStateNameRunning,
+			calls:  []string{"stop", "type=t2.small", "start"},
+			states: []string{"stopping", "stopped", "resized", "starting", "running"},
+		},
+		{
+			name:   "stopped stays stopped",
+			state:  types.InstanceStateNameStopped,
+			calls:  []string{"type=t2.small"},
+			states: []string{"resized"},
+		},
+		{
+			name:      "start failure rolls back",
+			state:     types.InstanceStateNameRunning,
+			startErrs: []error{startErr},
+			calls:     []string{"stop", "type=t2.small", "start", "stop", "type=t2.micro", "start"},
+			states:    []string{"stopping", "stopped", "resized", "starting", "failed", "rolled-back"},
+			wantErr:   "failed to start instance i-1 as t2.small, rolled back to t2.micro: failed to start instance: InsufficientInstanceCapacity",
+		},
+		{
+			name:      "launch record follows the type",
+			state:     types.InstanceStateNameRunning,
+			recorded:  true,
+			startErrs: []error{startErr},
+			calls: []string{"stop", "type=t2.small", "tag ec-manager:launch-type=t2.small", "start",
+				"stop", "type=t2.micro", "tag ec-manager:launch-type=t2.micro", "start"},
+			states:  []string{"stopping", "stopped", "resized", "starting", "failed", "rolled-back"},
+			wantErr: "failed to start instance i-1 as t2.small, rolled back to t2.micro: failed to start instance: InsufficientInstanceCapacity",
+		},
+		{
+			name:      "failed rollback",
+			state:     types.InstanceStateNameRunning,
+			startErrs: []error{startErr, errors.New("IncorrectInstanceState")},
+			calls:     []string{"stop", "type=t2.small", "start", "stop", "type=t2.micro", "start"},
+			states:    []string{"stopping", "stopped", "resized", "starting", "failed", "failed"},
+			wantErr:   "failed to start instance i-1 as t2.small: failed to start instance: InsufficientInstanceCapacity; rollback to t2.micro failed: failed to start instance: IncorrectInstanceState",
+		},
+		{
+			name:       "type change failure restarts",
+			state:      types.InstanceStateNameRunning,
+			modifyErrs: []error{errors.New("InvalidParameterCombination")},
+			calls:      []string{"stop", "type=t2.small", "start"},
+			states:     []string{"stopping", "stopped", "failed", "starting", "running"},
+			wantErr:    "failed to set instance type: InvalidParameterCombination",
+		},
+		{
+			name:       "type change failure leaves stopped instance",
+			state:      types.InstanceStateNameStopped,
+			modifyErrs: []error{errors.New("InvalidParameterCombination")},
+			calls:      []string{"type=t2.small"},
+			states:     []string{"failed"},
+			wantErr:    "failed to set instance type: InvalidParameterCombination",
+		},
+		{
+			name:     "launch record failure restores the type",
+			state:    types.InstanceStateNameRunning,
+			recorded: true,
+			tagErr:   errors.New("UnauthorizedOperation"),
+			calls:    []string{"stop", "type=t2.small", "tag ec-manager:launch-type=t2.small", "type=t2.micro", "start"},
+			states:   []string{"stopping", "stopped", "failed", "starting", "running"},
+			wantErr:  "failed to tag instance: UnauthorizedOperation",
+		},
+		{
+			name:       "failed restore",
+			state:      types.InstanceStateNameRunning,
+			recorded:   true,
+			tagErr:     errors.New("UnauthorizedOperation"),
+			modifyErrs: []error{nil, errors.New("IncorrectInstanceState")},
+			calls:      []string{"stop", "type=t2.small", "tag ec-manager:launch-type=t2.small", "type=t2.micro"},
+			states:     []string{"stopping", "stopped", "failed", "failed"},
+			wantErr:    "failed to resize instance i-1: failed to tag instance: UnauthorizedOperation; restoring t2.micro failed: failed to set instance type: IncorrectInstanceState",
+		},
+		{
+			name:    "terminated",
+			state:   types.InstanceStateNameTerminated,
+			wantErr: "cannot resize instance i-1 in state terminated",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := resizeInstance(tt.state)
+			if tt.recorded {
+				instance.Tags = []types.Tag{{Key: aws.String(LaunchTypeTag), Value: aws.String("t2.micro")}}
+			}
+			client := &resizeEC2Client{
+				instance:   instance,
+				image:      image,
+				types:      resizeTypes(),
+				startErrs:  tt.startErrs,
+				modifyErrs: tt.modifyErrs,
+				tagErr:     tt.tagErr,
+			}
+			var states []string
+			err := NewService(client).ResizeInstance(context.Background(), "i-1", "t2.small", func(p Progress) {
+				states = append(states, p.State)
+			})
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tt.calls, client.calls)
+			assert.Equal(t, tt.states, states)
+		})
+	}
+}
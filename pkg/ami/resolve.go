@@ -0,0 +1,138 @@
+package ami
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+)
+
+// ErrAmbiguousInstance is returned when a reference matches several instances
+var ErrAmbiguousInstance = errors.New("ambiguous instance")
+
+// liveStates are the states of instances that can still be acted on. A
+// terminated instance keeps its tags for a while, but is never what a Name
+// tag or address refers to.
+var liveStates = []string{"pending", "running", "shutting-down", "stopping", "stopped"}
+
+// refKind is how an instance reference is looked up
+type refKind struct {
+	filter string
+	value  func(types.Instance) string
+}
+
+var (
+	refByID = refKind{filter: "instance-id", value: func(i types.Instance) string {
+		return aws.ToString(i.InstanceId)
+	}}
+	refByIP = refKind{filter: "private-ip-address", value: func(i types.Instance) string {
+		return aws.ToString(i.PrivateIpAddress)
+	}}
+	refByDNS = refKind{filter: "private-dns-name", value: func(i types.Instance) string {
+		return aws.ToString(i.PrivateDnsName)
+	}}
+	refByName = refKind{filter: "tag:Name", value: instanceName}
+)
+
+// instanceID matches the short and long forms of instance IDs
+var instanceID = regexp.MustCompile(`^i-([0-9a-f]{8}|[0-9a-f]{17})$`)
+
+// kindOf returns how ref is looked up: instance IDs are i- and 8 or 17 hex
+// digits, private DNS names are EC2 internal host names, and anything else is
+// a Name tag
+func kindOf(ref string) refKind {
+	switch {
+	case isInstanceID(ref):
+		return refByID
+	case net.ParseIP(ref) != nil:
+		return refByIP
+	case strings.HasPrefix(ref, "ip-") && strings.HasSuffix(ref, ".internal"):
+		return refByDNS
+	default:
+		return refByName
+	}
+}
+
+// isInstanceID reports whether ref is an instance ID rather than a Name tag
+// such as i-love-web
+func isInstanceID(ref string) bool {
+	return instanceID.MatchString(ref)
+}
+
+// ResolveInstance finds the one instance ref refers to. ref may be an
+// instance ID, a Name tag, a private IP address or a private DNS name. A
+// reference that matches no instance returns ErrInstanceNotFound, and one
+// that matches several, such as a Name tag shared by two instances, returns
+// ErrAmbiguousInstance listing them.
+func (s *Service) ResolveInstance(ctx context.Context, ref string) (*types.Instance, error) {
+	kind := kindOf(ref)
+	input := &ec2.DescribeInstancesInput{InstanceIds: []string{ref}}
+	if kind.filter != refByID.filter {
+		input = &ec2.DescribeInstancesInput{
+			Filters: []types.Filter{
+				{Name: aws.String(kind.filter), Values: []string{ref}},
+				{Name: aws.String("instance-state-name"), Values: liveStates},
+			},
+		}
+	}
+
+	var matches []types.Instance
+	err := s.EachInstance(ctx, input, func(instance types.Instance) error {
+		if kind.value(instance) == ref {
+			matches = append(matches, instance)
+		}
+		return nil
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, fmt.Errorf("%w: %s", ErrInstanceNotFound, ref)
+		}
+		return nil, err
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("%w: %s", ErrInstanceNotFound, ref)
+	case 1:
+		return &matches[0], nil
+	}
+
+	described := make([]string, len(matches))
+	for i, instance := range matches {
+		state := ""
+		if instance.State != nil {
+			state = string(instance.State.Name)
+		}
+		described[i] = fmt.Sprintf("%s (%s)", aws.ToString(instance.InstanceId), state)
+	}
+	return nil, fmt.Errorf("%w %q matches %d instances: %s; use an instance ID",
+		ErrAmbiguousInstance, ref, len(matches), strings.Join(described, ", "))
+}
+
+// ResolveInstanceID returns the ID of the instance ref refers to
+func (s *Service) ResolveInstanceID(ctx context.Context, ref string) (string, error) {
+	instance, err := s.ResolveInstance(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(instance.InstanceId), nil
+}
+
+// isNotFound reports whether err is EC2 rejecting unknown instance IDs
+func isNotFound(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "InvalidInstanceID.NotFound", "InvalidInstanceID.Malformed":
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,56 @@
+package ami
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveInstance(t *testing.T) {
+	web := namedInstance("i-0a1b2c3d", "web-1", types.InstanceStateNameRunning)
+	web.PrivateIpAddress = aws.String("10.0.1.5")
+	web.PrivateDnsName = aws.String("ip-10-0-1-5.ec2.internal")
+
+	instances := []types.Instance{
+		web,
+		namedInstance("i-2", "app", types.InstanceStateNameRunning),
+		namedInstance("i-3", "app", types.InstanceStateNameStopped),
+		namedInstance("i-4", "old", types.InstanceStateNameTerminated),
+		namedInstance("i-5", "i-love-web", types.InstanceStateNameRunning),
+	}
+
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr error
+		errMsg  string
+	}{
+		{ref: "i-0a1b2c3d", want: "i-0a1b2c3d"},
+		{ref: "web-1", want: "i-0a1b2c3d"},
+		{ref: "10.0.1.5", want: "i-0a1b2c3d"},
+		{ref: "ip-10-0-1-5.ec2.internal", want: "i-0a1b2c3d"},
+		{ref: "i-love-web", want: "i-5"},
+		{ref: "i-09999999999999999", wantErr: ErrInstanceNotFound, errMsg: "instance not found: i-09999999999999999"},
+		{ref: "old", wantErr: ErrInstanceNotFound, errMsg: "instance not found: old"},
+		{ref: "app", wantErr: ErrAmbiguousInstance, errMsg: `ambiguous instance "app" matches 2 instances: i-2 (running), i-3 (stopped); use an instance ID`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			service := NewService(&filteringEC2Client{instances: instances})
+			got, err := service.ResolveInstance(context.Background(), tt.ref)
+			if tt.wantErr != nil {
+				assert.True(t, errors.Is(err, tt.wantErr), "got %v", err)
+				assert.EqualError(t, err, tt.errMsg)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, aws.ToString(got.InstanceId))
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/taemon1337/ec-manager/pkg/config"
 )
 
 // RestoreInstance restores an instance from a snapshot
@@ -41,6 +42,15 @@ func (s *Service) RestoreInstance(ctx context.Context, instanceID, snapshotID st
 		return fmt.Errorf("failed to create volume: %w", err)
 	}
 
+	// Wait for the volume to become available before attaching it
+	waiter := s.client.NewVolumeAvailableWaiter()
+	err = waiter.Wait(ctx, &ec2.DescribeVolumesInput{
+		VolumeIds: []string{aws.ToString(volume.VolumeId)},
+	}, config.GetOperationTimeout(config.OpVolumeAvailable))
+	if err != nil {
+		return fmt.Errorf("error waiting for volume to become available: %w", err)
+	}
+
 	// Get device name from snapshot tags
 	var deviceName string
 	for _, tag := range snapshot.Tags {
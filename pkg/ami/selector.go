@@ -0,0 +1,160 @@
+package ami
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// filterAliases maps short selector keys to EC2 filter names. Any other key,
+// such as tag:Env or vpc-id, is passed to EC2 unchanged.
+var filterAliases = map[string]string{
+	"state":  "instance-state-name",
+	"type":   "instance-type",
+	"name":   "tag:Name",
+	"id":     "instance-id",
+	"ami":    "image-id",
+	"az":     "availability-zone",
+	"vpc":    "vpc-id",
+	"subnet": "subnet-id",
+	"ip":     "private-ip-address",
+	"key":    "key-name",
+}
+
+// Selector selects a set of instances. Refs name instances by ID, Name tag,
+// private IP address or private DNS name. Filters are key=value EC2 filters.
+// Names are Name tag patterns that may contain * and ? wildcards. An
+// instance is selected when it matches a ref, if any are given, and every
+// filter and name pattern.
+type Selector struct {
+	Refs    []string
+	Filters []string
+	Names   []string
+}
+
+// IsEmpty reports whether the selector selects every instance
+func (s Selector) IsEmpty() bool {
+	return len(s.Refs) == 0 && len(s.Filters) == 0 && len(s.Names) == 0
+}
+
+// ParseFilter parses a key=value filter. Values separated by commas match
+// any of them, and keys may be one of the short aliases such as state or
+// type.
+func ParseFilter(filter string) (types.Filter, error) {
+	key, value, ok := strings.Cut(filter, "=")
+	key = strings.TrimSpace(key)
+	if !ok || key == "" || value == "" {
+		return types.Filter{}, fmt.Errorf("invalid filter %q, expected key=value", filter)
+	}
+	if name, ok := filterAliases[key]; ok {
+		key = name
+	}
+
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	if len(values) == 0 {
+		return types.Filter{}, fmt.Errorf("invalid filter %q, expected key=value", filter)
+	}
+	return types.Filter{Name: aws.String(key), Values: values}, nil
+}
+
+// EC2Filters returns the selector's filters and name patterns as EC2 filters.
+// Repeating a key matches any of its values.
+func (s Selector) EC2Filters() ([]types.Filter, error) {
+	var order []string
+	byName := map[string][]string{}
+	add := func(f types.Filter) {
+		name := aws.ToString(f.Name)
+		if _, ok := byName[name]; !ok {
+			order = append(order, name)
+		}
+		byName[name] = append(byName[name], f.Values...)
+	}
+
+	for _, filter := range s.Filters {
+		f, err := ParseFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+		add(f)
+	}
+	if len(s.Names) > 0 {
+		add(types.Filter{Name: aws.String("tag:Name"), Values: s.Names})
+	}
+
+	filters := make([]types.Filter, len(order))
+	for i, name := range order {
+		filters[i] = types.Filter{Name: aws.String(name), Values: byName[name]}
+	}
+	return filters, nil
+}
+
+// EachSelected calls fn once for every instance the selector matches. Each
+// ref is resolved with ResolveInstance, so it must match exactly one
+// instance; filters and name patterns then narrow the referenced instances.
+func (s *Service) EachSelected(ctx context.Context, sel Selector, fn func(types.Instance) error) error {
+	filters, err := sel.EC2Filters()
+	if err != nil {
+		return err
+	}
+	if len(sel.Refs) == 0 {
+		return s.EachInstance(ctx, &ec2.DescribeInstancesInput{Filters: filters}, fn)
+	}
+
+	var ids []string
+	var instances []types.Instance
+	seen := map[string]bool{}
+	for _, ref := range sel.Refs {
+		instance, err := s.ResolveInstance(ctx, ref)
+		if err != nil {
+			return err
+		}
+		id := aws.ToString(instance.InstanceId)
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+			instances = append(instances, *instance)
+		}
+	}
+
+	if len(filters) > 0 {
+		return s.EachInstance(ctx, &ec2.DescribeInstancesInput{InstanceIds: ids, Filters: filters}, fn)
+	}
+	for _, instance := range instances {
+		if done, err := stopped(fn(instance)); done {
+			return err
+		}
+	}
+	return nil
+}
+
+// SelectInstances returns every instance the selector matches
+func (s *Service) SelectInstances(ctx context.Context, sel Selector) ([]types.Instance, error) {
+	var instances []types.Instance
+	err := s.EachSelected(ctx, sel, func(instance types.Instance) error {
+		instances = append(instances, instance)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return instances, nil
+}
+
+// instanceName returns the instance's Name tag
+func instanceName(instance types.Instance) string {
+	for _, tag := range instance.Tags {
+		if aws.ToString(tag.Key) == "Name" {
+			return aws.ToString(tag.Value)
+		}
+	}
+	return ""
+}
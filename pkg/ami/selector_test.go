@@ -0,0 +1,146 @@
+package ami
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// filteringEC2Client applies instance IDs and the tag:Name,
+// instance-state-name and private address filters to a fixed set of
+// instances
+type filteringEC2Client struct {
+	EC2Client
+	instances []types.Instance
+}
+
+func (c *filteringEC2Client) DescribeInstances(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	var matched []types.Instance
+	for _, instance := range c.instances {
+		ok := len(params.InstanceIds) == 0 || contains(params.InstanceIds, aws.ToString(instance.InstanceId))
+		for _, f := range params.Filters {
+			var value string
+			switch aws.ToString(f.Name) {
+			case "tag:Name":
+				value = instanceName(instance)
+			case "instance-state-name":
+				value = string(instance.State.Name)
+			case "private-ip-address":
+				value = aws.ToString(instance.PrivateIpAddress)
+			case "private-dns-name":
+				value = aws.ToString(instance.PrivateDnsName)
+			default:
+				continue
+			}
+			if !contains(f.Values, value) {
+				ok = false
+			}
+		}
+		if ok {
+			matched = append(matched, instance)
+		}
+	}
+	return &ec2.DescribeInstancesOutput{Reservations: []types.Reservation{{Instances: matched}}}, nil
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func namedInstance(id, name string, state types.InstanceStateName) types.Instance {
+	return types.Instance{
+		InstanceId: aws.String(id),
+		State:      &types.InstanceState{Name: state},
+		Tags:       []types.Tag{{Key: aws.String("Name"), Value: aws.String(name)}},
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		filter  string
+		want    types.Filter
+		wantErr bool
+	}{
+		{filter: "state=running", want: types.Filter{Name: aws.String("instance-state-name"), Values: []string{"running"}}},
+		{filter: "tag:Env=prod,staging", want: types.Filter{Name: aws.String("tag:Env"), Values: []string{"prod", "staging"}}},
+		{filter: "vpc-id=vpc-1", want: types.Filter{Name: aws.String("vpc-id"), Values: []string{"vpc-1"}}},
+		{filter: "state", wantErr: true},
+		{filter: "=running", wantErr: true},
+		{filter: "state=,", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			got, err := ParseFilter(tt.filter)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestEC2FiltersMergesRepeatedKeys(t *testing.T) {
+	filters, err := Selector{
+		Filters: []string{"state=running", "tag:Env=prod", "state=stopped"},
+		Names:   []string{"web-*"},
+	}.EC2Filters()
+	require.NoError(t, err)
+	assert.Equal(t, []types.Filter{
+		{Name: aws.String("instance-state-name"), Values: []string{"running", "stopped"}},
+		{Name: aws.String("tag:Env"), Values: []string{"prod"}},
+		{Name: aws.String("tag:Name"), Values: []string{"web-*"}},
+	}, filters)
+}
+
+func TestSelectInstances(t *testing.T) {
+	instances := []types.Instance{
+		namedInstance("i-00000001", "web-1", types.InstanceStateNameRunning),
+		namedInstance("i-00000002", "web-2", types.InstanceStateNameStopped),
+		namedInstance("i-00000003", "db-1", types.InstanceStateNameRunning),
+	}
+
+	tests := []struct {
+		name    string
+		sel     Selector
+		want    []string
+		wantErr string
+	}{
+		{name: "everything", sel: Selector{}, want: []string{"i-00000001", "i-00000002", "i-00000003"}},
+		{name: "filter", sel: Selector{Filters: []string{"state=running"}}, want: []string{"i-00000001", "i-00000003"}},
+		{name: "ids and names", sel: Selector{Refs: []string{"i-00000002", "db-1", "i-00000003"}}, want: []string{"i-00000002", "i-00000003"}},
+		{name: "refs and filter", sel: Selector{Refs: []string{"web-1"}, Filters: []string{"state=running"}}, want: []string{"i-00000001"}},
+		{name: "missing ref", sel: Selector{Refs: []string{"i-00000001", "mail", "i-00000009"}}, wantErr: "instance not found: mail"},
+		{name: "bad filter", sel: Selector{Filters: []string{"state"}}, wantErr: `invalid filter "state", expected key=value`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewService(&filteringEC2Client{instances: instances})
+			got, err := service.SelectInstances(context.Background(), tt.sel)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			var ids []string
+			for _, instance := range got {
+				ids = append(ids, aws.ToString(instance.InstanceId))
+			}
+			assert.Equal(t, tt.want, ids)
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package ami
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+)
+
+// PurchaseOptionTag records whether an instance was requested as Spot or
+// on-demand capacity, so migrate can request the same for its replacement
+const PurchaseOptionTag = "ec-manager:purchase-option"
+
+// Purchase options recorded in PurchaseOptionTag
+const (
+	PurchaseOnDemand = "on-demand"
+	PurchaseSpot     = "spot"
+)
+
+// Spot request types
+const (
+	SpotOneTime    = "one-time"
+	SpotPersistent = "persistent"
+)
+
+// SpotConfig requests Spot capacity for a new instance
+type SpotConfig struct {
+	// Type is one-time, the default, or persistent
+	Type string
+	// MaxPrice is the highest hourly price in USD, e.g. 0.05. Empty means
+	// the on-demand price.
+	MaxPrice string
+	// InterruptionBehavior is terminate, stop or hibernate. One-time
+	// requests can only terminate; persistent ones default to stop.
+	InterruptionBehavior string
+}
+
+// withDefaults fills in the type and interruption behavior
+func (c SpotConfig) withDefaults() SpotConfig {
+	if c.Type == "" {
+		c.Type = SpotOneTime
+	}
+	if c.InterruptionBehavior == "" {
+		c.InterruptionBehavior = string(types.InstanceInterruptionBehaviorTerminate)
+		if c.Type == SpotPersistent {
+			c.InterruptionBehavior = string(types.InstanceInterruptionBehaviorStop)
+		}
+	}
+	return c
+}
+
+// Validate checks the request is one EC2 accepts
+func (c SpotConfig) Validate() error {
+	c = c.withDefaults()
+	switch c.Type {
+	case SpotOneTime:
+		if c.InterruptionBehavior != string(types.InstanceInterruptionBehaviorTerminate) {
+			return fmt.Errorf("one-time Spot instances can only terminate when interrupted, use a persistent request to %s", c.InterruptionBehavior)
+		}
+	case SpotPersistent:
+		switch types.InstanceInterruptionBehavior(c.InterruptionBehavior) {
+		case types.InstanceInterruptionBehaviorStop, types.InstanceInterruptionBehaviorHibernate:
+		case types.InstanceInterruptionBehaviorTerminate:
+			return fmt.Errorf("persistent Spot instances must stop or hibernate when interrupted")
+		default:
+			return fmt.Errorf("invalid Spot interruption behavior %q, expected terminate, stop or hibernate", c.InterruptionBehavior)
+		}
+	default:
+		return fmt.Errorf("invalid Spot request type %q, expected one-time or persistent", c.Type)
+	}
+
+	if c.MaxPrice != "" {
+		price, err := strconv.ParseFloat(c.MaxPrice, 64)
+		if err != nil || price <= 0 {
+			return fmt.Errorf("invalid Spot max price %q, expected a positive hourly price in USD", c.MaxPrice)
+		}
+	}
+	return nil
+}
+
+// String formats the request as recorded in PurchaseOptionTag, e.g.
+// spot,type=persistent,interruption=stop,max-price=0.05
+func (c SpotConfig) String() string {
+	c = c.withDefaults()
+	s := fmt.Sprintf("%s,type=%s,interruption=%s", PurchaseSpot, c.Type, c.InterruptionBehavior)
+	if c.MaxPrice != "" {
+		s += ",max-price=" + c.MaxPrice
+	}
+	return s
+}
+
+// ParsePurchaseOption parses a PurchaseOptionTag value, returning nil for
+// on-demand
+func ParsePurchaseOption(s string) (*SpotConfig, error) {
+	fields := strings.Split(s, ",")
+	switch fields[0] {
+	case PurchaseOnDemand:
+		return nil, nil
+	case PurchaseSpot:
+	default:
+		return nil, fmt.Errorf("invalid purchase option %q, expected on-demand or spot", s)
+	}
+
+	c := &SpotConfig{}
+	for _, field := range fields[1:] {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "type":
+			c.Type = value
+		case "interruption":
+			c.InterruptionBehavior = value
+		case "max-price":
+			c.MaxPrice = value
+		default:
+			return nil, fmt.Errorf("invalid purchase option %q: unknown key %q", s, key)
+		}
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// purchaseOption returns the Spot request an instance was launched with,
+// from its PurchaseOptionTag or, without one, its lifecycle
+func purchaseOption(instance types.Instance) (*SpotConfig, error) {
+	for _, tag := range instance.Tags {
+		if aws.ToString(tag.Key) == PurchaseOptionTag {
+			return ParsePurchaseOption(aws.ToString(tag.Value))
+		}
+	}
+	if instance.InstanceLifecycle == types.InstanceLifecycleTypeSpot {
+		return &SpotConfig{}, nil
+	}
+	return nil, nil
+}
+
+// marketOptions returns the RunInstances market options for the request
+func (c SpotConfig) marketOptions() *types.InstanceMarketOptionsRequest {
+	c = c.withDefaults()
+	options := &types.SpotMarketOptions{
+		SpotInstanceType:             types.SpotInstanceType(c.Type),
+		InstanceInterruptionBehavior: types.InstanceInterruptionBehavior(c.InterruptionBehavior),
+	}
+	if c.MaxPrice != "" {
+		options.MaxPrice = aws.String(c.MaxPrice)
+	}
+	return &types.InstanceMarketOptionsRequest{
+		MarketType:  types.MarketTypeSpot,
+		SpotOptions: options,
+	}
+}
+
+// CancelSpotRequests cancels the Spot requests the instances were launched
+// by. A persistent request launches a replacement when its instance is
+// terminated, so it must be cancelled first; instances launched on-demand
+// are skipped.
+func (s *Service) CancelSpotRequests(ctx context.Context, instances []types.Instance) error {
+	var ids []string
+	for _, instance := range instances {
+		if id := aws.ToString(instance.SpotInstanceRequestId); id != "" {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	_, err := s.client.CancelSpotInstanceRequests(ctx, &ec2.CancelSpotInstanceRequestsInput{SpotInstanceRequestIds: ids})
+	if err != nil {
+		return fmt.Errorf("failed to cancel Spot requests: %w", err)
+	}
+	return nil
+}
+
+// capacityErrorCodes are the RunInstances errors returned when there is no
+// capacity for the request, as opposed to a request that is wrong.
+// SpotMaxPriceTooLow is left out: the user capped the price, and launching
+// on-demand instead would ignore the cap.
+var capacityErrorCodes = []string{
+	"InsufficientInstanceCapacity",
+	"InsufficientCapacity",
+	"InsufficientHostCapacity",
+	"MaxSpotInstanceCountExceeded",
+}
+
+// isCapacityError reports whether err means the capacity requested is not
+// available right now
+func isCapacityError(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	for _, code := range capacityErrorCodes {
+		if apiErr.ErrorCode() == code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,208 @@
+package ami
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// spotEC2Client has no Spot capacity when noSpot is set, failing Spot
+// requests with spotErrCode or InsufficientInstanceCapacity, and records the
+// instances launched and Spot requests cancelled
+type spotEC2Client struct {
+	EC2Client
+	noSpot      bool
+	spotErrCode string
+	source      types.Instance
+	launched    []*ec2.RunInstancesInput
+	cancelled   []string
+}
+
+func (c *spotEC2Client) RunInstances(ctx context.Context, params *ec2.RunInstancesInput, optFns ...func(*ec2.Options)) (*ec2.RunInstancesOutput, error) {
+	c.launched = append(c.launched, params)
+	if c.noSpot && params.InstanceMarketOptions != nil {
+		code := c.spotErrCode
+		if code == "" {
+			code = "InsufficientInstanceCapacity"
+		}
+		return nil, &smithy.GenericAPIError{Code: code, Message: "no Spot capacity"}
+	}
+	return &ec2.RunInstancesOutput{Instances: []types.Instance{{InstanceId: aws.String("i-new")}}}, nil
+}
+
+func (c *spotEC2Client) CancelSpotInstanceRequests(ctx context.Context, params *ec2.CancelSpotInstanceRequestsInput, optFns ...func(*ec2.Options)) (*ec2.CancelSpotInstanceRequestsOutput, error) {
+	c.cancelled = append(c.cancelled, params.SpotInstanceRequestIds...)
+	return &ec2.CancelSpotInstanceRequestsOutput{}, nil
+}
+
+func (c *spotEC2Client) DescribeInstances(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	return &ec2.DescribeInstancesOutput{Reservations: []types.Reservation{{Instances: []types.Instance{c.source}}}}, nil
+}
+
+func TestSpotConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  SpotConfig
+		wantErr string
+	}{
+		{name: "defaults", config: SpotConfig{}},
+		{name: "persistent stop", config: SpotConfig{Type: SpotPersistent, InterruptionBehavior: "stop", MaxPrice: "0.05"}},
+		{name: "persistent hibernate", config: SpotConfig{Type: SpotPersistent, InterruptionBehavior: "hibernate"}},
+		{name: "one-time stop", config: SpotConfig{InterruptionBehavior: "stop"}, wantErr: "can only terminate"},
+		{name: "persistent terminate", config: SpotConfig{Type: SpotPersistent, InterruptionBehavior: "terminate"}, wantErr: "must stop or hibernate"},
+		{name: "unknown type", config: SpotConfig{Type: "forever"}, wantErr: "invalid Spot request type"},
+		{name: "unknown behavior", config: SpotConfig{Type: SpotPersistent, InterruptionBehavior: "pause"}, wantErr: "invalid Spot interruption behavior"},
+		{name: "bad price", config: SpotConfig{MaxPrice: "cheap"}, wantErr: "invalid Spot max price"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestParsePurchaseOption(t *testing.T) {
+	spot := SpotConfig{Type: SpotPersistent, MaxPrice: "0.05", InterruptionBehavior: "hibernate"}
+	assert.Equal(t, "spot,type=persistent,interruption=hibernate,max-price=0.05", spot.String())
+
+	parsed, err := ParsePurchaseOption(spot.String())
+	require.NoError(t, err)
+	assert.Equal(t, &spot, parsed)
+
+	parsed, err = ParsePurchaseOption(PurchaseOnDemand)
+	require.NoError(t, err)
+	assert.Nil(t, parsed)
+
+	_, err = ParsePurchaseOption("reserved")
+	assert.Error(t, err)
+	_, err = ParsePurchaseOption("spot,bid=1")
+	assert.Error(t, err)
+}
+
+func TestRunInstanceSpot(t *testing.T) {
+	client := &spotEC2Client{}
+	service := NewService(client)
+
+	result, err := service.RunInstance(context.Background(), InstanceConfig{ImageID: "ami-1", Spot: &SpotConfig{MaxPrice: "0.02"}})
+	require.NoError(t, err)
+	assert.Equal(t, &LaunchResult{InstanceID: "i-new", Spot: true, Attempts: []LaunchAttempt{{Spot: true}}}, result)
+
+	require.Len(t, client.launched, 1)
+	options := client.launched[0].InstanceMarketOptions
+	require.NotNil(t, options)
+	assert.Equal(t, types.MarketTypeSpot, options.MarketType)
+	assert.Equal(t, types.SpotInstanceTypeOneTime, options.SpotOptions.SpotInstanceType)
+	assert.Equal(t, types.InstanceInterruptionBehaviorTerminate, options.SpotOptions.InstanceInterruptionBehavior)
+	assert.Equal(t, "0.02", aws.ToString(options.SpotOptions.MaxPrice))
+}
+
+func TestRunInstanceFallsBackToOnDemand(t *testing.T) {
+	client := &spotEC2Client{noSpot: true}
+	service := NewService(client)
+
+	result, err := service.RunInstance(context.Background(), InstanceConfig{ImageID: "ami-1", Spot: &SpotConfig{}})
+	require.NoError(t, err)
+	assert.Equal(t, "i-new", result.InstanceID)
+	assert.False(t, result.Spot)
+	require.Len(t, result.Attempts, 2)
+	assert.True(t, result.Attempts[0].Spot)
+	assert.Contains(t, result.Attempts[0].Error, "InsufficientInstanceCapacity")
+
+	require.Len(t, client.launched, 2)
+	assert.Nil(t, client.launched[1].InstanceMarketOptions)
+}
+
+func TestRunInstanceSpotMaxPriceTooLow(t *testing.T) {
+	client := &spotEC2Client{noSpot: true, spotErrCode: "SpotMaxPriceTooLow"}
+	service := NewService(client)
+
+	_, err := service.RunInstance(context.Background(), InstanceConfig{ImageID: "ami-1", Spot: &SpotConfig{MaxPrice: "0.001"}})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "SpotMaxPriceTooLow")
+	assert.Len(t, client.launched, 1)
+}
+
+func TestCancelSpotRequests(t *testing.T) {
+	client := &spotEC2Client{}
+	service := NewService(client)
+
+	instances := []types.Instance{
+		{InstanceId: aws.String("i-1"), SpotInstanceRequestId: aws.String("sir-1")},
+		{InstanceId: aws.String("i-2")},
+		{InstanceId: aws.String("i-3"), SpotInstanceRequestId: aws.String("sir-3")},
+	}
+	require.NoError(t, service.CancelSpotRequests(context.Background(), instances))
+	assert.Equal(t, []string{"sir-1", "sir-3"}, client.cancelled)
+
+	client.cancelled = nil
+	require.NoError(t, service.CancelSpotRequests(context.Background(), instances[1:2]))
+	assert.Empty(t, client.cancelled)
+}
+
+func TestMigrateInstancePurchaseOption(t *testing.T) {
+	persistent := &SpotConfig{Type: SpotPersistent}
+	source := types.Instance{
+		InstanceId:   aws.String("i-old"),
+		InstanceType: types.InstanceTypeT3Micro,
+		KeyName:      aws.String("ops"),
+		SubnetId:     aws.String("subnet-1"),
+	}
+
+	tests := []struct {
+		name       string
+		tags       []types.Tag
+		lifecycle  types.InstanceLifecycleType
+		opts       []MigrateOption
+		wantMarket *types.SpotMarketOptions
+	}{
+		{name: "on-demand"},
+		{
+			name:       "recorded spot",
+			tags:       []types.Tag{{Key: aws.String(PurchaseOptionTag), Value: aws.String(persistent.String())}},
+			wantMarket: &types.SpotMarketOptions{SpotInstanceType: types.SpotInstanceTypePersistent, InstanceInterruptionBehavior: types.InstanceInterruptionBehaviorStop},
+		},
+		{
+			name:       "spot lifecycle",
+			lifecycle:  types.InstanceLifecycleTypeSpot,
+			wantMarket: &types.SpotMarketOptions{SpotInstanceType: types.SpotInstanceTypeOneTime, InstanceInterruptionBehavior: types.InstanceInterruptionBehaviorTerminate},
+		},
+		{
+			name: "switched to on-demand",
+			tags: []types.Tag{{Key: aws.String(PurchaseOptionTag), Value: aws.String(persistent.String())}},
+			opts: []MigrateOption{WithPurchaseOption(nil)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			instance := source
+			instance.Tags = tt.tags
+			instance.InstanceLifecycle = tt.lifecycle
+			client := &spotEC2Client{source: instance}
+
+			_, err := NewService(client).MigrateInstance(context.Background(), "i-old", "ami-new", tt.opts...)
+			require.NoError(t, err)
+			require.Len(t, client.launched, 1)
+
+			options := client.launched[0].InstanceMarketOptions
+			if tt.wantMarket == nil {
+				assert.Nil(t, options)
+				return
+			}
+			require.NotNil(t, options)
+			assert.Equal(t, tt.wantMarket, options.SpotOptions)
+		})
+	}
+}
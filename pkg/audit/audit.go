@@ -0,0 +1,248 @@
+// Package audit records the mutating actions ec-manager performs, so changes
+// can be traced back to who made them and with which command
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/taemon1337/ec-manager/pkg/logger"
+)
+
+// EnvLogPath overrides the location of the audit log
+const EnvLogPath = "ECMAN_AUDIT_LOG"
+
+// Results of an audited action
+const (
+	ResultSuccess = "success"
+	ResultFailed  = "failed"
+)
+
+// Record is one mutating action
+type Record struct {
+	Time time.Time `json:"time"`
+	// Caller is the ARN of the identity that made the call
+	Caller string `json:"caller,omitempty"`
+	// Account and Region are where the call was made, so resource IDs can
+	// be told apart across accounts and regions
+	Account string `json:"account,omitempty"`
+	Region  string `json:"region,omitempty"`
+	// Command is the ec-manager command line, with secrets removed
+	Command   string                 `json:"command,omitempty"`
+	Action    string                 `json:"action"`
+	Resources []string               `json:"resources,omitempty"`
+	Params    map[string]interface{} `json:"params,omitempty"`
+	Result    string                 `json:"result"`
+	Error     string                 `json:"error,omitempty"`
+}
+
+// Sink stores audit records
+type Sink interface {
+	Write(r Record) error
+}
+
+// Logger writes records to its sinks, filling in the time, the caller, the
+// account and region, and the command line
+type Logger struct {
+	command string
+	sinks   []Sink
+	now     func() time.Time
+	account string
+	region  string
+
+	resolveCaller func(ctx context.Context) (string, error)
+	callerOnce    sync.Once
+	caller        string
+
+	// mu is shared with the loggers created by For
+	mu *sync.Mutex
+}
+
+// NewLogger creates a logger for one command. resolveCaller is called once,
+// on the first record, to find the caller's ARN.
+func NewLogger(command string, resolveCaller func(ctx context.Context) (string, error), sinks ...Sink) *Logger {
+	return &Logger{
+		command:       command,
+		sinks:         sinks,
+		now:           time.Now,
+		resolveCaller: resolveCaller,
+		mu:            &sync.Mutex{},
+	}
+}
+
+// For returns a logger writing to the same sinks for calls made in account
+// and region by the identity resolveCaller finds. An empty account is taken
+// from the caller's ARN.
+func (l *Logger) For(account, region string, resolveCaller func(ctx context.Context) (string, error)) *Logger {
+	return &Logger{
+		command:       l.command,
+		sinks:         l.sinks,
+		now:           l.now,
+		account:       account,
+		region:        region,
+		resolveCaller: resolveCaller,
+		mu:            l.mu,
+	}
+}
+
+// Log writes r to every sink. The action has already happened, so a sink
+// that fails is logged as a warning instead of failing the command.
+func (l *Logger) Log(ctx context.Context, r Record) {
+	l.callerOnce.Do(func() {
+		if l.resolveCaller == nil {
+			return
+		}
+		caller, err := l.resolveCaller(ctx)
+		if err != nil {
+			logger.Warn("failed to get caller identity for audit log", "error", err)
+			caller = "unknown"
+		}
+		l.caller = caller
+	})
+
+	r.Time = l.now().UTC()
+	r.Caller = l.caller
+	r.Account = l.account
+	if r.Account == "" {
+		r.Account = accountFromARN(l.caller)
+	}
+	r.Region = l.region
+	r.Command = l.command
+	if r.Result == "" {
+		r.Result = ResultSuccess
+		if r.Error != "" {
+			r.Result = ResultFailed
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, sink := range l.sinks {
+		if err := sink.Write(r); err != nil {
+			logger.Warn("failed to write audit record", "action", r.Action, "error", err)
+		}
+	}
+}
+
+// accountFromARN returns the account ID of an ARN, or "" when arn is not
+// one, e.g. arn:aws:sts::123456789012:assumed-role/admin/alice
+func accountFromARN(arn string) string {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) < 6 || parts[0] != "arn" {
+		return ""
+	}
+	return parts[4]
+}
+
+// DefaultPath returns the audit log location, honouring ECMAN_AUDIT_LOG and
+// XDG_STATE_HOME before ~/.local/state/ec-manager/audit.jsonl
+func DefaultPath() (string, error) {
+	if path := os.Getenv(EnvLogPath); path != "" {
+		return path, nil
+	}
+
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("unable to get home directory: %w", err)
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+
+	return filepath.Join(dir, "ec-manager", "audit.jsonl"), nil
+}
+
+// Filter selects audit records. Empty fields match every record.
+type Filter struct {
+	// Action matches the action with or without its service prefix, e.g.
+	// TerminateInstances or ec2:TerminateInstances
+	Action string
+	// Resource matches records that include the resource ID
+	Resource string
+	// Caller matches callers containing the text
+	Caller string
+	// Since matches records made at or after the time
+	Since time.Time
+	// Failed matches only failed actions
+	Failed bool
+}
+
+// Match reports whether r is selected by the filter
+func (f Filter) Match(r Record) bool {
+	if f.Action != "" && !strings.EqualFold(r.Action, f.Action) && !strings.EqualFold(actionName(r.Action), f.Action) {
+		return false
+	}
+	if f.Resource != "" && !contains(r.Resources, f.Resource) {
+		return false
+	}
+	if f.Caller != "" && !strings.Contains(r.Caller, f.Caller) {
+		return false
+	}
+	if !f.Since.IsZero() && r.Time.Before(f.Since) {
+		return false
+	}
+	if f.Failed && r.Result != ResultFailed {
+		return false
+	}
+	return true
+}
+
+// actionName returns the action without its service prefix
+func actionName(action string) string {
+	if i := strings.Index(action, ":"); i >= 0 {
+		return action[i+1:]
+	}
+	return action
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Read calls fn for each record in the audit log at path, oldest first. A
+// missing log has no records.
+func Read(path string, fn func(Record) error) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return fmt.Errorf("failed to parse audit log %s line %d: %w", path, line, err)
+		}
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoggerWritesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "audit.jsonl")
+	resolved := 0
+	log := NewLogger("ec-manager delete i-1 --yes", func(ctx context.Context) (string, error) {
+		resolved++
+		return "arn:aws:iam::123456789012:user/alice", nil
+	}, NewFileSink(path))
+	log.now = func() time.Time { return time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC) }
+
+	ctx := context.Background()
+	log.Log(ctx, Record{Action: "ec2:TerminateInstances", Resources: []string{"i-1"}})
+	log.Log(ctx, Record{Action: "ec2:CreateTags", Resources: []string{"i-2"}, Error: "UnauthorizedOperation"})
+
+	var records []Record
+	require.NoError(t, Read(path, func(r Record) error {
+		records = append(records, r)
+		return nil
+	}))
+
+	require.Len(t, records, 2)
+	assert.Equal(t, 1, resolved)
+	assert.Equal(t, Record{
+		Time:      time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC),
+		Caller:    "arn:aws:iam::123456789012:user/alice",
+		Account:   "123456789012",
+		Command:   "ec-manager delete i-1 --yes",
+		Action:    "ec2:TerminateInstances",
+		Resources: []string{"i-1"},
+		Result:    ResultSuccess,
+	}, records[0])
+	assert.Equal(t, ResultFailed, records[1].Result)
+	assert.Equal(t, "UnauthorizedOperation", records[1].Error)
+}
+
+func TestLoggerUnknownCaller(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	log := NewLogger("ec-manager stop web", func(ctx context.Context) (string, error) {
+		return "", errors.New("expired token")
+	}, NewFileSink(path))
+	log.Log(context.Background(), Record{Action: "ec2:StopInstances"})
+
+	var callers []string
+	require.NoError(t, Read(path, func(r Record) error {
+		callers = append(callers, r.Caller)
+		return nil
+	}))
+	assert.Equal(t, []string{"unknown"}, callers)
+}
+
+func TestLoggerFor(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	log := NewLogger("ec-manager stop --accounts prod,dev web", nil, NewFileSink(path))
+	prod := log.For("111111111111", "eu-west-1", func(ctx context.Context) (string, error) {
+		return "arn:aws:sts::111111111111:assumed-role/ec-manager/alice", nil
+	})
+	dev := log.For("", "us-east-1", func(ctx context.Context) (string, error) {
+		return "arn:aws:sts::222222222222:assumed-role/ec-manager/alice", nil
+	})
+
+	ctx := context.Background()
+	prod.Log(ctx, Record{Action: "ec2:StopInstances", Resources: []string{"i-1"}})
+	dev.Log(ctx, Record{Action: "ec2:StopInstances", Resources: []string{"i-2"}})
+
+	var records []Record
+	require.NoError(t, Read(path, func(r Record) error {
+		records = append(records, r)
+		return nil
+	}))
+
+	require.Len(t, records, 2)
+	assert.Equal(t, "arn:aws:sts::111111111111:assumed-role/ec-manager/alice", records[0].Caller)
+	assert.Equal(t, "111111111111", records[0].Account)
+	assert.Equal(t, "eu-west-1", records[0].Region)
+	assert.Equal(t, "arn:aws:sts::222222222222:assumed-role/ec-manager/alice", records[1].Caller)
+	assert.Equal(t, "222222222222", records[1].Account)
+	assert.Equal(t, "us-east-1", records[1].Region)
+	assert.Equal(t, "ec-manager stop --accounts prod,dev web", records[1].Command)
+}
+
+func TestReadMissingLog(t *testing.T) {
+	err := Read(filepath.Join(t.TempDir(), "missing.jsonl"), func(Record) error {
+		t.Fatal("no records expected")
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestFilterMatch(t *testing.T) {
+	r := Record{
+		Time:      time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC),
+		Caller:    "arn:aws:sts::123456789012:assumed-role/admin/alice",
+		Action:    "ec2:TerminateInstances",
+		Resources: []string{"i-1", "i-2"},
+		Result:    ResultSuccess,
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{name: "empty", filter: Filter{}, want: true},
+		{name: "action", filter: Filter{Action: "terminateinstances"}, want: true},
+		{name: "prefixed action", filter: Filter{Action: "ec2:TerminateInstances"}, want: true},
+		{name: "other action", filter: Filter{Action: "StopInstances"}, want: false},
+		{name: "resource", filter: Filter{Resource: "i-2"}, want: true},
+		{name: "other resource", filter: Filter{Resource: "i-3"}, want: false},
+		{name: "caller", filter: Filter{Caller: "alice"}, want: true},
+		{name: "since", filter: Filter{Since: r.Time.Add(-time.Hour)}, want: true},
+		{name: "too old", filter: Filter{Since: r.Time.Add(time.Hour)}, want: false},
+		{name: "failed", filter: Filter{Failed: true}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.filter.Match(r))
+		})
+	}
+}
+
+func TestHTTPSink(t *testing.T) {
+	var got Record
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		if got.Action == "ec2:Reject" {
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+
+	sink := NewHTTPSink(server.URL)
+	require.NoError(t, sink.Write(Record{Action: "ec2:StopInstances", Resources: []string{"i-1"}}))
+	assert.Equal(t, []string{"i-1"}, got.Resources)
+
+	assert.ErrorContains(t, sink.Write(Record{Action: "ec2:Reject"}), "403 Forbidden")
+}
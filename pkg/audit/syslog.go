@@ -0,0 +1,53 @@
+//go:build !windows && !plan9
+
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+	"net/url"
+)
+
+// SyslogSink sends each record as JSON to syslog
+type SyslogSink struct {
+	network string
+	addr    string
+	writer  *syslog.Writer
+}
+
+// NewSyslogSink creates a sink for address, which is "local" for the local
+// daemon or a URL such as udp://logs.example.com:514 or tcp://... It only
+// connects on the first record, so commands that change nothing never
+// depend on syslog being reachable.
+func NewSyslogSink(address string) (*SyslogSink, error) {
+	network, addr := "", ""
+	if address != "local" {
+		u, err := url.Parse(address)
+		if err != nil || u.Host == "" || (u.Scheme != "udp" && u.Scheme != "tcp") {
+			return nil, fmt.Errorf("invalid syslog address %q, expected local, udp://host:port or tcp://host:port", address)
+		}
+		network, addr = u.Scheme, u.Host
+	}
+	return &SyslogSink{network: network, addr: addr}, nil
+}
+
+// Write sends r, as an error message when the action failed
+func (s *SyslogSink) Write(r Record) error {
+	if s.writer == nil {
+		writer, err := syslog.Dial(s.network, s.addr, syslog.LOG_NOTICE|syslog.LOG_USER, "ec-manager")
+		if err != nil {
+			return fmt.Errorf("failed to connect to syslog: %w", err)
+		}
+		s.writer = writer
+	}
+
+	data, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit record: %w", err)
+	}
+	if r.Result == ResultFailed {
+		return s.writer.Err(string(data))
+	}
+	return s.writer.Notice(string(data))
+}
@@ -0,0 +1,20 @@
+//go:build !windows && !plan9
+
+package audit
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSyslogSink(t *testing.T) {
+	for _, address := range []string{"local", "udp://logs.example.com:514", "tcp://10.0.0.1:601"} {
+		_, err := NewSyslogSink(address)
+		assert.NoError(t, err, address)
+	}
+	for _, address := range []string{"logs.example.com", "http://logs.example.com", "udp://"} {
+		_, err := NewSyslogSink(address)
+		assert.Error(t, err, address)
+	}
+}
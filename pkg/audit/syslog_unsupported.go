@@ -0,0 +1,21 @@
+//go:build windows || plan9
+
+package audit
+
+import "errors"
+
+// errSyslogUnsupported is returned where Go has no syslog client
+var errSyslogUnsupported = errors.New("syslog is not supported on this platform")
+
+// SyslogSink is unavailable on this platform
+type SyslogSink struct{}
+
+// NewSyslogSink always fails, as there is no syslog on this platform
+func NewSyslogSink(address string) (*SyslogSink, error) {
+	return nil, errSyslogUnsupported
+}
+
+// Write always fails, as there is no syslog on this platform
+func (s *SyslogSink) Write(r Record) error {
+	return errSyslogUnsupported
+}
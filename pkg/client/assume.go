@@ -0,0 +1,131 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// SessionName is the role session name used for every role ec-manager
+// assumes, so its actions are easy to find in CloudTrail
+const SessionName = "ec-manager"
+
+// Role is one step of a role chain
+type Role struct {
+	ARN string
+	// ExternalID is required by some cross-account trust policies
+	ExternalID string
+	// MFASerial and TokenCode provide MFA for roles that require it
+	MFASerial string
+	TokenCode func() (string, error)
+}
+
+// WithRoleChain assumes each role in turn on top of the profile's
+// credentials, so every call is made as the last role of the chain
+func WithRoleChain(roles ...Role) Option {
+	return func(c *Client) {
+		c.roles = roles
+	}
+}
+
+// WithMFASession gets one MFA-authenticated session for the profile's
+// credentials before any role is assumed, so roles in several accounts can
+// be assumed with a single MFA code. A nil tokenCode prompts on stdin.
+func WithMFASession(serial string, tokenCode func() (string, error)) Option {
+	return func(c *Client) {
+		c.mfaSerial = serial
+		c.mfaTokenCode = tokenCode
+	}
+}
+
+// mfaSession returns a copy of cfg whose credentials are a session token
+// obtained with the MFA device, cached until it expires
+func mfaSession(cfg aws.Config, serial string, tokenCode func() (string, error)) aws.Config {
+	if tokenCode == nil {
+		tokenCode = stscreds.StdinTokenProvider
+	}
+	stsClient := sts.NewFromConfig(cfg)
+	provider := aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+		code, err := tokenCode()
+		if err != nil {
+			return aws.Credentials{}, fmt.Errorf("failed to read MFA code: %w", err)
+		}
+		out, err := stsClient.GetSessionToken(ctx, &sts.GetSessionTokenInput{
+			SerialNumber: aws.String(serial),
+			TokenCode:    aws.String(code),
+		})
+		if err != nil {
+			return aws.Credentials{}, fmt.Errorf("failed to get MFA session: %w", err)
+		}
+		if out.Credentials == nil {
+			return aws.Credentials{}, fmt.Errorf("no credentials returned for MFA session")
+		}
+		return aws.Credentials{
+			AccessKeyID:     aws.ToString(out.Credentials.AccessKeyId),
+			SecretAccessKey: aws.ToString(out.Credentials.SecretAccessKey),
+			SessionToken:    aws.ToString(out.Credentials.SessionToken),
+			Source:          "MFASession",
+			CanExpire:       true,
+			Expires:         aws.ToTime(out.Credentials.Expiration),
+		}, nil
+	})
+
+	cfg = cfg.Copy()
+	cfg.Credentials = aws.NewCredentialsCache(provider)
+	return cfg
+}
+
+// assumeRoles returns a copy of cfg whose credentials come from assuming
+// each role in turn. Credentials are cached and refreshed before they
+// expire, so an MFA code is only asked for once per session.
+func assumeRoles(cfg aws.Config, roles []Role) aws.Config {
+	for _, role := range roles {
+		role := role
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), role.ARN, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = SessionName
+			if role.ExternalID != "" {
+				o.ExternalID = aws.String(role.ExternalID)
+			}
+			if role.MFASerial != "" {
+				o.SerialNumber = aws.String(role.MFASerial)
+				o.TokenProvider = role.TokenCode
+				if o.TokenProvider == nil {
+					o.TokenProvider = stscreds.StdinTokenProvider
+				}
+			}
+		})
+
+		cfg = cfg.Copy()
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+	return cfg
+}
+
+// ForAccount returns a client for another account, reached by assuming
+// roles on top of this client's credentials. An empty region keeps the
+// client's region. In mock mode the mock EC2 client is shared.
+func (c *Client) ForAccount(region string, roles ...Role) *Client {
+	account := *c
+	if region != "" {
+		account.region = region
+	}
+	if c.mockMode {
+		return &account
+	}
+
+	account.cfg = assumeRoles(c.cfg, roles)
+	account.cfg.Region = account.region
+	account.realEC2 = ec2.NewFromConfig(account.cfg)
+	return &account
+}
+
+// ForRegion returns a client for another region with this client's
+// credentials and retryer, so no role is assumed again and the regions share
+// one retry budget
+func (c *Client) ForRegion(region string) *Client {
+	return c.ForAccount(region)
+}
@@ -0,0 +1,189 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stsStandIn answers AssumeRole with credentials named after the role, and
+// GetSessionToken with AKID-session, and records which access key signed
+// each request
+type stsStandIn struct {
+	mu       sync.Mutex
+	requests []url.Values
+	signers  []string
+}
+
+func (s *stsStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Credential=AKID/date/region/sts/aws4_request
+	auth := r.Header.Get("Authorization")
+	signer := strings.SplitN(strings.SplitN(auth, "Credential=", 2)[1], "/", 2)[0]
+
+	s.mu.Lock()
+	s.requests = append(s.requests, r.PostForm)
+	s.signers = append(s.signers, signer)
+	s.mu.Unlock()
+
+	if r.PostForm.Get("Action") == "GetSessionToken" {
+		fmt.Fprintf(w, `<GetSessionTokenResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <GetSessionTokenResult>
+    <Credentials>
+      <AccessKeyId>AKID-session</AccessKeyId>
+      <SecretAccessKey>secret</SecretAccessKey>
+      <SessionToken>token</SessionToken>
+      <Expiration>%s</Expiration>
+    </Credentials>
+  </GetSessionTokenResult>
+</GetSessionTokenResponse>`, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+		return
+	}
+
+	role := r.PostForm.Get("RoleArn")
+	key := "AKID-" + role[strings.LastIndex(role, "/")+1:]
+	fmt.Fprintf(w, `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleResult>
+    <Credentials>
+      <AccessKeyId>%s</AccessKeyId>
+      <SecretAccessKey>secret</SecretAccessKey>
+      <SessionToken>token</SessionToken>
+      <Expiration>%s</Expiration>
+    </Credentials>
+    <AssumedRoleUser>
+      <Arn>%s</Arn>
+      <AssumedRoleId>AROA:ec-manager</AssumedRoleId>
+    </AssumedRoleUser>
+  </AssumeRoleResult>
+</AssumeRoleResponse>`, key, time.Now().Add(time.Hour).UTC().Format(time.RFC3339), role)
+}
+
+func TestAssumeRoles(t *testing.T) {
+	standIn := &stsStandIn{}
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+
+	base := aws.Config{
+		Region:       "us-east-1",
+		Credentials:  credentials.NewStaticCredentialsProvider("AKID-user", "secret", ""),
+		BaseEndpoint: aws.String(server.URL),
+	}
+
+	cfg := assumeRoles(base, []Role{
+		{
+			ARN:       "arn:aws:iam::111111111111:role/hub",
+			MFASerial: "arn:aws:iam::111111111111:mfa/user",
+			TokenCode: func() (string, error) { return "123456", nil },
+		},
+		{
+			ARN:        "arn:aws:iam::222222222222:role/target",
+			ExternalID: "ext-1",
+		},
+	})
+
+	creds, err := cfg.Credentials.Retrieve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "AKID-target", creds.AccessKeyID)
+
+	require.Len(t, standIn.requests, 2)
+
+	hub := standIn.requests[0]
+	assert.Equal(t, "arn:aws:iam::111111111111:role/hub", hub.Get("RoleArn"))
+	assert.Equal(t, SessionName, hub.Get("RoleSessionName"))
+	assert.Equal(t, "arn:aws:iam::111111111111:mfa/user", hub.Get("SerialNumber"))
+	assert.Equal(t, "123456", hub.Get("TokenCode"))
+	assert.Empty(t, hub.Get("ExternalId"))
+	assert.Equal(t, "AKID-user", standIn.signers[0])
+
+	target := standIn.requests[1]
+	assert.Equal(t, "arn:aws:iam::222222222222:role/target", target.Get("RoleArn"))
+	assert.Equal(t, "ext-1", target.Get("ExternalId"))
+	assert.Empty(t, target.Get("SerialNumber"))
+	assert.Equal(t, "AKID-hub", standIn.signers[1], "second role must be assumed with the first role's credentials")
+
+	// Credentials are cached, so the chain is not assumed again
+	_, err = cfg.Credentials.Retrieve(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, standIn.requests, 2)
+
+	// The base config is left untouched
+	baseCreds, err := base.Credentials.Retrieve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "AKID-user", baseCreds.AccessKeyID)
+}
+
+func TestMFASession(t *testing.T) {
+	standIn := &stsStandIn{}
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+
+	base := aws.Config{
+		Region:       "us-east-1",
+		Credentials:  credentials.NewStaticCredentialsProvider("AKID-user", "secret", ""),
+		BaseEndpoint: aws.String(server.URL),
+	}
+
+	codes := 0
+	hub := mfaSession(base, "arn:aws:iam::111111111111:mfa/user", func() (string, error) {
+		codes++
+		return "123456", nil
+	})
+
+	// Roles in two accounts are assumed from the one MFA session
+	for _, arn := range []string{"arn:aws:iam::222222222222:role/dev", "arn:aws:iam::333333333333:role/prod"} {
+		cfg := assumeRoles(hub, []Role{{ARN: arn}})
+		_, err := cfg.Credentials.Retrieve(context.Background())
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, 1, codes, "the MFA code must be used once")
+	require.Len(t, standIn.requests, 3)
+	session := standIn.requests[0]
+	assert.Equal(t, "GetSessionToken", session.Get("Action"))
+	assert.Equal(t, "arn:aws:iam::111111111111:mfa/user", session.Get("SerialNumber"))
+	assert.Equal(t, "123456", session.Get("TokenCode"))
+	assert.Equal(t, "AKID-user", standIn.signers[0])
+	for i := 1; i < 3; i++ {
+		assert.Empty(t, standIn.requests[i].Get("SerialNumber"))
+		assert.Equal(t, "AKID-session", standIn.signers[i])
+	}
+}
+
+func TestForAccount(t *testing.T) {
+	c, err := NewClient(true, "", "us-east-1")
+	require.NoError(t, err)
+
+	account := c.ForAccount("eu-west-1", Role{ARN: "arn:aws:iam::222222222222:role/target"})
+	assert.True(t, account.IsMock())
+	assert.Equal(t, "eu-west-1", account.region)
+	assert.Equal(t, "us-east-1", c.region)
+	assert.Same(t, c.GetEC2Client(), account.GetEC2Client())
+
+	assert.Equal(t, "us-east-1", c.ForAccount("").region)
+}
+
+func TestForRegion(t *testing.T) {
+	creds := aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider("AKID", "secret", ""))
+	c := &Client{region: "us-east-1", cfg: aws.Config{Region: "us-east-1", Credentials: creds}}
+
+	regional := c.ForRegion("eu-west-1")
+	assert.Equal(t, "eu-west-1", regional.region)
+	assert.Equal(t, "eu-west-1", regional.AWSConfig().Region)
+	assert.Same(t, creds, regional.AWSConfig().Credentials, "the assumed credentials must be reused")
+	assert.Equal(t, "us-east-1", c.AWSConfig().Region)
+}
@@ -3,10 +3,12 @@ package client
 import (
 	"context"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
@@ -20,9 +22,38 @@ type Client struct {
 	cfg      aws.Config
 	mockMode bool
 	mockEC2  *mock.MockEC2Client
+	mockCW   *mock.MockCloudWatchClient
 	realEC2  *ec2.Client
 	profile  string
 	region   string
+	pageSize int32
+	ctx      context.Context
+	roles    []Role
+
+	// mfaSerial and mfaTokenCode set up an MFA session under the roles
+	mfaSerial    string
+	mfaTokenCode func() (string, error)
+
+	retryPolicy RetryPolicy
+	retryer     *retryCounter
+}
+
+// Option configures optional Client behaviour
+type Option func(*Client)
+
+// WithContext sets the context used while loading and verifying AWS
+// credentials, so that a cancelled command does not hang on start-up
+func WithContext(ctx context.Context) Option {
+	return func(c *Client) {
+		c.ctx = ctx
+	}
+}
+
+// WithPageSize sets the page size requested from paginated EC2 APIs
+func WithPageSize(size int32) Option {
+	return func(c *Client) {
+		c.pageSize = size
+	}
 }
 
 // NewDefaultConfig returns a default configuration
@@ -31,18 +62,30 @@ func NewDefaultConfig() (bool, string, string) {
 }
 
 // NewClient creates a new AWS client
-func NewClient(mockMode bool, profile, region string) (*Client, error) {
+func NewClient(mockMode bool, profile, region string, opts ...Option) (*Client, error) {
 	client := &Client{
-		mockMode: mockMode,
-		profile:  profile,
-		region:   region,
+		mockMode:    mockMode,
+		profile:     profile,
+		region:      region,
+		retryPolicy: DefaultRetryPolicy(),
+		ctx:         context.Background(),
+	}
+	for _, opt := range opts {
+		opt(client)
 	}
 
+	if err := client.retryPolicy.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid retry policy: %w", err)
+	}
+	client.retryer = newRetryCounter(client.retryPolicy)
+
 	if mockMode {
 		// Create mock EC2 client
 		mockEC2 := mock.NewMockEC2ClientWithoutT()
 		mock.SetupDefaultMockResponses(mockEC2)
 		client.mockEC2 = mockEC2
+		client.mockCW = mock.NewMockCloudWatchClientWithoutT()
+		mock.SetupDefaultCloudWatchResponses(client.mockCW)
 		return client, nil
 	}
 
@@ -64,22 +107,31 @@ func (c *Client) loadAWSConfig() (aws.Config, error) {
 	var cfg aws.Config
 	var err error
 
+	// Every service client built from this config shares one retryer, and
+	// with it one retry token bucket and adaptive send rate
 	opts := []func(*config.LoadOptions) error{
 		config.WithRegion(c.region),
+		config.WithRetryer(func() aws.Retryer {
+			return c.retryer
+		}),
 	}
 
 	if c.profile != "" {
 		opts = append(opts, config.WithSharedConfigProfile(c.profile))
 	}
 
-	cfg, err = config.LoadDefaultConfig(context.Background(), opts...)
+	cfg, err = config.LoadDefaultConfig(c.ctx, opts...)
 	if err != nil {
 		return cfg, fmt.Errorf("failed to load AWS config: %w", err)
 	}
+	if c.mfaSerial != "" {
+		cfg = mfaSession(cfg, c.mfaSerial, c.mfaTokenCode)
+	}
+	cfg = assumeRoles(cfg, c.roles)
 
 	// Verify credentials
 	stsClient := sts.NewFromConfig(cfg)
-	_, err = stsClient.GetCallerIdentity(context.Background(), &sts.GetCallerIdentityInput{})
+	_, err = stsClient.GetCallerIdentity(c.ctx, &sts.GetCallerIdentityInput{})
 	if err != nil {
 		return cfg, fmt.Errorf("failed to verify AWS credentials: %w", err)
 	}
@@ -87,6 +139,23 @@ func (c *Client) loadAWSConfig() (aws.Config, error) {
 	return cfg, nil
 }
 
+// AWSConfig returns the loaded AWS configuration. It is the zero value in
+// mock mode.
+func (c *Client) AWSConfig() aws.Config {
+	return c.cfg
+}
+
+// IsMock reports whether the client is running in mock mode
+func (c *Client) IsMock() bool {
+	return c.mockMode
+}
+
+// RetryStats returns the number of retries made so far by all service
+// clients sharing this client's configuration
+func (c *Client) RetryStats() RetryStats {
+	return c.retryer.stats()
+}
+
 // GetEC2Client returns the EC2 client (either mock or real)
 func (c *Client) GetEC2Client() ecTypes.EC2Client {
 	if c.mockMode {
@@ -95,33 +164,33 @@ func (c *Client) GetEC2Client() ecTypes.EC2Client {
 	return &EC2ClientWrapper{c.realEC2}
 }
 
-// GetAMIService returns a new AMI service instance
-func (c *Client) GetAMIService() *ami.Service {
-	return ami.NewService(c.GetEC2Client())
-}
-
-// ListImages lists AMIs based on the provided filters
-func (c *Client) ListImages(filters []types.Filter) ([]types.Image, error) {
+// GetCloudWatchClient returns the CloudWatch client (either mock or real)
+func (c *Client) GetCloudWatchClient() ecTypes.CloudWatchClient {
 	if c.mockMode {
-		output, err := c.mockEC2.DescribeImages(context.Background(), &ec2.DescribeImagesInput{
-			Filters: filters,
-		})
-		if err != nil {
-			return nil, err
-		}
-		return output.Images, nil
-	}
-
-	input := &ec2.DescribeImagesInput{
-		Filters: filters,
+		return c.mockCW
 	}
+	return cloudwatch.NewFromConfig(c.cfg)
+}
 
-	output, err := c.realEC2.DescribeImages(context.Background(), input)
+// ListImages lists AMIs based on the provided filters
+func (c *Client) ListImages(ctx context.Context, filters []types.Filter) ([]types.Image, error) {
+	var images []types.Image
+	err := c.EachImage(ctx, filters, func(image types.Image) error {
+		images = append(images, image)
+		return nil
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to list images: %w", err)
 	}
+	return images, nil
+}
 
-	return output.Images, nil
+// EachImage calls fn for every AMI matching the filters, reading one page at
+// a time so large accounts are not held in memory
+func (c *Client) EachImage(ctx context.Context, filters []types.Filter, fn func(types.Image) error) error {
+	return ami.NewService(c.GetEC2Client(), ami.WithPageSize(c.pageSize)).EachImage(ctx, &ec2.DescribeImagesInput{
+		Filters: filters,
+	}, fn)
 }
 
 // EC2Client is an interface for AWS EC2 client
@@ -132,6 +201,7 @@ type EC2Client interface {
 	CreateTags(ctx context.Context, params *ec2.CreateTagsInput, optFns ...func(*ec2.Options)) (*ec2.CreateTagsOutput, error)
 	RunInstances(ctx context.Context, params *ec2.RunInstancesInput, optFns ...func(*ec2.Options)) (*ec2.RunInstancesOutput, error)
 	TerminateInstances(ctx context.Context, params *ec2.TerminateInstancesInput, optFns ...func(*ec2.Options)) (*ec2.TerminateInstancesOutput, error)
+	CancelSpotInstanceRequests(ctx context.Context, params *ec2.CancelSpotInstanceRequestsInput, optFns ...func(*ec2.Options)) (*ec2.CancelSpotInstanceRequestsOutput, error)
 	AttachVolume(ctx context.Context, params *ec2.AttachVolumeInput, optFns ...func(*ec2.Options)) (*ec2.AttachVolumeOutput, error)
 	CreateSnapshot(ctx context.Context, params *ec2.CreateSnapshotInput, optFns ...func(*ec2.Options)) (*ec2.CreateSnapshotOutput, error)
 	CreateVolume(ctx context.Context, params *ec2.CreateVolumeInput, optFns ...func(*ec2.Options)) (*ec2.CreateVolumeOutput, error)
@@ -187,3 +257,30 @@ func (c *EC2ClientWrapper) NewVolumeAvailableWaiter() interface {
 } {
 	return ec2.NewVolumeAvailableWaiter(c.Client)
 }
+
+// mockRegions are the regions reported in mock mode
+var mockRegions = []string{"us-east-1", "us-west-2"}
+
+// Regions returns the regions enabled for the account, sorted by name
+func (c *Client) Regions(ctx context.Context) ([]string, error) {
+	if c.mockMode {
+		return append([]string(nil), mockRegions...), nil
+	}
+
+	out, err := c.realEC2.DescribeRegions(ctx, &ec2.DescribeRegionsInput{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe regions: %w", err)
+	}
+
+	regions := make([]string, 0, len(out.Regions))
+	for _, r := range out.Regions {
+		regions = append(regions, aws.ToString(r.RegionName))
+	}
+	sort.Strings(regions)
+	return regions, nil
+}
+
+// Region returns the client's region
+func (c *Client) Region() string {
+	return c.region
+}
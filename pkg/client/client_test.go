@@ -1,8 +1,15 @@
 package client
 
 import (
+	"context"
+	"errors"
 	"testing"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/smithy-go"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -46,14 +53,31 @@ func TestGetEC2Client(t *testing.T) {
 	})
 }
 
-func TestGetAMIService(t *testing.T) {
+func TestGetCloudWatchClient(t *testing.T) {
+	client, err := NewClient(true, "", "us-east-1")
+	assert.NoError(t, err)
+
+	// The mock serves the fixture metrics of the running test instance only
+	cw := client.GetCloudWatchClient()
+	for instanceID, want := range map[string]int{"i-123": 14 * 24, "i-456": 0} {
+		out, err := cw.GetMetricStatistics(context.Background(), &cloudwatch.GetMetricStatisticsInput{
+			MetricName: aws.String("CPUUtilization"),
+			Dimensions: []cwtypes.Dimension{{Name: aws.String("InstanceId"), Value: aws.String(instanceID)}},
+		})
+		assert.NoError(t, err)
+		assert.Len(t, out.Datapoints, want, instanceID)
+	}
+}
+
+func TestListImages(t *testing.T) {
 	t.Run("with mock mode", func(t *testing.T) {
 		client, err := NewClient(true, "", "us-east-1")
 		assert.NoError(t, err)
 		assert.NotNil(t, client)
 
-		amiService := client.GetAMIService()
-		assert.NotNil(t, amiService)
+		images, err := client.ListImages(context.Background(), nil)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, images)
 	})
 
 	// Skip tests that require AWS credentials
@@ -61,3 +85,43 @@ func TestGetAMIService(t *testing.T) {
 		t.Skip("Skipping test that requires AWS credentials")
 	})
 }
+
+func TestNewClientRetryPolicy(t *testing.T) {
+	t.Run("rejects invalid mode", func(t *testing.T) {
+		policy := DefaultRetryPolicy()
+		policy.Mode = "aggressive"
+		_, err := NewClient(true, "", "us-east-1", WithRetryPolicy(policy))
+		assert.ErrorContains(t, err, "invalid retry mode")
+	})
+
+	t.Run("rejects zero attempts", func(t *testing.T) {
+		policy := DefaultRetryPolicy()
+		policy.MaxAttempts = 0
+		_, err := NewClient(true, "", "us-east-1", WithRetryPolicy(policy))
+		assert.ErrorContains(t, err, "max attempts")
+	})
+}
+
+func TestRetryCounter(t *testing.T) {
+	for _, mode := range []string{RetryModeStandard, RetryModeAdaptive} {
+		t.Run(mode, func(t *testing.T) {
+			policy := DefaultRetryPolicy()
+			policy.Mode = mode
+			policy.MaxBackoff = time.Millisecond
+			counter := newRetryCounter(policy)
+
+			throttle := &smithy.GenericAPIError{Code: "RequestLimitExceeded", Message: "Request limit exceeded."}
+			assert.True(t, counter.IsErrorRetryable(throttle))
+			assert.Equal(t, 5, counter.MaxAttempts())
+
+			delay, err := counter.RetryDelay(1, throttle)
+			assert.NoError(t, err)
+			assert.LessOrEqual(t, delay, time.Millisecond)
+
+			_, err = counter.RetryDelay(2, errors.New("connection reset"))
+			assert.NoError(t, err)
+
+			assert.Equal(t, RetryStats{Retries: 2, Throttles: 1}, counter.stats())
+		})
+	}
+}
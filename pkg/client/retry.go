@@ -0,0 +1,141 @@
+package client
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/ratelimit"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/taemon1337/ec-manager/pkg/logger"
+)
+
+// Retry modes supported by RetryPolicy
+const (
+	// RetryModeStandard retries with exponential backoff and jitter
+	RetryModeStandard = "standard"
+	// RetryModeAdaptive adds client-side send rate limiting that backs off
+	// further whenever the service responds with throttling errors
+	RetryModeAdaptive = "adaptive"
+)
+
+// RetryPolicy controls how AWS API calls are retried
+type RetryPolicy struct {
+	// Mode is either RetryModeStandard or RetryModeAdaptive
+	Mode string
+	// MaxAttempts is the total number of attempts per call, including the first
+	MaxAttempts int
+	// MaxBackoff caps the jittered exponential delay between attempts
+	MaxBackoff time.Duration
+	// RetryTokens is the capacity of the retry token bucket. Every retry
+	// spends tokens and successful calls refund them, so a burst of failures
+	// across goroutines stops retrying instead of amplifying the load.
+	RetryTokens uint
+}
+
+// DefaultRetryPolicy returns the retry policy used when none is configured
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		Mode:        RetryModeAdaptive,
+		MaxAttempts: 5,
+		MaxBackoff:  20 * time.Second,
+		RetryTokens: 500,
+	}
+}
+
+// Validate checks the policy for unsupported values
+func (p RetryPolicy) Validate() error {
+	if p.Mode != RetryModeStandard && p.Mode != RetryModeAdaptive {
+		return fmt.Errorf("invalid retry mode %q: must be %s or %s", p.Mode, RetryModeStandard, RetryModeAdaptive)
+	}
+	if p.MaxAttempts < 1 {
+		return fmt.Errorf("max attempts must be at least 1, got %d", p.MaxAttempts)
+	}
+	if p.MaxBackoff <= 0 {
+		return fmt.Errorf("max backoff must be positive, got %s", p.MaxBackoff)
+	}
+	return nil
+}
+
+// WithRetryPolicy sets the retry policy applied to every AWS API call
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) {
+		c.retryPolicy = policy
+	}
+}
+
+// RetryStats reports how many retries were made by a client
+type RetryStats struct {
+	// Retries is the number of attempts made after a failed first attempt
+	Retries int64
+	// Throttles is the number of retries caused by throttling errors such
+	// as RequestLimitExceeded
+	Throttles int64
+}
+
+// retryCounter wraps a retryer to log and count every retry. A single
+// instance is shared by all service clients so that they draw from the same
+// token bucket.
+type retryCounter struct {
+	aws.RetryerV2
+	retries   atomic.Int64
+	throttles atomic.Int64
+}
+
+// NewRetryer builds the retryer described by policy
+func NewRetryer(policy RetryPolicy) aws.RetryerV2 {
+	return newRetryCounter(policy)
+}
+
+func newRetryCounter(policy RetryPolicy) *retryCounter {
+	standard := func(o *retry.StandardOptions) {
+		o.MaxAttempts = policy.MaxAttempts
+		o.MaxBackoff = policy.MaxBackoff
+		o.Backoff = retry.NewExponentialJitterBackoff(policy.MaxBackoff)
+		if policy.RetryTokens > 0 {
+			o.RateLimiter = ratelimit.NewTokenRateLimit(policy.RetryTokens)
+		}
+	}
+
+	var retryer aws.RetryerV2
+	if policy.Mode == RetryModeAdaptive {
+		retryer = retry.NewAdaptiveMode(func(o *retry.AdaptiveModeOptions) {
+			o.StandardOptions = append(o.StandardOptions, standard)
+		})
+	} else {
+		retryer = retry.NewStandard(standard)
+	}
+
+	return &retryCounter{RetryerV2: retryer}
+}
+
+// RetryDelay is only called when a failed attempt is about to be retried
+func (r *retryCounter) RetryDelay(attempt int, err error) (time.Duration, error) {
+	delay, delayErr := r.RetryerV2.RetryDelay(attempt, err)
+	if delayErr != nil {
+		return delay, delayErr
+	}
+
+	r.retries.Add(1)
+	throttled := retry.IsErrorThrottles(retry.DefaultThrottles).IsErrorThrottle(err).Bool()
+	if throttled {
+		r.throttles.Add(1)
+	}
+
+	logger.Debug("retrying AWS API call",
+		"attempt", attempt,
+		"delay", delay,
+		"throttled", throttled,
+		"error", err)
+
+	return delay, nil
+}
+
+// stats returns a snapshot of the retry counters
+func (r *retryCounter) stats() RetryStats {
+	return RetryStats{
+		Retries:   r.retries.Load(),
+		Throttles: r.throttles.Load(),
+	}
+}
@@ -17,14 +17,16 @@ import (
 // 1. AWS credentials file
 // 2. IAM user info
 // 3. STS caller identity
-func GetAWSUsername(ctx context.Context) (string, error) {
+//
+// optFns are passed to the AWS config loader, e.g. to share a retryer.
+func GetAWSUsername(ctx context.Context, optFns ...func(*config.LoadOptions) error) (string, error) {
 	// First try to get from credentials file
 	if username := getUserFromCredentials(); username != "" {
 		return username, nil
 	}
 
 	// Load AWS config
-	cfg, err := config.LoadDefaultConfig(ctx)
+	cfg, err := config.LoadDefaultConfig(ctx, optFns...)
 	if err != nil {
 		return "", err
 	}
@@ -1,18 +1,110 @@
 package config
 
-import "time"
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
 
 var (
 	// DefaultTimeout is the default timeout for AWS operations
 	DefaultTimeout = 5 * time.Minute
+
+	timeoutMu         sync.RWMutex
+	operationTimeouts = map[string]time.Duration{}
+)
+
+// Operations that wait on AWS resources and can be given their own timeout
+const (
+	// OpInstanceRunning waits for an instance to reach the running state
+	OpInstanceRunning = "instance-running"
+	// OpInstanceStopped waits for an instance to reach the stopped state
+	OpInstanceStopped = "instance-stopped"
+	// OpInstanceTerminated waits for an instance to reach the terminated state
+	OpInstanceTerminated = "instance-terminated"
+	// OpVolumeAvailable waits for a volume to become available
+	OpVolumeAvailable = "volume-available"
+	// OpImageAvailable waits for a new AMI to become available
+	OpImageAvailable = "image-available"
 )
 
+// Operations lists every operation that accepts a timeout
+func Operations() []string {
+	return []string{
+		OpInstanceRunning,
+		OpInstanceStopped,
+		OpInstanceTerminated,
+		OpVolumeAvailable,
+		OpImageAvailable,
+	}
+}
+
 // SetTimeout sets the global timeout for AWS operations
 func SetTimeout(t time.Duration) {
+	timeoutMu.Lock()
+	defer timeoutMu.Unlock()
 	DefaultTimeout = t
 }
 
 // GetTimeout gets the global timeout for AWS operations
 func GetTimeout() time.Duration {
+	timeoutMu.RLock()
+	defer timeoutMu.RUnlock()
+	return DefaultTimeout
+}
+
+// SetOperationTimeout overrides the timeout for a single operation
+func SetOperationTimeout(op string, t time.Duration) {
+	timeoutMu.Lock()
+	defer timeoutMu.Unlock()
+	operationTimeouts[op] = t
+}
+
+// GetOperationTimeout returns the timeout for an operation, falling back to
+// the global timeout when it has not been overridden
+func GetOperationTimeout(op string) time.Duration {
+	timeoutMu.RLock()
+	defer timeoutMu.RUnlock()
+	if t, ok := operationTimeouts[op]; ok {
+		return t
+	}
 	return DefaultTimeout
 }
+
+// SetOperationTimeouts parses operation=duration pairs, such as
+// "instance-stopped" => "10m", and applies them as operation timeouts
+func SetOperationTimeouts(values map[string]string) error {
+	known := map[string]bool{}
+	for _, op := range Operations() {
+		known[op] = true
+	}
+
+	// Sort so the first invalid entry is reported deterministically
+	ops := make([]string, 0, len(values))
+	for op := range values {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+
+	parsed := map[string]time.Duration{}
+	for _, op := range ops {
+		if !known[op] {
+			return fmt.Errorf("unknown operation %q: must be one of %s", op, strings.Join(Operations(), ", "))
+		}
+		t, err := time.ParseDuration(values[op])
+		if err != nil {
+			return fmt.Errorf("invalid timeout for %s: %w", op, err)
+		}
+		if t <= 0 {
+			return fmt.Errorf("timeout for %s must be positive", op)
+		}
+		parsed[op] = t
+	}
+
+	for op, t := range parsed {
+		SetOperationTimeout(op, t)
+	}
+	return nil
+}
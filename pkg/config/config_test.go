@@ -0,0 +1,73 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// restoreTimeouts puts back the global and operation timeouts when the test
+// ends, so other tests see the defaults
+func restoreTimeouts(t *testing.T) {
+	original := GetTimeout()
+	timeoutMu.RLock()
+	overrides := make(map[string]time.Duration, len(operationTimeouts))
+	for op, timeout := range operationTimeouts {
+		overrides[op] = timeout
+	}
+	timeoutMu.RUnlock()
+
+	t.Cleanup(func() {
+		SetTimeout(original)
+		timeoutMu.Lock()
+		defer timeoutMu.Unlock()
+		operationTimeouts = overrides
+	})
+}
+
+func TestOperationTimeouts(t *testing.T) {
+	restoreTimeouts(t)
+
+	SetTimeout(2 * time.Minute)
+	assert.Equal(t, 2*time.Minute, GetOperationTimeout(OpVolumeAvailable))
+
+	err := SetOperationTimeouts(map[string]string{
+		OpInstanceStopped: "10m",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 10*time.Minute, GetOperationTimeout(OpInstanceStopped))
+	assert.Equal(t, 2*time.Minute, GetOperationTimeout(OpInstanceRunning))
+}
+
+func TestSetOperationTimeoutsInvalid(t *testing.T) {
+	tests := []struct {
+		name        string
+		values      map[string]string
+		errContains string
+	}{
+		{
+			name:        "unknown operation",
+			values:      map[string]string{"snapshot-completed": "10m"},
+			errContains: "unknown operation",
+		},
+		{
+			name:        "bad duration",
+			values:      map[string]string{OpInstanceRunning: "ten minutes"},
+			errContains: "invalid timeout",
+		},
+		{
+			name:        "not positive",
+			values:      map[string]string{OpInstanceRunning: "0s"},
+			errContains: "must be positive",
+		},
+	}
+
+	restoreTimeouts(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := SetOperationTimeouts(tt.values)
+			assert.ErrorContains(t, err, tt.errContains)
+		})
+	}
+}
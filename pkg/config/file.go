@@ -0,0 +1,319 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Environment variables that override the configuration file
+const (
+	// EnvConfigPath overrides the location of the configuration file
+	EnvConfigPath = "ECMAN_CONFIG"
+	// EnvContext selects the context instead of current-context
+	EnvContext = "ECMAN_CONTEXT"
+	// EnvProfile overrides the context's AWS profile
+	EnvProfile = "ECMAN_PROFILE"
+	// EnvRegion overrides the context's AWS region
+	EnvRegion = "ECMAN_REGION"
+	// EnvSubnet overrides the context's default subnet
+	EnvSubnet = "ECMAN_SUBNET"
+	// EnvKeyName overrides the context's default key pair
+	EnvKeyName = "ECMAN_KEY"
+	// EnvInstanceType overrides the context's default instance type
+	EnvInstanceType = "ECMAN_INSTANCE_TYPE"
+	// EnvOutput overrides the context's output format
+	EnvOutput = "ECMAN_OUTPUT"
+)
+
+// Output formats
+const (
+	// OutputText prints human readable text
+	OutputText = "text"
+	// OutputJSON prints machine readable JSON
+	OutputJSON = "json"
+)
+
+// File is the ec-manager configuration file. It holds named contexts, each
+// bundling the defaults for one AWS environment, and the name of the context
+// used when none is given.
+type File struct {
+	CurrentContext string              `yaml:"current-context,omitempty"`
+	Contexts       map[string]*Context `yaml:"contexts,omitempty"`
+	Audit          Audit               `yaml:"audit,omitempty"`
+}
+
+// Audit configures where the mutating actions of every command are recorded
+type Audit struct {
+	// File is the JSONL audit log, ~/.local/state/ec-manager/audit.jsonl by
+	// default. ECMAN_AUDIT_LOG overrides it.
+	File string `yaml:"file,omitempty"`
+	// Syslog also sends records to syslog: "local", or a udp:// or tcp://
+	// address
+	Syslog string `yaml:"syslog,omitempty"`
+	// URL also receives each record as a JSON POST
+	URL string `yaml:"url,omitempty"`
+}
+
+// Context holds the defaults applied to every command run in it
+type Context struct {
+	Profile      string            `yaml:"profile,omitempty"`
+	Region       string            `yaml:"region,omitempty"`
+	Subnet       string            `yaml:"subnet,omitempty"`
+	KeyName      string            `yaml:"key,omitempty"`
+	InstanceType string            `yaml:"instance-type,omitempty"`
+	Tags         map[string]string `yaml:"tags,omitempty"`
+	Output       string            `yaml:"output,omitempty"`
+
+	// AssumeRole is a chain of roles assumed in order on top of the
+	// profile's credentials, e.g. a hub account role followed by a role in
+	// the target account
+	AssumeRole []string `yaml:"assume-role,omitempty"`
+	// ExternalID is passed when assuming the last role of the chain
+	ExternalID string `yaml:"external-id,omitempty"`
+	// MFASerial is the MFA device used when assuming the first role
+	MFASerial string `yaml:"mfa-serial,omitempty"`
+	// Accounts are the accounts commands run in with --accounts
+	Accounts []Account `yaml:"accounts,omitempty"`
+}
+
+// Account is an AWS account commands can run in by assuming a role in it
+// after the context's role chain
+type Account struct {
+	ID         string `yaml:"id"`
+	Name       string `yaml:"name,omitempty"`
+	Role       string `yaml:"role"`
+	ExternalID string `yaml:"external-id,omitempty"`
+	Region     string `yaml:"region,omitempty"`
+}
+
+// RoleARN returns the ARN of the account's role. Role may be a full ARN or
+// a role name in the account.
+func (a Account) RoleARN() string {
+	if strings.HasPrefix(a.Role, "arn:") {
+		return a.Role
+	}
+	return fmt.Sprintf("arn:aws:iam::%s:role/%s", a.ID, a.Role)
+}
+
+// Label returns the account ID, followed by its name when it has one
+func (a Account) Label() string {
+	if a.Name == "" {
+		return a.ID
+	}
+	return fmt.Sprintf("%s (%s)", a.ID, a.Name)
+}
+
+// SelectAccounts returns the accounts matching names, by name or ID, in the
+// order given. "all" selects every account.
+func (c Context) SelectAccounts(names []string) ([]Account, error) {
+	if len(names) == 1 && names[0] == "all" {
+		if len(c.Accounts) == 0 {
+			return nil, fmt.Errorf("no accounts are configured in the context")
+		}
+		return c.Accounts, nil
+	}
+
+	selected := make([]Account, 0, len(names))
+	for _, name := range names {
+		found := false
+		for _, a := range c.Accounts {
+			if a.ID == name || a.Name == name {
+				selected = append(selected, a)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("account %q is not configured in the context", name)
+		}
+	}
+	return selected, nil
+}
+
+// SetAccount adds the account or replaces the one with the same ID
+func (c *Context) SetAccount(a Account) {
+	for i := range c.Accounts {
+		if c.Accounts[i].ID == a.ID {
+			c.Accounts[i] = a
+			return
+		}
+	}
+	c.Accounts = append(c.Accounts, a)
+}
+
+// RemoveAccount removes the account with the given ID or name
+func (c *Context) RemoveAccount(name string) error {
+	for i, a := range c.Accounts {
+		if a.ID == name || a.Name == name {
+			c.Accounts = append(c.Accounts[:i], c.Accounts[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("account %q not found", name)
+}
+
+// DefaultConfigPath returns the configuration file location, honouring
+// ECMAN_CONFIG and XDG_CONFIG_HOME before ~/.config/ec-manager/config.yaml
+func DefaultConfigPath() (string, error) {
+	if path := os.Getenv(EnvConfigPath); path != "" {
+		return path, nil
+	}
+
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("unable to get home directory: %w", err)
+		}
+		dir = filepath.Join(home, ".config")
+	}
+
+	return filepath.Join(dir, "ec-manager", "config.yaml"), nil
+}
+
+// LoadFile reads the configuration file at path. A missing file is not an
+// error and yields an empty configuration.
+func LoadFile(path string) (*File, error) {
+	f := &File{}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	if err := yaml.Unmarshal(data, f); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	for name, c := range f.Contexts {
+		if c == nil {
+			f.Contexts[name] = &Context{}
+		}
+	}
+	return f, nil
+}
+
+// Save writes the configuration file to path, replacing it atomically so a
+// failed write never leaves a truncated file behind
+func (f *File) Save(path string) error {
+	data, err := yaml.Marshal(f)
+	if err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".config-*.yaml")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary config file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return fmt.Errorf("failed to set config file permissions: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to save config file: %w", err)
+	}
+	return nil
+}
+
+// ContextNames returns the names of all contexts in sorted order
+func (f *File) ContextNames() []string {
+	names := make([]string, 0, len(f.Contexts))
+	for name := range f.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// UseContext makes name the current context
+func (f *File) UseContext(name string) error {
+	if _, ok := f.Contexts[name]; !ok {
+		return fmt.Errorf("context %q not found", name)
+	}
+	f.CurrentContext = name
+	return nil
+}
+
+// SetContext creates or replaces the named context
+func (f *File) SetContext(name string, c *Context) {
+	if f.Contexts == nil {
+		f.Contexts = map[string]*Context{}
+	}
+	f.Contexts[name] = c
+}
+
+// Resolve returns the effective context: the one named by name, ECMAN_CONTEXT
+// or current-context, in that order, with ECMAN_* environment overrides
+// applied. Without any context configured the result only reflects the
+// environment.
+func (f *File) Resolve(name string) (Context, error) {
+	if name == "" {
+		name = os.Getenv(EnvContext)
+	}
+	if name == "" {
+		name = f.CurrentContext
+	}
+
+	var resolved Context
+	if name != "" {
+		c, ok := f.Contexts[name]
+		if !ok {
+			return Context{}, fmt.Errorf("context %q not found", name)
+		}
+		resolved = *c
+	}
+
+	overrides := []struct {
+		env   string
+		field *string
+	}{
+		{EnvProfile, &resolved.Profile},
+		{EnvRegion, &resolved.Region},
+		{EnvSubnet, &resolved.Subnet},
+		{EnvKeyName, &resolved.KeyName},
+		{EnvInstanceType, &resolved.InstanceType},
+		{EnvOutput, &resolved.Output},
+	}
+	for _, o := range overrides {
+		if v := os.Getenv(o.env); v != "" {
+			*o.field = v
+		}
+	}
+
+	if err := ValidateOutput(resolved.Output); err != nil {
+		return Context{}, err
+	}
+	return resolved, nil
+}
+
+// ValidateOutput checks that format is a supported output format. An empty
+// format is allowed and means the default.
+func ValidateOutput(format string) error {
+	switch format {
+	case "", OutputText, OutputJSON:
+		return nil
+	}
+	return fmt.Errorf("invalid output format %q: must be %s or %s", format, OutputText, OutputJSON)
+}
@@ -0,0 +1,148 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ec-manager", "config.yaml")
+
+	f, err := LoadFile(path)
+	require.NoError(t, err)
+	assert.Empty(t, f.Contexts)
+
+	f.SetContext("dev", &Context{
+		Profile: "dev",
+		Region:  "us-west-2",
+		Subnet:  "subnet-123",
+		Tags:    map[string]string{"Team": "infra"},
+	})
+	require.NoError(t, f.UseContext("dev"))
+	require.NoError(t, f.Save(path))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	loaded, err := LoadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "dev", loaded.CurrentContext)
+	assert.Equal(t, f.Contexts["dev"], loaded.Contexts["dev"])
+
+	assert.ErrorContains(t, loaded.UseContext("prod"), "not found")
+}
+
+func TestFileResolve(t *testing.T) {
+	f := &File{
+		CurrentContext: "dev",
+		Contexts: map[string]*Context{
+			"dev":  {Profile: "dev", Region: "us-west-2", Output: OutputText},
+			"prod": {Profile: "prod", Region: "us-east-1", KeyName: "prod-key"},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		context     string
+		env         map[string]string
+		want        Context
+		errContains string
+	}{
+		{
+			name: "current context",
+			want: Context{Profile: "dev", Region: "us-west-2", Output: OutputText},
+		},
+		{
+			name:    "explicit context",
+			context: "prod",
+			want:    Context{Profile: "prod", Region: "us-east-1", KeyName: "prod-key"},
+		},
+		{
+			name: "context from environment",
+			env:  map[string]string{EnvContext: "prod"},
+			want: Context{Profile: "prod", Region: "us-east-1", KeyName: "prod-key"},
+		},
+		{
+			name: "environment overrides",
+			env:  map[string]string{EnvRegion: "eu-west-1", EnvOutput: OutputJSON},
+			want: Context{Profile: "dev", Region: "eu-west-1", Output: OutputJSON},
+		},
+		{
+			name:        "unknown context",
+			context:     "staging",
+			errContains: "not found",
+		},
+		{
+			name:        "invalid output",
+			env:         map[string]string{EnvOutput: "xml"},
+			errContains: "invalid output format",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, env := range []string{EnvContext, EnvProfile, EnvRegion, EnvSubnet, EnvKeyName, EnvInstanceType, EnvOutput} {
+				t.Setenv(env, tt.env[env])
+			}
+
+			got, err := f.Resolve(tt.context)
+			if tt.errContains != "" {
+				assert.ErrorContains(t, err, tt.errContains)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestContextAccounts(t *testing.T) {
+	c := Context{AssumeRole: []string{"arn:aws:iam::111111111111:role/hub"}}
+	c.SetAccount(Account{ID: "222222222222", Name: "prod", Role: "ec-manager"})
+	c.SetAccount(Account{ID: "333333333333", Role: "arn:aws:iam::333333333333:role/ops/admin", Region: "eu-west-1"})
+	c.SetAccount(Account{ID: "222222222222", Name: "prod", Role: "deploy"})
+	require.Len(t, c.Accounts, 2)
+
+	assert.Equal(t, "arn:aws:iam::222222222222:role/deploy", c.Accounts[0].RoleARN())
+	assert.Equal(t, "arn:aws:iam::333333333333:role/ops/admin", c.Accounts[1].RoleARN())
+	assert.Equal(t, "222222222222 (prod)", c.Accounts[0].Label())
+	assert.Equal(t, "333333333333", c.Accounts[1].Label())
+
+	tests := []struct {
+		name     string
+		names    []string
+		expected []string
+		wantErr  string
+	}{
+		{name: "all", names: []string{"all"}, expected: []string{"222222222222", "333333333333"}},
+		{name: "by name and id", names: []string{"333333333333", "prod"}, expected: []string{"333333333333", "222222222222"}},
+		{name: "unknown", names: []string{"staging"}, wantErr: `account "staging" is not configured`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			accounts, err := c.SelectAccounts(tt.names)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			var ids []string
+			for _, a := range accounts {
+				ids = append(ids, a.ID)
+			}
+			assert.Equal(t, tt.expected, ids)
+		})
+	}
+
+	_, err := Context{}.SelectAccounts([]string{"all"})
+	assert.ErrorContains(t, err, "no accounts")
+
+	require.NoError(t, c.RemoveAccount("prod"))
+	assert.Len(t, c.Accounts, 1)
+	assert.ErrorContains(t, c.RemoveAccount("prod"), "not found")
+}
@@ -0,0 +1,452 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/ini.v1"
+)
+
+// Profile kinds supported by the setup wizard
+const (
+	// ProfileStatic uses long-lived access keys from the credentials file
+	ProfileStatic = "static"
+	// ProfileSSO signs in through IAM Identity Center
+	ProfileSSO = "sso"
+	// ProfileAssumeRole assumes a role using a source profile, optionally
+	// with MFA
+	ProfileAssumeRole = "assume-role"
+)
+
+// Keys written to the shared config file for a profile. Saving a profile
+// removes any of these it does not set, so switching kinds leaves no stale
+// settings behind.
+var profileConfigKeys = []string{
+	"region",
+	"sso_start_url",
+	"sso_region",
+	"sso_account_id",
+	"sso_role_name",
+	"role_arn",
+	"source_profile",
+	"mfa_serial",
+}
+
+// Keys written to the shared credentials file for a profile
+var profileCredentialKeys = []string{
+	"aws_access_key_id",
+	"aws_secret_access_key",
+	"aws_session_token",
+}
+
+// Profile is a named profile from the shared AWS config and credentials files
+type Profile struct {
+	Name   string
+	Region string
+
+	// Static credentials, stored in the credentials file
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// IAM Identity Center settings
+	SSOStartURL  string
+	SSORegion    string
+	SSOAccountID string
+	SSORoleName  string
+
+	// Assume-role settings
+	RoleARN       string
+	SourceProfile string
+	MFASerial     string
+}
+
+// Kind reports how the profile obtains credentials
+func (p Profile) Kind() string {
+	switch {
+	case p.SSOStartURL != "":
+		return ProfileSSO
+	case p.RoleARN != "":
+		return ProfileAssumeRole
+	default:
+		return ProfileStatic
+	}
+}
+
+// Validate checks that the settings required by the profile's kind are set
+func (p Profile) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("profile name is required")
+	}
+	if strings.ContainsAny(p.Name, "[] \t") {
+		return fmt.Errorf("invalid profile name %q", p.Name)
+	}
+
+	var missing []string
+	require := func(value, key string) {
+		if value == "" {
+			missing = append(missing, key)
+		}
+	}
+
+	switch p.Kind() {
+	case ProfileSSO:
+		require(p.SSORegion, "sso_region")
+		require(p.SSOAccountID, "sso_account_id")
+		require(p.SSORoleName, "sso_role_name")
+	case ProfileAssumeRole:
+		require(p.SourceProfile, "source_profile")
+		if p.SourceProfile == p.Name {
+			return fmt.Errorf("profile %s cannot be its own source profile", p.Name)
+		}
+	default:
+		require(p.AccessKeyID, "aws_access_key_id")
+		require(p.SecretAccessKey, "aws_secret_access_key")
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("%s profile %s is missing %s", p.Kind(), p.Name, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// SharedConfigPath returns the shared AWS config file, honouring
+// AWS_CONFIG_FILE
+func SharedConfigPath() (string, error) {
+	return sharedFilePath("AWS_CONFIG_FILE", "config")
+}
+
+// SharedCredentialsPath returns the shared AWS credentials file, honouring
+// AWS_SHARED_CREDENTIALS_FILE
+func SharedCredentialsPath() (string, error) {
+	return sharedFilePath("AWS_SHARED_CREDENTIALS_FILE", "credentials")
+}
+
+func sharedFilePath(env, name string) (string, error) {
+	if path := os.Getenv(env); path != "" {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".aws", name), nil
+}
+
+// ListProfiles returns every profile found in the shared config and
+// credentials files, sorted by name
+func ListProfiles() ([]Profile, error) {
+	configPath, err := SharedConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	credentialsPath, err := SharedCredentialsPath()
+	if err != nil {
+		return nil, err
+	}
+	return listProfiles(configPath, credentialsPath)
+}
+
+// LoadProfile returns the named profile and whether it exists
+func LoadProfile(name string) (Profile, bool, error) {
+	profiles, err := ListProfiles()
+	if err != nil {
+		return Profile{}, false, err
+	}
+	for _, p := range profiles {
+		if p.Name == name {
+			return p, true, nil
+		}
+	}
+	return Profile{Name: name}, false, nil
+}
+
+func listProfiles(configPath, credentialsPath string) ([]Profile, error) {
+	profiles := map[string]*Profile{}
+	get := func(name string) *Profile {
+		if p, ok := profiles[name]; ok {
+			return p
+		}
+		p := &Profile{Name: name}
+		profiles[name] = p
+		return p
+	}
+
+	cfg, err := loadIniFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, section := range cfg.Sections() {
+		name := section.Name()
+		if name == ini.DefaultSection {
+			continue
+		}
+		if name != "default" {
+			if !strings.HasPrefix(name, "profile ") {
+				// sso-session and services sections are not profiles
+				continue
+			}
+			name = strings.TrimSpace(strings.TrimPrefix(name, "profile "))
+		}
+
+		p := get(name)
+		p.Region = section.Key("region").String()
+		p.SSOStartURL = section.Key("sso_start_url").String()
+		p.SSORegion = section.Key("sso_region").String()
+		p.SSOAccountID = section.Key("sso_account_id").String()
+		p.SSORoleName = section.Key("sso_role_name").String()
+		p.RoleARN = section.Key("role_arn").String()
+		p.SourceProfile = section.Key("source_profile").String()
+		p.MFASerial = section.Key("mfa_serial").String()
+	}
+
+	creds, err := loadIniFile(credentialsPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, section := range creds.Sections() {
+		if section.Name() == ini.DefaultSection {
+			continue
+		}
+		p := get(section.Name())
+		p.AccessKeyID = section.Key("aws_access_key_id").String()
+		p.SecretAccessKey = section.Key("aws_secret_access_key").String()
+		p.SessionToken = section.Key("aws_session_token").String()
+	}
+
+	result := make([]Profile, 0, len(profiles))
+	for _, p := range profiles {
+		result = append(result, *p)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+// SaveProfile writes the profile to the shared config and credentials files,
+// keeping every other profile and setting in them intact
+func SaveProfile(p Profile) error {
+	configPath, err := SharedConfigPath()
+	if err != nil {
+		return err
+	}
+	credentialsPath, err := SharedCredentialsPath()
+	if err != nil {
+		return err
+	}
+	return SaveProfileTo(p, configPath, credentialsPath)
+}
+
+// SaveProfileTo writes the profile to the given config and credentials files
+func SaveProfileTo(p Profile, configPath, credentialsPath string) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+
+	err := updateIniFile(configPath, func(f *ini.File) error {
+		sectionName := "profile " + p.Name
+		if p.Name == "default" {
+			sectionName = "default"
+		}
+
+		section, err := f.NewSection(sectionName)
+		if err != nil {
+			return fmt.Errorf("failed to create profile section: %w", err)
+		}
+		for _, key := range profileConfigKeys {
+			section.DeleteKey(key)
+		}
+
+		setKeys(section, map[string]string{
+			"region":         p.Region,
+			"sso_start_url":  p.SSOStartURL,
+			"sso_region":     p.SSORegion,
+			"sso_account_id": p.SSOAccountID,
+			"sso_role_name":  p.SSORoleName,
+			"role_arn":       p.RoleARN,
+			"source_profile": p.SourceProfile,
+			"mfa_serial":     p.MFASerial,
+		})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update config file: %w", err)
+	}
+
+	// Credentials take precedence over the config file, so profiles that do
+	// not use static keys must not leave old keys behind
+	if p.Kind() != ProfileStatic {
+		return RemoveCredentials(p.Name, credentialsPath)
+	}
+	return SaveCredentials(p.Name, p.AccessKeyID, p.SecretAccessKey, p.SessionToken, credentialsPath)
+}
+
+// SaveCredentials writes keys for profile to the credentials file at path.
+// An empty session token removes any previous one.
+func SaveCredentials(profile, accessKey, secretKey, sessionToken, path string) error {
+	if profile == "" {
+		profile = "default"
+	}
+
+	err := updateIniFile(path, func(f *ini.File) error {
+		section, err := f.NewSection(profile)
+		if err != nil {
+			return fmt.Errorf("failed to create profile section: %w", err)
+		}
+		for _, key := range profileCredentialKeys {
+			section.DeleteKey(key)
+		}
+
+		setKeys(section, map[string]string{
+			"aws_access_key_id":     accessKey,
+			"aws_secret_access_key": secretKey,
+			"aws_session_token":     sessionToken,
+		})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save credentials file: %w", err)
+	}
+	return nil
+}
+
+// RemoveCredentials deletes the profile's keys from the credentials file
+func RemoveCredentials(profile, path string) error {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	err := updateIniFile(path, func(f *ini.File) error {
+		section, err := f.GetSection(profile)
+		if err != nil {
+			return nil
+		}
+		for _, key := range profileCredentialKeys {
+			section.DeleteKey(key)
+		}
+		if len(section.Keys()) == 0 {
+			f.DeleteSection(profile)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update credentials file: %w", err)
+	}
+	return nil
+}
+
+// StageProfile copies the current shared files into dir and writes p to the
+// copies, so the profile can be tried out before the real files are changed
+func StageProfile(p Profile, dir string) (configPath, credentialsPath string, err error) {
+	srcConfig, err := SharedConfigPath()
+	if err != nil {
+		return "", "", err
+	}
+	srcCredentials, err := SharedCredentialsPath()
+	if err != nil {
+		return "", "", err
+	}
+
+	configPath = filepath.Join(dir, "config")
+	credentialsPath = filepath.Join(dir, "credentials")
+	if err := copyFile(srcConfig, configPath); err != nil {
+		return "", "", err
+	}
+	if err := copyFile(srcCredentials, credentialsPath); err != nil {
+		return "", "", err
+	}
+
+	if err := SaveProfileTo(p, configPath, credentialsPath); err != nil {
+		return "", "", err
+	}
+	return configPath, credentialsPath, nil
+}
+
+// setKeys sets every non-empty value on section
+func setKeys(section *ini.Section, values map[string]string) {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if values[key] != "" {
+			section.Key(key).SetValue(values[key])
+		}
+	}
+}
+
+// loadIniFile reads an ini file, treating a missing file as empty
+func loadIniFile(path string) (*ini.File, error) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return ini.Empty(), nil
+	}
+	f, err := ini.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", path, err)
+	}
+	return f, nil
+}
+
+// updateIniFile applies fn to the ini file at path and writes it back through
+// a temporary file, so a failure never leaves a half-written file
+func updateIniFile(path string, fn func(*ini.File) error) error {
+	f, err := loadIniFile(path)
+	if err != nil {
+		return err
+	}
+	if err := fn(f); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := f.WriteTo(tmp); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return fmt.Errorf("failed to set permissions on %s: %w", path, err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// copyFile copies src to dst. A missing src leaves dst absent.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dst, err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+	return out.Close()
+}
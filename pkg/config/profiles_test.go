@@ -0,0 +1,89 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSaveProfile(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config")
+	credentialsPath := filepath.Join(dir, "credentials")
+	t.Setenv("AWS_CONFIG_FILE", configPath)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", credentialsPath)
+
+	require.NoError(t, os.WriteFile(configPath, []byte("[default]\nregion = us-east-1\noutput = json\n\n[sso-session corp]\nsso_region = us-east-1\n"), 0600))
+
+	static := Profile{Name: "dev", Region: "us-west-2", AccessKeyID: "AKIA1", SecretAccessKey: "secret"}
+	require.NoError(t, SaveProfile(static))
+
+	profiles, err := ListProfiles()
+	require.NoError(t, err)
+	require.Len(t, profiles, 2)
+	assert.Equal(t, "default", profiles[0].Name)
+	assert.Equal(t, static, profiles[1])
+
+	// Switching to assume-role drops the static keys
+	role := Profile{Name: "dev", Region: "us-west-2", RoleARN: "arn:aws:iam::123456789012:role/admin", SourceProfile: "default", MFASerial: "arn:aws:iam::123456789012:mfa/me"}
+	require.NoError(t, SaveProfile(role))
+
+	loaded, found, err := LoadProfile("dev")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, role, loaded)
+	assert.Equal(t, ProfileAssumeRole, loaded.Kind())
+
+	// Unrelated settings are kept
+	data, err := os.ReadFile(configPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "output = json")
+	assert.Contains(t, string(data), "[sso-session corp]")
+}
+
+func TestProfileValidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		profile     Profile
+		errContains string
+	}{
+		{
+			name:    "static",
+			profile: Profile{Name: "dev", AccessKeyID: "AKIA1", SecretAccessKey: "secret"},
+		},
+		{
+			name:        "static missing secret",
+			profile:     Profile{Name: "dev", AccessKeyID: "AKIA1"},
+			errContains: "aws_secret_access_key",
+		},
+		{
+			name:        "sso missing account",
+			profile:     Profile{Name: "dev", SSOStartURL: "https://corp.awsapps.com/start", SSORegion: "us-east-1", SSORoleName: "Admin"},
+			errContains: "sso_account_id",
+		},
+		{
+			name:        "role sourcing itself",
+			profile:     Profile{Name: "dev", RoleARN: "arn:aws:iam::123456789012:role/admin", SourceProfile: "dev"},
+			errContains: "own source profile",
+		},
+		{
+			name:        "invalid name",
+			profile:     Profile{Name: "my profile", AccessKeyID: "AKIA1", SecretAccessKey: "secret"},
+			errContains: "invalid profile name",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.profile.Validate()
+			if tt.errContains == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorContains(t, err, tt.errContains)
+		})
+	}
+}
@@ -62,6 +62,14 @@ func Init(level LogLevel) {
 	})
 }
 
+// InitWriter initializes the default logger with the specified level,
+// writing to w instead of stdout
+func InitWriter(level LogLevel, w io.Writer) {
+	loggerOnce.Do(func() {
+		defaultLogger = NewLogger(level, w)
+	})
+}
+
 // Get returns the default logger, initializing it if necessary
 func Get() *Logger {
 	mu.RLock()
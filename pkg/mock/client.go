@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
@@ -36,9 +37,10 @@ var IAMClientKey = iamClientKey{}
 // MockEC2Client is a mock implementation of the EC2Client interface
 type MockEC2Client struct {
 	mock.Mock
-	InstanceStoppedWaiter *waiters.MockInstanceStoppedWaiter
-	InstanceRunningWaiter *waiters.MockInstanceRunningWaiter
-	VolumeAvailableWaiter *waiters.MockVolumeAvailableWaiter
+	InstanceStoppedWaiter    *waiters.MockInstanceStoppedWaiter
+	InstanceRunningWaiter    *waiters.MockInstanceRunningWaiter
+	InstanceTerminatedWaiter *waiters.MockInstanceTerminatedWaiter
+	VolumeAvailableWaiter    *waiters.MockVolumeAvailableWaiter
 }
 
 // NewMockEC2Client creates a new mock EC2 client
@@ -190,7 +192,7 @@ func (m *MockEC2Client) CreateTags(ctx context.Context, params *ec2.CreateTagsIn
 
 // RunInstances implements the EC2 client interface
 func (m *MockEC2Client) RunInstances(ctx context.Context, params *ec2.RunInstancesInput, optFns ...func(*ec2.Options)) (*ec2.RunInstancesOutput, error) {
-	args := m.Called(ctx, params, optFns)
+	args := m.Called(ctx, params, mock.Anything)
 	if args.Get(1) != nil {
 		return nil, args.Get(1).(error)
 	}
@@ -218,9 +220,45 @@ func (m *MockEC2Client) TerminateInstances(ctx context.Context, params *ec2.Term
 	return args.Get(0).(*ec2.TerminateInstancesOutput), nil
 }
 
+// CancelSpotInstanceRequests implements the EC2 client interface
+func (m *MockEC2Client) CancelSpotInstanceRequests(ctx context.Context, params *ec2.CancelSpotInstanceRequestsInput, optFns ...func(*ec2.Options)) (*ec2.CancelSpotInstanceRequestsOutput, error) {
+	args := m.Called(ctx, params)
+	if args.Get(1) != nil {
+		return nil, args.Get(1).(error)
+	}
+	return args.Get(0).(*ec2.CancelSpotInstanceRequestsOutput), nil
+}
+
+// DescribeInstanceAttribute implements the EC2 client interface
+func (m *MockEC2Client) DescribeInstanceAttribute(ctx context.Context, params *ec2.DescribeInstanceAttributeInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceAttributeOutput, error) {
+	args := m.Called(ctx, params)
+	if args.Get(1) != nil {
+		return nil, args.Get(1).(error)
+	}
+	return args.Get(0).(*ec2.DescribeInstanceAttributeOutput), nil
+}
+
+// ModifyInstanceAttribute implements the EC2 client interface
+func (m *MockEC2Client) ModifyInstanceAttribute(ctx context.Context, params *ec2.ModifyInstanceAttributeInput, optFns ...func(*ec2.Options)) (*ec2.ModifyInstanceAttributeOutput, error) {
+	args := m.Called(ctx, params)
+	if args.Get(1) != nil {
+		return nil, args.Get(1).(error)
+	}
+	return args.Get(0).(*ec2.ModifyInstanceAttributeOutput), nil
+}
+
+// DescribeInstanceTypes implements the EC2 client interface
+func (m *MockEC2Client) DescribeInstanceTypes(ctx context.Context, params *ec2.DescribeInstanceTypesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstanceTypesOutput, error) {
+	args := m.Called(ctx, params)
+	if args.Get(1) != nil {
+		return nil, args.Get(1).(error)
+	}
+	return args.Get(0).(*ec2.DescribeInstanceTypesOutput), nil
+}
+
 // AttachVolume implements the EC2 client interface
 func (m *MockEC2Client) AttachVolume(ctx context.Context, params *ec2.AttachVolumeInput, optFns ...func(*ec2.Options)) (*ec2.AttachVolumeOutput, error) {
-	args := m.Called(ctx, params, optFns)
+	args := m.Called(ctx, params, mock.Anything)
 	if args.Get(1) != nil {
 		return nil, args.Get(1).(error)
 	}
@@ -299,6 +337,9 @@ func (m *MockEC2Client) NewInstanceStoppedWaiter() interface {
 func (m *MockEC2Client) NewInstanceTerminatedWaiter() interface {
 	Wait(ctx context.Context, params *ec2.DescribeInstancesInput, maxWaitDur time.Duration, optFns ...func(*ec2.InstanceTerminatedWaiterOptions)) error
 } {
+	if m.InstanceTerminatedWaiter != nil {
+		return m.InstanceTerminatedWaiter
+	}
 	return &waiters.MockInstanceTerminatedWaiter{
 		Mock: mock.Mock{},
 	}
@@ -386,3 +427,47 @@ func (m *MockIAMClient) ListUsers(ctx context.Context, params *iam.ListUsersInpu
 	}
 	return args.Get(0).(*iam.ListUsersOutput), args.Error(1)
 }
+
+// GetRole implements the IAM client interface
+func (m *MockIAMClient) GetRole(ctx context.Context, params *iam.GetRoleInput, optFns ...func(*iam.Options)) (*iam.GetRoleOutput, error) {
+	args := m.Called(ctx, params, optFns)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*iam.GetRoleOutput), args.Error(1)
+}
+
+// SimulatePrincipalPolicy implements the IAM client interface
+func (m *MockIAMClient) SimulatePrincipalPolicy(ctx context.Context, params *iam.SimulatePrincipalPolicyInput, optFns ...func(*iam.Options)) (*iam.SimulatePrincipalPolicyOutput, error) {
+	args := m.Called(ctx, params, optFns)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*iam.SimulatePrincipalPolicyOutput), args.Error(1)
+}
+
+// MockCloudWatchClient is a mock implementation of CloudWatchClient
+type MockCloudWatchClient struct {
+	mock.Mock
+}
+
+// NewMockCloudWatchClient creates a new mock CloudWatch client
+func NewMockCloudWatchClient(t *testing.T) *MockCloudWatchClient {
+	m := &MockCloudWatchClient{}
+	m.Test(t)
+	return m
+}
+
+// NewMockCloudWatchClientWithoutT creates a new mock CloudWatch client without testing.T
+func NewMockCloudWatchClientWithoutT() *MockCloudWatchClient {
+	return &MockCloudWatchClient{}
+}
+
+// GetMetricStatistics implements the CloudWatch client interface
+func (m *MockCloudWatchClient) GetMetricStatistics(ctx context.Context, params *cloudwatch.GetMetricStatisticsInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.GetMetricStatisticsOutput, error) {
+	args := m.Called(ctx, params)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*cloudwatch.GetMetricStatisticsOutput), args.Error(1)
+}
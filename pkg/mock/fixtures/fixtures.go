@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/spf13/cobra"
@@ -162,12 +163,15 @@ func TestSnapshot() ec2types.Snapshot {
 func TestListAMIs() []ec2types.Image {
 	return []ec2types.Image{
 		{
-			ImageId:      aws.String("ami-123"),
-			Name:         aws.String("test-ami-1"),
-			Description:  aws.String("Test AMI 1 for unit tests"),
-			State:        ec2types.ImageStateAvailable,
-			Architecture: ec2types.ArchitectureValuesX8664,
-			Platform:     "Linux/UNIX",
+			ImageId:            aws.String("ami-123"),
+			Name:               aws.String("test-ami-1"),
+			Description:        aws.String("Test AMI 1 for unit tests"),
+			State:              ec2types.ImageStateAvailable,
+			Architecture:       ec2types.ArchitectureValuesX8664,
+			Platform:           "Linux/UNIX",
+			RootDeviceName:     aws.String("/dev/xvda"),
+			VirtualizationType: ec2types.VirtualizationTypeHvm,
+			EnaSupport:         aws.Bool(true),
 			Tags: []ec2types.Tag{
 				{
 					Key:   aws.String("Name"),
@@ -180,12 +184,15 @@ func TestListAMIs() []ec2types.Image {
 			},
 		},
 		{
-			ImageId:      aws.String("ami-456"),
-			Name:         aws.String("test-ami-2"),
-			Description:  aws.String("Test AMI 2 for unit tests"),
-			State:        ec2types.ImageStateAvailable,
-			Architecture: ec2types.ArchitectureValuesX8664,
-			Platform:     "Windows",
+			ImageId:            aws.String("ami-456"),
+			Name:               aws.String("test-ami-2"),
+			Description:        aws.String("Test AMI 2 for unit tests"),
+			State:              ec2types.ImageStateAvailable,
+			Architecture:       ec2types.ArchitectureValuesX8664,
+			Platform:           "Windows",
+			RootDeviceName:     aws.String("/dev/sda1"),
+			VirtualizationType: ec2types.VirtualizationTypeHvm,
+			EnaSupport:         aws.Bool(true),
 			Tags: []ec2types.Tag{
 				{
 					Key:   aws.String("Name"),
@@ -297,3 +304,66 @@ func TestListKeyPairs() []ec2types.KeyPairInfo {
 		},
 	}
 }
+
+// TestListInstanceTypes returns a list of test instance types
+func TestListInstanceTypes() []ec2types.InstanceTypeInfo {
+	return []ec2types.InstanceTypeInfo{
+		testInstanceType(ec2types.InstanceTypeT2Micro, 1, 1024, "Low to Moderate", false),
+		testInstanceType(ec2types.InstanceTypeT2Small, 1, 2048, "Low to Moderate", false),
+		testInstanceType(ec2types.InstanceTypeT3Nano, 2, 512, "Up to 5 Gigabit", true),
+		testInstanceType(ec2types.InstanceTypeT3Micro, 2, 1024, "Up to 5 Gigabit", true),
+		testInstanceType(ec2types.InstanceTypeT3Small, 2, 2048, "Up to 5 Gigabit", true),
+		testInstanceType(ec2types.InstanceTypeM5Large, 2, 8192, "Up to 10 Gigabit", true),
+	}
+}
+
+// testInstanceType returns a current x86_64 HVM instance type
+func testInstanceType(name ec2types.InstanceType, vcpus int32, memoryMiB int64, network string, ena bool) ec2types.InstanceTypeInfo {
+	enaSupport := ec2types.EnaSupportUnsupported
+	if ena {
+		enaSupport = ec2types.EnaSupportRequired
+	}
+	return ec2types.InstanceTypeInfo{
+		InstanceType:                 name,
+		CurrentGeneration:            aws.Bool(true),
+		VCpuInfo:                     &ec2types.VCpuInfo{DefaultVCpus: aws.Int32(vcpus)},
+		MemoryInfo:                   &ec2types.MemoryInfo{SizeInMiB: aws.Int64(memoryMiB)},
+		ProcessorInfo:                &ec2types.ProcessorInfo{SupportedArchitectures: []ec2types.ArchitectureType{ec2types.ArchitectureTypeX8664}},
+		SupportedVirtualizationTypes: []ec2types.VirtualizationType{ec2types.VirtualizationTypeHvm},
+		NetworkInfo: &ec2types.NetworkInfo{
+			NetworkPerformance: aws.String(network),
+			EnaSupport:         enaSupport,
+		},
+	}
+}
+
+// TestMetricDatapoints returns two weeks of hourly CloudWatch datapoints of
+// an AWS/EC2 metric for the test instances: the running instance is mostly
+// idle and the stopped one has no data
+func TestMetricDatapoints(instanceID, metric string) []cwtypes.Datapoint {
+	if instanceID != TestInstanceID {
+		return nil
+	}
+
+	var datapoints []cwtypes.Datapoint
+	start := time.Now().Add(-14 * 24 * time.Hour).Truncate(time.Hour)
+	for i := 0; i < 14*24; i++ {
+		dp := cwtypes.Datapoint{Timestamp: aws.Time(start.Add(time.Duration(i) * time.Hour))}
+		switch metric {
+		case "CPUUtilization":
+			dp.Average, dp.Maximum = aws.Float64(3.5), aws.Float64(3.5)
+			if i == 100 {
+				dp.Maximum = aws.Float64(12)
+			}
+		case "NetworkIn", "NetworkOut":
+			dp.Sum = aws.Float64(36e6)
+			if i == 100 {
+				dp.Sum = aws.Float64(144e6)
+			}
+		default:
+			return nil
+		}
+		datapoints = append(datapoints, dp)
+	}
+	return datapoints
+}
@@ -3,10 +3,13 @@ package mock
 import (
 	"context"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
 	"github.com/stretchr/testify/mock"
 	"github.com/taemon1337/ec-manager/pkg/mock/fixtures"
+	"github.com/taemon1337/ec-manager/pkg/mock/waiters"
 )
 
 // Define a custom key type for context values
@@ -41,17 +44,61 @@ func SetupDefaultMockResponses(m *MockEC2Client) {
 		KeyPairs: fixtures.TestListKeyPairs(),
 	}, nil)
 
-	m.On("CreateImage", mock.Anything, mock.Anything).Return(&ec2.CreateImageOutput{}, nil)
+	m.On("CreateImage", mock.Anything, mock.Anything).Return(&ec2.CreateImageOutput{
+		ImageId: aws.String("ami-mock123"),
+	}, nil)
 	m.On("CreateTags", mock.Anything, mock.Anything).Return(&ec2.CreateTagsOutput{}, nil)
 	m.On("RunInstances", mock.Anything, mock.Anything).Return(&ec2.RunInstancesOutput{}, nil)
 	m.On("StopInstances", mock.Anything, mock.Anything).Return(&ec2.StopInstancesOutput{}, nil)
 	m.On("StartInstances", mock.Anything, mock.Anything).Return(&ec2.StartInstancesOutput{}, nil)
 	m.On("TerminateInstances", mock.Anything, mock.Anything).Return(&ec2.TerminateInstancesOutput{}, nil)
+	m.On("CancelSpotInstanceRequests", mock.Anything, mock.Anything).Return(&ec2.CancelSpotInstanceRequestsOutput{}, nil)
 	m.On("AttachVolume", mock.Anything, mock.Anything).Return(&ec2.AttachVolumeOutput{}, nil)
 	m.On("CreateSnapshot", mock.Anything, mock.Anything).Return(&ec2.CreateSnapshotOutput{}, nil)
 	m.On("CreateVolume", mock.Anything, mock.Anything).Return(&ec2.CreateVolumeOutput{}, nil)
 	m.On("DescribeSnapshots", mock.Anything, mock.Anything).Return(&ec2.DescribeSnapshotsOutput{}, nil)
 	m.On("DescribeVolumes", mock.Anything, mock.Anything).Return(&ec2.DescribeVolumesOutput{}, nil)
+	m.On("DescribeInstanceAttribute", mock.Anything, mock.Anything).Return(&ec2.DescribeInstanceAttributeOutput{
+		DisableApiTermination: &ec2types.AttributeBooleanValue{Value: aws.Bool(false)},
+	}, nil)
+	m.On("ModifyInstanceAttribute", mock.Anything, mock.Anything).Return(&ec2.ModifyInstanceAttributeOutput{}, nil)
+	m.On("DescribeInstanceTypes", mock.Anything, mock.Anything).Return(&ec2.DescribeInstanceTypesOutput{
+		InstanceTypes: fixtures.TestListInstanceTypes(),
+	}, nil)
+
+	// Waiters return immediately so lifecycle commands complete in mock mode
+	m.InstanceRunningWaiter = &waiters.MockInstanceRunningWaiter{}
+	m.InstanceRunningWaiter.On("Wait", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	m.InstanceStoppedWaiter = &waiters.MockInstanceStoppedWaiter{}
+	m.InstanceStoppedWaiter.On("Wait", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	m.InstanceTerminatedWaiter = &waiters.MockInstanceTerminatedWaiter{}
+	m.InstanceTerminatedWaiter.On("Wait", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	m.VolumeAvailableWaiter = &waiters.MockVolumeAvailableWaiter{}
+	m.VolumeAvailableWaiter.On("Wait", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil)
+}
+
+// SetupDefaultCloudWatchResponses answers GetMetricStatistics with the
+// fixture datapoints of the requested metric and instance
+func SetupDefaultCloudWatchResponses(m *MockCloudWatchClient) {
+	for _, metric := range []string{"CPUUtilization", "NetworkIn", "NetworkOut"} {
+		metric := metric
+		m.On("GetMetricStatistics", mock.Anything, mock.MatchedBy(func(input *cloudwatch.GetMetricStatisticsInput) bool {
+			return aws.ToString(input.MetricName) == metric && metricInstance(input) == fixtures.TestInstanceID
+		})).Return(&cloudwatch.GetMetricStatisticsOutput{
+			Datapoints: fixtures.TestMetricDatapoints(fixtures.TestInstanceID, metric),
+		}, nil)
+	}
+	m.On("GetMetricStatistics", mock.Anything, mock.Anything).Return(&cloudwatch.GetMetricStatisticsOutput{}, nil)
+}
+
+// metricInstance returns the InstanceId dimension of a metric request
+func metricInstance(input *cloudwatch.GetMetricStatisticsInput) string {
+	for _, d := range input.Dimensions {
+		if aws.ToString(d.Name) == "InstanceId" {
+			return aws.ToString(d.Value)
+		}
+	}
+	return ""
 }
 
 // WithMockEC2Client creates a context with a mock EC2 client for testing
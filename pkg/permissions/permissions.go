@@ -0,0 +1,386 @@
+// Package permissions knows which AWS actions each ec-manager command needs
+// and checks whether an identity may perform them, using EC2 DryRun requests
+// and IAM policy simulation.
+package permissions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/smithy-go"
+	"github.com/taemon1337/ec-manager/pkg/types"
+)
+
+// Status is the outcome of a single check
+type Status string
+
+const (
+	// Pass means the action is allowed
+	Pass Status = "pass"
+	// Fail means the action is denied
+	Fail Status = "fail"
+	// Unknown means the check could not decide
+	Unknown Status = "unknown"
+	// Skipped means the check does not apply to the action
+	Skipped Status = "n/a"
+)
+
+// Commands maps each ec-manager command, by its path below the root
+// command, to the actions it calls
+var Commands = map[string][]string{
+	"backup":            {"ec2:DescribeInstances", "ec2:DescribeImages", "ec2:CreateImage", "ec2:CreateTags"},
+	"check credentials": {"ec2:DescribeInstances", "iam:ListUsers", "iam:ListRoles", "sts:AssumeRole"},
+	"check drift":       {"ec2:DescribeInstances", "ec2:DescribeImages"},
+	"check migrate":     {"ec2:DescribeInstances", "ec2:DescribeImages"},
+	"check rightsize":   {"ec2:DescribeInstances", "ec2:DescribeInstanceTypes", "cloudwatch:GetMetricStatistics"},
+	"cost":              {"ec2:DescribeInstances", "ec2:DescribeSnapshots"},
+	"cost refresh":      {"pricing:GetProducts"},
+	"apply": {"ec2:DescribeInstances", "ec2:DescribeImages", "ec2:RunInstances", "ec2:CreateTags",
+		"ec2:ModifyInstanceAttribute", "iam:PassRole"},
+	"create": {"ec2:RunInstances", "ec2:CreateTags", "ec2:DescribeInstances", "ec2:DescribeImages", "iam:PassRole"},
+	"delete": {"ec2:DescribeInstances", "ec2:DescribeInstanceAttribute", "ec2:CancelSpotInstanceRequests", "ec2:TerminateInstances",
+		"ec2:CreateImage", "ec2:CreateTags", "ec2:DescribeImages"},
+	"list amis":      {"ec2:DescribeImages"},
+	"list backups":   {"ec2:DescribeImages"},
+	"list instances": {"ec2:DescribeInstances"},
+	"list keys":      {"ec2:DescribeKeyPairs"},
+	"list subnets":   {"ec2:DescribeSubnets"},
+	"migrate":        {"ec2:DescribeInstances", "ec2:DescribeImages", "ec2:RunInstances", "ec2:CreateTags"},
+	"protect":        {"ec2:DescribeInstances", "ec2:ModifyInstanceAttribute"},
+	"restart":        {"ec2:DescribeInstances", "ec2:StopInstances", "ec2:StartInstances"},
+	"resize": {"ec2:DescribeInstances", "ec2:DescribeImages", "ec2:DescribeInstanceTypes", "ec2:StopInstances",
+		"ec2:ModifyInstanceAttribute", "ec2:CreateTags", "ec2:StartInstances"},
+	"restore": {"ec2:DescribeInstances", "ec2:DescribeImages", "ec2:DescribeSnapshots", "ec2:DescribeVolumes",
+		"ec2:CreateVolume", "ec2:AttachVolume", "ec2:RunInstances", "ec2:CreateTags"},
+	"ssh":   {"ec2:DescribeInstances"},
+	"start": {"ec2:DescribeInstances", "ec2:StartInstances"},
+	"stop":  {"ec2:DescribeInstances", "ec2:StopInstances"},
+}
+
+// CommandNames returns the commands with known requirements, sorted
+func CommandNames() []string {
+	names := make([]string, 0, len(Commands))
+	for name := range Commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Result is the outcome of checking one action
+type Result struct {
+	Action     string `json:"action"`
+	DryRun     Status `json:"dryRun"`
+	Simulation Status `json:"simulation"`
+	Status     Status `json:"status"`
+	Detail     string `json:"detail,omitempty"`
+}
+
+// IAMAPI is the IAM API used for policy simulation
+type IAMAPI interface {
+	GetRole(context.Context, *iam.GetRoleInput, ...func(*iam.Options)) (*iam.GetRoleOutput, error)
+	SimulatePrincipalPolicy(context.Context, *iam.SimulatePrincipalPolicyInput, ...func(*iam.Options)) (*iam.SimulatePrincipalPolicyOutput, error)
+}
+
+// Placeholder resources used by DryRun requests for actions that need one.
+// EC2 checks permissions before it looks the resources up, and any answer
+// other than DryRunOperation or UnauthorizedOperation is left to simulation.
+const (
+	placeholderInstance = "i-00000000000000000"
+	placeholderImage    = "ami-00000000000000000"
+	placeholderVolume   = "vol-00000000000000000"
+	placeholderSnapshot = "snap-00000000000000000"
+	// placeholderSpotRequest is a well-formed Spot request ID
+	placeholderSpotRequest = "sir-00000000"
+)
+
+// dryRunProbes send each EC2 action with DryRun set
+var dryRunProbes = map[string]func(context.Context, types.EC2Client) error{
+	"ec2:DescribeInstances": func(ctx context.Context, c types.EC2Client) error {
+		_, err := c.DescribeInstances(ctx, &ec2.DescribeInstancesInput{DryRun: aws.Bool(true)})
+		return err
+	},
+	"ec2:DescribeImages": func(ctx context.Context, c types.EC2Client) error {
+		_, err := c.DescribeImages(ctx, &ec2.DescribeImagesInput{DryRun: aws.Bool(true), Owners: []string{"self"}})
+		return err
+	},
+	"ec2:DescribeSnapshots": func(ctx context.Context, c types.EC2Client) error {
+		_, err := c.DescribeSnapshots(ctx, &ec2.DescribeSnapshotsInput{DryRun: aws.Bool(true), OwnerIds: []string{"self"}})
+		return err
+	},
+	"ec2:DescribeVolumes": func(ctx context.Context, c types.EC2Client) error {
+		_, err := c.DescribeVolumes(ctx, &ec2.DescribeVolumesInput{DryRun: aws.Bool(true)})
+		return err
+	},
+	"ec2:DescribeSubnets": func(ctx context.Context, c types.EC2Client) error {
+		_, err := c.DescribeSubnets(ctx, &ec2.DescribeSubnetsInput{DryRun: aws.Bool(true)})
+		return err
+	},
+	"ec2:DescribeInstanceTypes": func(ctx context.Context, c types.EC2Client) error {
+		_, err := c.DescribeInstanceTypes(ctx, &ec2.DescribeInstanceTypesInput{DryRun: aws.Bool(true)})
+		return err
+	},
+	"ec2:DescribeKeyPairs": func(ctx context.Context, c types.EC2Client) error {
+		_, err := c.DescribeKeyPairs(ctx, &ec2.DescribeKeyPairsInput{DryRun: aws.Bool(true)})
+		return err
+	},
+	"ec2:RunInstances": func(ctx context.Context, c types.EC2Client) error {
+		_, err := c.RunInstances(ctx, &ec2.RunInstancesInput{
+			DryRun:       aws.Bool(true),
+			ImageId:      aws.String(placeholderImage),
+			InstanceType: ec2types.InstanceTypeT3Micro,
+			MinCount:     aws.Int32(1),
+			MaxCount:     aws.Int32(1),
+		})
+		return err
+	},
+	"ec2:StartInstances": func(ctx context.Context, c types.EC2Client) error {
+		_, err := c.StartInstances(ctx, &ec2.StartInstancesInput{DryRun: aws.Bool(true), InstanceIds: []string{placeholderInstance}})
+		return err
+	},
+	"ec2:StopInstances": func(ctx context.Context, c types.EC2Client) error {
+		_, err := c.StopInstances(ctx, &ec2.StopInstancesInput{DryRun: aws.Bool(true), InstanceIds: []string{placeholderInstance}})
+		return err
+	},
+	"ec2:TerminateInstances": func(ctx context.Context, c types.EC2Client) error {
+		_, err := c.TerminateInstances(ctx, &ec2.TerminateInstancesInput{DryRun: aws.Bool(true), InstanceIds: []string{placeholderInstance}})
+		return err
+	},
+	"ec2:CancelSpotInstanceRequests": func(ctx context.Context, c types.EC2Client) error {
+		_, err := c.CancelSpotInstanceRequests(ctx, &ec2.CancelSpotInstanceRequestsInput{DryRun: aws.Bool(true), SpotInstanceRequestIds: []string{placeholderSpotRequest}})
+		return err
+	},
+	"ec2:DescribeInstanceAttribute": func(ctx context.Context, c types.EC2Client) error {
+		_, err := c.DescribeInstanceAttribute(ctx, &ec2.DescribeInstanceAttributeInput{
+			DryRun:     aws.Bool(true),
+			InstanceId: aws.String(placeholderInstance),
+			Attribute:  ec2types.InstanceAttributeNameDisableApiTermination,
+		})
+		return err
+	},
+	"ec2:ModifyInstanceAttribute": func(ctx context.Context, c types.EC2Client) error {
+		_, err := c.ModifyInstanceAttribute(ctx, &ec2.ModifyInstanceAttributeInput{
+			DryRun:                aws.Bool(true),
+			InstanceId:            aws.String(placeholderInstance),
+			DisableApiTermination: &ec2types.AttributeBooleanValue{Value: aws.Bool(true)},
+		})
+		return err
+	},
+	"ec2:CreateImage": func(ctx context.Context, c types.EC2Client) error {
+		_, err := c.CreateImage(ctx, &ec2.CreateImageInput{DryRun: aws.Bool(true), InstanceId: aws.String(placeholderInstance), Name: aws.String("ec-manager-permission-check")})
+		return err
+	},
+	"ec2:CreateTags": func(ctx context.Context, c types.EC2Client) error {
+		_, err := c.CreateTags(ctx, &ec2.CreateTagsInput{
+			DryRun:    aws.Bool(true),
+			Resources: []string{placeholderInstance},
+			Tags:      []ec2types.Tag{{Key: aws.String("ec-manager"), Value: aws.String("permission-check")}},
+		})
+		return err
+	},
+	"ec2:CreateVolume": func(ctx context.Context, c types.EC2Client) error {
+		_, err := c.CreateVolume(ctx, &ec2.CreateVolumeInput{DryRun: aws.Bool(true), SnapshotId: aws.String(placeholderSnapshot), AvailabilityZone: probeZone(ctx, c)})
+		return err
+	},
+	"ec2:AttachVolume": func(ctx context.Context, c types.EC2Client) error {
+		_, err := c.AttachVolume(ctx, &ec2.AttachVolumeInput{
+			DryRun:     aws.Bool(true),
+			InstanceId: aws.String(placeholderInstance),
+			VolumeId:   aws.String(placeholderVolume),
+			Device:     aws.String("/dev/sdf"),
+		})
+		return err
+	},
+	"ec2:CreateSnapshot": func(ctx context.Context, c types.EC2Client) error {
+		_, err := c.CreateSnapshot(ctx, &ec2.CreateSnapshotInput{DryRun: aws.Bool(true), VolumeId: aws.String(placeholderVolume)})
+		return err
+	},
+}
+
+// zoneLister is implemented by EC2 clients that can list availability
+// zones, such as the SDK client
+type zoneLister interface {
+	DescribeAvailabilityZones(ctx context.Context, params *ec2.DescribeAvailabilityZonesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeAvailabilityZonesOutput, error)
+}
+
+// probeZone returns the first available zone of the client's region, by
+// name. When the zones cannot be listed the zone is left out and EC2 reports
+// it missing, so the check is inconclusive rather than wrong.
+func probeZone(ctx context.Context, c types.EC2Client) *string {
+	lister, ok := c.(zoneLister)
+	if !ok {
+		return nil
+	}
+	out, err := lister.DescribeAvailabilityZones(ctx, &ec2.DescribeAvailabilityZonesInput{
+		Filters: []ec2types.Filter{{Name: aws.String("state"), Values: []string{"available"}}},
+	})
+	if err != nil {
+		return nil
+	}
+
+	var zones []string
+	for _, zone := range out.AvailabilityZones {
+		if name := aws.ToString(zone.ZoneName); name != "" {
+			zones = append(zones, name)
+		}
+	}
+	if len(zones) == 0 {
+		return nil
+	}
+	sort.Strings(zones)
+	return aws.String(zones[0])
+}
+
+// Checker checks actions for one identity
+type Checker struct {
+	ec2       types.EC2Client
+	iam       IAMAPI
+	principal string
+}
+
+// NewChecker creates a checker for the caller ARN returned by STS. The IAM
+// client may be nil to skip policy simulation.
+func NewChecker(ec2Client types.EC2Client, iamClient IAMAPI, callerARN string) *Checker {
+	return &Checker{ec2: ec2Client, iam: iamClient, principal: callerARN}
+}
+
+// Check checks every action and returns the results in the same order
+func (c *Checker) Check(ctx context.Context, actions []string) ([]Result, error) {
+	results := make([]Result, len(actions))
+	for i, action := range actions {
+		results[i] = Result{Action: action, DryRun: Skipped, Simulation: Skipped}
+		if probe, ok := dryRunProbes[action]; ok {
+			status, detail := dryRunStatus(probe(ctx, c.ec2))
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			results[i].DryRun = status
+			results[i].Detail = detail
+		}
+	}
+
+	decisions, err := c.simulate(ctx, actions)
+	for i := range results {
+		switch {
+		case err != nil:
+			results[i].Simulation = Unknown
+			if results[i].Detail == "" {
+				results[i].Detail = err.Error()
+			}
+		case decisions != nil:
+			if d, ok := decisions[actions[i]]; ok {
+				results[i].Simulation = simulationStatus(d)
+				if results[i].Simulation == Fail {
+					results[i].Detail = "simulation: " + d
+				}
+			}
+		}
+		results[i].Status = combine(results[i].DryRun, results[i].Simulation)
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return nil, ctxErr
+	}
+	return results, nil
+}
+
+// dryRunStatus interprets the error returned by a DryRun request
+func dryRunStatus(err error) (Status, string) {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		if err == nil {
+			return Unknown, "dry run returned no error"
+		}
+		return Unknown, err.Error()
+	}
+
+	switch apiErr.ErrorCode() {
+	case "DryRunOperation":
+		return Pass, ""
+	case "UnauthorizedOperation", "AccessDenied", "AuthFailure":
+		return Fail, "dry run: " + apiErr.ErrorCode()
+	default:
+		return Unknown, "dry run: " + apiErr.ErrorCode()
+	}
+}
+
+// simulationStatus maps an IAM evaluation decision to a status
+func simulationStatus(decision string) Status {
+	if decision == "allowed" {
+		return Pass
+	}
+	return Fail
+}
+
+// combine derives an action's status from both checks: any denial fails,
+// otherwise any pass passes
+func combine(dryRun, simulation Status) Status {
+	switch {
+	case dryRun == Fail || simulation == Fail:
+		return Fail
+	case dryRun == Pass || simulation == Pass:
+		return Pass
+	default:
+		return Unknown
+	}
+}
+
+// simulate runs the IAM policy simulator for the principal, returning the
+// decision for each action. It returns nil when simulation does not apply.
+func (c *Checker) simulate(ctx context.Context, actions []string) (map[string]string, error) {
+	if c.iam == nil || len(actions) == 0 {
+		return nil, nil
+	}
+
+	source, err := c.policySource(ctx)
+	if err != nil || source == "" {
+		return nil, err
+	}
+
+	decisions := make(map[string]string, len(actions))
+	paginator := iam.NewSimulatePrincipalPolicyPaginator(c.iam, &iam.SimulatePrincipalPolicyInput{
+		PolicySourceArn: aws.String(source),
+		ActionNames:     actions,
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to simulate policies: %w", err)
+		}
+		for _, r := range page.EvaluationResults {
+			decisions[aws.ToString(r.EvalActionName)] = string(r.EvalDecision)
+		}
+	}
+	return decisions, nil
+}
+
+// policySource returns the IAM user or role whose policies are simulated.
+// Assumed-role sessions are resolved to their role, including its path.
+// The account root user cannot be simulated and always has every permission.
+func (c *Checker) policySource(ctx context.Context) (string, error) {
+	parts := strings.SplitN(c.principal, ":", 6)
+	if len(parts) != 6 {
+		return "", fmt.Errorf("invalid caller ARN %q", c.principal)
+	}
+
+	resource := parts[5]
+	switch {
+	case resource == "root":
+		return "", nil
+	case parts[2] == "sts" && strings.HasPrefix(resource, "assumed-role/"):
+		name := strings.Split(resource, "/")[1]
+		out, err := c.iam.GetRole(ctx, &iam.GetRoleInput{RoleName: aws.String(name)})
+		if err != nil {
+			return "", fmt.Errorf("failed to get role %s: %w", name, err)
+		}
+		return aws.ToString(out.Role.Arn), nil
+	default:
+		return c.principal, nil
+	}
+}
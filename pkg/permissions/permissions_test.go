@@ -0,0 +1,186 @@
+package permissions
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	iamtypes "github.com/aws/aws-sdk-go-v2/service/iam/types"
+	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	mockclient "github.com/taemon1337/ec-manager/pkg/mock"
+	"github.com/taemon1337/ec-manager/pkg/types"
+)
+
+// dryRunEC2 answers DryRun requests with a fixed error code per action
+type dryRunEC2 struct {
+	types.EC2Client
+	codes map[string]string
+}
+
+func (c *dryRunEC2) answer(action string) error {
+	return &smithy.GenericAPIError{Code: c.codes[action]}
+}
+
+func (c *dryRunEC2) DescribeInstances(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	return nil, c.answer("ec2:DescribeInstances")
+}
+
+func (c *dryRunEC2) StopInstances(ctx context.Context, params *ec2.StopInstancesInput, optFns ...func(*ec2.Options)) (*ec2.StopInstancesOutput, error) {
+	return nil, c.answer("ec2:StopInstances")
+}
+
+func (c *dryRunEC2) TerminateInstances(ctx context.Context, params *ec2.TerminateInstancesInput, optFns ...func(*ec2.Options)) (*ec2.TerminateInstancesOutput, error) {
+	return nil, c.answer("ec2:TerminateInstances")
+}
+
+func simulation(decisions map[string]iamtypes.PolicyEvaluationDecisionType) *iam.SimulatePrincipalPolicyOutput {
+	out := &iam.SimulatePrincipalPolicyOutput{}
+	for action, decision := range decisions {
+		out.EvaluationResults = append(out.EvaluationResults, iamtypes.EvaluationResult{
+			EvalActionName: aws.String(action),
+			EvalDecision:   decision,
+		})
+	}
+	return out
+}
+
+func TestCommands(t *testing.T) {
+	for _, name := range CommandNames() {
+		for _, action := range Commands[name] {
+			if _, ok := dryRunProbes[action]; !ok {
+				assert.NotContains(t, action, "ec2:", "%s: EC2 action %s has no dry run probe", name, action)
+			}
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	ec2Client := &dryRunEC2{codes: map[string]string{
+		"ec2:DescribeInstances":  "DryRunOperation",
+		"ec2:StopInstances":      "UnauthorizedOperation",
+		"ec2:TerminateInstances": "InvalidInstanceID.NotFound",
+	}}
+	actions := []string{"ec2:DescribeInstances", "ec2:StopInstances", "ec2:TerminateInstances", "sts:AssumeRole"}
+
+	tests := []struct {
+		name       string
+		callerARN  string
+		setup      func(*mockclient.MockIAMClient)
+		noSimulate bool
+		expected   []Status
+	}{
+		{
+			name:      "user simulated",
+			callerARN: "arn:aws:iam::123456789012:user/ci",
+			setup: func(m *mockclient.MockIAMClient) {
+				m.On("SimulatePrincipalPolicy", mock.Anything, mock.MatchedBy(func(in *iam.SimulatePrincipalPolicyInput) bool {
+					return aws.ToString(in.PolicySourceArn) == "arn:aws:iam::123456789012:user/ci" && len(in.ActionNames) == 4
+				}), mock.Anything).Return(simulation(map[string]iamtypes.PolicyEvaluationDecisionType{
+					"ec2:DescribeInstances":  iamtypes.PolicyEvaluationDecisionTypeAllowed,
+					"ec2:StopInstances":      iamtypes.PolicyEvaluationDecisionTypeAllowed,
+					"ec2:TerminateInstances": iamtypes.PolicyEvaluationDecisionTypeImplicitDeny,
+					"sts:AssumeRole":         iamtypes.PolicyEvaluationDecisionTypeAllowed,
+				}), nil)
+			},
+			expected: []Status{Pass, Fail, Fail, Pass},
+		},
+		{
+			name:      "assumed role resolved to role",
+			callerARN: "arn:aws:sts::123456789012:assumed-role/deploy/session",
+			setup: func(m *mockclient.MockIAMClient) {
+				m.On("GetRole", mock.Anything, mock.MatchedBy(func(in *iam.GetRoleInput) bool {
+					return aws.ToString(in.RoleName) == "deploy"
+				}), mock.Anything).Return(&iam.GetRoleOutput{
+					Role: &iamtypes.Role{Arn: aws.String("arn:aws:iam::123456789012:role/ci/deploy")},
+				}, nil)
+				m.On("SimulatePrincipalPolicy", mock.Anything, mock.MatchedBy(func(in *iam.SimulatePrincipalPolicyInput) bool {
+					return aws.ToString(in.PolicySourceArn) == "arn:aws:iam::123456789012:role/ci/deploy"
+				}), mock.Anything).Return(simulation(map[string]iamtypes.PolicyEvaluationDecisionType{
+					"ec2:DescribeInstances":  iamtypes.PolicyEvaluationDecisionTypeAllowed,
+					"ec2:StopInstances":      iamtypes.PolicyEvaluationDecisionTypeImplicitDeny,
+					"ec2:TerminateInstances": iamtypes.PolicyEvaluationDecisionTypeAllowed,
+					"sts:AssumeRole":         iamtypes.PolicyEvaluationDecisionTypeExplicitDeny,
+				}), nil)
+			},
+			expected: []Status{Pass, Fail, Pass, Fail},
+		},
+		{
+			name:      "simulation denied",
+			callerARN: "arn:aws:iam::123456789012:user/ci",
+			setup: func(m *mockclient.MockIAMClient) {
+				m.On("SimulatePrincipalPolicy", mock.Anything, mock.Anything, mock.Anything).
+					Return(nil, errors.New("AccessDenied"))
+			},
+			expected: []Status{Pass, Fail, Unknown, Unknown},
+		},
+		{
+			name:       "dry run only",
+			callerARN:  "arn:aws:iam::123456789012:user/ci",
+			noSimulate: true,
+			expected:   []Status{Pass, Fail, Unknown, Unknown},
+		},
+		{
+			name:      "account root is not simulated",
+			callerARN: "arn:aws:iam::123456789012:root",
+			expected:  []Status{Pass, Fail, Unknown, Unknown},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			iamClient := mockclient.NewMockIAMClient(t)
+			if tt.setup != nil {
+				tt.setup(iamClient)
+			}
+
+			var simulator IAMAPI = iamClient
+			if tt.noSimulate {
+				simulator = nil
+			}
+			results, err := NewChecker(ec2Client, simulator, tt.callerARN).Check(context.Background(), actions)
+			require.NoError(t, err)
+			require.Len(t, results, len(actions))
+
+			for i, r := range results {
+				assert.Equal(t, actions[i], r.Action)
+				assert.Equal(t, tt.expected[i], r.Status, "%s: %+v", r.Action, r)
+			}
+			assert.Equal(t, Skipped, results[3].DryRun)
+			iamClient.AssertExpectations(t)
+		})
+	}
+}
+
+// zonesEC2 lists availability zones
+type zonesEC2 struct {
+	types.EC2Client
+	zones []string
+	err   error
+}
+
+func (c zonesEC2) DescribeAvailabilityZones(ctx context.Context, params *ec2.DescribeAvailabilityZonesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeAvailabilityZonesOutput, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	out := &ec2.DescribeAvailabilityZonesOutput{}
+	for _, zone := range c.zones {
+		out.AvailabilityZones = append(out.AvailabilityZones, ec2types.AvailabilityZone{ZoneName: aws.String(zone)})
+	}
+	return out, nil
+}
+
+func TestProbeZone(t *testing.T) {
+	ctx := context.Background()
+	// Not every region has an "a" zone, so the zone is looked up
+	assert.Equal(t, "us-east-1b", aws.ToString(probeZone(ctx, zonesEC2{zones: []string{"us-east-1c", "us-east-1b"}})))
+	assert.Nil(t, probeZone(ctx, zonesEC2{}))
+	assert.Nil(t, probeZone(ctx, zonesEC2{err: errors.New("UnauthorizedOperation")}))
+	assert.Nil(t, probeZone(ctx, &dryRunEC2{}))
+}
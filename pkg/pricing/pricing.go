@@ -0,0 +1,198 @@
+// Package pricing estimates the monthly cost of EC2 instances and snapshot
+// storage from a table of Linux on-demand prices
+package pricing
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// HoursPerMonth is the number of hours a month is billed as
+const HoursPerMonth = 730
+
+// EnvPricingPath overrides the location of the refreshed price table
+const EnvPricingPath = "ECMAN_PRICING"
+
+// ErrNoPrice is returned when the table has no price for a region or type
+var ErrNoPrice = errors.New("no price")
+
+// prices is the table shipped with ec-manager
+//
+//go:embed prices.json
+var prices []byte
+
+// Table holds Linux on-demand prices per region
+type Table struct {
+	// Updated is the date the prices were read, e.g. 2024-03-01
+	Updated  string `json:"updated"`
+	Currency string `json:"currency"`
+	// SpotFactor is the fraction of the on-demand price Spot capacity is
+	// estimated at, as Spot prices change continuously
+	SpotFactor float64                 `json:"spotFactor"`
+	Regions    map[string]RegionPrices `json:"regions"`
+}
+
+// RegionPrices are the prices of one region
+type RegionPrices struct {
+	// Updated is the date the region's prices were refreshed, when they
+	// are newer than the table's
+	Updated string `json:"updated,omitempty"`
+	// Instances are hourly prices by instance type
+	Instances map[string]float64 `json:"instances"`
+	// SnapshotGBMonth is the price of a GB-month of EBS snapshot storage
+	SnapshotGBMonth float64 `json:"snapshotGbMonth"`
+}
+
+// Default returns the price table shipped with ec-manager
+func Default() (*Table, error) {
+	return Parse(prices)
+}
+
+// Parse parses a JSON price table
+func Parse(data []byte) (*Table, error) {
+	t := &Table{}
+	if err := json.Unmarshal(data, t); err != nil {
+		return nil, fmt.Errorf("failed to parse price table: %w", err)
+	}
+	if t.Regions == nil {
+		t.Regions = map[string]RegionPrices{}
+	}
+	return t, nil
+}
+
+// Load returns the shipped table with the regions of the refreshed table at
+// path replacing its own
+func Load(path string) (*Table, error) {
+	t, err := Default()
+	if err != nil {
+		return nil, err
+	}
+	refreshed, err := LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	t.Merge(refreshed)
+	return t, nil
+}
+
+// LoadFile reads the refreshed price table at path. A missing file is not
+// an error and yields an empty table.
+func LoadFile(path string) (*Table, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Table{Regions: map[string]RegionPrices{}}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read price table: %w", err)
+	}
+	t, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return t, nil
+}
+
+// Merge replaces the prices of every region in other, dating them with
+// other's date unless they have their own
+func (t *Table) Merge(other *Table) {
+	for region, p := range other.Regions {
+		if p.Updated == "" {
+			p.Updated = other.Updated
+		}
+		t.Regions[region] = p
+	}
+	if t.Currency == "" {
+		t.Currency = other.Currency
+	}
+	if t.SpotFactor == 0 {
+		t.SpotFactor = other.SpotFactor
+	}
+}
+
+// UpdatedFor returns the date of the prices of region
+func (t *Table) UpdatedFor(region string) string {
+	if p, ok := t.Regions[region]; ok && p.Updated != "" {
+		return p.Updated
+	}
+	return t.Updated
+}
+
+// Save writes the table to path as JSON
+func (t *Table) Save(path string) error {
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode price table: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create price table directory: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write price table: %w", err)
+	}
+	return nil
+}
+
+// DefaultPath returns the refreshed price table location, honouring
+// ECMAN_PRICING and XDG_CACHE_HOME before ~/.cache/ec-manager/pricing.json
+func DefaultPath() (string, error) {
+	if path := os.Getenv(EnvPricingPath); path != "" {
+		return path, nil
+	}
+
+	dir := os.Getenv("XDG_CACHE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("unable to get home directory: %w", err)
+		}
+		dir = filepath.Join(home, ".cache")
+	}
+
+	return filepath.Join(dir, "ec-manager", "pricing.json"), nil
+}
+
+// RegionNames returns the regions with prices, sorted
+func (t *Table) RegionNames() []string {
+	names := make([]string, 0, len(t.Regions))
+	for name := range t.Regions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// InstanceMonthly estimates the monthly cost of running an instance of
+// instanceType in region, on Spot capacity when spot is set. maxPrice, the
+// hourly Spot limit, caps the Spot estimate when it is positive.
+func (t *Table) InstanceMonthly(region, instanceType string, spot bool, maxPrice float64) (float64, error) {
+	p, ok := t.Regions[region]
+	if !ok {
+		return 0, fmt.Errorf("%w for region %s", ErrNoPrice, region)
+	}
+	hourly, ok := p.Instances[instanceType]
+	if !ok {
+		return 0, fmt.Errorf("%w for %s in %s", ErrNoPrice, instanceType, region)
+	}
+	if spot {
+		hourly *= t.SpotFactor
+		if maxPrice > 0 && maxPrice < hourly {
+			hourly = maxPrice
+		}
+	}
+	return hourly * HoursPerMonth, nil
+}
+
+// SnapshotMonthly estimates the monthly cost of storing gib GiB of
+// snapshots in region
+func (t *Table) SnapshotMonthly(region string, gib int64) (float64, error) {
+	p, ok := t.Regions[region]
+	if !ok || p.SnapshotGBMonth == 0 {
+		return 0, fmt.Errorf("%w for snapshots in %s", ErrNoPrice, region)
+	}
+	return float64(gib) * p.SnapshotGBMonth, nil
+}
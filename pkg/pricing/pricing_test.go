@@ -0,0 +1,118 @@
+package pricing
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testTable() *Table {
+	return &Table{
+		Updated:    "2024-03-01",
+		Currency:   "USD",
+		SpotFactor: 0.35,
+		Regions: map[string]RegionPrices{
+			"us-east-1": {
+				Instances:       map[string]float64{"t3.micro": 0.0104, "m5.large": 0.096},
+				SnapshotGBMonth: 0.05,
+			},
+			"eu-west-1": {Instances: map[string]float64{"t3.micro": 0.0114}},
+		},
+	}
+}
+
+func TestDefault(t *testing.T) {
+	table, err := Default()
+	require.NoError(t, err)
+	assert.Equal(t, "USD", table.Currency)
+	assert.Greater(t, table.SpotFactor, 0.0)
+	assert.Contains(t, table.RegionNames(), "us-east-1")
+
+	monthly, err := table.InstanceMonthly("us-east-1", "t3.micro", false, 0)
+	require.NoError(t, err)
+	assert.Greater(t, monthly, 0.0)
+}
+
+func TestInstanceMonthly(t *testing.T) {
+	tests := []struct {
+		name         string
+		region       string
+		instanceType string
+		spot         bool
+		maxPrice     float64
+		want         float64
+		wantErr      string
+	}{
+		{name: "on-demand", region: "us-east-1", instanceType: "m5.large", want: 0.096 * HoursPerMonth},
+		{name: "spot", region: "us-east-1", instanceType: "m5.large", spot: true, want: 0.096 * 0.35 * HoursPerMonth},
+		{name: "spot capped by max price", region: "us-east-1", instanceType: "m5.large", spot: true, maxPrice: 0.02, want: 0.02 * HoursPerMonth},
+		{name: "max price above estimate", region: "us-east-1", instanceType: "m5.large", spot: true, maxPrice: 0.5, want: 0.096 * 0.35 * HoursPerMonth},
+		{name: "max price ignored on-demand", region: "us-east-1", instanceType: "m5.large", maxPrice: 0.02, want: 0.096 * HoursPerMonth},
+		{name: "unknown type", region: "us-east-1", instanceType: "x9.huge", wantErr: "no price for x9.huge in us-east-1"},
+		{name: "unknown region", region: "ap-south-1", instanceType: "t3.micro", wantErr: "no price for region ap-south-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := testTable().InstanceMonthly(tt.region, tt.instanceType, tt.spot, tt.maxPrice)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				assert.ErrorIs(t, err, ErrNoPrice)
+				return
+			}
+			require.NoError(t, err)
+			assert.InDelta(t, tt.want, got, 1e-9)
+		})
+	}
+}
+
+func TestSnapshotMonthly(t *testing.T) {
+	got, err := testTable().SnapshotMonthly("us-east-1", 100)
+	require.NoError(t, err)
+	assert.InDelta(t, 5.0, got, 1e-9)
+
+	_, err = testTable().SnapshotMonthly("eu-west-1", 100)
+	assert.EqualError(t, err, "no price for snapshots in eu-west-1")
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ec-manager", "pricing.json")
+
+	// A missing file leaves the shipped prices
+	table, err := Load(path)
+	require.NoError(t, err)
+	shipped, err := Default()
+	require.NoError(t, err)
+	assert.Equal(t, shipped, table)
+
+	refreshed := &Table{
+		Updated:  "2024-06-01",
+		Currency: "USD",
+		Regions: map[string]RegionPrices{
+			"us-east-1": {Instances: map[string]float64{"t3.micro": 0.01}, SnapshotGBMonth: 0.05},
+		},
+	}
+	require.NoError(t, refreshed.Save(path))
+
+	table, err = Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{"t3.micro": 0.01}, table.Regions["us-east-1"].Instances)
+	assert.Equal(t, "2024-06-01", table.UpdatedFor("us-east-1"))
+	assert.Equal(t, shipped.Updated, table.UpdatedFor("us-west-2"))
+	assert.Equal(t, shipped.Regions["us-west-2"], table.Regions["us-west-2"])
+}
+
+func TestDefaultPath(t *testing.T) {
+	t.Setenv(EnvPricingPath, "")
+	t.Setenv("XDG_CACHE_HOME", "/cache")
+	path, err := DefaultPath()
+	require.NoError(t, err)
+	assert.Equal(t, "/cache/ec-manager/pricing.json", path)
+
+	t.Setenv(EnvPricingPath, "/etc/prices.json")
+	path, err = DefaultPath()
+	require.NoError(t, err)
+	assert.Equal(t, "/etc/prices.json", path)
+}
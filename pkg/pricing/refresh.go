@@ -0,0 +1,152 @@
+package pricing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/pricing"
+	"github.com/aws/aws-sdk-go-v2/service/pricing/types"
+)
+
+// APIRegion is the region the Pricing API is called in
+const APIRegion = "us-east-1"
+
+// API is the AWS Pricing API used to refresh prices
+type API interface {
+	GetProducts(ctx context.Context, params *pricing.GetProductsInput, optFns ...func(*pricing.Options)) (*pricing.GetProductsOutput, error)
+}
+
+// product is the part of a Pricing API price list entry that is read
+type product struct {
+	Product struct {
+		Attributes struct {
+			InstanceType string `json:"instanceType"`
+			UsageType    string `json:"usagetype"`
+		} `json:"attributes"`
+	} `json:"product"`
+	Terms struct {
+		OnDemand map[string]struct {
+			PriceDimensions map[string]struct {
+				Unit         string            `json:"unit"`
+				PricePerUnit map[string]string `json:"pricePerUnit"`
+			} `json:"priceDimensions"`
+		} `json:"OnDemand"`
+	} `json:"terms"`
+}
+
+// price returns the on-demand price per unit in USD
+func (p product) price(unit string) (float64, bool) {
+	for _, term := range p.Terms.OnDemand {
+		for _, dim := range term.PriceDimensions {
+			if dim.Unit != unit {
+				continue
+			}
+			price, err := strconv.ParseFloat(dim.PricePerUnit["USD"], 64)
+			if err == nil && price > 0 {
+				return price, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// Refresh reads the current Linux on-demand instance and snapshot storage
+// prices of regions from the Pricing API
+func Refresh(ctx context.Context, api API, regions []string, spotFactor float64) (*Table, error) {
+	updated := time.Now().UTC().Format("2006-01-02")
+	t := &Table{
+		Updated:    updated,
+		Currency:   "USD",
+		SpotFactor: spotFactor,
+		Regions:    map[string]RegionPrices{},
+	}
+
+	for _, region := range regions {
+		p := RegionPrices{Updated: updated, Instances: map[string]float64{}}
+
+		err := eachProduct(ctx, api, map[string]string{
+			"regionCode":      region,
+			"productFamily":   "Compute Instance",
+			"operatingSystem": "Linux",
+			"tenancy":         "Shared",
+			"preInstalledSw":  "NA",
+			"capacitystatus":  "Used",
+			"licenseModel":    "No License required",
+		}, func(pr product) {
+			if price, ok := pr.price("Hrs"); ok && pr.Product.Attributes.InstanceType != "" {
+				p.Instances[pr.Product.Attributes.InstanceType] = price
+			}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get instance prices for %s: %w", region, err)
+		}
+
+		err = eachProduct(ctx, api, map[string]string{
+			"regionCode":    region,
+			"productFamily": "Storage Snapshot",
+		}, func(pr product) {
+			if !strings.HasSuffix(pr.Product.Attributes.UsageType, "EBS:SnapshotUsage") {
+				return
+			}
+			if price, ok := pr.price("GB-Mo"); ok {
+				p.SnapshotGBMonth = price
+			}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get snapshot prices for %s: %w", region, err)
+		}
+
+		if len(p.Instances) == 0 {
+			return nil, fmt.Errorf("no instance prices found for region %s", region)
+		}
+		t.Regions[region] = p
+	}
+	return t, nil
+}
+
+// eachProduct calls fn for every AmazonEC2 product matching the attributes
+func eachProduct(ctx context.Context, api API, attributes map[string]string, fn func(product)) error {
+	input := &pricing.GetProductsInput{
+		ServiceCode:   aws.String("AmazonEC2"),
+		FormatVersion: aws.String("aws_v1"),
+	}
+	for _, field := range sortedKeys(attributes) {
+		input.Filters = append(input.Filters, types.Filter{
+			Field: aws.String(field),
+			Type:  types.FilterTypeTermMatch,
+			Value: aws.String(attributes[field]),
+		})
+	}
+
+	paginator := pricing.NewGetProductsPaginator(api, input)
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, entry := range page.PriceList {
+			var pr product
+			if err := json.Unmarshal([]byte(entry), &pr); err != nil {
+				return fmt.Errorf("failed to parse price list: %w", err)
+			}
+			fn(pr)
+		}
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,65 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/pricing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// pricingAPI returns fixed price lists per product family
+type pricingAPI struct {
+	priceLists map[string][]string
+	err        error
+	inputs     []*pricing.GetProductsInput
+}
+
+func (p *pricingAPI) GetProducts(ctx context.Context, params *pricing.GetProductsInput, optFns ...func(*pricing.Options)) (*pricing.GetProductsOutput, error) {
+	p.inputs = append(p.inputs, params)
+	if p.err != nil {
+		return nil, p.err
+	}
+	for _, f := range params.Filters {
+		if aws.ToString(f.Field) == "productFamily" {
+			return &pricing.GetProductsOutput{PriceList: p.priceLists[aws.ToString(f.Value)]}, nil
+		}
+	}
+	return &pricing.GetProductsOutput{}, nil
+}
+
+func TestRefresh(t *testing.T) {
+	api := &pricingAPI{priceLists: map[string][]string{
+		"Compute Instance": {
+			`{"product":{"attributes":{"instanceType":"t3.micro"}},"terms":{"OnDemand":{"A":{"priceDimensions":{"B":{"unit":"Hrs","pricePerUnit":{"USD":"0.0104000000"}}}}}}}`,
+			`{"product":{"attributes":{"instanceType":"m5.large"}},"terms":{"OnDemand":{"A":{"priceDimensions":{"B":{"unit":"Hrs","pricePerUnit":{"USD":"0.0960000000"}}}}}}}`,
+			`{"product":{"attributes":{"instanceType":"m5.xlarge"}},"terms":{"OnDemand":{"A":{"priceDimensions":{"B":{"unit":"Hrs","pricePerUnit":{"USD":"0.0000000000"}}}}}}}`,
+		},
+		"Storage Snapshot": {
+			`{"product":{"attributes":{"usagetype":"EBS:SnapshotArchiveStorage"}},"terms":{"OnDemand":{"A":{"priceDimensions":{"B":{"unit":"GB-Mo","pricePerUnit":{"USD":"0.0125"}}}}}}}`,
+			`{"product":{"attributes":{"usagetype":"EBS:SnapshotUsage"}},"terms":{"OnDemand":{"A":{"priceDimensions":{"B":{"unit":"GB-Mo","pricePerUnit":{"USD":"0.05"}}}}}}}`,
+		},
+	}}
+
+	table, err := Refresh(context.Background(), api, []string{"us-east-1"}, 0.35)
+	require.NoError(t, err)
+	assert.Equal(t, 0.35, table.SpotFactor)
+	assert.Equal(t, table.Updated, table.Regions["us-east-1"].Updated)
+	assert.Equal(t, map[string]float64{"t3.micro": 0.0104, "m5.large": 0.096}, table.Regions["us-east-1"].Instances)
+	assert.Equal(t, 0.05, table.Regions["us-east-1"].SnapshotGBMonth)
+
+	require.Len(t, api.inputs, 2)
+	assert.Equal(t, "AmazonEC2", aws.ToString(api.inputs[0].ServiceCode))
+	assert.Len(t, api.inputs[0].Filters, 7)
+}
+
+func TestRefreshErrors(t *testing.T) {
+	_, err := Refresh(context.Background(), &pricingAPI{err: errors.New("AccessDeniedException")}, []string{"us-east-1"}, 0.35)
+	assert.EqualError(t, err, "failed to get instance prices for us-east-1: AccessDeniedException")
+
+	_, err = Refresh(context.Background(), &pricingAPI{}, []string{"xx-nowhere-1"}, 0.35)
+	assert.EqualError(t, err, "no instance prices found for region xx-nowhere-1")
+}
@@ -0,0 +1,125 @@
+package rightsize
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// Utilization summarizes an instance's CPU and network use over a window
+type Utilization struct {
+	// CPUAverage and CPUMax are percentages of the instance's vCPUs
+	CPUAverage float64 `json:"cpuAverage"`
+	CPUMax     float64 `json:"cpuMax"`
+	// NetworkPeakBytes is the highest hourly average of bytes per second
+	// in either direction
+	NetworkPeakBytes float64 `json:"networkPeakBytesPerSecond"`
+	// Datapoints is the number of CPU datapoints the summary is based on
+	Datapoints int `json:"datapoints"`
+}
+
+// HasData reports whether there were any datapoints in the window
+func (u Utilization) HasData() bool {
+	return u.Datapoints > 0
+}
+
+// MetricsSource reports the utilization of an instance between start and end
+type MetricsSource interface {
+	Utilization(ctx context.Context, instanceID string, start, end time.Time) (Utilization, error)
+}
+
+// StaticSource is a MetricsSource with fixed utilization per instance ID.
+// Instances it does not know have no data.
+type StaticSource map[string]Utilization
+
+// Utilization implements MetricsSource
+func (s StaticSource) Utilization(ctx context.Context, instanceID string, start, end time.Time) (Utilization, error) {
+	return s[instanceID], nil
+}
+
+// CloudWatchAPI is the CloudWatch API used to read instance metrics
+type CloudWatchAPI interface {
+	GetMetricStatistics(ctx context.Context, params *cloudwatch.GetMetricStatisticsInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.GetMetricStatisticsOutput, error)
+}
+
+// CloudWatch limits GetMetricStatistics to this many datapoints per call
+const maxDatapoints = 1440
+
+// defaultPeriod is the metric period in seconds for short windows
+const defaultPeriod int32 = 3600
+
+// CloudWatchSource reads the AWS/EC2 metrics of instances from CloudWatch
+type CloudWatchSource struct {
+	client CloudWatchAPI
+}
+
+// NewCloudWatchSource creates a metrics source using the CloudWatch client
+func NewCloudWatchSource(client CloudWatchAPI) *CloudWatchSource {
+	return &CloudWatchSource{client: client}
+}
+
+// Utilization implements MetricsSource with hourly CPUUtilization,
+// NetworkIn and NetworkOut statistics. Longer windows use longer periods to
+// stay within the datapoint limit.
+func (s *CloudWatchSource) Utilization(ctx context.Context, instanceID string, start, end time.Time) (Utilization, error) {
+	period := metricPeriod(start, end)
+
+	cpu, err := s.statistics(ctx, instanceID, "CPUUtilization", start, end, period, cwtypes.StatisticAverage, cwtypes.StatisticMaximum)
+	if err != nil {
+		return Utilization{}, err
+	}
+	var u Utilization
+	var total float64
+	for _, dp := range cpu {
+		total += aws.ToFloat64(dp.Average)
+		u.CPUMax = math.Max(u.CPUMax, aws.ToFloat64(dp.Maximum))
+	}
+	u.Datapoints = len(cpu)
+	if u.Datapoints > 0 {
+		u.CPUAverage = total / float64(u.Datapoints)
+	}
+
+	for _, metric := range []string{"NetworkIn", "NetworkOut"} {
+		datapoints, err := s.statistics(ctx, instanceID, metric, start, end, period, cwtypes.StatisticSum)
+		if err != nil {
+			return Utilization{}, err
+		}
+		for _, dp := range datapoints {
+			u.NetworkPeakBytes = math.Max(u.NetworkPeakBytes, aws.ToFloat64(dp.Sum)/float64(period))
+		}
+	}
+	return u, nil
+}
+
+// statistics returns the datapoints of one AWS/EC2 metric of an instance
+func (s *CloudWatchSource) statistics(ctx context.Context, instanceID, metric string, start, end time.Time, period int32, stats ...cwtypes.Statistic) ([]cwtypes.Datapoint, error) {
+	out, err := s.client.GetMetricStatistics(ctx, &cloudwatch.GetMetricStatisticsInput{
+		Namespace:  aws.String("AWS/EC2"),
+		MetricName: aws.String(metric),
+		Dimensions: []cwtypes.Dimension{{Name: aws.String("InstanceId"), Value: aws.String(instanceID)}},
+		StartTime:  aws.Time(start),
+		EndTime:    aws.Time(end),
+		Period:     aws.Int32(period),
+		Statistics: stats,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get %s of %s: %w", metric, instanceID, err)
+	}
+	return out.Datapoints, nil
+}
+
+// metricPeriod returns the shortest whole number of hours that covers the
+// window in at most maxDatapoints periods
+func metricPeriod(start, end time.Time) int32 {
+	hours := int64(math.Ceil(end.Sub(start).Hours()))
+	periods := (hours + maxDatapoints - 1) / maxDatapoints
+	if periods < 1 {
+		periods = 1
+	}
+	return defaultPeriod * int32(periods)
+}
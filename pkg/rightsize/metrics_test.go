@@ -0,0 +1,72 @@
+package rightsize
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// cloudWatchAPI returns fixed datapoints per metric name
+type cloudWatchAPI struct {
+	datapoints map[string][]cwtypes.Datapoint
+	err        error
+	inputs     []*cloudwatch.GetMetricStatisticsInput
+}
+
+func (c *cloudWatchAPI) GetMetricStatistics(ctx context.Context, params *cloudwatch.GetMetricStatisticsInput, optFns ...func(*cloudwatch.Options)) (*cloudwatch.GetMetricStatisticsOutput, error) {
+	c.inputs = append(c.inputs, params)
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &cloudwatch.GetMetricStatisticsOutput{Datapoints: c.datapoints[aws.ToString(params.MetricName)]}, nil
+}
+
+func TestCloudWatchSourceUtilization(t *testing.T) {
+	api := &cloudWatchAPI{datapoints: map[string][]cwtypes.Datapoint{
+		"CPUUtilization": {
+			{Average: aws.Float64(10), Maximum: aws.Float64(40)},
+			{Average: aws.Float64(20), Maximum: aws.Float64(35)},
+		},
+		"NetworkIn":  {{Sum: aws.Float64(3600 * 1000)}},
+		"NetworkOut": {{Sum: aws.Float64(3600 * 5000)}, {Sum: aws.Float64(3600 * 2000)}},
+	}}
+	end := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	start := end.AddDate(0, 0, -14)
+
+	u, err := NewCloudWatchSource(api).Utilization(context.Background(), "i-1", start, end)
+	require.NoError(t, err)
+	assert.Equal(t, Utilization{CPUAverage: 15, CPUMax: 40, NetworkPeakBytes: 5000, Datapoints: 2}, u)
+
+	require.Len(t, api.inputs, 3)
+	in := api.inputs[0]
+	assert.Equal(t, "AWS/EC2", aws.ToString(in.Namespace))
+	assert.Equal(t, "i-1", aws.ToString(in.Dimensions[0].Value))
+	assert.Equal(t, int32(3600), aws.ToInt32(in.Period))
+	assert.Equal(t, []cwtypes.Statistic{cwtypes.StatisticAverage, cwtypes.StatisticMaximum}, in.Statistics)
+
+	_, err = NewCloudWatchSource(&cloudWatchAPI{err: errors.New("throttled")}).Utilization(context.Background(), "i-1", start, end)
+	assert.EqualError(t, err, "failed to get CPUUtilization of i-1: throttled")
+}
+
+func TestMetricPeriod(t *testing.T) {
+	end := time.Now()
+	tests := []struct {
+		days     int
+		expected int32
+	}{
+		{days: 1, expected: 3600},
+		{days: 60, expected: 3600},
+		{days: 61, expected: 7200},
+		{days: 365, expected: 7 * 3600},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, metricPeriod(end.AddDate(0, 0, -tt.days), end), "%d days", tt.days)
+	}
+}
@@ -0,0 +1,227 @@
+// Package rightsize recommends instance types from instance utilization
+package rightsize
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// Defaults for Options
+const (
+	DefaultTargetCPU      = 70.0
+	DefaultMinMemoryRatio = 0.5
+)
+
+// Options tune recommendations
+type Options struct {
+	// TargetCPU is the peak CPU utilization percentage a recommended type
+	// should run at
+	TargetCPU float64
+	// MinMemoryRatio is the smallest fraction of the current memory a
+	// recommended type keeps. CloudWatch does not report memory use, so
+	// types are shrunk at most this far in one step.
+	MinMemoryRatio float64
+}
+
+func (o Options) withDefaults() Options {
+	if o.TargetCPU <= 0 {
+		o.TargetCPU = DefaultTargetCPU
+	}
+	if o.MinMemoryRatio <= 0 {
+		o.MinMemoryRatio = DefaultMinMemoryRatio
+	}
+	return o
+}
+
+// Validate checks the options
+func (o Options) Validate() error {
+	if o.TargetCPU < 0 || o.TargetCPU > 100 {
+		return fmt.Errorf("invalid target CPU %.0f%%, expected a percentage between 1 and 100", o.TargetCPU)
+	}
+	if o.MinMemoryRatio < 0 || o.MinMemoryRatio > 1 {
+		return fmt.Errorf("invalid memory ratio %g, expected a fraction between 0 and 1", o.MinMemoryRatio)
+	}
+	return nil
+}
+
+// Recommendation is the recommended type for one instance. RecommendedType
+// is empty when the instance should keep its type.
+type Recommendation struct {
+	InstanceID      string      `json:"instanceId"`
+	Name            string      `json:"name,omitempty"`
+	ImageID         string      `json:"imageId,omitempty"`
+	CurrentType     string      `json:"currentType"`
+	RecommendedType string      `json:"recommendedType,omitempty"`
+	Reason          string      `json:"reason"`
+	Utilization     Utilization `json:"utilization"`
+}
+
+// TypeLister lists instance type descriptions, e.g. ami.Service
+type TypeLister interface {
+	ListInstanceTypes(ctx context.Context, input *ec2.DescribeInstanceTypesInput) ([]ec2types.InstanceTypeInfo, error)
+}
+
+// Recommender recommends instance types from utilization metrics
+type Recommender struct {
+	types   TypeLister
+	metrics MetricsSource
+	opts    Options
+	// families caches the type specs of each class and architecture
+	families map[string][]TypeSpec
+}
+
+// NewRecommender creates a recommender reading type specs from types and
+// utilization from metrics
+func NewRecommender(types TypeLister, metrics MetricsSource, opts Options) *Recommender {
+	return &Recommender{
+		types:    types,
+		metrics:  metrics,
+		opts:     opts.withDefaults(),
+		families: map[string][]TypeSpec{},
+	}
+}
+
+// Recommend recommends a type for instance from its utilization between
+// start and end
+func (r *Recommender) Recommend(ctx context.Context, instance ec2types.Instance, start, end time.Time) (Recommendation, error) {
+	rec := Recommendation{
+		InstanceID:  aws.ToString(instance.InstanceId),
+		ImageID:     aws.ToString(instance.ImageId),
+		CurrentType: string(instance.InstanceType),
+	}
+	for _, tag := range instance.Tags {
+		if aws.ToString(tag.Key) == "Name" {
+			rec.Name = aws.ToString(tag.Value)
+		}
+	}
+
+	u, err := r.metrics.Utilization(ctx, rec.InstanceID, start, end)
+	if err != nil {
+		return rec, err
+	}
+	rec.Utilization = u
+	if !u.HasData() {
+		rec.Reason = "no utilization data"
+		return rec, nil
+	}
+
+	arch := string(instance.Architecture)
+	if arch == "" {
+		arch = string(ec2types.ArchitectureValuesX8664)
+	}
+	candidates, err := r.family(ctx, rec.CurrentType, arch)
+	if err != nil {
+		return rec, err
+	}
+	var current *TypeSpec
+	for i := range candidates {
+		if candidates[i].Name == rec.CurrentType {
+			current = &candidates[i]
+		}
+	}
+	if current == nil {
+		rec.Reason = fmt.Sprintf("no specification for type %s", rec.CurrentType)
+		return rec, nil
+	}
+
+	rec.RecommendedType, rec.Reason = recommend(*current, candidates, arch, u, r.opts)
+	return rec, nil
+}
+
+// family returns the type specs of the class of instanceType that run arch
+func (r *Recommender) family(ctx context.Context, instanceType, arch string) ([]TypeSpec, error) {
+	class := NewTypeSpec(ec2types.InstanceTypeInfo{InstanceType: ec2types.InstanceType(instanceType)}).Class
+	if class == "" {
+		class = instanceType
+	}
+	key := class + "/" + arch
+	if specs, ok := r.families[key]; ok {
+		return specs, nil
+	}
+
+	infos, err := r.types.ListInstanceTypes(ctx, &ec2.DescribeInstanceTypesInput{
+		Filters: []ec2types.Filter{
+			{Name: aws.String("instance-type"), Values: []string{class + "*"}},
+			{Name: aws.String("processor-info.supported-architecture"), Values: []string{arch}},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	specs := make([]TypeSpec, 0, len(infos))
+	for _, info := range infos {
+		if spec := NewTypeSpec(info); spec.Class == class || spec.Name == instanceType {
+			specs = append(specs, spec)
+		}
+	}
+	r.families[key] = specs
+	return specs, nil
+}
+
+// recommend picks the smallest, then newest, current generation type with
+// the features of current that fits the utilization, or "" to keep current
+func recommend(current TypeSpec, candidates []TypeSpec, arch string, u Utilization, opts Options) (string, string) {
+	needVCPUs := int32(math.Ceil(float64(current.VCPUs) * u.CPUMax / opts.TargetCPU))
+	if needVCPUs < 1 {
+		needVCPUs = 1
+	}
+	needMemory := int64(math.Ceil(float64(current.MemoryMiB) * opts.MinMemoryRatio))
+	needGbps := u.NetworkPeakBytes * 8 / 1e9
+
+	var fits []TypeSpec
+	for _, c := range candidates {
+		switch {
+		case c.Name == current.Name, !c.CurrentGeneration, !c.Supports(arch):
+			continue
+		case !c.sameFamilyFeatures(current), c.Generation < current.Generation:
+			continue
+		case c.VCPUs < needVCPUs, c.MemoryMiB < needMemory, c.MemoryMiB > current.MemoryMiB:
+			continue
+		case needGbps > 0 && c.NetworkGbps > 0 && needGbps > c.NetworkGbps:
+			continue
+		}
+		smaller := c.MemoryMiB < current.MemoryMiB || c.VCPUs < current.VCPUs
+		if c.Generation == current.Generation && !smaller {
+			continue
+		}
+		fits = append(fits, c)
+	}
+
+	if len(fits) == 0 {
+		if u.CPUMax > opts.TargetCPU {
+			return "", fmt.Sprintf("CPU peaks at %.0f%%, above the %.0f%% target", u.CPUMax, opts.TargetCPU)
+		}
+		return "", "no smaller or newer type fits"
+	}
+
+	sort.Slice(fits, func(i, j int) bool {
+		a, b := fits[i], fits[j]
+		switch {
+		case a.MemoryMiB != b.MemoryMiB:
+			return a.MemoryMiB < b.MemoryMiB
+		case a.Generation != b.Generation:
+			return a.Generation > b.Generation
+		case a.VCPUs != b.VCPUs:
+			return a.VCPUs < b.VCPUs
+		}
+		return a.Name < b.Name
+	})
+	best := fits[0]
+
+	var reasons []string
+	if best.Generation > current.Generation {
+		reasons = append(reasons, "newer generation")
+	}
+	if best.MemoryMiB < current.MemoryMiB || best.VCPUs < current.VCPUs {
+		reasons = append(reasons, fmt.Sprintf("CPU peaks at %.0f%% against a %.0f%% target", u.CPUMax, opts.TargetCPU))
+	}
+	return best.Name, strings.Join(reasons, ", ")
+}
@@ -0,0 +1,178 @@
+package rightsize
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// typeInfo describes a current generation instance type
+func typeInfo(name string, vcpus int32, memoryMiB int64, network string, archs ...ec2types.ArchitectureType) ec2types.InstanceTypeInfo {
+	if len(archs) == 0 {
+		archs = []ec2types.ArchitectureType{ec2types.ArchitectureTypeX8664}
+	}
+	return ec2types.InstanceTypeInfo{
+		InstanceType:      ec2types.InstanceType(name),
+		CurrentGeneration: aws.Bool(true),
+		VCpuInfo:          &ec2types.VCpuInfo{DefaultVCpus: aws.Int32(vcpus)},
+		MemoryInfo:        &ec2types.MemoryInfo{SizeInMiB: aws.Int64(memoryMiB)},
+		ProcessorInfo:     &ec2types.ProcessorInfo{SupportedArchitectures: archs},
+		NetworkInfo:       &ec2types.NetworkInfo{NetworkPerformance: aws.String(network)},
+	}
+}
+
+var testTypes = []ec2types.InstanceTypeInfo{
+	typeInfo("m5.large", 2, 8192, "Up to 10 Gigabit"),
+	typeInfo("m5.xlarge", 4, 16384, "Up to 10 Gigabit"),
+	typeInfo("m5.2xlarge", 8, 32768, "Up to 10 Gigabit"),
+	typeInfo("m5d.large", 2, 8192, "Up to 10 Gigabit"),
+	typeInfo("m6i.large", 2, 8192, "Up to 12.5 Gigabit"),
+	typeInfo("m6i.xlarge", 4, 16384, "Up to 12.5 Gigabit"),
+	typeInfo("m6i.2xlarge", 8, 32768, "Up to 12.5 Gigabit"),
+	typeInfo("m6g.large", 2, 8192, "Up to 10 Gigabit", ec2types.ArchitectureTypeArm64),
+	typeInfo("m7i.xlarge", 4, 16384, "Up to 12.5 Gigabit"),
+	typeInfo("mac1.metal", 12, 32768, "25 Gigabit", ec2types.ArchitectureTypeX8664Mac),
+}
+
+func TestNewTypeSpec(t *testing.T) {
+	spec := NewTypeSpec(typeInfo("m6id.xlarge", 4, 16384, "Up to 12.5 Gigabit"))
+	assert.Equal(t, "m", spec.Class)
+	assert.Equal(t, 6, spec.Generation)
+	assert.Equal(t, "id", spec.Attributes)
+	assert.Equal(t, "xlarge", spec.Size)
+	assert.Equal(t, 12.5, spec.NetworkGbps)
+	assert.True(t, spec.Supports("x86_64"))
+
+	low := NewTypeSpec(typeInfo("t2.micro", 1, 1024, "Low to Moderate"))
+	assert.Zero(t, low.NetworkGbps)
+
+	card := typeInfo("c7gn.large", 2, 4096, "Up to 30 Gigabit")
+	card.NetworkInfo.NetworkCards = []ec2types.NetworkCardInfo{{BaselineBandwidthInGbps: aws.Float64(6.25)}}
+	assert.Equal(t, 6.25, NewTypeSpec(card).NetworkGbps)
+}
+
+func TestRecommend(t *testing.T) {
+	specs := make([]TypeSpec, len(testTypes))
+	for i, info := range testTypes {
+		specs[i] = NewTypeSpec(info)
+	}
+	find := func(name string) TypeSpec {
+		for _, s := range specs {
+			if s.Name == name {
+				return s
+			}
+		}
+		t.Fatalf("no type %s", name)
+		return TypeSpec{}
+	}
+
+	tests := []struct {
+		name     string
+		current  string
+		u        Utilization
+		expected string
+		reason   string
+	}{
+		{
+			name:     "idle shrinks one size on the newest generation",
+			current:  "m5.2xlarge",
+			u:        Utilization{CPUMax: 10, Datapoints: 1},
+			expected: "m7i.xlarge",
+			reason:   "newer generation, CPU peaks at 10% against a 70% target",
+		},
+		{
+			name:     "busy moves to a newer generation of the same size",
+			current:  "m5.large",
+			u:        Utilization{CPUMax: 65, Datapoints: 1},
+			expected: "m6i.large",
+			reason:   "newer generation",
+		},
+		{
+			name:     "overloaded keeps its type",
+			current:  "m7i.xlarge",
+			u:        Utilization{CPUMax: 95, Datapoints: 1},
+			expected: "",
+			reason:   "CPU peaks at 95%, above the 70% target",
+		},
+		{
+			name:     "family features are kept",
+			current:  "m5d.large",
+			u:        Utilization{CPUMax: 10, Datapoints: 1},
+			expected: "",
+			reason:   "no smaller or newer type fits",
+		},
+		{
+			name:     "network peak above the smaller type's bandwidth",
+			current:  "m6i.2xlarge",
+			u:        Utilization{CPUMax: 10, NetworkPeakBytes: 1.6e9, Datapoints: 1},
+			expected: "",
+			reason:   "no smaller or newer type fits",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, reason := recommend(find(tt.current), specs, "x86_64", tt.u, Options{}.withDefaults())
+			assert.Equal(t, tt.expected, got)
+			assert.Equal(t, tt.reason, reason)
+		})
+	}
+}
+
+// typeLister is a TypeLister returning fixed types, recording the filters
+type typeLister struct {
+	infos []ec2types.InstanceTypeInfo
+	calls []*ec2.DescribeInstanceTypesInput
+}
+
+func (l *typeLister) ListInstanceTypes(ctx context.Context, input *ec2.DescribeInstanceTypesInput) ([]ec2types.InstanceTypeInfo, error) {
+	l.calls = append(l.calls, input)
+	return l.infos, nil
+}
+
+func TestRecommenderRecommend(t *testing.T) {
+	lister := &typeLister{infos: testTypes}
+	metrics := StaticSource{
+		"i-1": {CPUAverage: 2, CPUMax: 10, Datapoints: 24},
+		"i-2": {CPUAverage: 50, CPUMax: 65, Datapoints: 24},
+	}
+	r := NewRecommender(lister, metrics, Options{})
+	end := time.Now()
+	start := end.AddDate(0, 0, -1)
+
+	instance := func(id, instanceType string) ec2types.Instance {
+		return ec2types.Instance{
+			InstanceId:   aws.String(id),
+			ImageId:      aws.String("ami-1"),
+			InstanceType: ec2types.InstanceType(instanceType),
+			Architecture: ec2types.ArchitectureValuesX8664,
+			Tags:         []ec2types.Tag{{Key: aws.String("Name"), Value: aws.String("web-" + id)}},
+		}
+	}
+
+	rec, err := r.Recommend(context.Background(), instance("i-1", "m5.xlarge"), start, end)
+	require.NoError(t, err)
+	assert.Equal(t, "web-i-1", rec.Name)
+	assert.Equal(t, "ami-1", rec.ImageID)
+	assert.Equal(t, "m6i.large", rec.RecommendedType)
+
+	rec, err = r.Recommend(context.Background(), instance("i-2", "m5.large"), start, end)
+	require.NoError(t, err)
+	assert.Equal(t, "m6i.large", rec.RecommendedType)
+
+	rec, err = r.Recommend(context.Background(), instance("i-3", "m5.large"), start, end)
+	require.NoError(t, err)
+	assert.Empty(t, rec.RecommendedType)
+	assert.Equal(t, "no utilization data", rec.Reason)
+
+	// Types of the same class and architecture are listed once
+	require.Len(t, lister.calls, 1)
+	assert.Equal(t, []string{"m*"}, lister.calls[0].Filters[0].Values)
+	assert.Equal(t, []string{"x86_64"}, lister.calls[0].Filters[1].Values)
+}
@@ -0,0 +1,109 @@
+package rightsize
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+)
+
+// TypeSpec is the part of an instance type's specification rightsizing
+// compares
+type TypeSpec struct {
+	Name string
+	// Class, Generation, Attributes and Size are parsed from the name, e.g.
+	// m, 6, id and xlarge for m6id.xlarge
+	Class         string
+	Generation    int
+	Attributes    string
+	Size          string
+	VCPUs         int32
+	MemoryMiB     int64
+	Architectures []string
+	// NetworkGbps is the network bandwidth, zero when it is only described
+	// as low, moderate or high
+	NetworkGbps       float64
+	CurrentGeneration bool
+}
+
+// typeName matches instance type names, e.g. m6id.xlarge
+var typeName = regexp.MustCompile(`^([a-z]+?)(\d+)([a-z-]*)\.([a-z0-9-]+)$`)
+
+// gigabit matches network performance descriptions with a bandwidth, e.g.
+// "Up to 12.5 Gigabit"
+var gigabit = regexp.MustCompile(`([\d.]+) Gigabit`)
+
+// NewTypeSpec converts an instance type description to a TypeSpec
+func NewTypeSpec(info ec2types.InstanceTypeInfo) TypeSpec {
+	spec := TypeSpec{
+		Name:              string(info.InstanceType),
+		CurrentGeneration: aws.ToBool(info.CurrentGeneration),
+	}
+	if m := typeName.FindStringSubmatch(spec.Name); m != nil {
+		spec.Class = m[1]
+		spec.Generation, _ = strconv.Atoi(m[2])
+		spec.Attributes = m[3]
+		spec.Size = m[4]
+	}
+	if info.VCpuInfo != nil {
+		spec.VCPUs = aws.ToInt32(info.VCpuInfo.DefaultVCpus)
+	}
+	if info.MemoryInfo != nil {
+		spec.MemoryMiB = aws.ToInt64(info.MemoryInfo.SizeInMiB)
+	}
+	if info.ProcessorInfo != nil {
+		for _, arch := range info.ProcessorInfo.SupportedArchitectures {
+			spec.Architectures = append(spec.Architectures, string(arch))
+		}
+	}
+	spec.NetworkGbps = networkGbps(info.NetworkInfo)
+	return spec
+}
+
+// networkGbps returns the baseline bandwidth of the first network card, or
+// the bandwidth in the network performance description
+func networkGbps(info *ec2types.NetworkInfo) float64 {
+	if info == nil {
+		return 0
+	}
+	for _, card := range info.NetworkCards {
+		if card.BaselineBandwidthInGbps != nil {
+			return *card.BaselineBandwidthInGbps
+		}
+	}
+	if m := gigabit.FindStringSubmatch(aws.ToString(info.NetworkPerformance)); m != nil {
+		gbps, _ := strconv.ParseFloat(m[1], 64)
+		return gbps
+	}
+	return 0
+}
+
+// Supports reports whether the type runs the architecture
+func (t TypeSpec) Supports(arch string) bool {
+	for _, a := range t.Architectures {
+		if a == arch {
+			return true
+		}
+	}
+	return false
+}
+
+// sameFamilyFeatures reports whether t has the features of other's family,
+// such as local storage or enhanced networking, ignoring the processor
+// vendor: m5d, m6id and m7ad all have local NVMe storage
+func (t TypeSpec) sameFamilyFeatures(other TypeSpec) bool {
+	return t.Class == other.Class && features(t.Attributes) == features(other.Attributes)
+}
+
+// features returns family attributes without the processor vendor letters
+func features(attributes string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case 'a', 'i', 'g':
+			return -1
+		}
+		return r
+	}, attributes)
+}
@@ -0,0 +1,274 @@
+// Package session caches temporary AWS credentials, such as assumed-role
+// sessions, in ec-manager's cache directory so they can be reused across
+// commands and served to other tools through credential_process without
+// writing secrets into the shared AWS files.
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// RefreshWindow is how long before expiry a session is refreshed. AWS SDKs
+// call credential_process again shortly before credentials expire, so
+// sessions are renewed a little earlier than that.
+const RefreshWindow = 15 * time.Minute
+
+// ErrNotFound is returned when a session is not in the cache
+var ErrNotFound = errors.New("session not found")
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9_.@=+,-]+$`)
+
+// Session is a cached set of temporary credentials and what is needed to
+// obtain new ones
+type Session struct {
+	Name string `json:"name"`
+
+	// RoleARN is the role assumed for the session
+	RoleARN string `json:"roleArn"`
+	// SourceProfile provides the credentials used to assume the role. Empty
+	// means the default credential chain.
+	SourceProfile string `json:"sourceProfile,omitempty"`
+	// MFASerial is the MFA device required to assume the role, if any
+	MFASerial string `json:"mfaSerial,omitempty"`
+	// DurationSeconds is the requested session length, 0 for the role default
+	DurationSeconds int32 `json:"durationSeconds,omitempty"`
+
+	AccessKeyID     string    `json:"accessKeyId"`
+	SecretAccessKey string    `json:"secretAccessKey"`
+	SessionToken    string    `json:"sessionToken"`
+	Expiration      time.Time `json:"expiration"`
+}
+
+// Fresh reports whether the session's credentials are valid for at least
+// RefreshWindow
+func (s *Session) Fresh(now time.Time) bool {
+	return s != nil && s.AccessKeyID != "" && now.Add(RefreshWindow).Before(s.Expiration)
+}
+
+// Credentials returns the session's credentials
+func (s *Session) Credentials() aws.Credentials {
+	return aws.Credentials{
+		AccessKeyID:     s.AccessKeyID,
+		SecretAccessKey: s.SecretAccessKey,
+		SessionToken:    s.SessionToken,
+		Source:          "ec-manager session " + s.Name,
+		CanExpire:       true,
+		Expires:         s.Expiration,
+	}
+}
+
+// SetCredentials replaces the session's credentials
+func (s *Session) SetCredentials(creds aws.Credentials) {
+	s.AccessKeyID = creds.AccessKeyID
+	s.SecretAccessKey = creds.SecretAccessKey
+	s.SessionToken = creds.SessionToken
+	s.Expiration = creds.Expires
+}
+
+// ProcessOutput returns the session in the JSON format expected from a
+// credential_process command
+func (s *Session) ProcessOutput() ([]byte, error) {
+	out := struct {
+		Version         int    `json:"Version"`
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string `json:"SecretAccessKey"`
+		SessionToken    string `json:"SessionToken,omitempty"`
+		Expiration      string `json:"Expiration,omitempty"`
+	}{
+		Version:         1,
+		AccessKeyID:     s.AccessKeyID,
+		SecretAccessKey: s.SecretAccessKey,
+		SessionToken:    s.SessionToken,
+	}
+	if !s.Expiration.IsZero() {
+		out.Expiration = s.Expiration.UTC().Format(time.RFC3339)
+	}
+	return json.Marshal(out)
+}
+
+// NameForRole derives a session name from a role ARN, e.g. "admin" for
+// arn:aws:iam::123456789012:role/admin
+func NameForRole(roleARN string) string {
+	name := roleARN[strings.LastIndex(roleARN, "/")+1:]
+	if name == "" || !validName.MatchString(name) {
+		return "session"
+	}
+	return name
+}
+
+// Refresher obtains new credentials for a session
+type Refresher func(ctx context.Context, s *Session) (aws.Credentials, error)
+
+// Cache stores sessions as files in a directory only the owner can read
+type Cache struct {
+	dir string
+	now func() time.Time
+}
+
+// DefaultDir returns the cache directory, ~/.cache/ec-manager/sessions on
+// Linux
+func DefaultDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to get cache directory: %w", err)
+	}
+	return filepath.Join(dir, "ec-manager", "sessions"), nil
+}
+
+// NewCache creates a cache in dir
+func NewCache(dir string) *Cache {
+	return &Cache{dir: dir, now: time.Now}
+}
+
+// NewDefaultCache creates a cache in DefaultDir
+func NewDefaultCache() (*Cache, error) {
+	dir, err := DefaultDir()
+	if err != nil {
+		return nil, err
+	}
+	return NewCache(dir), nil
+}
+
+func (c *Cache) path(name string) (string, error) {
+	if !validName.MatchString(name) {
+		return "", fmt.Errorf("invalid session name %q", name)
+	}
+	return filepath.Join(c.dir, name+".json"), nil
+}
+
+// Load returns the named session or ErrNotFound
+func (c *Cache) Load(name string) (*Session, error) {
+	path, err := c.path(name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session: %w", err)
+	}
+
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse session %s: %w", name, err)
+	}
+	return &s, nil
+}
+
+// Save writes a session to the cache, replacing any previous one
+func (c *Cache) Save(s *Session) error {
+	path, err := c.path(s.Name)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode session: %w", err)
+	}
+
+	if err := os.MkdirAll(c.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create session cache directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(c.dir, ".session-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary session file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write session: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write session: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return fmt.Errorf("failed to set session permissions: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the named session
+func (c *Cache) Delete(name string) error {
+	path, err := c.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+// List returns every cached session sorted by name
+func (c *Cache) List() ([]*Session, error) {
+	entries, err := os.ReadDir(c.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session cache: %w", err)
+	}
+
+	var sessions []*Session
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		s, err := c.Load(name)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Name < sessions[j].Name
+	})
+	return sessions, nil
+}
+
+// Get returns the named session, refreshing and saving it first when it is
+// missing credentials or about to expire
+func (c *Cache) Get(ctx context.Context, s *Session, refresh Refresher) (*Session, error) {
+	cached, err := c.Load(s.Name)
+	switch {
+	case err == nil && cached.RoleARN == s.RoleARN:
+		if cached.Fresh(c.now()) {
+			return cached, nil
+		}
+	case err != nil && !errors.Is(err, ErrNotFound):
+		return nil, err
+	}
+
+	creds, err := refresh(ctx, s)
+	if err != nil {
+		return nil, err
+	}
+	s.SetCredentials(creds)
+
+	if err := c.Save(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
@@ -0,0 +1,112 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheGet(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	cache := NewCache(t.TempDir())
+	cache.now = func() time.Time { return now }
+
+	refreshes := 0
+	refresh := func(ctx context.Context, s *Session) (aws.Credentials, error) {
+		refreshes++
+		return aws.Credentials{
+			AccessKeyID:     "ASIA1",
+			SecretAccessKey: "secret",
+			SessionToken:    "token",
+			Expires:         now.Add(time.Hour),
+		}, nil
+	}
+
+	spec := func() *Session {
+		return &Session{Name: "admin", RoleARN: "arn:aws:iam::123456789012:role/admin"}
+	}
+
+	s, err := cache.Get(context.Background(), spec(), refresh)
+	require.NoError(t, err)
+	assert.Equal(t, "ASIA1", s.AccessKeyID)
+	assert.Equal(t, 1, refreshes)
+
+	info, err := os.Stat(filepath.Join(cache.dir, "admin.json"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// Fresh sessions come from the cache
+	_, err = cache.Get(context.Background(), spec(), refresh)
+	require.NoError(t, err)
+	assert.Equal(t, 1, refreshes)
+
+	// Sessions close to expiry are refreshed
+	now = now.Add(50 * time.Minute)
+	_, err = cache.Get(context.Background(), spec(), refresh)
+	require.NoError(t, err)
+	assert.Equal(t, 2, refreshes)
+
+	// A different role for the same name is never served from the cache
+	other := spec()
+	other.RoleARN = "arn:aws:iam::123456789012:role/other"
+	_, err = cache.Get(context.Background(), other, refresh)
+	require.NoError(t, err)
+	assert.Equal(t, 3, refreshes)
+
+	// Refresh failures are returned and leave the cache untouched
+	_, err = cache.Get(context.Background(), &Session{Name: "broken", RoleARN: "arn"}, func(context.Context, *Session) (aws.Credentials, error) {
+		return aws.Credentials{}, errors.New("access denied")
+	})
+	assert.ErrorContains(t, err, "access denied")
+	_, err = cache.Load("broken")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	sessions, err := cache.List()
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "admin", sessions[0].Name)
+
+	require.NoError(t, cache.Delete("admin"))
+	sessions, err = cache.List()
+	require.NoError(t, err)
+	assert.Empty(t, sessions)
+}
+
+func TestProcessOutput(t *testing.T) {
+	s := &Session{
+		AccessKeyID:     "ASIA1",
+		SecretAccessKey: "secret",
+		SessionToken:    "token",
+		Expiration:      time.Date(2024, 1, 1, 13, 0, 0, 0, time.UTC),
+	}
+
+	data, err := s.ProcessOutput()
+	require.NoError(t, err)
+
+	var out map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &out))
+	assert.Equal(t, map[string]interface{}{
+		"Version":         float64(1),
+		"AccessKeyId":     "ASIA1",
+		"SecretAccessKey": "secret",
+		"SessionToken":    "token",
+		"Expiration":      "2024-01-01T13:00:00Z",
+	}, out)
+}
+
+func TestNameForRole(t *testing.T) {
+	assert.Equal(t, "admin", NameForRole("arn:aws:iam::123456789012:role/admin"))
+	assert.Equal(t, "deploy", NameForRole("arn:aws:iam::123456789012:role/ci/deploy"))
+	assert.Equal(t, "session", NameForRole("arn:aws:iam::123456789012:role/"))
+
+	_, err := NewCache(t.TempDir()).Load("../escape")
+	assert.ErrorContains(t, err, "invalid session name")
+}
@@ -0,0 +1,313 @@
+package spec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/taemon1337/ec-manager/pkg/ami"
+)
+
+// Action is what apply does to converge an instance
+type Action string
+
+// Actions of a change
+const (
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+	ActionNone   Action = "none"
+)
+
+// Change converges one instance of a spec
+type Change struct {
+	Action Action
+	Name   string
+	// InstanceID is the existing instance, or the new one once created
+	InstanceID string
+	ImageID    string
+	// Details describe what apply changes, e.g. "tag Env: staging -> prod"
+	Details []string
+	// Warnings describe drift apply cannot converge in place
+	Warnings []string
+	// Drift lists each attribute of an existing instance that differs from
+	// the spec, whether or not apply can change it
+	Drift []ami.Drift
+
+	config       ami.InstanceConfig
+	tags         map[string]string
+	groups       []string
+	instanceType string
+	// record rewrites the instance's launch record once the update is made
+	record map[string]string
+}
+
+// Diff compares the desired instances with the actual ones, found by their
+// Name tag, and returns the change for each instance in spec order
+func Diff(ctx context.Context, svc *ami.Service, f *File) ([]Change, error) {
+	changes := make([]Change, 0, len(f.Instances))
+	for _, desired := range f.Instances {
+		change, err := diffInstance(ctx, svc, desired)
+		if err != nil {
+			return nil, fmt.Errorf("instance %s: %w", desired.Name, err)
+		}
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+func diffInstance(ctx context.Context, svc *ami.Service, desired Instance) (Change, error) {
+	imageID, err := resolveAMI(ctx, svc, desired.AMI)
+	if err != nil {
+		return Change{}, err
+	}
+	change := Change{Name: desired.Name, ImageID: imageID}
+
+	actual, err := svc.ResolveInstance(ctx, desired.Name)
+	if errors.Is(err, ami.ErrInstanceNotFound) {
+		change.Action = ActionCreate
+		change.config = desired.config(imageID)
+		change.Details = createDetails(desired, imageID)
+		return change, nil
+	}
+	if err != nil {
+		return Change{}, err
+	}
+
+	change.Action = ActionNone
+	change.InstanceID = aws.ToString(actual.InstanceId)
+
+	actualTags := map[string]string{}
+	for _, tag := range actual.Tags {
+		actualTags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	desiredTags := desired.DesiredTags()
+	for _, key := range sortedKeys(desiredTags) {
+		old, ok := actualTags[key]
+		if ok && old == desiredTags[key] {
+			continue
+		}
+		if !ok {
+			old = "(none)"
+		}
+		if change.tags == nil {
+			change.tags = map[string]string{}
+		}
+		change.tags[key] = desiredTags[key]
+		change.Drift = append(change.Drift, ami.Drift{Attribute: "tag:" + key, Expected: desiredTags[key], Actual: actualTags[key]})
+		change.Details = append(change.Details, fmt.Sprintf("tag %s: %s -> %s", key, old, desiredTags[key]))
+	}
+
+	if len(desired.SecurityGroups) > 0 {
+		var groups []string
+		for _, group := range actual.SecurityGroups {
+			groups = append(groups, aws.ToString(group.GroupId))
+		}
+		if !sameSet(groups, desired.SecurityGroups) {
+			change.Drift = append(change.Drift, ami.Drift{Attribute: "security-groups",
+				Expected: strings.Join(desired.SecurityGroups, ","), Actual: strings.Join(groups, ",")})
+			change.groups = desired.SecurityGroups
+			change.Details = append(change.Details, fmt.Sprintf("security groups: %s -> %s",
+				strings.Join(groups, ","), strings.Join(desired.SecurityGroups, ",")))
+		}
+	}
+
+	if actualType := string(actual.InstanceType); actualType != desired.Type {
+		change.Drift = append(change.Drift, ami.Drift{Attribute: "type", Expected: desired.Type, Actual: actualType})
+		if actual.State != nil && actual.State.Name == types.InstanceStateNameStopped {
+			change.instanceType = desired.Type
+			change.Details = append(change.Details, fmt.Sprintf("type: %s -> %s", actualType, desired.Type))
+		} else {
+			change.Warnings = append(change.Warnings, fmt.Sprintf("type is %s, the spec wants %s; stop the instance to change it", actualType, desired.Type))
+		}
+	}
+
+	if actualImage := aws.ToString(actual.ImageId); actualImage != imageID {
+		change.Drift = append(change.Drift, ami.Drift{Attribute: "ami", Expected: imageID, Actual: actualImage})
+		change.Warnings = append(change.Warnings, fmt.Sprintf("runs AMI %s, the spec selects %s; use 'ec-manager migrate' to replace it", actualImage, imageID))
+	}
+	if actualSubnet := aws.ToString(actual.SubnetId); actualSubnet != desired.Subnet {
+		change.Drift = append(change.Drift, ami.Drift{Attribute: "subnet", Expected: desired.Subnet, Actual: actualSubnet})
+		change.Warnings = append(change.Warnings, fmt.Sprintf("is in subnet %s, the spec wants %s; this cannot be changed in place", actualSubnet, desired.Subnet))
+	}
+	if actualKey := aws.ToString(actual.KeyName); desired.Key != "" && actualKey != desired.Key {
+		change.Drift = append(change.Drift, ami.Drift{Attribute: "key", Expected: desired.Key, Actual: actualKey})
+		change.Warnings = append(change.Warnings, fmt.Sprintf("uses key %s, the spec wants %s; this cannot be changed in place", actualKey, desired.Key))
+	}
+
+	if len(change.Details) > 0 {
+		change.Action = ActionUpdate
+		change.record = updatedRecord(*actual, actualTags, change)
+	}
+	return change, nil
+}
+
+// updatedRecord returns the launch record tags of actual that change once
+// change is applied
+func updatedRecord(actual types.Instance, actualTags map[string]string, change Change) map[string]string {
+	if !ami.HasLaunchRecord(actual) {
+		return nil
+	}
+	tags := make(map[string]string, len(actualTags)+len(change.tags))
+	for key, value := range actualTags {
+		tags[key] = value
+	}
+	for key, value := range change.tags {
+		tags[key] = value
+	}
+	groups := change.groups
+	if groups == nil {
+		for _, group := range actual.SecurityGroups {
+			groups = append(groups, aws.ToString(group.GroupId))
+		}
+	}
+	instanceType := change.instanceType
+	if instanceType == "" {
+		instanceType = string(actual.InstanceType)
+	}
+	return ami.LaunchRecordUpdate(actual, tags, groups, instanceType)
+}
+
+// resolveAMI returns the AMI ID the selector picks
+func resolveAMI(ctx context.Context, svc *ami.Service, selector AMISelector) (string, error) {
+	var image *types.Image
+	var err error
+	switch {
+	case selector.ID != "":
+		image, err = svc.GetImage(ctx, selector.ID)
+	case selector.Version != "":
+		image, err = svc.GetAMIByVersion(ctx, selector.OS, selector.Version)
+	default:
+		image, err = svc.GetLatestAMI(ctx, selector.OS)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve AMI: %w", err)
+	}
+	return aws.ToString(image.ImageId), nil
+}
+
+func createDetails(desired Instance, imageID string) []string {
+	details := []string{
+		fmt.Sprintf("%s from %s in %s", desired.Type, imageID, desired.Subnet),
+	}
+	if desired.Key != "" {
+		details = append(details, "key: "+desired.Key)
+	}
+	if len(desired.SecurityGroups) > 0 {
+		details = append(details, "security groups: "+strings.Join(desired.SecurityGroups, ","))
+	}
+	if desired.InstanceProfile != "" {
+		details = append(details, "instance profile: "+desired.InstanceProfile)
+	}
+	if desired.RootVolume != nil {
+		details = append(details, "root volume: "+describeVolume(*desired.RootVolume))
+	}
+	for _, v := range desired.Volumes {
+		details = append(details, "volume: "+describeVolume(v))
+	}
+	tags := desired.DesiredTags()
+	for _, key := range sortedKeys(tags) {
+		details = append(details, fmt.Sprintf("tag %s: %s", key, tags[key]))
+	}
+	return details
+}
+
+func describeVolume(v Volume) string {
+	var parts []string
+	if v.Size > 0 {
+		parts = append(parts, fmt.Sprintf("%d GiB", v.Size))
+	}
+	if v.Type != "" {
+		parts = append(parts, v.Type)
+	}
+	if v.Device != "" {
+		parts = append(parts, "at "+v.Device)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Apply makes the changes in order, calling done after each one that does
+// something. A failed change does not stop the others; the error reports
+// how many failed.
+func Apply(ctx context.Context, svc *ami.Service, changes []Change, done func(Change, error)) error {
+	failed, total := 0, 0
+	for i := range changes {
+		change := &changes[i]
+		if change.Action == ActionNone {
+			continue
+		}
+		total++
+		err := applyChange(ctx, svc, change)
+		if err != nil {
+			failed++
+		}
+		if done != nil {
+			done(*change, err)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to apply %d of %d changes", failed, total)
+	}
+	return nil
+}
+
+func applyChange(ctx context.Context, svc *ami.Service, change *Change) error {
+	if change.Action == ActionCreate {
+		id, err := svc.CreateInstance(ctx, change.config)
+		if err != nil {
+			return err
+		}
+		change.InstanceID = id
+		return nil
+	}
+
+	if len(change.tags) > 0 {
+		if err := svc.TagInstance(ctx, change.InstanceID, change.tags); err != nil {
+			return err
+		}
+	}
+	if len(change.groups) > 0 {
+		if err := svc.SetSecurityGroups(ctx, change.InstanceID, change.groups); err != nil {
+			return err
+		}
+	}
+	if change.instanceType != "" {
+		if err := svc.SetInstanceType(ctx, change.InstanceID, change.instanceType); err != nil {
+			return err
+		}
+	}
+	// Record the changes so check drift does not report them
+	if len(change.record) > 0 {
+		if err := svc.TagInstance(ctx, change.InstanceID, change.record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sameSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = append([]string(nil), a...), append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,175 @@
+package spec
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/taemon1337/ec-manager/pkg/ami"
+)
+
+// specEC2Client describes fixed instances, resolves every AMI lookup to
+// ami-latest and records the changes made
+type specEC2Client struct {
+	ami.EC2Client
+	instances []types.Instance
+
+	tagged   []*ec2.CreateTagsInput
+	modified []*ec2.ModifyInstanceAttributeInput
+	launched []*ec2.RunInstancesInput
+}
+
+func (c *specEC2Client) DescribeInstances(ctx context.Context, params *ec2.DescribeInstancesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeInstancesOutput, error) {
+	return &ec2.DescribeInstancesOutput{Reservations: []types.Reservation{{Instances: c.instances}}}, nil
+}
+
+func (c *specEC2Client) DescribeImages(ctx context.Context, params *ec2.DescribeImagesInput, optFns ...func(*ec2.Options)) (*ec2.DescribeImagesOutput, error) {
+	return &ec2.DescribeImagesOutput{Images: []types.Image{{
+		ImageId:        aws.String("ami-latest"),
+		CreationDate:   aws.String("2024-01-01T00:00:00.000Z"),
+		RootDeviceName: aws.String("/dev/xvda"),
+	}}}, nil
+}
+
+func (c *specEC2Client) CreateTags(ctx context.Context, params *ec2.CreateTagsInput, optFns ...func(*ec2.Options)) (*ec2.CreateTagsOutput, error) {
+	c.tagged = append(c.tagged, params)
+	return &ec2.CreateTagsOutput{}, nil
+}
+
+func (c *specEC2Client) ModifyInstanceAttribute(ctx context.Context, params *ec2.ModifyInstanceAttributeInput, optFns ...func(*ec2.Options)) (*ec2.ModifyInstanceAttributeOutput, error) {
+	c.modified = append(c.modified, params)
+	return &ec2.ModifyInstanceAttributeOutput{}, nil
+}
+
+func (c *specEC2Client) RunInstances(ctx context.Context, params *ec2.RunInstancesInput, optFns ...func(*ec2.Options)) (*ec2.RunInstancesOutput, error) {
+	c.launched = append(c.launched, params)
+	return &ec2.RunInstancesOutput{Instances: []types.Instance{{InstanceId: aws.String("i-new")}}}, nil
+}
+
+func instance(id, name string, state types.InstanceStateName, tags ...string) types.Instance {
+	i := types.Instance{
+		InstanceId:     aws.String(id),
+		ImageId:        aws.String("ami-latest"),
+		InstanceType:   types.InstanceTypeT3Micro,
+		SubnetId:       aws.String("subnet-1"),
+		KeyName:        aws.String("ops"),
+		State:          &types.InstanceState{Name: state},
+		SecurityGroups: []types.GroupIdentifier{{GroupId: aws.String("sg-1")}},
+		Tags:           []types.Tag{{Key: aws.String("Name"), Value: aws.String(name)}},
+	}
+	for j := 0; j+1 < len(tags); j += 2 {
+		i.Tags = append(i.Tags, types.Tag{Key: aws.String(tags[j]), Value: aws.String(tags[j+1])})
+	}
+	return i
+}
+
+func TestDiffAndApply(t *testing.T) {
+	client := &specEC2Client{instances: []types.Instance{
+		instance("i-1", "same", types.InstanceStateNameRunning, "Env", "prod"),
+		instance("i-2", "retag", types.InstanceStateNameStopped, "Env", "dev"),
+		instance("i-3", "running", types.InstanceStateNameRunning, "Env", "prod"),
+	}}
+	svc := ami.NewService(client)
+
+	f, err := Parse([]byte(`
+instances:
+  - {name: same, ami: {os: RHEL9}, security-groups: [sg-1]}
+  - {name: retag, ami: {os: RHEL9}, type: t3.large, security-groups: [sg-2], migrate: true}
+  - {name: running, ami: {id: ami-old}, type: t3.large}
+  - {name: new, ami: {os: RHEL9, version: "9.2"}, volumes: [{size: 20}]}
+`), Defaults{Type: "t3.micro", Subnet: "subnet-1", Key: "ops", Tags: map[string]string{"Env": "prod"}})
+	require.NoError(t, err)
+
+	changes, err := Diff(context.Background(), svc, f)
+	require.NoError(t, err)
+	require.Len(t, changes, 4)
+
+	assert.Equal(t, ActionNone, changes[0].Action)
+	assert.Empty(t, changes[0].Warnings)
+
+	assert.Equal(t, ActionUpdate, changes[1].Action)
+	assert.Equal(t, []string{
+		"tag Env: dev -> prod",
+		"tag ami-migrate: (none) -> enabled",
+		"security groups: sg-1 -> sg-2",
+		"type: t3.micro -> t3.large",
+	}, changes[1].Details)
+
+	assert.Equal(t, []ami.Drift{
+		{Attribute: "tag:Env", Expected: "prod", Actual: "dev"},
+		{Attribute: "tag:ami-migrate", Expected: "enabled"},
+		{Attribute: "security-groups", Expected: "sg-2", Actual: "sg-1"},
+		{Attribute: "type", Expected: "t3.large", Actual: "t3.micro"},
+	}, changes[1].Drift)
+
+	// A running instance's type is drift, not a change
+	assert.Equal(t, ActionNone, changes[2].Action)
+	assert.Len(t, changes[2].Warnings, 1)
+	assert.Contains(t, changes[2].Warnings[0], "stop the instance")
+	assert.Equal(t, []ami.Drift{{Attribute: "type", Expected: "t3.large", Actual: "t3.micro"}}, changes[2].Drift)
+
+	assert.Equal(t, ActionCreate, changes[3].Action)
+	assert.Equal(t, "ami-latest", changes[3].ImageID)
+
+	var applied []string
+	err = Apply(context.Background(), svc, changes, func(c Change, err error) {
+		require.NoError(t, err)
+		applied = append(applied, c.Name+" "+c.InstanceID)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"retag i-2", "new i-new"}, applied)
+
+	require.Len(t, client.tagged, 1)
+	assert.Equal(t, []string{"i-2"}, client.tagged[0].Resources)
+	require.Len(t, client.modified, 2)
+	assert.Equal(t, []string{"sg-2"}, client.modified[0].Groups)
+	assert.Equal(t, "t3.large", aws.ToString(client.modified[1].InstanceType.Value))
+	require.Len(t, client.launched, 1)
+	assert.Equal(t, "ami-latest", aws.ToString(client.launched[0].ImageId))
+	assert.Len(t, client.launched[0].BlockDeviceMappings, 1)
+}
+
+func TestApplyUpdatesLaunchRecord(t *testing.T) {
+	recorded := instance("i-1", "web", types.InstanceStateNameStopped, "Env", "dev",
+		ami.LaunchTypeTag, "t3.micro", ami.LaunchSecurityGroupsTag, "sg-1", ami.LaunchTagsTag, "sha256:launched")
+
+	client := &specEC2Client{instances: []types.Instance{recorded}}
+	svc := ami.NewService(client)
+
+	f, err := Parse([]byte(`
+instances:
+  - {name: web, ami: {os: RHEL9}, type: t3.large, security-groups: [sg-2]}
+`), Defaults{Type: "t3.micro", Subnet: "subnet-1", Key: "ops", Tags: map[string]string{"Env": "prod"}})
+	require.NoError(t, err)
+
+	changes, err := Diff(context.Background(), svc, f)
+	require.NoError(t, err)
+	require.NoError(t, Apply(context.Background(), svc, changes, nil))
+
+	// The instance as it is after apply has no drift from its launch record
+	updated := recorded
+	tags := map[string]string{}
+	for _, tag := range updated.Tags {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	for _, input := range client.tagged {
+		for _, tag := range input.Tags {
+			tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+		}
+	}
+	updated.Tags = nil
+	for _, key := range sortedKeys(tags) {
+		updated.Tags = append(updated.Tags, types.Tag{Key: aws.String(key), Value: aws.String(tags[key])})
+	}
+	updated.SecurityGroups = []types.GroupIdentifier{{GroupId: aws.String("sg-2")}}
+	updated.InstanceType = types.InstanceTypeT3Large
+
+	require.Len(t, client.tagged, 2)
+	assert.Equal(t, "t3.large", tags[ami.LaunchTypeTag])
+	assert.Equal(t, "sg-2", tags[ami.LaunchSecurityGroupsTag])
+	assert.Empty(t, ami.LaunchDrift(updated))
+}
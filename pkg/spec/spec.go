@@ -0,0 +1,231 @@
+// Package spec describes desired EC2 instances declaratively and converges
+// the actual instances towards them
+package spec
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/taemon1337/ec-manager/pkg/ami"
+	"gopkg.in/yaml.v3"
+)
+
+// Tags ec-manager manages for the backup and migrate settings of a spec
+const (
+	BackupTag  = "ami-backup"
+	MigrateTag = "ami-migrate"
+)
+
+// BackupPolicies are the accepted values of an instance's backup setting
+var BackupPolicies = []string{"none", "daily", "weekly", "monthly"}
+
+// File is a set of desired instances
+type File struct {
+	Instances []Instance `yaml:"instances"`
+}
+
+// Instance is one desired instance, identified by its Name tag
+type Instance struct {
+	Name            string            `yaml:"name"`
+	AMI             AMISelector       `yaml:"ami"`
+	Type            string            `yaml:"type,omitempty"`
+	Subnet          string            `yaml:"subnet,omitempty"`
+	Key             string            `yaml:"key,omitempty"`
+	SecurityGroups  []string          `yaml:"security-groups,omitempty"`
+	InstanceProfile string            `yaml:"instance-profile,omitempty"`
+	RootVolume      *Volume           `yaml:"root-volume,omitempty"`
+	Volumes         []Volume          `yaml:"volumes,omitempty"`
+	Tags            map[string]string `yaml:"tags,omitempty"`
+	// Backup is the backup policy, recorded in the ami-backup tag
+	Backup string `yaml:"backup,omitempty"`
+	// Migrate opts the instance in to migrate --enabled, or out of it when
+	// false, with the ami-migrate tag
+	Migrate *bool `yaml:"migrate,omitempty"`
+}
+
+// AMISelector selects the AMI of an instance by ID, or by the OS tag and
+// optionally the Version tag. Without a version the AMI tagged
+// ami-migrate=latest for the OS is used.
+type AMISelector struct {
+	ID      string `yaml:"id,omitempty"`
+	OS      string `yaml:"os,omitempty"`
+	Version string `yaml:"version,omitempty"`
+}
+
+// Volume is an EBS volume of an instance
+type Volume struct {
+	Size   int32  `yaml:"size,omitempty"`
+	Type   string `yaml:"type,omitempty"`
+	Device string `yaml:"device,omitempty"`
+}
+
+// Defaults fill in the settings instances leave out, usually from the
+// configuration context
+type Defaults struct {
+	Type   string
+	Subnet string
+	Key    string
+	Tags   map[string]string
+}
+
+// Load reads and validates the spec file at path, or standard input for -
+func Load(path string, defaults Defaults) (*File, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spec: %w", err)
+	}
+	return Parse(data, defaults)
+}
+
+// Parse decodes and validates a spec. Unknown fields are an error, so typos
+// are not silently ignored.
+func Parse(data []byte, defaults Defaults) (*File, error) {
+	f := &File{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(f); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse spec: %w", err)
+	}
+
+	f.applyDefaults(defaults)
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *File) applyDefaults(d Defaults) {
+	for i := range f.Instances {
+		instance := &f.Instances[i]
+		if instance.Type == "" {
+			instance.Type = d.Type
+		}
+		if instance.Subnet == "" {
+			instance.Subnet = d.Subnet
+		}
+		if instance.Key == "" {
+			instance.Key = d.Key
+		}
+		if len(d.Tags) > 0 {
+			tags := make(map[string]string, len(d.Tags)+len(instance.Tags))
+			for key, value := range d.Tags {
+				tags[key] = value
+			}
+			for key, value := range instance.Tags {
+				tags[key] = value
+			}
+			instance.Tags = tags
+		}
+	}
+}
+
+// Validate checks every instance, naming the first one that is invalid
+func (f *File) Validate() error {
+	if len(f.Instances) == 0 {
+		return fmt.Errorf("spec has no instances")
+	}
+
+	seen := map[string]bool{}
+	for i, instance := range f.Instances {
+		if instance.Name == "" {
+			return fmt.Errorf("instance %d: name is required", i+1)
+		}
+		if seen[instance.Name] {
+			return fmt.Errorf("instance %s: name is used more than once", instance.Name)
+		}
+		seen[instance.Name] = true
+
+		if err := instance.validate(); err != nil {
+			return fmt.Errorf("instance %s: %w", instance.Name, err)
+		}
+	}
+	return nil
+}
+
+func (i Instance) validate() error {
+	switch {
+	case i.AMI.ID != "" && (i.AMI.OS != "" || i.AMI.Version != ""):
+		return fmt.Errorf("ami: give either id or os, not both")
+	case i.AMI.ID == "" && i.AMI.OS == "":
+		return fmt.Errorf("ami: id or os is required")
+	case i.Type == "":
+		return fmt.Errorf("type is required unless set in the context")
+	case i.Subnet == "":
+		return fmt.Errorf("subnet is required unless set in the context")
+	}
+
+	if i.Backup != "" && !contains(BackupPolicies, i.Backup) {
+		return fmt.Errorf("backup %q is not one of %v", i.Backup, BackupPolicies)
+	}
+	if i.RootVolume != nil && i.RootVolume.Size < 0 {
+		return fmt.Errorf("root-volume: size must be positive")
+	}
+	if i.RootVolume != nil && i.RootVolume.Device != "" {
+		return fmt.Errorf("root-volume: device cannot be set, the root volume is at the AMI's root device")
+	}
+	for _, v := range i.Volumes {
+		if v.Size <= 0 {
+			return fmt.Errorf("volumes: size is required and must be positive")
+		}
+	}
+	return nil
+}
+
+// DesiredTags returns the tags the instance should have: its own tags, its
+// Name and the tags recording its backup and migrate settings
+func (i Instance) DesiredTags() map[string]string {
+	tags := make(map[string]string, len(i.Tags)+3)
+	for key, value := range i.Tags {
+		tags[key] = value
+	}
+	tags["Name"] = i.Name
+	if i.Backup != "" {
+		tags[BackupTag] = i.Backup
+	}
+	if i.Migrate != nil {
+		tags[MigrateTag] = "disabled"
+		if *i.Migrate {
+			tags[MigrateTag] = "enabled"
+		}
+	}
+	return tags
+}
+
+// config returns the launch configuration of the instance with the AMI
+func (i Instance) config(imageID string) ami.InstanceConfig {
+	cfg := ami.InstanceConfig{
+		ImageID:          imageID,
+		InstanceType:     i.Type,
+		KeyName:          i.Key,
+		SubnetID:         i.Subnet,
+		Name:             i.Name,
+		SecurityGroupIDs: i.SecurityGroups,
+		InstanceProfile:  i.InstanceProfile,
+		Tags:             i.DesiredTags(),
+	}
+	if i.RootVolume != nil {
+		cfg.RootVolume = ami.VolumeConfig{SizeGiB: i.RootVolume.Size, Type: i.RootVolume.Type}
+	}
+	for _, v := range i.Volumes {
+		cfg.Volumes = append(cfg.Volumes, ami.VolumeConfig{SizeGiB: v.Size, Type: v.Type, Device: v.Device})
+	}
+	return cfg
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
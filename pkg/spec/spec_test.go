@@ -0,0 +1,75 @@
+package spec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	defaults := Defaults{Type: "t3.micro", Subnet: "subnet-1", Key: "ops", Tags: map[string]string{"Team": "web", "Env": "dev"}}
+
+	f, err := Parse([]byte(`
+instances:
+  - name: web-1
+    ami: {os: RHEL9}
+    tags: {Env: prod}
+    backup: daily
+    migrate: false
+  - name: web-2
+    ami: {id: ami-1}
+    type: t3.large
+    subnet: subnet-2
+    volumes:
+      - {size: 100, type: gp3}
+`), defaults)
+	require.NoError(t, err)
+	require.Len(t, f.Instances, 2)
+
+	web1 := f.Instances[0]
+	assert.Equal(t, "t3.micro", web1.Type)
+	assert.Equal(t, "subnet-1", web1.Subnet)
+	assert.Equal(t, "ops", web1.Key)
+	assert.Equal(t, map[string]string{
+		"Name":     "web-1",
+		"Team":     "web",
+		"Env":      "prod",
+		BackupTag:  "daily",
+		MigrateTag: "disabled",
+	}, web1.DesiredTags())
+
+	web2 := f.Instances[1]
+	assert.Equal(t, "t3.large", web2.Type)
+	assert.Equal(t, "subnet-2", web2.Subnet)
+	assert.Equal(t, []Volume{{Size: 100, Type: "gp3"}}, web2.Volumes)
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		wantErr string
+	}{
+		{name: "empty", spec: ``, wantErr: "no instances"},
+		{name: "unknown field", spec: "instances:\n  - name: a\n    amii: {os: RHEL9}\n", wantErr: "field amii not found"},
+		{name: "no name", spec: "instances:\n  - ami: {os: RHEL9}\n", wantErr: "instance 1: name is required"},
+		{name: "duplicate name", spec: "instances:\n  - {name: a, ami: {os: RHEL9}}\n  - {name: a, ami: {os: RHEL9}}\n", wantErr: "used more than once"},
+		{name: "no ami", spec: "instances:\n  - name: a\n", wantErr: "id or os is required"},
+		{name: "id and os", spec: "instances:\n  - {name: a, ami: {id: ami-1, os: RHEL9}}\n", wantErr: "not both"},
+		{name: "bad backup", spec: "instances:\n  - {name: a, ami: {os: RHEL9}, backup: hourly}\n", wantErr: "backup \"hourly\""},
+		{name: "root volume device", spec: "instances:\n  - {name: a, ami: {os: RHEL9}, root-volume: {size: 50, device: /dev/sda1}}\n", wantErr: "root-volume: device cannot be set"},
+		{name: "volume without size", spec: "instances:\n  - {name: a, ami: {os: RHEL9}, volumes: [{type: gp3}]}\n", wantErr: "size is required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.spec), Defaults{Type: "t3.micro", Subnet: "subnet-1"})
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+
+	_, err := Parse([]byte("instances:\n  - {name: a, ami: {os: RHEL9}}\n"), Defaults{Type: "t3.micro"})
+	assert.ErrorContains(t, err, "subnet is required")
+}
@@ -0,0 +1,121 @@
+package sso
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// refreshWindow is how long before expiry a token is refreshed, so that a
+// command never starts with a token that expires part way through
+const refreshWindow = 5 * time.Minute
+
+// Token is an IAM Identity Center access token. It is cached in the same
+// format and location as the AWS CLI and SDK, so a login with either tool is
+// picked up by the other.
+type Token struct {
+	AccessToken           string     `json:"accessToken"`
+	ExpiresAt             time.Time  `json:"expiresAt"`
+	RefreshToken          string     `json:"refreshToken,omitempty"`
+	ClientID              string     `json:"clientId,omitempty"`
+	ClientSecret          string     `json:"clientSecret,omitempty"`
+	RegistrationExpiresAt *time.Time `json:"registrationExpiresAt,omitempty"`
+	Scopes                []string   `json:"scopes,omitempty"`
+	Region                string     `json:"region,omitempty"`
+	StartURL              string     `json:"startUrl,omitempty"`
+}
+
+// Valid reports whether the token can be used for at least refreshWindow
+func (t *Token) Valid(now time.Time) bool {
+	return t != nil && t.AccessToken != "" && now.Add(refreshWindow).Before(t.ExpiresAt)
+}
+
+// CanRefresh reports whether the token carries a refresh token and a client
+// registration that has not expired
+func (t *Token) CanRefresh(now time.Time) bool {
+	return t != nil && t.RefreshToken != "" && t.registrationValid(now)
+}
+
+func (t *Token) registrationValid(now time.Time) bool {
+	return t.ClientID != "" && t.ClientSecret != "" &&
+		t.RegistrationExpiresAt != nil && now.Before(*t.RegistrationExpiresAt)
+}
+
+// DefaultCacheDir returns ~/.aws/sso/cache
+func DefaultCacheDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to get home directory: %w", err)
+	}
+	return filepath.Join(home, ".aws", "sso", "cache"), nil
+}
+
+// cachePath returns the cache file for key, the start URL of a legacy SSO
+// profile, named by the hex SHA1 of the key like the AWS CLI does
+func cachePath(dir, key string) string {
+	sum := sha1.Sum([]byte(key))
+	return filepath.Join(dir, strings.ToLower(hex.EncodeToString(sum[:]))+".json")
+}
+
+// loadToken reads a cached token. A missing file returns nil and no error.
+func loadToken(path string) (*Token, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cached SSO token: %w", err)
+	}
+
+	var t Token
+	if err := json.Unmarshal(data, &t); err != nil {
+		return nil, fmt.Errorf("failed to parse cached SSO token %s: %w", path, err)
+	}
+	return &t, nil
+}
+
+// saveToken writes a token to the cache, readable only by the owner
+func saveToken(path string, t *Token) error {
+	// Other tools parse these timestamps without fractional seconds
+	t.ExpiresAt = t.ExpiresAt.UTC().Truncate(time.Second)
+	if t.RegistrationExpiresAt != nil {
+		expires := t.RegistrationExpiresAt.UTC().Truncate(time.Second)
+		t.RegistrationExpiresAt = &expires
+	}
+
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode SSO token: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create SSO cache directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".token-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary token file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write SSO token: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write SSO token: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return fmt.Errorf("failed to set SSO token permissions: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to save SSO token: %w", err)
+	}
+	return nil
+}
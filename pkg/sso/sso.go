@@ -0,0 +1,482 @@
+// Package sso signs in to AWS IAM Identity Center (SSO) with the OAuth device
+// authorization flow and uses the resulting token to list and assume the
+// accounts and roles assigned to the user.
+package sso
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sso"
+	ssotypes "github.com/aws/aws-sdk-go-v2/service/sso/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssooidc"
+	oidctypes "github.com/aws/aws-sdk-go-v2/service/ssooidc/types"
+	"github.com/taemon1337/ec-manager/pkg/logger"
+)
+
+const (
+	clientName = "ec-manager"
+	clientType = "public"
+
+	// scopeAccountAccess lets the token list and sign in to accounts. IAM
+	// Identity Center only issues refresh tokens to clients registered with
+	// scopes.
+	scopeAccountAccess = "sso:account:access"
+
+	grantTypeDeviceCode   = "urn:ietf:params:oauth:grant-type:device_code"
+	grantTypeRefreshToken = "refresh_token"
+
+	defaultPollInterval = 5 * time.Second
+	slowDownIncrement   = 5 * time.Second
+)
+
+// EnvEndpoint replaces the OIDC and portal endpoints, e.g. with a local
+// stand-in for testing
+const EnvEndpoint = "ECMAN_SSO_ENDPOINT"
+
+var (
+	// ErrLoginRequired is returned when there is no usable cached token
+	ErrLoginRequired = errors.New("SSO session expired or missing, run 'ec-manager sso login'")
+	// ErrAuthorizationExpired is returned when the user did not approve the
+	// device authorization in time
+	ErrAuthorizationExpired = errors.New("SSO device authorization expired before it was approved")
+)
+
+// OIDCAPI is the subset of the SSO OIDC client used for signing in
+type OIDCAPI interface {
+	RegisterClient(ctx context.Context, params *ssooidc.RegisterClientInput, optFns ...func(*ssooidc.Options)) (*ssooidc.RegisterClientOutput, error)
+	StartDeviceAuthorization(ctx context.Context, params *ssooidc.StartDeviceAuthorizationInput, optFns ...func(*ssooidc.Options)) (*ssooidc.StartDeviceAuthorizationOutput, error)
+	CreateToken(ctx context.Context, params *ssooidc.CreateTokenInput, optFns ...func(*ssooidc.Options)) (*ssooidc.CreateTokenOutput, error)
+}
+
+// PortalAPI is the subset of the SSO portal client used once signed in
+type PortalAPI interface {
+	sso.ListAccountsAPIClient
+	sso.ListAccountRolesAPIClient
+	GetRoleCredentials(ctx context.Context, params *sso.GetRoleCredentialsInput, optFns ...func(*sso.Options)) (*sso.GetRoleCredentialsOutput, error)
+	Logout(ctx context.Context, params *sso.LogoutInput, optFns ...func(*sso.Options)) (*sso.LogoutOutput, error)
+}
+
+// Client signs in to one IAM Identity Center start URL
+type Client struct {
+	startURL string
+	region   string
+	oidc     OIDCAPI
+	portal   PortalAPI
+	cacheDir string
+	out      io.Writer
+	now      func() time.Time
+	sleep    func(context.Context, time.Duration) error
+}
+
+// Option configures a Client
+type Option func(*options)
+
+type options struct {
+	endpoint   string
+	cacheDir   string
+	out        io.Writer
+	httpClient aws.HTTPClient
+}
+
+// WithEndpoint sends OIDC and portal requests to endpoint instead of the AWS
+// endpoints for the region
+func WithEndpoint(endpoint string) Option {
+	return func(o *options) {
+		o.endpoint = endpoint
+	}
+}
+
+// WithCacheDir stores tokens in dir instead of ~/.aws/sso/cache
+func WithCacheDir(dir string) Option {
+	return func(o *options) {
+		o.cacheDir = dir
+	}
+}
+
+// WithOutput sets where sign-in instructions are printed
+func WithOutput(w io.Writer) Option {
+	return func(o *options) {
+		o.out = w
+	}
+}
+
+// WithHTTPClient sets the HTTP client used for OIDC and portal requests
+func WithHTTPClient(client aws.HTTPClient) Option {
+	return func(o *options) {
+		o.httpClient = client
+	}
+}
+
+// NewClient creates a client for the start URL, whose OIDC and portal
+// endpoints live in region
+func NewClient(startURL, region string, opts ...Option) (*Client, error) {
+	if startURL == "" {
+		return nil, fmt.Errorf("SSO start URL is required")
+	}
+	if region == "" {
+		return nil, fmt.Errorf("SSO region is required")
+	}
+
+	o := options{
+		endpoint: os.Getenv(EnvEndpoint),
+		out:      os.Stderr,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.cacheDir == "" {
+		dir, err := DefaultCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		o.cacheDir = dir
+	}
+
+	var endpoint *string
+	if o.endpoint != "" {
+		endpoint = aws.String(o.endpoint)
+	}
+
+	return &Client{
+		startURL: startURL,
+		region:   region,
+		oidc: ssooidc.New(ssooidc.Options{
+			Region:       region,
+			BaseEndpoint: endpoint,
+			HTTPClient:   o.httpClient,
+		}),
+		portal: sso.New(sso.Options{
+			Region:       region,
+			BaseEndpoint: endpoint,
+			HTTPClient:   o.httpClient,
+		}),
+		cacheDir: o.cacheDir,
+		out:      o.out,
+		now:      time.Now,
+		sleep:    sleepContext,
+	}, nil
+}
+
+// CachePath returns the file the client's token is cached in
+func (c *Client) CachePath() string {
+	return cachePath(c.cacheDir, c.startURL)
+}
+
+// Login returns a valid token, refreshing the cached one when possible and
+// otherwise running the device authorization flow. With force set, the flow
+// always runs.
+func (c *Client) Login(ctx context.Context, force bool) (*Token, error) {
+	if !force {
+		t, err := c.Token(ctx)
+		if err == nil {
+			return t, nil
+		}
+		if !errors.Is(err, ErrLoginRequired) {
+			logger.Debug("cached SSO token unusable, signing in again", "error", err)
+		}
+	}
+
+	// A corrupt cache only costs the saved client registration
+	cached, err := loadToken(c.CachePath())
+	if err != nil {
+		logger.Debug("ignoring cached SSO token", "error", err)
+		cached = nil
+	}
+
+	t, err := c.authorizeDevice(ctx, cached)
+	if err != nil {
+		return nil, err
+	}
+	if err := saveToken(c.CachePath(), t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Token returns the cached token, refreshing it when it is about to expire.
+// It returns ErrLoginRequired when the user must sign in again.
+func (c *Client) Token(ctx context.Context) (*Token, error) {
+	t, err := loadToken(c.CachePath())
+	if err != nil {
+		return nil, err
+	}
+
+	now := c.now()
+	if t.Valid(now) {
+		return t, nil
+	}
+	if !t.CanRefresh(now) {
+		return nil, ErrLoginRequired
+	}
+
+	refreshed, err := c.refresh(ctx, t)
+	if err != nil {
+		logger.Debug("failed to refresh SSO token", "error", err)
+		return nil, ErrLoginRequired
+	}
+	if err := saveToken(c.CachePath(), refreshed); err != nil {
+		return nil, err
+	}
+	return refreshed, nil
+}
+
+// Logout signs out of the portal and removes the cached token
+func (c *Client) Logout(ctx context.Context) error {
+	t, err := loadToken(c.CachePath())
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return nil
+	}
+
+	if t.Valid(c.now()) {
+		if _, err := c.portal.Logout(ctx, &sso.LogoutInput{AccessToken: aws.String(t.AccessToken)}); err != nil {
+			logger.Debug("failed to sign out of SSO portal", "error", err)
+		}
+	}
+
+	if err := os.Remove(c.CachePath()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove cached SSO token: %w", err)
+	}
+	return nil
+}
+
+// register returns a client registration, reusing the one in cached while it
+// is still valid. Registrations without scopes never get refresh tokens, so
+// they are replaced.
+func (c *Client) register(ctx context.Context, cached *Token) (*Token, error) {
+	if cached != nil && len(cached.Scopes) > 0 && cached.registrationValid(c.now()) {
+		return &Token{
+			ClientID:              cached.ClientID,
+			ClientSecret:          cached.ClientSecret,
+			RegistrationExpiresAt: cached.RegistrationExpiresAt,
+			Scopes:                cached.Scopes,
+		}, nil
+	}
+
+	out, err := c.oidc.RegisterClient(ctx, &ssooidc.RegisterClientInput{
+		ClientName: aws.String(clientName),
+		ClientType: aws.String(clientType),
+		Scopes:     []string{scopeAccountAccess},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to register SSO client: %w", err)
+	}
+
+	expires := time.Unix(out.ClientSecretExpiresAt, 0)
+	return &Token{
+		ClientID:              aws.ToString(out.ClientId),
+		ClientSecret:          aws.ToString(out.ClientSecret),
+		RegistrationExpiresAt: &expires,
+		Scopes:                []string{scopeAccountAccess},
+	}, nil
+}
+
+// authorizeDevice runs the device authorization flow: the user approves the
+// request in a browser while the client polls for the token
+func (c *Client) authorizeDevice(ctx context.Context, cached *Token) (*Token, error) {
+	t, err := c.register(ctx, cached)
+	if err != nil {
+		return nil, err
+	}
+
+	auth, err := c.oidc.StartDeviceAuthorization(ctx, &ssooidc.StartDeviceAuthorizationInput{
+		ClientId:     aws.String(t.ClientID),
+		ClientSecret: aws.String(t.ClientSecret),
+		StartUrl:     aws.String(c.startURL),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start SSO device authorization: %w", err)
+	}
+
+	verifyURL := aws.ToString(auth.VerificationUriComplete)
+	if verifyURL == "" {
+		verifyURL = aws.ToString(auth.VerificationUri)
+	}
+	fmt.Fprintf(c.out, "To sign in, open the following URL in a browser:\n\n  %s\n\nand confirm the code %s\n\n",
+		verifyURL, aws.ToString(auth.UserCode))
+
+	interval := time.Duration(auth.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	deadline := c.now().Add(time.Duration(auth.ExpiresIn) * time.Second)
+
+	for {
+		out, err := c.oidc.CreateToken(ctx, &ssooidc.CreateTokenInput{
+			ClientId:     aws.String(t.ClientID),
+			ClientSecret: aws.String(t.ClientSecret),
+			DeviceCode:   auth.DeviceCode,
+			GrantType:    aws.String(grantTypeDeviceCode),
+		})
+		if err == nil {
+			return c.tokenFromOutput(out, t), nil
+		}
+
+		var pending *oidctypes.AuthorizationPendingException
+		var slowDown *oidctypes.SlowDownException
+		var expired *oidctypes.ExpiredTokenException
+		switch {
+		case errors.As(err, &pending):
+		case errors.As(err, &slowDown):
+			interval += slowDownIncrement
+		case errors.As(err, &expired):
+			return nil, ErrAuthorizationExpired
+		default:
+			return nil, fmt.Errorf("failed to create SSO token: %w", err)
+		}
+
+		if auth.ExpiresIn > 0 && c.now().Add(interval).After(deadline) {
+			return nil, ErrAuthorizationExpired
+		}
+		if err := c.sleep(ctx, interval); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// refresh exchanges the token's refresh token for a new access token
+func (c *Client) refresh(ctx context.Context, t *Token) (*Token, error) {
+	out, err := c.oidc.CreateToken(ctx, &ssooidc.CreateTokenInput{
+		ClientId:     aws.String(t.ClientID),
+		ClientSecret: aws.String(t.ClientSecret),
+		RefreshToken: aws.String(t.RefreshToken),
+		GrantType:    aws.String(grantTypeRefreshToken),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh SSO token: %w", err)
+	}
+
+	refreshed := c.tokenFromOutput(out, t)
+	if refreshed.RefreshToken == "" {
+		refreshed.RefreshToken = t.RefreshToken
+	}
+	return refreshed, nil
+}
+
+// tokenFromOutput builds a token from a CreateToken response and the client
+// registration it was issued to
+func (c *Client) tokenFromOutput(out *ssooidc.CreateTokenOutput, registration *Token) *Token {
+	return &Token{
+		AccessToken:           aws.ToString(out.AccessToken),
+		ExpiresAt:             c.now().Add(time.Duration(out.ExpiresIn) * time.Second),
+		RefreshToken:          aws.ToString(out.RefreshToken),
+		ClientID:              registration.ClientID,
+		ClientSecret:          registration.ClientSecret,
+		RegistrationExpiresAt: registration.RegistrationExpiresAt,
+		Scopes:                registration.Scopes,
+		Region:                c.region,
+		StartURL:              c.startURL,
+	}
+}
+
+// Account is an AWS account assigned to the signed-in user
+type Account struct {
+	ID    string
+	Name  string
+	Email string
+}
+
+// Accounts lists every account the signed-in user can access
+func (c *Client) Accounts(ctx context.Context) ([]Account, error) {
+	t, err := c.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var accounts []Account
+	paginator := sso.NewListAccountsPaginator(c.portal, &sso.ListAccountsInput{
+		AccessToken: aws.String(t.AccessToken),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list SSO accounts: %w", err)
+		}
+		for _, a := range page.AccountList {
+			accounts = append(accounts, accountFromInfo(a))
+		}
+	}
+	return accounts, nil
+}
+
+// AccountRoles lists the roles the signed-in user can assume in an account
+func (c *Client) AccountRoles(ctx context.Context, accountID string) ([]string, error) {
+	t, err := c.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var roles []string
+	paginator := sso.NewListAccountRolesPaginator(c.portal, &sso.ListAccountRolesInput{
+		AccessToken: aws.String(t.AccessToken),
+		AccountId:   aws.String(accountID),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list SSO roles for account %s: %w", accountID, err)
+		}
+		for _, r := range page.RoleList {
+			roles = append(roles, aws.ToString(r.RoleName))
+		}
+	}
+	return roles, nil
+}
+
+// RoleCredentials returns temporary credentials for a role in an account
+func (c *Client) RoleCredentials(ctx context.Context, accountID, roleName string) (aws.Credentials, error) {
+	t, err := c.Token(ctx)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+
+	out, err := c.portal.GetRoleCredentials(ctx, &sso.GetRoleCredentialsInput{
+		AccessToken: aws.String(t.AccessToken),
+		AccountId:   aws.String(accountID),
+		RoleName:    aws.String(roleName),
+	})
+	if err != nil {
+		return aws.Credentials{}, fmt.Errorf("failed to get SSO role credentials: %w", err)
+	}
+	if out.RoleCredentials == nil {
+		return aws.Credentials{}, fmt.Errorf("no credentials returned for role %s in account %s", roleName, accountID)
+	}
+
+	return aws.Credentials{
+		AccessKeyID:     aws.ToString(out.RoleCredentials.AccessKeyId),
+		SecretAccessKey: aws.ToString(out.RoleCredentials.SecretAccessKey),
+		SessionToken:    aws.ToString(out.RoleCredentials.SessionToken),
+		Source:          "ec-manager SSO",
+		CanExpire:       true,
+		Expires:         time.UnixMilli(out.RoleCredentials.Expiration),
+	}, nil
+}
+
+func accountFromInfo(a ssotypes.AccountInfo) Account {
+	return Account{
+		ID:    aws.ToString(a.AccountId),
+		Name:  aws.ToString(a.AccountName),
+		Email: aws.ToString(a.EmailAddress),
+	}
+}
+
+// sleepContext waits for d or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,270 @@
+package sso
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// standIn is a local stand-in for the SSO OIDC and portal endpoints
+type standIn struct {
+	mu            sync.Mutex
+	pending       int
+	registrations int
+	deviceGrants  int
+	refreshGrants int
+	scopes        []string
+}
+
+func (s *standIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	reply := func(status int, body interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(body)
+	}
+	fail := func(code string) {
+		w.Header().Set("X-Amzn-ErrorType", code)
+		reply(http.StatusBadRequest, map[string]string{"error": code})
+	}
+	authorized := func() bool {
+		if r.Header.Get("X-Amz-Sso_bearer_token") != "access-token" {
+			w.Header().Set("X-Amzn-ErrorType", "UnauthorizedException")
+			reply(http.StatusUnauthorized, map[string]string{"message": "bad token"})
+			return false
+		}
+		return true
+	}
+
+	switch r.URL.Path {
+	case "/client/register":
+		var in struct {
+			Scopes []string `json:"scopes"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&in)
+		s.registrations++
+		s.scopes = in.Scopes
+		reply(http.StatusOK, map[string]interface{}{
+			"clientId":              "client-id",
+			"clientSecret":          "client-secret",
+			"clientSecretExpiresAt": time.Now().Add(24 * time.Hour).Unix(),
+		})
+	case "/device_authorization":
+		reply(http.StatusOK, map[string]interface{}{
+			"deviceCode":              "device-code",
+			"userCode":                "ABCD-EFGH",
+			"verificationUri":         "https://device.sso.example/",
+			"verificationUriComplete": "https://device.sso.example/?user_code=ABCD-EFGH",
+			"expiresIn":               600,
+			"interval":                1,
+		})
+	case "/token":
+		var in map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&in)
+		switch in["grantType"] {
+		case grantTypeDeviceCode:
+			if s.pending > 0 {
+				s.pending--
+				fail("AuthorizationPendingException")
+				return
+			}
+			s.deviceGrants++
+			reply(http.StatusOK, map[string]interface{}{
+				"accessToken":  "access-token",
+				"expiresIn":    3600,
+				"refreshToken": "refresh-token",
+				"tokenType":    "Bearer",
+			})
+		case grantTypeRefreshToken:
+			if len(s.scopes) == 0 {
+				// Clients registered without scopes get no refresh tokens
+				fail("InvalidGrantException")
+				return
+			}
+			if in["refreshToken"] != "refresh-token" {
+				fail("InvalidGrantException")
+				return
+			}
+			s.refreshGrants++
+			reply(http.StatusOK, map[string]interface{}{
+				"accessToken": "access-token",
+				"expiresIn":   3600,
+				"tokenType":   "Bearer",
+			})
+		default:
+			fail("UnsupportedGrantTypeException")
+		}
+	case "/assignment/accounts":
+		if !authorized() {
+			return
+		}
+		if r.URL.Query().Get("next_token") == "" {
+			reply(http.StatusOK, map[string]interface{}{
+				"accountList": []map[string]string{{"accountId": "111111111111", "accountName": "dev"}},
+				"nextToken":   "page-2",
+			})
+			return
+		}
+		reply(http.StatusOK, map[string]interface{}{
+			"accountList": []map[string]string{{"accountId": "222222222222", "accountName": "prod"}},
+		})
+	case "/assignment/roles":
+		if !authorized() {
+			return
+		}
+		reply(http.StatusOK, map[string]interface{}{
+			"roleList": []map[string]string{
+				{"accountId": r.URL.Query().Get("account_id"), "roleName": "Admin"},
+				{"accountId": r.URL.Query().Get("account_id"), "roleName": "ReadOnly"},
+			},
+		})
+	case "/federation/credentials":
+		if !authorized() {
+			return
+		}
+		reply(http.StatusOK, map[string]interface{}{
+			"roleCredentials": map[string]interface{}{
+				"accessKeyId":     "ASIA" + r.URL.Query().Get("role_name"),
+				"secretAccessKey": "secret",
+				"sessionToken":    "session",
+				"expiration":      time.Now().Add(time.Hour).UnixMilli(),
+			},
+		})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newTestClient(t *testing.T, server *httptest.Server, out *bytes.Buffer) *Client {
+	t.Helper()
+	c, err := NewClient("https://corp.awsapps.com/start", "us-east-1",
+		WithEndpoint(server.URL),
+		WithCacheDir(t.TempDir()),
+		WithOutput(out))
+	require.NoError(t, err)
+	c.sleep = func(ctx context.Context, d time.Duration) error { return ctx.Err() }
+	return c
+}
+
+func TestLoginDeviceFlow(t *testing.T) {
+	stand := &standIn{pending: 2}
+	server := httptest.NewServer(stand)
+	defer server.Close()
+
+	var out bytes.Buffer
+	c := newTestClient(t, server, &out)
+
+	token, err := c.Login(context.Background(), false)
+	require.NoError(t, err)
+	assert.Equal(t, "access-token", token.AccessToken)
+	assert.Contains(t, out.String(), "ABCD-EFGH")
+	assert.Equal(t, 1, stand.deviceGrants)
+
+	info, err := os.Stat(c.CachePath())
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// A valid cached token is reused without signing in again
+	_, err = c.Login(context.Background(), false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stand.deviceGrants)
+	assert.Equal(t, 1, stand.registrations)
+
+	// Forcing a login reuses the client registration
+	token, err = c.Login(context.Background(), true)
+	require.NoError(t, err)
+	assert.Equal(t, 2, stand.deviceGrants)
+	assert.Equal(t, 1, stand.registrations)
+
+	// A registration without scopes cannot refresh tokens and is replaced
+	token.Scopes = nil
+	require.NoError(t, saveToken(c.CachePath(), token))
+	_, err = c.Login(context.Background(), true)
+	require.NoError(t, err)
+	assert.Equal(t, 2, stand.registrations)
+}
+
+func TestTokenRefresh(t *testing.T) {
+	stand := &standIn{}
+	server := httptest.NewServer(stand)
+	defer server.Close()
+
+	c := newTestClient(t, server, &bytes.Buffer{})
+	_, err := c.Login(context.Background(), false)
+	require.NoError(t, err)
+
+	// An hour later the token is about to expire and is refreshed
+	c.now = func() time.Time { return time.Now().Add(58 * time.Minute) }
+	token, err := c.Token(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, stand.refreshGrants)
+	assert.Equal(t, "refresh-token", token.RefreshToken)
+	assert.Equal(t, []string{"sso:account:access"}, stand.scopes)
+	assert.Equal(t, []string{"sso:account:access"}, token.Scopes)
+
+	// Without a refresh token the user has to sign in again
+	token.RefreshToken = ""
+	token.ExpiresAt = time.Now()
+	require.NoError(t, saveToken(c.CachePath(), token))
+	_, err = c.Token(context.Background())
+	assert.ErrorIs(t, err, ErrLoginRequired)
+}
+
+func TestAccountsAndRoles(t *testing.T) {
+	server := httptest.NewServer(&standIn{})
+	defer server.Close()
+
+	c := newTestClient(t, server, &bytes.Buffer{})
+
+	_, err := c.Accounts(context.Background())
+	assert.ErrorIs(t, err, ErrLoginRequired)
+
+	_, err = c.Login(context.Background(), false)
+	require.NoError(t, err)
+
+	accounts, err := c.Accounts(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []Account{
+		{ID: "111111111111", Name: "dev"},
+		{ID: "222222222222", Name: "prod"},
+	}, accounts)
+
+	roles, err := c.AccountRoles(context.Background(), "111111111111")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Admin", "ReadOnly"}, roles)
+
+	creds, err := c.RoleCredentials(context.Background(), "111111111111", "Admin")
+	require.NoError(t, err)
+	assert.Equal(t, "ASIAAdmin", creds.AccessKeyID)
+	assert.True(t, creds.CanExpire)
+}
+
+func TestLoginAuthorizationExpired(t *testing.T) {
+	stand := &standIn{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			w.Header().Set("X-Amzn-ErrorType", "ExpiredTokenException")
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"expired_token"}`)
+			return
+		}
+		stand.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, &bytes.Buffer{})
+	_, err := c.Login(context.Background(), false)
+	assert.ErrorIs(t, err, ErrAuthorizationExpired)
+}
@@ -0,0 +1,478 @@
+// Package trust evaluates IAM role trust policies to decide whether a caller
+// can assume a role, and explains the decision.
+package trust
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Decision is the outcome of evaluating a trust policy for a caller
+type Decision string
+
+const (
+	// Allowed means the caller is trusted without further requirements
+	Allowed Decision = "assumable"
+	// RequiresMFA means the caller is trusted when it presents an MFA code
+	RequiresMFA Decision = "requires-mfa"
+	// Conditional means the caller is trusted subject to conditions that
+	// cannot be checked from the caller identity, such as an external ID
+	Conditional Decision = "conditional"
+	// Denied means the trust policy does not allow the caller
+	Denied Decision = "not-assumable"
+)
+
+// Caller is the identity role assumption is evaluated for, as returned by
+// STS GetCallerIdentity
+type Caller struct {
+	Account string
+	ARN     string
+	UserID  string
+}
+
+// PrincipalARN returns the IAM ARN trust policies refer to. Assumed-role
+// session ARNs are mapped back to their role, without its path.
+func (c Caller) PrincipalARN() string {
+	// arn:aws:sts::123456789012:assumed-role/name/session
+	parts := strings.SplitN(c.ARN, ":", 6)
+	if len(parts) == 6 && parts[2] == "sts" && strings.HasPrefix(parts[5], "assumed-role/") {
+		resource := strings.Split(parts[5], "/")
+		return fmt.Sprintf("arn:%s:iam::%s:role/%s", parts[1], parts[4], resource[1])
+	}
+	return c.ARN
+}
+
+// partition returns the partition of the caller's ARN, such as aws-cn
+func (c Caller) partition() string {
+	parts := strings.SplitN(c.ARN, ":", 3)
+	if len(parts) == 3 && parts[0] == "arn" && parts[1] != "" {
+		return parts[1]
+	}
+	return "aws"
+}
+
+// Result explains the decision for one role
+type Result struct {
+	Decision Decision
+	Reasons  []string
+}
+
+// Policy is a parsed trust policy document
+type Policy struct {
+	Version   string     `json:"Version"`
+	Statement Statements `json:"Statement"`
+}
+
+// Statements is a policy's statement list, which may be a single object
+type Statements []Statement
+
+// UnmarshalJSON accepts both a statement and a list of statements
+func (s *Statements) UnmarshalJSON(data []byte) error {
+	var list []Statement
+	if err := json.Unmarshal(data, &list); err == nil {
+		*s = list
+		return nil
+	}
+
+	var st Statement
+	if err := json.Unmarshal(data, &st); err != nil {
+		return err
+	}
+	*s = Statements{st}
+	return nil
+}
+
+// Statement is a single trust policy statement
+type Statement struct {
+	Sid          string                           `json:"Sid"`
+	Effect       string                           `json:"Effect"`
+	Principal    Principal                        `json:"Principal"`
+	NotPrincipal *Principal                       `json:"NotPrincipal"`
+	Action       StringList                       `json:"Action"`
+	NotAction    StringList                       `json:"NotAction"`
+	Condition    map[string]map[string]StringList `json:"Condition"`
+}
+
+// Principal lists principals by type, e.g. "AWS" or "Service". The wildcard
+// principal "*" is stored under the "*" key.
+type Principal map[string]StringList
+
+// UnmarshalJSON accepts both "*" and an object of principal types
+func (p *Principal) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*p = Principal{"*": {s}}
+		return nil
+	}
+
+	var m map[string]StringList
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("invalid principal: %w", err)
+	}
+	*p = m
+	return nil
+}
+
+// StringList is a policy value that may be a single string or a list. Bools
+// and numbers, which appear in conditions, are kept as strings.
+type StringList []string
+
+// UnmarshalJSON accepts a string, number, bool or a list of them
+func (l *StringList) UnmarshalJSON(data []byte) error {
+	var values []interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		var v interface{}
+		if err := json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+		values = []interface{}{v}
+	}
+
+	*l = make(StringList, 0, len(values))
+	for _, v := range values {
+		switch v := v.(type) {
+		case string:
+			*l = append(*l, v)
+		case bool:
+			*l = append(*l, strconv.FormatBool(v))
+		case float64:
+			*l = append(*l, strconv.FormatFloat(v, 'f', -1, 64))
+		default:
+			return fmt.Errorf("unsupported policy value %v", v)
+		}
+	}
+	return nil
+}
+
+// ParsePolicy parses a trust policy document. IAM returns documents URL
+// encoded, so encoded documents are decoded first.
+func ParsePolicy(document string) (*Policy, error) {
+	if !strings.HasPrefix(strings.TrimSpace(document), "{") {
+		decoded, err := url.QueryUnescape(document)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode trust policy: %w", err)
+		}
+		document = decoded
+	}
+
+	var p Policy
+	if err := json.Unmarshal([]byte(document), &p); err != nil {
+		return nil, fmt.Errorf("failed to parse trust policy: %w", err)
+	}
+	return &p, nil
+}
+
+// Evaluate decides whether caller can assume a role with the trust policy.
+// An explicit deny wins over any allow; among allows, the least restrictive
+// decision is reported. A deny the caller can avoid, such as one for
+// sessions without MFA, limits that decision instead.
+func Evaluate(p *Policy, caller Caller) Result {
+	var allows []Result
+	var reasons []string
+	limit, limitReasons := Allowed, []string(nil)
+
+	for i, st := range p.Statement {
+		name := st.Sid
+		if name == "" {
+			name = fmt.Sprintf("statement %d", i+1)
+		}
+
+		if !matchesAction(st) {
+			continue
+		}
+		if st.NotPrincipal != nil {
+			reasons = append(reasons, fmt.Sprintf("%s: NotPrincipal is not evaluated", name))
+			continue
+		}
+
+		matched, why := matchPrincipal(st.Principal, caller)
+		if !matched {
+			if strings.EqualFold(st.Effect, "Allow") {
+				reasons = append(reasons, fmt.Sprintf("%s: %s", name, why))
+			}
+			continue
+		}
+
+		if strings.EqualFold(st.Effect, "Deny") {
+			avoid := evaluateDenyConditions(st.Condition, caller)
+			switch avoid.Decision {
+			case Denied:
+				return Result{
+					Decision: Denied,
+					Reasons:  []string{fmt.Sprintf("%s: explicitly denies %s", name, why)},
+				}
+			case Allowed:
+				continue
+			}
+			if rank(avoid.Decision) < rank(limit) {
+				limit = avoid.Decision
+			}
+			limitReasons = append(limitReasons, prefix(name, avoid.Reasons)...)
+			continue
+		}
+
+		cond := evaluateConditions(st.Condition, caller)
+		r := Result{Decision: cond.Decision, Reasons: []string{fmt.Sprintf("%s: trusts %s", name, why)}}
+		r.Reasons = append(r.Reasons, prefix(name, cond.Reasons)...)
+		allows = append(allows, r)
+	}
+
+	best := Result{Decision: Denied}
+	for _, r := range allows {
+		if rank(r.Decision) > rank(best.Decision) {
+			best = r
+		}
+	}
+	if best.Decision == Denied {
+		if len(allows) > 0 {
+			for _, r := range allows {
+				reasons = append(reasons, r.Reasons...)
+			}
+		}
+		if len(reasons) == 0 {
+			reasons = []string{"no statement allows sts:AssumeRole"}
+		}
+		best.Reasons = reasons
+		return best
+	}
+	if rank(limit) < rank(best.Decision) {
+		best.Decision = limit
+	}
+	best.Reasons = append(append([]string(nil), best.Reasons...), limitReasons...)
+	return best
+}
+
+// rank orders decisions from least to most permissive
+func rank(d Decision) int {
+	switch d {
+	case Allowed:
+		return 3
+	case RequiresMFA:
+		return 2
+	case Conditional:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func prefix(name string, reasons []string) []string {
+	out := make([]string, len(reasons))
+	for i, r := range reasons {
+		out[i] = name + ": " + r
+	}
+	return out
+}
+
+// matchesAction reports whether the statement covers sts:AssumeRole
+func matchesAction(st Statement) bool {
+	if len(st.NotAction) > 0 {
+		for _, a := range st.NotAction {
+			if wildcardMatch(strings.ToLower(a), "sts:assumerole") {
+				return false
+			}
+		}
+		return true
+	}
+	for _, a := range st.Action {
+		if wildcardMatch(strings.ToLower(a), "sts:assumerole") {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPrincipal reports whether the principal covers the caller, and
+// describes what matched or why nothing did
+func matchPrincipal(p Principal, caller Caller) (bool, string) {
+	if values, ok := p["*"]; ok && contains(values, "*") {
+		return true, "any principal"
+	}
+
+	principalARN := caller.PrincipalARN()
+	for _, v := range p["AWS"] {
+		switch {
+		case v == "*":
+			return true, "any AWS principal"
+		case v == caller.Account || v == fmt.Sprintf("arn:%s:iam::%s:root", caller.partition(), caller.Account):
+			return true, fmt.Sprintf("account %s (the caller also needs sts:AssumeRole in its own policies)", caller.Account)
+		case strings.EqualFold(v, principalARN) || sameRole(v, principalARN):
+			return true, v
+		}
+	}
+
+	if len(p["AWS"]) == 0 {
+		types := make([]string, 0, len(p))
+		for t := range p {
+			types = append(types, t)
+		}
+		return false, fmt.Sprintf("only trusts %s principals", strings.Join(types, ", "))
+	}
+	return false, fmt.Sprintf("does not trust %s", principalARN)
+}
+
+// sameRole matches a role ARN with a path against the path-less role ARN
+// derived from an assumed-role session
+func sameRole(trusted, caller string) bool {
+	if !strings.Contains(caller, ":role/") || !strings.Contains(trusted, ":role/") {
+		return false
+	}
+	trustedAccount := strings.SplitN(trusted, ":role/", 2)[0]
+	callerAccount := strings.SplitN(caller, ":role/", 2)[0]
+	return trustedAccount == callerAccount && path.Base(trusted) == path.Base(caller)
+}
+
+// conditionResult is the outcome of evaluating a statement's conditions
+type conditionResult struct {
+	Decision Decision
+	Reasons  []string
+}
+
+// evaluateConditions checks the conditions that can be decided from the
+// caller identity and reports the rest as requirements
+func evaluateConditions(conditions map[string]map[string]StringList, caller Caller) conditionResult {
+	result := conditionResult{Decision: Allowed}
+	downgrade := func(d Decision, reason string) {
+		if rank(d) < rank(result.Decision) {
+			result.Decision = d
+		}
+		result.Reasons = append(result.Reasons, reason)
+	}
+
+	for operator, keys := range conditions {
+		op := strings.TrimSuffix(strings.TrimPrefix(operator, "ForAnyValue:"), "IfExists")
+		op = strings.TrimPrefix(op, "ForAllValues:")
+
+		for key, values := range keys {
+			switch strings.ToLower(key) {
+			case "aws:multifactorauthpresent":
+				if op == "Bool" && contains(values, "true") {
+					downgrade(RequiresMFA, "requires MFA")
+				} else if op == "Null" && contains(values, "false") {
+					downgrade(RequiresMFA, "requires MFA")
+				}
+			case "aws:multifactorauthage":
+				downgrade(RequiresMFA, fmt.Sprintf("requires MFA used within %s seconds", strings.Join(values, ", ")))
+			case "sts:externalid":
+				downgrade(Conditional, "requires an external ID")
+			case "aws:principalaccount":
+				if !matchCondition(op, values, caller.Account) {
+					downgrade(Denied, fmt.Sprintf("aws:PrincipalAccount must be %s", strings.Join(values, ", ")))
+				}
+			case "aws:principalarn":
+				if !matchCondition(op, values, caller.PrincipalARN()) {
+					downgrade(Denied, fmt.Sprintf("aws:PrincipalArn must match %s", strings.Join(values, ", ")))
+				}
+			case "aws:userid":
+				if !matchCondition(op, values, caller.UserID) {
+					downgrade(Denied, fmt.Sprintf("aws:userid must match %s", strings.Join(values, ", ")))
+				}
+			default:
+				downgrade(Conditional, fmt.Sprintf("condition %s on %s is not evaluated", operator, key))
+			}
+		}
+	}
+	return result
+}
+
+// evaluateDenyConditions decides whether a deny statement's conditions apply
+// to the caller, reporting what the caller must do to avoid the deny: Allowed
+// when a condition rules it out, Denied when they all hold, and otherwise the
+// least the caller can do to rule one out
+func evaluateDenyConditions(conditions map[string]map[string]StringList, caller Caller) conditionResult {
+	result := conditionResult{Decision: Denied}
+	avoid := func(d Decision, reason string) {
+		if rank(d) > rank(result.Decision) {
+			result.Decision = d
+		}
+		result.Reasons = append(result.Reasons, reason)
+	}
+
+	for operator, keys := range conditions {
+		op := strings.TrimSuffix(strings.TrimPrefix(operator, "ForAnyValue:"), "IfExists")
+		op = strings.TrimPrefix(op, "ForAllValues:")
+
+		for key, values := range keys {
+			switch strings.ToLower(key) {
+			case "aws:multifactorauthpresent":
+				if (op == "Bool" && contains(values, "false")) || (op == "Null" && contains(values, "true")) {
+					avoid(RequiresMFA, "denies sessions without MFA")
+				} else {
+					avoid(Conditional, "denies sessions with MFA")
+				}
+			case "aws:multifactorauthage":
+				avoid(RequiresMFA, fmt.Sprintf("denies depending on MFA age %s", strings.Join(values, ", ")))
+			case "aws:principalaccount":
+				if !matchCondition(op, values, caller.Account) {
+					return conditionResult{Decision: Allowed}
+				}
+			case "aws:principalarn":
+				if !matchCondition(op, values, caller.PrincipalARN()) {
+					return conditionResult{Decision: Allowed}
+				}
+			case "aws:userid":
+				if !matchCondition(op, values, caller.UserID) {
+					return conditionResult{Decision: Allowed}
+				}
+			default:
+				avoid(Conditional, fmt.Sprintf("may deny: condition %s on %s is not evaluated", operator, key))
+			}
+		}
+	}
+	return result
+}
+
+// matchCondition applies a string or ARN condition operator
+func matchCondition(op string, values []string, actual string) bool {
+	negate := strings.Contains(op, "Not")
+	matched := false
+	for _, v := range values {
+		switch op {
+		case "StringEquals", "StringNotEquals", "ArnEquals", "ArnNotEquals":
+			matched = matched || v == actual
+		case "StringEqualsIgnoreCase", "StringNotEqualsIgnoreCase":
+			matched = matched || strings.EqualFold(v, actual)
+		default:
+			// StringLike, ArnLike and their negations
+			matched = matched || wildcardMatch(v, actual)
+		}
+	}
+	if negate {
+		return !matched
+	}
+	return matched
+}
+
+// wildcardMatch matches s against a pattern where * matches any sequence
+// and ? matches one character
+func wildcardMatch(pattern, s string) bool {
+	if pattern == "" {
+		return s == ""
+	}
+	switch pattern[0] {
+	case '*':
+		for i := 0; i <= len(s); i++ {
+			if wildcardMatch(pattern[1:], s[i:]) {
+				return true
+			}
+		}
+		return false
+	case '?':
+		return s != "" && wildcardMatch(pattern[1:], s[1:])
+	default:
+		return s != "" && pattern[0] == s[0] && wildcardMatch(pattern[1:], s[1:])
+	}
+}
+
+func contains(values []string, want string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, want) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,207 @@
+package trust
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var user = Caller{
+	Account: "123456789012",
+	ARN:     "arn:aws:iam::123456789012:user/alice",
+	UserID:  "AIDAEXAMPLE",
+}
+
+func TestParsePolicy(t *testing.T) {
+	doc := `{"Version":"2012-10-17","Statement":{"Effect":"Allow","Principal":"*","Action":"sts:AssumeRole","Condition":{"Bool":{"aws:MultiFactorAuthPresent":true}}}}`
+
+	for name, input := range map[string]string{
+		"plain":       doc,
+		"url encoded": url.QueryEscape(doc),
+	} {
+		t.Run(name, func(t *testing.T) {
+			p, err := ParsePolicy(input)
+			require.NoError(t, err)
+			require.Len(t, p.Statement, 1)
+			assert.Equal(t, StringList{"*"}, p.Statement[0].Principal["*"])
+			assert.Equal(t, StringList{"sts:AssumeRole"}, p.Statement[0].Action)
+			assert.Equal(t, StringList{"true"}, p.Statement[0].Condition["Bool"]["aws:MultiFactorAuthPresent"])
+		})
+	}
+
+	_, err := ParsePolicy("not json")
+	assert.Error(t, err)
+}
+
+func TestPrincipalARN(t *testing.T) {
+	assert.Equal(t, user.ARN, user.PrincipalARN())
+
+	assumed := Caller{ARN: "arn:aws:sts::123456789012:assumed-role/admin/session"}
+	assert.Equal(t, "arn:aws:iam::123456789012:role/admin", assumed.PrincipalARN())
+}
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name     string
+		caller   Caller
+		policy   string
+		expected Decision
+		reason   string
+	}{
+		{
+			name:     "account root",
+			policy:   `{"Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::123456789012:root"},"Action":"sts:AssumeRole"}]}`,
+			expected: Allowed,
+			reason:   "account 123456789012",
+		},
+		{
+			name:     "account id",
+			policy:   `{"Statement":[{"Effect":"Allow","Principal":{"AWS":["111111111111","123456789012"]},"Action":["sts:TagSession","sts:AssumeRole"]}]}`,
+			expected: Allowed,
+		},
+		{
+			name:     "other account",
+			policy:   `{"Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::111111111111:root"},"Action":"sts:AssumeRole"}]}`,
+			expected: Denied,
+			reason:   "does not trust arn:aws:iam::123456789012:user/alice",
+		},
+		{
+			name:     "user arn",
+			policy:   `{"Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::123456789012:user/alice"},"Action":"sts:*"}]}`,
+			expected: Allowed,
+		},
+		{
+			name:     "other user",
+			policy:   `{"Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::123456789012:user/bob"},"Action":"sts:AssumeRole"}]}`,
+			expected: Denied,
+		},
+		{
+			name:     "assumed role session",
+			caller:   Caller{Account: "123456789012", ARN: "arn:aws:sts::123456789012:assumed-role/admin/me"},
+			policy:   `{"Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::123456789012:role/ops/admin"},"Action":"sts:AssumeRole"}]}`,
+			expected: Allowed,
+		},
+		{
+			name:     "service principal",
+			policy:   `{"Statement":[{"Effect":"Allow","Principal":{"Service":"ec2.amazonaws.com"},"Action":"sts:AssumeRole"}]}`,
+			expected: Denied,
+			reason:   "only trusts Service principals",
+		},
+		{
+			name:     "web identity only",
+			policy:   `{"Statement":[{"Effect":"Allow","Principal":{"Federated":"cognito-identity.amazonaws.com"},"Action":"sts:AssumeRoleWithWebIdentity"}]}`,
+			expected: Denied,
+			reason:   "no statement allows sts:AssumeRole",
+		},
+		{
+			name:     "mfa required",
+			policy:   `{"Statement":[{"Effect":"Allow","Principal":{"AWS":"123456789012"},"Action":"sts:AssumeRole","Condition":{"Bool":{"aws:MultiFactorAuthPresent":"true"}}}]}`,
+			expected: RequiresMFA,
+			reason:   "requires MFA",
+		},
+		{
+			name:     "external id",
+			policy:   `{"Statement":[{"Effect":"Allow","Principal":{"AWS":"*"},"Action":"sts:AssumeRole","Condition":{"StringEquals":{"sts:ExternalId":"secret"}}}]}`,
+			expected: Conditional,
+			reason:   "requires an external ID",
+		},
+		{
+			name:     "principal arn like",
+			policy:   `{"Statement":[{"Effect":"Allow","Principal":{"AWS":"*"},"Action":"sts:AssumeRole","Condition":{"ArnLike":{"aws:PrincipalArn":"arn:aws:iam::123456789012:user/a*"}}}]}`,
+			expected: Allowed,
+		},
+		{
+			name:     "principal arn mismatch",
+			policy:   `{"Statement":[{"Effect":"Allow","Principal":{"AWS":"*"},"Action":"sts:AssumeRole","Condition":{"StringEquals":{"aws:PrincipalArn":"arn:aws:iam::123456789012:user/bob"}}}]}`,
+			expected: Denied,
+			reason:   "aws:PrincipalArn must match",
+		},
+		{
+			name:     "principal account mismatch",
+			policy:   `{"Statement":[{"Effect":"Allow","Principal":{"AWS":"*"},"Action":"sts:AssumeRole","Condition":{"StringEquals":{"aws:PrincipalAccount":"111111111111"}}}]}`,
+			expected: Denied,
+			reason:   "aws:PrincipalAccount must be 111111111111",
+		},
+		{
+			name:     "unknown condition",
+			policy:   `{"Statement":[{"Effect":"Allow","Principal":{"AWS":"*"},"Action":"sts:AssumeRole","Condition":{"StringEquals":{"aws:PrincipalOrgID":"o-123"}}}]}`,
+			expected: Conditional,
+			reason:   "aws:PrincipalOrgID is not evaluated",
+		},
+		{
+			name: "explicit deny",
+			policy: `{"Statement":[
+				{"Effect":"Allow","Principal":{"AWS":"123456789012"},"Action":"sts:AssumeRole"},
+				{"Sid":"NoAlice","Effect":"Deny","Principal":{"AWS":"arn:aws:iam::123456789012:user/alice"},"Action":"sts:AssumeRole"}]}`,
+			expected: Denied,
+			reason:   "NoAlice: explicitly denies",
+		},
+		{
+			name: "deny without mfa",
+			policy: `{"Statement":[
+				{"Effect":"Allow","Principal":{"AWS":"123456789012"},"Action":"sts:AssumeRole"},
+				{"Sid":"NoMFA","Effect":"Deny","Principal":{"AWS":"*"},"Action":"sts:AssumeRole","Condition":{"BoolIfExists":{"aws:MultiFactorAuthPresent":"false"}}}]}`,
+			expected: RequiresMFA,
+			reason:   "NoMFA: denies sessions without MFA",
+		},
+		{
+			name: "deny ruled out by principal condition",
+			policy: `{"Statement":[
+				{"Effect":"Allow","Principal":{"AWS":"123456789012"},"Action":"sts:AssumeRole"},
+				{"Effect":"Deny","Principal":{"AWS":"*"},"Action":"sts:AssumeRole","Condition":{"StringEquals":{"aws:PrincipalArn":"arn:aws:iam::123456789012:user/bob"}}}]}`,
+			expected: Allowed,
+		},
+		{
+			name: "deny on an unknown condition",
+			policy: `{"Statement":[
+				{"Effect":"Allow","Principal":{"AWS":"123456789012"},"Action":"sts:AssumeRole"},
+				{"Effect":"Deny","Principal":{"AWS":"*"},"Action":"sts:AssumeRole","Condition":{"StringNotEquals":{"aws:PrincipalOrgID":"o-123"}}}]}`,
+			expected: Conditional,
+			reason:   "may deny: condition StringNotEquals on aws:PrincipalOrgID is not evaluated",
+		},
+		{
+			name:     "other partition",
+			caller:   Caller{Account: "123456789012", ARN: "arn:aws-cn:iam::123456789012:user/alice"},
+			policy:   `{"Statement":[{"Effect":"Allow","Principal":{"AWS":"arn:aws-cn:iam::123456789012:root"},"Action":"sts:AssumeRole"}]}`,
+			expected: Allowed,
+			reason:   "account 123456789012",
+		},
+		{
+			name: "least restrictive allow wins",
+			policy: `{"Statement":[
+				{"Effect":"Allow","Principal":{"AWS":"123456789012"},"Action":"sts:AssumeRole","Condition":{"Bool":{"aws:MultiFactorAuthPresent":"true"}}},
+				{"Effect":"Allow","Principal":{"AWS":"arn:aws:iam::123456789012:user/alice"},"Action":"sts:AssumeRole"}]}`,
+			expected: Allowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caller := tt.caller
+			if caller.ARN == "" {
+				caller = user
+			}
+
+			p, err := ParsePolicy(tt.policy)
+			require.NoError(t, err)
+
+			result := Evaluate(p, caller)
+			assert.Equal(t, tt.expected, result.Decision, result.Reasons)
+			assert.NotEmpty(t, result.Reasons)
+			if tt.reason != "" {
+				assert.Contains(t, strings.Join(result.Reasons, "\n"), tt.reason)
+			}
+		})
+	}
+}
+
+func TestWildcardMatch(t *testing.T) {
+	assert.True(t, wildcardMatch("sts:*", "sts:assumerole"))
+	assert.True(t, wildcardMatch("*", ""))
+	assert.True(t, wildcardMatch("a?c", "abc"))
+	assert.False(t, wildcardMatch("a?c", "ac"))
+	assert.False(t, wildcardMatch("sts:assumerolewith*", "sts:assumerole"))
+}